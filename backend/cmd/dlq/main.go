@@ -0,0 +1,271 @@
+// Command dlq inspects and recovers messages in the image processing
+// dead-letter queue.
+//
+//	dlq list [-limit N]
+//	dlq show -id MESSAGE_ID
+//	dlq replay (-id MESSAGE_ID[,MESSAGE_ID...] | -all)
+//	dlq purge -yes
+//	dlq export [-out FILE] [-limit N]
+//
+// Connection settings are read from the RABBITMQ_* environment variables.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
+
+const usage = `Usage: dlq <command> [flags]
+
+Commands:
+  list     List dead letters with their failure reason and x-death history
+  show     Print one dead letter as JSON
+  replay   Publish dead letters back to the processing queue
+  purge    Delete every dead letter
+  export   Write dead letters as JSONL
+`
+
+const maxReasonWidth = 80
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	err := run(ctx, os.Args[1], os.Args[2:])
+	stop()
+	if err != nil {
+		log.Printf("dlq %s: %v", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	var (
+		limit = flags.Int("limit", 0, "Maximum number of messages to read (0 = all)")
+		ids   = flags.String("id", "", "Comma-separated message IDs")
+		all   = flags.Bool("all", false, "Replay every message")
+		yes   = flags.Bool("yes", false, "Confirm purge")
+		out   = flags.String("out", "", "Output file (default stdout)")
+	)
+
+	switch command {
+	case "list", "show", "replay", "purge", "export":
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg.RabbitMQ); err != nil {
+		return fmt.Errorf("failed to load rabbitmq configuration: %w", err)
+	}
+	if err := cleanenv.ReadEnv(&cfg.Queue); err != nil {
+		return fmt.Errorf("failed to load queue configuration: %w", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	q, err := queue.NewRabbitMQQueueWithLogger(&cfg.RabbitMQ, &cfg.Queue.Consumer, logger)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := q.Close(); closeErr != nil {
+			log.Printf("Failed to close RabbitMQ connection: %v", closeErr)
+		}
+	}()
+
+	switch command {
+	case "list":
+		return list(ctx, q, *limit)
+	case "show":
+		return show(ctx, q, *ids)
+	case "replay":
+		return replay(ctx, q, *ids, *all)
+	case "purge":
+		return purge(ctx, q, *yes)
+	default:
+		return export(ctx, q, *out, *limit)
+	}
+}
+
+func list(ctx context.Context, q *queue.RabbitMQQueue, limit int) error {
+	letters, err := q.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd // column padding
+	fmt.Fprintln(w, "MESSAGE ID\tTASK ID\tREPLAYS\tDEATHS\tREASON")
+	for _, letter := range letters {
+		taskID := "-"
+		if letter.Message != nil {
+			taskID = letter.Message.TaskID.String()
+		}
+
+		deaths := make([]string, 0, len(letter.Deaths))
+		for _, death := range letter.Deaths {
+			deaths = append(deaths, fmt.Sprintf("%s:%s x%d", death.Queue, death.Reason, death.Count))
+		}
+
+		reason := letter.Reason
+		if letter.DecodeError != "" && reason == "" {
+			reason = letter.DecodeError
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			orDash(letter.MessageID),
+			taskID,
+			letter.ReplayCount,
+			orDash(strings.Join(deaths, ", ")),
+			orDash(truncate(reason, maxReasonWidth)))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d message(s)\n", len(letters))
+	return nil
+}
+
+func show(ctx context.Context, q *queue.RabbitMQQueue, id string) error {
+	if id == "" {
+		return errors.New("-id is required")
+	}
+
+	letters, err := q.ListDeadLetters(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(letters, func(letter queue.DeadLetterMessage) bool {
+		return letter.MessageID == id
+	})
+	if index < 0 {
+		return fmt.Errorf("message %s not found in %s", id, queue.DLQName)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(letters[index])
+}
+
+func replay(ctx context.Context, q *queue.RabbitMQQueue, ids string, all bool) error {
+	wanted := splitIDs(ids)
+	if all == (len(wanted) > 0) {
+		return errors.New("exactly one of -id or -all is required")
+	}
+
+	replayed, err := q.ReplayDeadLetters(ctx, func(letter *queue.DeadLetterMessage) bool {
+		return all || slices.Contains(wanted, letter.MessageID)
+	})
+	fmt.Fprintf(os.Stderr, "%d message(s) replayed to %s\n", replayed, queue.ExchangeName)
+	if err != nil {
+		return err
+	}
+
+	if !all && replayed < len(wanted) {
+		return fmt.Errorf("%d of %d message(s) not found", len(wanted)-replayed, len(wanted))
+	}
+	return nil
+}
+
+func purge(ctx context.Context, q *queue.RabbitMQQueue, yes bool) error {
+	if !yes {
+		return errors.New("purge deletes every dead letter, pass -yes to confirm")
+	}
+
+	count, err := q.PurgeDeadLetters(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%d message(s) purged from %s\n", count, queue.DLQName)
+	return nil
+}
+
+func export(ctx context.Context, q *queue.RabbitMQQueue, out string, limit int) (err error) {
+	letters, err := q.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "" {
+		file, createErr := os.Create(out)
+		if createErr != nil {
+			return fmt.Errorf("failed to create %s: %w", out, createErr)
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+		w = file
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, letter := range letters {
+		if err = encoder.Encode(letter); err != nil {
+			return fmt.Errorf("failed to write message %s: %w", letter.MessageID, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d message(s) exported\n", len(letters))
+	return nil
+}
+
+func splitIDs(ids string) []string {
+	var result []string
+	for id := range strings.SplitSeq(ids, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// truncate shortens s to at most width characters, cutting between runes so
+// that multi-byte characters aren't split.
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-len("...")]) + "..."
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+// Command reencrypt rewrites stored objects with the server-side encryption
+// configured by the S3_SSE* environment variables. Run it after turning
+// encryption on, changing it or rotating the SSE-C master key: move the old
+// key to S3_SSE_PREVIOUS_MASTER_KEYS, set the new S3_SSE_MASTER_KEY,
+// run reencrypt until it reports no failures, then drop the old key.
+//
+//	reencrypt [-bucket BUCKET] [-prefix PREFIX]
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/service"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+)
+
+func main() {
+	var (
+		bucket = flag.String("bucket", "", "Only re-encrypt this bucket (default: uploads, processed and bottles)")
+		prefix = flag.String("prefix", "", "Only re-encrypt objects whose name starts with this prefix")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	failed, err := run(ctx, *bucket, *prefix)
+	stop()
+	if err != nil {
+		log.Printf("reencrypt: %v", err)
+		os.Exit(1)
+	}
+	if failed > 0 {
+		log.Printf("reencrypt: %d object(s) failed, run again before dropping previous master keys", failed)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, bucket, prefix string) (int, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	base, err := storage.NewS3Storage(&cfg.S3)
+	if err != nil {
+		return 0, err
+	}
+	// No read cache: it would be emptied under a running server or worker
+	// sharing its directory, and re-encryption reads nothing twice.
+	store := storage.NewRetryingStorage(base, &cfg.Storage, logger)
+	reencryption := service.NewReencryptionService(store, cfg, logger)
+
+	buckets := reencryption.Buckets()
+	if bucket != "" {
+		buckets = []string{bucket}
+	}
+
+	report, err := reencryption.Reencrypt(ctx, buckets, prefix)
+	if err != nil {
+		return 0, err
+	}
+	return report.Failed, nil
+}
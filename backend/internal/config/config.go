@@ -27,35 +27,270 @@ type RabbitMQConfig struct {
 	User     string `env:"RABBITMQ_USER" env-default:"beermania_user" validate:"required"`
 	Password string `env:"RABBITMQ_PASSWORD" env-default:"beermania_password" validate:"required"`
 	VHost    string `env:"RABBITMQ_VHOST" env-default:"/" validate:"required"`
+	Prefetch int    `env:"RABBITMQ_PREFETCH" env-default:"1" validate:"min=1,max=1000"` // Unacked messages per consumer, at least one per handler (QUEUE_CONCURRENCY)
 }
 
+const (
+	QueueBackendRabbitMQ = "rabbitmq"
+	QueueBackendPostgres = "postgres"
+)
+
+// QueueConfig selects the queue backend. The postgres backend keeps jobs in
+// the application database and needs no broker. Consumer settings apply to
+// every backend.
+//
+//nolint:golines // long struct tags with metadata
+type QueueConfig struct {
+	Backend                  string `env:"QUEUE_BACKEND" env-default:"rabbitmq" validate:"oneof=rabbitmq postgres"`
+	VisibilityTimeoutSeconds int    `env:"QUEUE_VISIBILITY_TIMEOUT_SECONDS" env-default:"300" validate:"min=5,max=86400"` // A postgres job whose lease isn't renewed within this time is handed out again
+	PollIntervalSeconds      int    `env:"QUEUE_POLL_INTERVAL_SECONDS" env-default:"5" validate:"min=1,max=3600"`         // Fallback polling when a LISTEN/NOTIFY wakeup is missed
+	Consumer                 ConsumerConfig
+}
+
+// ConsumerConfig controls how a worker consumes tasks, whatever the queue
+// backend.
+//
 //nolint:golines // long struct tags with metadata
-type MinIOConfig struct {
-	Endpoint                    string `env:"MINIO_ENDPOINT" env-default:"localhost:9000" validate:"required"`
-	AccessKey                   string `env:"MINIO_ACCESS_KEY" env-default:"minioadmin" validate:"required"`
-	SecretKey                   string `env:"MINIO_SECRET_KEY" env-default:"minioadmin" validate:"required"`
-	UseSSL                      bool   `env:"MINIO_USE_SSL" env-default:"false"`
-	BucketUploads               string `env:"MINIO_BUCKET_UPLOADS" env-default:"uploads" validate:"required"`
-	BucketProcessed             string `env:"MINIO_BUCKET_PROCESSED" env-default:"processed" validate:"required"`
-	PresignedURLExpirationHours int    `env:"MINIO_PRESIGNED_URL_EXPIRATION_HOURS" env-default:"168" validate:"min=1,max=8760"` // Default: 7 days (168 hours), max: 1 year
+type ConsumerConfig struct {
+	Concurrency            int   `env:"QUEUE_CONCURRENCY" env-default:"1" validate:"min=1,max=100"`                 // Concurrent handler goroutines
+	ShutdownTimeoutSeconds int   `env:"QUEUE_SHUTDOWN_TIMEOUT_SECONDS" env-default:"30" validate:"min=0,max=3600"`  // Drain time before in-flight handlers are cancelled
+	MaxAttempts            int   `env:"QUEUE_MAX_ATTEMPTS" env-default:"5" validate:"min=1,max=100"`                // Retried messages are dead-lettered after this many attempts
+	LaneWeights            []int `env:"QUEUE_LANE_WEIGHTS" env-default:"6,3,1" validate:"len=3,dive,min=1,max=100"` // Relative share of interactive, normal and bulk deliveries under load
+}
+
+func (c *ConsumerConfig) ShutdownTimeout() time.Duration {
+	return time.Duration(c.ShutdownTimeoutSeconds) * time.Second
+}
+
+func (c *QueueConfig) VisibilityTimeout() time.Duration {
+	return time.Duration(c.VisibilityTimeoutSeconds) * time.Second
 }
 
-func (c *MinIOConfig) PresignedURLExpiration() time.Duration {
+func (c *QueueConfig) PollInterval() time.Duration {
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+const (
+	SSENone = "none"
+	SSES3   = "sse-s3"
+	SSEKMS  = "sse-kms"
+	SSEC    = "sse-c"
+)
+
+const (
+	// S3CredentialsStatic signs requests with AccessKey, SecretKey and
+	// SessionToken.
+	S3CredentialsStatic = "static"
+	// S3CredentialsChain takes credentials from the AWS_* environment
+	// variables, then the shared credentials file, then the IAM role of the
+	// instance, task or pod.
+	S3CredentialsChain = "chain"
+)
+
+const (
+	S3AddressingAuto        = "auto"
+	S3AddressingPath        = "path"
+	S3AddressingVirtualHost = "virtual-host"
+)
+
+const (
+	// BucketSetupCreate creates missing buckets and sets their default
+	// encryption.
+	BucketSetupCreate = "create"
+	// BucketSetupVerify only checks that the buckets exist, for providers
+	// where buckets are pre-provisioned and CreateBucket is forbidden.
+	BucketSetupVerify = "verify"
+	// BucketSetupSkip leaves the buckets alone, for credentials that can't
+	// even check them.
+	BucketSetupSkip = "skip"
+)
+
+// S3Config configures object storage on MinIO, AWS S3 or another
+// S3-compatible provider. Settings that existed before S3 support still
+// accept their MINIO_* names. With sse-c the backend encrypts every object
+// with a key derived from SSEMasterKey, which needs TLS and rules out
+// presigned URLs: results are proxied and direct uploads are unavailable.
+// Pre-provisioned buckets that aren't created by the backend need their
+// default encryption set up front for sse-s3 and sse-kms to cover direct
+// uploads.
+//
+//nolint:golines // long struct tags with metadata
+type S3Config struct {
+	Endpoint                    string   `env:"S3_ENDPOINT,MINIO_ENDPOINT" env-default:"localhost:9000" validate:"required"` // Host and port, s3.amazonaws.com or s3.<region>.amazonaws.com for AWS
+	Credentials                 string   `env:"S3_CREDENTIALS" env-default:"static" validate:"oneof=static chain"`           // Static keys or the AWS credential chain (environment, shared file, IAM role)
+	AccessKey                   string   `env:"S3_ACCESS_KEY,MINIO_ACCESS_KEY" env-default:"minioadmin" validate:"required_if=Credentials static"`
+	SecretKey                   string   `env:"S3_SECRET_KEY,MINIO_SECRET_KEY" env-default:"minioadmin" validate:"required_if=Credentials static"`
+	SessionToken                string   `env:"S3_SESSION_TOKEN"` // Session token of temporary static credentials
+	UseSSL                      bool     `env:"S3_USE_SSL,MINIO_USE_SSL" env-default:"false"`
+	CABundle                    string   `env:"S3_CA_BUNDLE" validate:"omitempty,file"`                                         // PEM file with CA certificates trusted in addition to the system ones
+	AddressingStyle             string   `env:"S3_ADDRESSING_STYLE" env-default:"auto" validate:"oneof=auto path virtual-host"` // Bucket in the path or in the host name, auto picks virtual-host for AWS
+	BucketSetup                 string   `env:"S3_BUCKET_SETUP" env-default:"create" validate:"oneof=create verify skip"`       // What happens to the buckets at startup
+	BucketUploads               string   `env:"S3_BUCKET_UPLOADS,MINIO_BUCKET_UPLOADS" env-default:"uploads" validate:"required"`
+	BucketProcessed             string   `env:"S3_BUCKET_PROCESSED,MINIO_BUCKET_PROCESSED" env-default:"processed" validate:"required"`
+	BucketBottles               string   `env:"S3_BUCKET_BOTTLES,MINIO_BUCKET_BOTTLES" env-default:"bottles" validate:"required"`
+	PresignedURLExpirationHours int      `env:"S3_PRESIGNED_URL_EXPIRATION_HOURS,MINIO_PRESIGNED_URL_EXPIRATION_HOURS" env-default:"168" validate:"min=1,max=8760"` // Default: 7 days (168 hours), max: 1 year
+	Region                      string   `env:"S3_REGION,MINIO_REGION" env-default:"us-east-1" validate:"required"`
+	PublicURL                   string   `env:"S3_PUBLIC_URL,MINIO_PUBLIC_URL" validate:"omitempty,url"`                                  // Scheme and host clients reach storage at, presigned URLs are signed for it (default: S3_ENDPOINT)
+	SSE                         string   `env:"S3_SSE,MINIO_SSE" env-default:"none" validate:"oneof=none sse-s3 sse-kms sse-c"`           // Server-side encryption of stored objects
+	SSEKMSKeyID                 string   `env:"S3_SSE_KMS_KEY_ID,MINIO_SSE_KMS_KEY_ID" validate:"required_if=SSE sse-kms"`                // KMS key of sse-kms
+	SSEMasterKey                string   `env:"S3_SSE_MASTER_KEY,MINIO_SSE_MASTER_KEY" validate:"required_if=SSE sse-c,omitempty,base64"` // Base64 32-byte key the sse-c key of every object is derived from
+	SSEPreviousMasterKeys       []string `env:"S3_SSE_PREVIOUS_MASTER_KEYS,MINIO_SSE_PREVIOUS_MASTER_KEYS" validate:"dive,base64"`        // Rotated out master keys, still used for reads until the reencrypt job ran
+}
+
+func (c *S3Config) PresignedURLExpiration() time.Duration {
 	return time.Duration(c.PresignedURLExpirationHours) * time.Hour
 }
 
+// StorageConfig controls the decorators layered around object storage:
+// retries of transient failures, an on-disk read cache of hot objects and
+// call metrics. The cache holds decrypted copies of the objects, so its
+// directory must be as protected as the storage credentials, and it must
+// not be shared between processes: it is emptied at startup.
+//
+//nolint:golines // long struct tags with metadata
+type StorageConfig struct {
+	RetryAttempts              int      `env:"STORAGE_RETRY_ATTEMPTS" env-default:"3" validate:"min=1,max=10"`                     // Attempts per call, 1 disables retries
+	RetryBaseDelayMilliseconds int      `env:"STORAGE_RETRY_BASE_DELAY_MILLISECONDS" env-default:"100" validate:"min=1,max=60000"` // Delay before the first retry, doubled for every further one
+	RetryMaxDelayMilliseconds  int      `env:"STORAGE_RETRY_MAX_DELAY_MILLISECONDS" env-default:"2000" validate:"min=1,max=60000,gtefield=RetryBaseDelayMilliseconds"`
+	CacheDir                   string   `env:"STORAGE_CACHE_DIR"`                                                                             // Empty disables the read cache
+	CacheMaxBytes              int64    `env:"STORAGE_CACHE_MAX_BYTES" env-default:"536870912" validate:"min=1"`                              // Default: 512 MiB, least recently used objects are evicted beyond it
+	CacheMaxObjectBytes        int64    `env:"STORAGE_CACHE_MAX_OBJECT_BYTES" env-default:"33554432" validate:"min=1,ltefield=CacheMaxBytes"` // Default: 32 MiB, larger objects are never cached
+	CacheTTLSeconds            int      `env:"STORAGE_CACHE_TTL_SECONDS" env-default:"3600" validate:"min=1,max=604800"`                      // Bounds how long changes made by other processes go unnoticed
+	CacheBuckets               []string `env:"STORAGE_CACHE_BUCKETS"`                                                                         // Buckets whose objects are cached (default: processed and bottles buckets)
+	SlowCallMilliseconds       int      `env:"STORAGE_SLOW_CALL_MILLISECONDS" env-default:"1000" validate:"min=1"`                            // Calls slower than this are logged
+}
+
+func (c *StorageConfig) RetryBaseDelay() time.Duration {
+	return time.Duration(c.RetryBaseDelayMilliseconds) * time.Millisecond
+}
+
+func (c *StorageConfig) RetryMaxDelay() time.Duration {
+	return time.Duration(c.RetryMaxDelayMilliseconds) * time.Millisecond
+}
+
+func (c *StorageConfig) CacheTTL() time.Duration {
+	return time.Duration(c.CacheTTLSeconds) * time.Second
+}
+
+func (c *StorageConfig) SlowCallThreshold() time.Duration {
+	return time.Duration(c.SlowCallMilliseconds) * time.Millisecond
+}
+
+// UploadConfig controls direct uploads, where the client PUTs the file to a
+// presigned storage URL and then completes the upload, and resumable uploads,
+// where the client sends the file in chunks through the backend.
+//
+//nolint:golines // long struct tags with metadata
+type UploadConfig struct {
+	URLExpirationMinutes   int   `env:"UPLOAD_URL_EXPIRATION_MINUTES" env-default:"15" validate:"min=1,max=10080"`                    // Lifetime of the presigned PUT URL
+	TTLMinutes             int   `env:"UPLOAD_TTL_MINUTES" env-default:"60" validate:"min=1,max=10080,gtefield=URLExpirationMinutes"` // Uploads not completed within this time expire and their file is deleted
+	CleanupIntervalSeconds int   `env:"UPLOAD_CLEANUP_INTERVAL_SECONDS" env-default:"300" validate:"min=10,max=86400"`                // How often expired uploads are looked for
+	ResumableTTLMinutes    int   `env:"UPLOAD_RESUMABLE_TTL_MINUTES" env-default:"1440" validate:"min=1,max=10080"`                   // Resumable uploads expire this long after their last chunk
+	ChunkBytes             int64 `env:"UPLOAD_CHUNK_BYTES" env-default:"5242880" validate:"min=5242880,max=104857600"`                // Chunk size of resumable uploads, S3 parts are at least 5 MiB
+}
+
+func (c *UploadConfig) URLExpiration() time.Duration {
+	return time.Duration(c.URLExpirationMinutes) * time.Minute
+}
+
+func (c *UploadConfig) TTL() time.Duration {
+	return time.Duration(c.TTLMinutes) * time.Minute
+}
+
+func (c *UploadConfig) ResumableTTL() time.Duration {
+	return time.Duration(c.ResumableTTLMinutes) * time.Minute
+}
+
+func (c *UploadConfig) CleanupInterval() time.Duration {
+	return time.Duration(c.CleanupIntervalSeconds) * time.Second
+}
+
+// RetentionConfig controls how long stored files are kept once an image
+// finished processing. Zero keeps the files forever. Processed images are
+// deleted together with their original, renditions and cached variants, and
+// the image becomes expired. Files of deleted images whose deletion failed
+// are retried every TombstoneIntervalSeconds.
+//
+//nolint:golines // long struct tags with metadata
+type RetentionConfig struct {
+	OriginalDays             int `env:"RETENTION_ORIGINAL_DAYS" env-default:"0" validate:"min=0,max=36500"`                 // Originals of completed images are deleted this long after completion
+	FailedOriginalDays       int `env:"RETENTION_FAILED_ORIGINAL_DAYS" env-default:"0" validate:"min=0,max=36500"`          // Failed images expire this long after failing
+	ProcessedDays            int `env:"RETENTION_PROCESSED_DAYS" env-default:"0" validate:"min=0,max=36500"`                // Completed images expire this long after completion
+	IntervalMinutes          int `env:"RETENTION_INTERVAL_MINUTES" env-default:"60" validate:"min=1,max=10080"`             // How often files past their retention are looked for
+	TombstoneIntervalSeconds int `env:"RETENTION_TOMBSTONE_INTERVAL_SECONDS" env-default:"300" validate:"min=10,max=86400"` // How often failed deletions of deleted images' files are retried
+}
+
+func (c *RetentionConfig) OriginalRetention() time.Duration {
+	return days(c.OriginalDays)
+}
+
+func (c *RetentionConfig) FailedOriginalRetention() time.Duration {
+	return days(c.FailedOriginalDays)
+}
+
+func (c *RetentionConfig) ProcessedRetention() time.Duration {
+	return days(c.ProcessedDays)
+}
+
+func (c *RetentionConfig) Interval() time.Duration {
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+func (c *RetentionConfig) TombstoneInterval() time.Duration {
+	return time.Duration(c.TombstoneIntervalSeconds) * time.Second
+}
+
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+//nolint:golines // long struct tags with metadata
+type ImageConfig struct {
+	MaxUploadBytes             int64    `env:"IMAGE_MAX_UPLOAD_BYTES" env-default:"20971520" validate:"min=1"`     // Default: 20 MiB
+	MaxPixels                  int64    `env:"IMAGE_MAX_PIXELS" env-default:"50000000" validate:"min=1"`           // Default: 50 megapixels
+	MaxDimension               int      `env:"IMAGE_MAX_DIMENSION" env-default:"12000" validate:"min=1,max=65535"` // Max width or height in pixels
+	JPEGQuality                int      `env:"IMAGE_JPEG_QUALITY" env-default:"92" validate:"min=1,max=100"`
+	ExifAllowlist              []string `env:"IMAGE_EXIF_ALLOWLIST" env-default:"Make,Model,ExposureTime,FNumber,ISOSpeedRatings,FocalLength,ColorSpace"` // GPS and orientation are always stripped
+	KeepOriginalExif           bool     `env:"IMAGE_KEEP_ORIGINAL_EXIF" env-default:"false"`                                                              // Store the unfiltered EXIF as JSON on the image row
+	RenditionSizes             []int    `env:"IMAGE_RENDITION_SIZES" env-default:"256,1024" validate:"dive,min=16,max=8192"`                              // Max dimension of each rendition
+	RenditionFormats           []string `env:"IMAGE_RENDITION_FORMATS" env-default:"webp,jpeg" validate:"dive,oneof=jpeg png webp"`                       // Every size is rendered in every format
+	BottleMaxBytes             int64    `env:"IMAGE_BOTTLE_MAX_BYTES" env-default:"5242880" validate:"min=1"`                                             // Default: 5 MiB per bottle overlay
+	BottleCheckIntervalSeconds int      `env:"IMAGE_BOTTLE_CHECK_INTERVAL_SECONDS" env-default:"30" validate:"min=1"`                                     // How often the worker checks the catalog for changes
+}
+
+func (c *ImageConfig) BottleCheckInterval() time.Duration {
+	return time.Duration(c.BottleCheckIntervalSeconds) * time.Second
+}
+
+const (
+	ResultDeliveryRedirect = "redirect"
+	ResultDeliveryProxy    = "proxy"
+)
+
 //nolint:golines // long struct tags with metadata
 type BackendConfig struct {
-	Port     string `env:"BACKEND_PORT" env-default:"8080" validate:"required"`
-	LogLevel string `env:"BACKEND_LOG_LEVEL" env-default:"info" validate:"oneof=debug info warn error"`
-	Env      string `env:"BACKEND_ENV" env-default:"development" validate:"oneof=development production staging"`
+	Port                    string            `env:"BACKEND_PORT" env-default:"8080" validate:"required"`
+	LogLevel                string            `env:"BACKEND_LOG_LEVEL" env-default:"info" validate:"oneof=debug info warn error"`
+	Env                     string            `env:"BACKEND_ENV" env-default:"development" validate:"oneof=development production staging"`
+	APIKeyTiers             map[string]string `env:"BACKEND_API_KEY_TIERS" validate:"dive,keys,required,endkeys,oneof=interactive normal bulk"` // key:tier pairs, the tier is the highest priority the key may use
+	ThroughputWindowSeconds int               `env:"BACKEND_THROUGHPUT_WINDOW_SECONDS" env-default:"900" validate:"min=60,max=86400"`           // Finished tasks in this window give the throughput for queue wait estimates
+	ResultDelivery          string            `env:"BACKEND_RESULT_DELIVERY" env-default:"redirect" validate:"oneof=redirect proxy"`            // Redirect to a presigned URL or stream results through the backend
+}
+
+func (c *BackendConfig) ThroughputWindow() time.Duration {
+	return time.Duration(c.ThroughputWindowSeconds) * time.Second
 }
 
 type Config struct {
-	Database DatabaseConfig
-	RabbitMQ RabbitMQConfig
-	MinIO    MinIOConfig
-	Backend  BackendConfig
+	Database  DatabaseConfig
+	RabbitMQ  RabbitMQConfig
+	Queue     QueueConfig
+	S3        S3Config
+	Storage   StorageConfig
+	Upload    UploadConfig
+	Retention RetentionConfig
+	Image     ImageConfig
+	Backend   BackendConfig
 }
 
 func Load() (*Config, error) {
@@ -70,8 +305,28 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to load rabbitmq configuration: %w", err)
 	}
 
-	if err := cleanenv.ReadEnv(&cfg.MinIO); err != nil {
-		return nil, fmt.Errorf("failed to load minio configuration: %w", err)
+	if err := cleanenv.ReadEnv(&cfg.Queue); err != nil {
+		return nil, fmt.Errorf("failed to load queue configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadEnv(&cfg.S3); err != nil {
+		return nil, fmt.Errorf("failed to load s3 configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadEnv(&cfg.Storage); err != nil {
+		return nil, fmt.Errorf("failed to load storage configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadEnv(&cfg.Upload); err != nil {
+		return nil, fmt.Errorf("failed to load upload configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadEnv(&cfg.Retention); err != nil {
+		return nil, fmt.Errorf("failed to load retention configuration: %w", err)
+	}
+
+	if err := cleanenv.ReadEnv(&cfg.Image); err != nil {
+		return nil, fmt.Errorf("failed to load image configuration: %w", err)
 	}
 
 	if err := cleanenv.ReadEnv(&cfg.Backend); err != nil {
@@ -98,8 +353,34 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("rabbitmq config validation failed: %w", err)
 	}
 
-	if err := validate.Struct(c.MinIO); err != nil {
-		return fmt.Errorf("minio config validation failed: %w", err)
+	if err := validate.Struct(c.Queue); err != nil {
+		return fmt.Errorf("queue config validation failed: %w", err)
+	}
+
+	// Every handler needs an unacked delivery to work on.
+	if c.Queue.Backend == QueueBackendRabbitMQ && c.RabbitMQ.Prefetch < c.Queue.Consumer.Concurrency {
+		return fmt.Errorf("rabbitmq config validation failed: RABBITMQ_PREFETCH (%d) must be at least QUEUE_CONCURRENCY (%d)",
+			c.RabbitMQ.Prefetch, c.Queue.Consumer.Concurrency)
+	}
+
+	if err := validate.Struct(c.S3); err != nil {
+		return fmt.Errorf("s3 config validation failed: %w", err)
+	}
+
+	if err := validate.Struct(c.Storage); err != nil {
+		return fmt.Errorf("storage config validation failed: %w", err)
+	}
+
+	if err := validate.Struct(c.Upload); err != nil {
+		return fmt.Errorf("upload config validation failed: %w", err)
+	}
+
+	if err := validate.Struct(c.Retention); err != nil {
+		return fmt.Errorf("retention config validation failed: %w", err)
+	}
+
+	if err := validate.Struct(c.Image); err != nil {
+		return fmt.Errorf("image config validation failed: %w", err)
 	}
 
 	if err := validate.Struct(c.Backend); err != nil {
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Default anchor of an overlay: the middle of the bottle base.
+const (
+	DefaultBottleAnchorX = 0.5
+	DefaultBottleAnchorY = 1.0
+)
+
+// BottleAsset is a bottle overlay from the catalog. The overlay image carries
+// its alpha mask; the remaining fields tell the compositor how to place it.
+//
+//nolint:golines // long struct tags with metadata
+type BottleAsset struct {
+	ID            uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
+	Style         string    `json:"style" gorm:"type:varchar(64);not null;uniqueIndex" db:"style"`
+	Name          string    `json:"name" gorm:"type:varchar(128);not null" db:"name"`
+	Bucket        string    `json:"bucket" gorm:"type:varchar(63);not null" db:"bucket"`
+	ObjectKey     string    `json:"object_key" gorm:"type:varchar(512);not null" db:"object_key"`
+	Format        string    `json:"format" gorm:"type:varchar(10);not null" db:"format"`
+	Width         int       `json:"width" gorm:"not null" db:"width"`
+	Height        int       `json:"height" gorm:"not null" db:"height"`
+	AnchorX       float64   `json:"anchor_x" gorm:"not null" db:"anchor_x"` // relative to the overlay width
+	AnchorY       float64   `json:"anchor_y" gorm:"not null" db:"anchor_y"` // relative to the overlay height
+	ShadowOpacity float64   `json:"shadow_opacity" gorm:"not null;default:0" db:"shadow_opacity"`
+	ShadowOffsetX float64   `json:"shadow_offset_x" gorm:"not null;default:0" db:"shadow_offset_x"` // relative to the overlay width
+	ShadowOffsetY float64   `json:"shadow_offset_y" gorm:"not null;default:0" db:"shadow_offset_y"` // relative to the overlay height
+	ShadowBlur    float64   `json:"shadow_blur" gorm:"not null;default:0" db:"shadow_blur"`         // relative to the overlay height
+	Enabled       bool      `json:"enabled" gorm:"not null;default:true;index" db:"enabled"`
+	Version       int       `json:"version" gorm:"not null;default:1" db:"version"`
+	CreatedAt     time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+}
+
+func (BottleAsset) TableName() string {
+	return "bottle_assets"
+}
+
+// AspectRatio returns the natural width to height ratio of the overlay.
+func (a *BottleAsset) AspectRatio() float64 {
+	if a.Height == 0 {
+		return 0
+	}
+	return float64(a.Width) / float64(a.Height)
+}
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,25 +14,52 @@ const (
 	ImageStatusProcessing ImageStatus = "processing"
 	ImageStatusCompleted  ImageStatus = "completed"
 	ImageStatusFailed     ImageStatus = "failed"
+	// ImageStatusExpired means the retention of the image ran out and its
+	// files were deleted.
+	ImageStatusExpired ImageStatus = "expired"
 )
 
 type Image struct {
 	//nolint:golines // long struct tags with metadata
-	ID           uuid.UUID   `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
-	OriginalURL  string      `json:"original_url" gorm:"type:varchar(512);not null" db:"original_url"`
-	ProcessedURL *string     `json:"processed_url" gorm:"type:varchar(512)" db:"processed_url"`
-	Status       ImageStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending';check:status IN ('pending','processing','completed','failed')" db:"status"`
-	CreatedAt    time.Time   `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
-	UpdatedAt    time.Time   `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+	ID                uuid.UUID       `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4();index:idx_images_list,priority:2;index:idx_images_list_status,priority:3;index:idx_images_list_client,priority:3" db:"id"`
+	OriginalBucket    string          `json:"original_bucket" gorm:"type:varchar(63);not null;default:''" db:"original_bucket"`
+	OriginalKey       string          `json:"original_key" gorm:"type:varchar(512);not null;default:'';index" db:"original_key"`
+	ProcessedBucket   *string         `json:"processed_bucket" gorm:"type:varchar(63)" db:"processed_bucket"`
+	ProcessedKey      *string         `json:"processed_key" gorm:"type:varchar(512)" db:"processed_key"` // set once processing completed
+	Status            ImageStatus     `json:"status" gorm:"type:varchar(20);not null;default:'pending';index:idx_images_retention,priority:1;index:idx_images_list_status,priority:1;check:status IN ('pending','processing','completed','failed','expired')" db:"status"`
+	Format            string          `json:"format" gorm:"type:varchar(10);not null;default:''" db:"format"`
+	Width             int             `json:"width" gorm:"not null;default:0" db:"width"`
+	Height            int             `json:"height" gorm:"not null;default:0" db:"height"`
+	OriginalExif      json.RawMessage `json:"original_exif,omitempty" gorm:"type:jsonb" db:"original_exif"`
+	ContentHash       *string         `json:"content_hash" gorm:"type:varchar(64);uniqueIndex" db:"content_hash"`                       // hex SHA-256 of the stored original
+	FinishedAt        *time.Time      `json:"finished_at" gorm:"index:idx_images_retention,priority:2" db:"finished_at"`                // when processing completed or failed
+	OriginalDeletedAt *time.Time      `json:"original_deleted_at" db:"original_deleted_at"`                                             // set once retention deleted the original
+	ClientID          *string         `json:"client_id" gorm:"type:varchar(64);index:idx_images_list_client,priority:1" db:"client_id"` // client that uploaded the image first
+	CreatedAt         time.Time       `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP;index:idx_images_list,priority:1;index:idx_images_list_status,priority:2;index:idx_images_list_client,priority:2" db:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
 }
 
 func (Image) TableName() string {
 	return "images"
 }
 
+// ImageClient records a client that uploaded an image, including uploads
+// that were deduplicated into an image another client uploaded first.
+//
+//nolint:golines // long struct tags with metadata
+type ImageClient struct {
+	ImageID   uuid.UUID `json:"image_id" gorm:"type:uuid;primaryKey" db:"image_id"`
+	ClientID  string    `json:"client_id" gorm:"type:varchar(64);primaryKey;index:idx_image_clients_client" db:"client_id"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+}
+
+func (ImageClient) TableName() string {
+	return "image_clients"
+}
+
 func (s ImageStatus) IsValid() bool {
 	switch s {
-	case ImageStatusPending, ImageStatusProcessing, ImageStatusCompleted, ImageStatusFailed:
+	case ImageStatusPending, ImageStatusProcessing, ImageStatusCompleted, ImageStatusFailed, ImageStatusExpired:
 		return true
 	default:
 		return false
@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type QueueJobStatus string
+
+const (
+	QueueJobStatusReady QueueJobStatus = "ready"
+	QueueJobStatusDead  QueueJobStatus = "dead"
+)
+
+// QueueJob is a message of the postgres queue backend. A ready job is
+// claimed by setting a lease and pushing VisibleAt past the visibility
+// timeout; it is deleted when acked and becomes visible again if the lease
+// isn't renewed in time.
+//
+//nolint:golines // long struct tags with metadata
+type QueueJob struct {
+	ID            uuid.UUID      `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
+	Seq           int64          `json:"seq" gorm:"type:bigserial;autoIncrement;not null" db:"seq"` // publish order among jobs visible at the same time
+	MessageID     uuid.UUID      `json:"message_id" gorm:"type:uuid;not null;index" db:"message_id"`
+	CorrelationID string         `json:"correlation_id" gorm:"type:varchar(64);not null;default:''" db:"correlation_id"`
+	Lane          TaskPriority   `json:"lane" gorm:"type:varchar(16);not null;index:idx_queue_jobs_claim,priority:2;check:lane IN ('interactive','normal','bulk')" db:"lane"`
+	Status        QueueJobStatus `json:"status" gorm:"type:varchar(16);not null;default:'ready';index:idx_queue_jobs_claim,priority:1;check:status IN ('ready','dead')" db:"status"`
+	Body          []byte         `json:"body" gorm:"type:bytea;not null" db:"body"`
+	Attempt       int            `json:"attempt" gorm:"not null;default:0" db:"attempt"`
+	Lease         *uuid.UUID     `json:"lease" gorm:"type:uuid" db:"lease"`
+	VisibleAt     time.Time      `json:"visible_at" gorm:"not null;default:CURRENT_TIMESTAMP;index:idx_queue_jobs_claim,priority:3" db:"visible_at"`
+	LastError     *string        `json:"last_error" gorm:"type:text" db:"last_error"`
+	DeadReason    *string        `json:"dead_reason" gorm:"type:text" db:"dead_reason"`
+	CreatedAt     time.Time      `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+}
+
+func (QueueJob) TableName() string {
+	return "queue_jobs"
+}
+
+func (s QueueJobStatus) IsValid() bool {
+	switch s {
+	case QueueJobStatusReady, QueueJobStatusDead:
+		return true
+	default:
+		return false
+	}
+}
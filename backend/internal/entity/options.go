@@ -0,0 +1,118 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ProcessingOptionsVersion is the schema version of ProcessingOptions carried
+// in queue messages. Bump it on any incompatible change.
+const ProcessingOptionsVersion = 1
+
+const (
+	MinBottleScale    = 0.1
+	MaxBottleScale    = 3.0
+	MaxBottleRotation = 180.0
+	MaxBottleCount    = 5
+)
+
+type BottlePlacement string
+
+const (
+	BottlePlacementAuto  BottlePlacement = "auto"
+	BottlePlacementLeft  BottlePlacement = "left"
+	BottlePlacementRight BottlePlacement = "right"
+	BottlePlacementHand  BottlePlacement = "hand"
+	BottlePlacementTable BottlePlacement = "table"
+)
+
+//nolint:gochecknoglobals // compiled once, read-only
+var bottleStylePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// BottlePosition is an explicit bottle anchor in coordinates relative to the
+// image size: (0, 0) is the top-left corner, (1, 1) the bottom-right one.
+type BottlePosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// ProcessingOptions controls how bottles are composited into an image.
+// Zero values mean "let the worker decide", so the default options
+// serialise to an empty JSON object.
+type ProcessingOptions struct {
+	BottleStyle string          `json:"bottle_style,omitempty"`
+	Placement   BottlePlacement `json:"placement,omitempty"`
+	Position    *BottlePosition `json:"position,omitempty"` // overrides Placement
+	Scale       float64         `json:"scale,omitempty"`
+	Rotation    float64         `json:"rotation,omitempty"` // degrees, clockwise
+	Count       int             `json:"count,omitempty"`
+}
+
+func (p BottlePlacement) IsValid() bool {
+	switch p {
+	case BottlePlacementAuto, BottlePlacementLeft, BottlePlacementRight, BottlePlacementHand, BottlePlacementTable:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p BottlePlacement) String() string {
+	return string(p)
+}
+
+// IsValidBottleStyle reports whether style is a well-formed catalog slug.
+func IsValidBottleStyle(style string) bool {
+	return bottleStylePattern.MatchString(style)
+}
+
+func (o *ProcessingOptions) Validate() error {
+	if o.BottleStyle != "" && !IsValidBottleStyle(o.BottleStyle) {
+		return errors.New("bottle_style must be a lowercase catalog slug")
+	}
+	if o.Placement != "" && !o.Placement.IsValid() {
+		return fmt.Errorf("placement %q is not supported", o.Placement)
+	}
+	if o.Position != nil {
+		if o.Placement != "" && o.Placement != BottlePlacementAuto {
+			return errors.New("placement and position cannot be combined")
+		}
+		if o.Position.X < 0 || o.Position.X > 1 || o.Position.Y < 0 || o.Position.Y > 1 {
+			return errors.New("position coordinates must be between 0 and 1")
+		}
+	}
+	if o.Scale != 0 && (o.Scale < MinBottleScale || o.Scale > MaxBottleScale) {
+		return fmt.Errorf("scale must be between %.1f and %.1f", MinBottleScale, MaxBottleScale)
+	}
+	if o.Rotation < -MaxBottleRotation || o.Rotation > MaxBottleRotation {
+		return fmt.Errorf("rotation must be between %.0f and %.0f degrees", -MaxBottleRotation, MaxBottleRotation)
+	}
+	// Zero leaves the count to the worker, like the other options.
+	if o.Count != 0 && (o.Count < 1 || o.Count > MaxBottleCount) {
+		return fmt.Errorf("count must be between 1 and %d", MaxBottleCount)
+	}
+	return nil
+}
+
+// Value stores the options as JSONB.
+func (o ProcessingOptions) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+// Scan reads the options from a JSONB column.
+func (o *ProcessingOptions) Scan(src any) error {
+	switch value := src.(type) {
+	case nil:
+		*o = ProcessingOptions{}
+		return nil
+	case []byte:
+		return json.Unmarshal(value, o)
+	case string:
+		return json.Unmarshal([]byte(value), o)
+	default:
+		return fmt.Errorf("cannot scan %T into ProcessingOptions", src)
+	}
+}
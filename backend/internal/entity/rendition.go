@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RenditionKind string
+
+const (
+	RenditionKindOriginal  RenditionKind = "original"
+	RenditionKindProcessed RenditionKind = "processed"
+)
+
+// ImageRendition is a downscaled copy of the original of an image or of the
+// processed result of one of its tasks. Renditions of the original have no
+// TaskID.
+//
+//nolint:golines // long struct tags with metadata
+type ImageRendition struct {
+	ID        uuid.UUID     `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
+	ImageID   uuid.UUID     `json:"image_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_image_renditions_original,where:task_id IS NULL" db:"image_id"`
+	TaskID    *uuid.UUID    `json:"task_id,omitempty" gorm:"type:uuid;uniqueIndex:idx_image_renditions_processed,where:task_id IS NOT NULL" db:"task_id"`
+	Kind      RenditionKind `json:"kind" gorm:"type:varchar(20);not null;uniqueIndex:idx_image_renditions_original;check:kind IN ('original','processed')" db:"kind"`
+	Size      int           `json:"size" gorm:"not null;uniqueIndex:idx_image_renditions_original;uniqueIndex:idx_image_renditions_processed" db:"size"` // requested max dimension
+	Format    string        `json:"format" gorm:"type:varchar(10);not null;uniqueIndex:idx_image_renditions_original;uniqueIndex:idx_image_renditions_processed" db:"format"`
+	Width     int           `json:"width" gorm:"not null" db:"width"`
+	Height    int           `json:"height" gorm:"not null" db:"height"`
+	Bytes     int64         `json:"bytes" gorm:"not null" db:"bytes"`
+	Bucket    string        `json:"bucket" gorm:"type:varchar(63);not null" db:"bucket"`
+	ObjectKey string        `json:"object_key" gorm:"type:varchar(512);not null" db:"object_key"`
+	CreatedAt time.Time     `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+}
+
+func (ImageRendition) TableName() string {
+	return "image_renditions"
+}
+
+func (k RenditionKind) IsValid() bool {
+	switch k {
+	case RenditionKindOriginal, RenditionKindProcessed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (k RenditionKind) String() string {
+	return string(k)
+}
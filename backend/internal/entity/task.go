@@ -15,14 +15,29 @@ const (
 	TaskStatusFailed     TaskStatus = "failed"
 )
 
+// TaskPriority selects the queue lane of a task. Interactive requests (such
+// as the Telegram bot) must not wait behind bulk imports.
+type TaskPriority string
+
+const (
+	TaskPriorityInteractive TaskPriority = "interactive"
+	TaskPriorityNormal      TaskPriority = "normal"
+	TaskPriorityBulk        TaskPriority = "bulk"
+)
+
 //nolint:golines // long struct tags with metadata
 type ProcessingTask struct {
-	ID           uuid.UUID  `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
-	ImageID      uuid.UUID  `json:"image_id" gorm:"type:uuid;not null;index" db:"image_id"`
-	Status       TaskStatus `json:"status" gorm:"type:varchar(20);not null;default:'pending';index;check:status IN ('pending','processing','completed','failed')" db:"status"`
-	ErrorMessage *string    `json:"error_message" gorm:"type:text" db:"error_message"`
-	CreatedAt    time.Time  `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP;index" db:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+	ID              uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4();index:idx_processing_tasks_list,priority:2;index:idx_processing_tasks_list_status,priority:3;index:idx_processing_tasks_list_client,priority:3" db:"id"`
+	ImageID         uuid.UUID         `json:"image_id" gorm:"type:uuid;not null;index" db:"image_id"`
+	Status          TaskStatus        `json:"status" gorm:"type:varchar(20);not null;default:'pending';index;index:idx_processing_tasks_queue,priority:1;index:idx_processing_tasks_list_status,priority:1;check:status IN ('pending','processing','completed','failed')" db:"status"`
+	Priority        TaskPriority      `json:"priority" gorm:"type:varchar(16);not null;default:'normal';index:idx_processing_tasks_queue,priority:2;check:priority IN ('interactive','normal','bulk')" db:"priority"`
+	Options         ProcessingOptions `json:"options" gorm:"type:jsonb;not null;default:'{}'" db:"options"`
+	ProcessedBucket *string           `json:"processed_bucket" gorm:"type:varchar(63)" db:"processed_bucket"`
+	ProcessedKey    *string           `json:"processed_key" gorm:"type:varchar(512)" db:"processed_key"` // result of this task, set once it completed
+	ErrorMessage    *string           `json:"error_message" gorm:"type:text" db:"error_message"`
+	ClientID        *string           `json:"client_id" gorm:"type:varchar(64);index:idx_processing_tasks_list_client,priority:1" db:"client_id"` // client that requested the task
+	CreatedAt       time.Time         `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP;index;index:idx_processing_tasks_queue,priority:3;index:idx_processing_tasks_list,priority:1;index:idx_processing_tasks_list_status,priority:2;index:idx_processing_tasks_list_client,priority:2" db:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
 }
 
 func (ProcessingTask) TableName() string {
@@ -41,3 +56,30 @@ func (s TaskStatus) IsValid() bool {
 func (s TaskStatus) String() string {
 	return string(s)
 }
+
+func (p TaskPriority) IsValid() bool {
+	switch p {
+	case TaskPriorityInteractive, TaskPriorityNormal, TaskPriorityBulk:
+		return true
+	default:
+		return false
+	}
+}
+
+// Rank orders priorities from the most urgent (0) to the least urgent.
+func (p TaskPriority) Rank() int {
+	switch p {
+	case TaskPriorityInteractive:
+		return 0
+	case TaskPriorityNormal:
+		return 1
+	case TaskPriorityBulk:
+		return 2 //nolint:mnd // least urgent
+	default:
+		return 1
+	}
+}
+
+func (p TaskPriority) String() string {
+	return string(p)
+}
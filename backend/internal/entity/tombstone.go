@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ObjectTombstone is a stored object, or with Prefix every object under
+// ObjectKey, that must be deleted because its image was deleted. Tombstones
+// are recorded together with the deletion of the image and removed once the
+// storage deletion succeeded, so failed deletions are retried.
+//
+//nolint:golines // long struct tags with metadata
+type ObjectTombstone struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
+	ImageID   uuid.UUID `json:"image_id" gorm:"type:uuid;not null" db:"image_id"` // the deleted image, kept for tracing
+	Bucket    string    `json:"bucket" gorm:"type:varchar(63);not null" db:"bucket"`
+	ObjectKey string    `json:"object_key" gorm:"type:varchar(512);not null" db:"object_key"`
+	Prefix    bool      `json:"prefix" gorm:"not null;default:false" db:"prefix"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0" db:"attempts"`
+	LastError *string   `json:"last_error" gorm:"type:text" db:"last_error"`
+	RetryAt   time.Time `json:"retry_at" gorm:"not null;default:CURRENT_TIMESTAMP;index" db:"retry_at"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+}
+
+func (ObjectTombstone) TableName() string {
+	return "object_tombstones"
+}
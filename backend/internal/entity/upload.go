@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UploadStatus string
+
+const (
+	UploadStatusPending   UploadStatus = "pending"
+	UploadStatusCompleted UploadStatus = "completed"
+	UploadStatusExpired   UploadStatus = "expired"
+)
+
+// Upload is a direct upload: the client PUTs the file to a presigned URL for
+// Bucket/ObjectKey and completes the upload, which creates the image and its
+// processing task. Pending uploads past ExpiresAt are cleaned up.
+//
+// A resumable upload instead receives the file in chunks that are stored as
+// parts of the multipart upload MultipartID; once all Size bytes arrived the
+// parts are assembled into the object and MultipartID is cleared.
+//
+//nolint:golines // long struct tags with metadata
+type Upload struct {
+	ID          uuid.UUID         `json:"id" gorm:"type:uuid;primary_key;default:uuid_generate_v4()" db:"id"`
+	Bucket      string            `json:"bucket" gorm:"type:varchar(63);not null" db:"bucket"`
+	ObjectKey   string            `json:"object_key" gorm:"type:varchar(512);not null" db:"object_key"`
+	ContentType string            `json:"content_type" gorm:"type:varchar(64);not null" db:"content_type"`
+	Size        int64             `json:"size" gorm:"not null" db:"size"` // declared file size
+	Options     ProcessingOptions `json:"options" gorm:"type:jsonb;not null;default:'{}'" db:"options"`
+	Priority    TaskPriority      `json:"priority" gorm:"type:varchar(16);not null;default:'normal';check:priority IN ('interactive','normal','bulk')" db:"priority"`
+	ClientID    *string           `json:"client_id" gorm:"type:varchar(64)" db:"client_id"` // client the image and task are recorded for
+	Status      UploadStatus      `json:"status" gorm:"type:varchar(16);not null;default:'pending';index:idx_uploads_expiry,priority:1;check:status IN ('pending','completed','expired')" db:"status"`
+	Resumable   bool              `json:"resumable" gorm:"not null;default:false" db:"resumable"`
+	MultipartID *string           `json:"multipart_id" gorm:"type:varchar(255)" db:"multipart_id"`
+	Received    int64             `json:"received" gorm:"not null;default:0" db:"received"` // bytes of a resumable upload stored so far
+	ImageID     *uuid.UUID        `json:"image_id" gorm:"type:uuid" db:"image_id"`
+	TaskID      *uuid.UUID        `json:"task_id" gorm:"type:uuid" db:"task_id"`
+	ExpiresAt   time.Time         `json:"expires_at" gorm:"not null;index:idx_uploads_expiry,priority:2" db:"expires_at"`
+	CreatedAt   time.Time         `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"updated_at"`
+}
+
+func (Upload) TableName() string {
+	return "uploads"
+}
+
+// UploadPart is a stored chunk of a resumable upload.
+//
+//nolint:golines // long struct tags with metadata
+type UploadPart struct {
+	UploadID  uuid.UUID `json:"upload_id" gorm:"type:uuid;primaryKey" db:"upload_id"`
+	Number    int       `json:"number" gorm:"primaryKey;autoIncrement:false" db:"number"`
+	ETag      string    `json:"etag" gorm:"type:varchar(128);not null" db:"etag"`
+	Size      int64     `json:"size" gorm:"not null" db:"size"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP" db:"created_at"`
+}
+
+func (UploadPart) TableName() string {
+	return "upload_parts"
+}
+
+func (s UploadStatus) IsValid() bool {
+	switch s {
+	case UploadStatusPending, UploadStatusCompleted, UploadStatusExpired:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s UploadStatus) String() string {
+	return string(s)
+}
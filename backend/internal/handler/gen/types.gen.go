@@ -9,9 +9,17 @@ import (
 	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
+// Defines values for CreateUploadRequestContentType.
+const (
+	ImageJpeg CreateUploadRequestContentType = "image/jpeg"
+	ImagePng  CreateUploadRequestContentType = "image/png"
+	ImageWebp CreateUploadRequestContentType = "image/webp"
+)
+
 // Defines values for GetImageResponseStatus.
 const (
 	GetImageResponseStatusCompleted  GetImageResponseStatus = "completed"
+	GetImageResponseStatusExpired    GetImageResponseStatus = "expired"
 	GetImageResponseStatusFailed     GetImageResponseStatus = "failed"
 	GetImageResponseStatusPending    GetImageResponseStatus = "pending"
 	GetImageResponseStatusProcessing GetImageResponseStatus = "processing"
@@ -49,6 +57,163 @@ const (
 	HealthResponseStatusOk    HealthResponseStatus = "ok"
 )
 
+// Defines values for ImageFormat.
+const (
+	Jpeg ImageFormat = "jpeg"
+	Png  ImageFormat = "png"
+	Webp ImageFormat = "webp"
+)
+
+// Defines values for ImageStatus.
+const (
+	ImageStatusCompleted  ImageStatus = "completed"
+	ImageStatusExpired    ImageStatus = "expired"
+	ImageStatusFailed     ImageStatus = "failed"
+	ImageStatusPending    ImageStatus = "pending"
+	ImageStatusProcessing ImageStatus = "processing"
+)
+
+// Defines values for ImageRenditionKind.
+const (
+	Original  ImageRenditionKind = "original"
+	Processed ImageRenditionKind = "processed"
+)
+
+// Defines values for ListSort.
+const (
+	CreatedAt      ListSort = "created_at"
+	MinusCreatedAt ListSort = "-created_at"
+)
+
+// Defines values for ProcessingOptionsPlacement.
+const (
+	Auto  ProcessingOptionsPlacement = "auto"
+	Hand  ProcessingOptionsPlacement = "hand"
+	Left  ProcessingOptionsPlacement = "left"
+	Right ProcessingOptionsPlacement = "right"
+	Table ProcessingOptionsPlacement = "table"
+)
+
+// Defines values for ResultDelivery.
+const (
+	Proxy    ResultDelivery = "proxy"
+	Redirect ResultDelivery = "redirect"
+)
+
+// Defines values for ResumableUploadStatus.
+const (
+	ResumableUploadStatusCompleted ResumableUploadStatus = "completed"
+	ResumableUploadStatusExpired   ResumableUploadStatus = "expired"
+	ResumableUploadStatusPending   ResumableUploadStatus = "pending"
+)
+
+// Defines values for TaskPriority.
+const (
+	Bulk        TaskPriority = "bulk"
+	Interactive TaskPriority = "interactive"
+	Normal      TaskPriority = "normal"
+)
+
+// Defines values for TaskStatus.
+const (
+	TaskStatusCompleted  TaskStatus = "completed"
+	TaskStatusFailed     TaskStatus = "failed"
+	TaskStatusPending    TaskStatus = "pending"
+	TaskStatusProcessing TaskStatus = "processing"
+)
+
+// BottleAsset Bottle overlay from the catalog
+type BottleAsset struct {
+	AnchorX float64 `json:"anchor_x"`
+	AnchorY float64 `json:"anchor_y"`
+
+	// AspectRatio Natural width to height ratio
+	AspectRatio float64   `json:"aspect_ratio"`
+	CreatedAt   time.Time `json:"created_at"`
+	Enabled     bool      `json:"enabled"`
+
+	// Format Image format detected from the file content
+	Format        ImageFormat        `json:"format"`
+	Height        int                `json:"height"`
+	Id            openapi_types.UUID `json:"id"`
+	Name          string             `json:"name"`
+	ShadowBlur    float64            `json:"shadow_blur"`
+	ShadowOffsetX float64            `json:"shadow_offset_x"`
+	ShadowOffsetY float64            `json:"shadow_offset_y"`
+	ShadowOpacity float64            `json:"shadow_opacity"`
+	Style         string             `json:"style"`
+	UpdatedAt     time.Time          `json:"updated_at"`
+
+	// Url Temporary URL of the overlay, generated per request (null if storage uses SSE-C)
+	Url *string `json:"url"`
+
+	// Version Incremented each time the overlay is replaced
+	Version int `json:"version"`
+	Width   int `json:"width"`
+}
+
+// BottleAssetMetadata Placement metadata of a bottle overlay, relative to the overlay size
+type BottleAssetMetadata struct {
+	// AnchorX Horizontal point of the overlay placed at the target position
+	AnchorX *float64 `json:"anchor_x,omitempty"`
+
+	// AnchorY Vertical point of the overlay placed at the target position (the bottle base by default)
+	AnchorY       *float64 `json:"anchor_y,omitempty"`
+	Name          string   `json:"name"`
+	ShadowBlur    *float64 `json:"shadow_blur,omitempty"`
+	ShadowOffsetX *float64 `json:"shadow_offset_x,omitempty"`
+	ShadowOffsetY *float64 `json:"shadow_offset_y,omitempty"`
+	ShadowOpacity *float64 `json:"shadow_opacity,omitempty"`
+	Style         string   `json:"style"`
+}
+
+// BottlePosition Explicit bottle anchor relative to the image size, (0, 0) is the top-left corner
+type BottlePosition struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// CreateUploadRequest Declared file of a direct upload
+type CreateUploadRequest struct {
+	// ContentType Content-Type the file will be PUT with
+	ContentType CreateUploadRequestContentType `json:"content_type"`
+
+	// Options Bottle compositing options. All fields are optional, omitted fields are chosen by the worker.
+	// Identical uploads with identical options are deduplicated.
+	Options *ProcessingOptions `json:"options,omitempty"`
+
+	// Priority Processing lane of the task. Defaults to the tier of the API key (normal without a key).
+	// A client may request a lower priority than its tier, never a higher one.
+	Priority *TaskPriority `json:"priority,omitempty"`
+
+	// Size Exact size of the file in bytes, at most the upload limit
+	Size int64 `json:"size"`
+}
+
+// CreateUploadRequestContentType Content-Type the file will be PUT with
+type CreateUploadRequestContentType string
+
+// CreateUploadResponse Created direct upload
+type CreateUploadResponse struct {
+	// ExpiresAt The upload must be completed by this time
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// Headers Headers the upload request must send as is
+	Headers map[string]string `json:"headers"`
+
+	// Method HTTP method of the upload request
+	Method string `json:"method"`
+
+	// UploadId Upload ID to complete the upload with
+	UploadId openapi_types.UUID `json:"upload_id"`
+
+	// UploadUrl Presigned URL to PUT the file to
+	UploadUrl string `json:"upload_url"`
+
+	// UrlExpiresAt The upload URL stops working at this time
+	UrlExpiresAt time.Time `json:"url_expires_at"`
+}
+
 // Error Ошибка API
 type Error struct {
 	// Code Код ошибки
@@ -63,11 +228,23 @@ type Error struct {
 
 // GetImageResponse Метаданные изображения
 type GetImageResponse struct {
-	CreatedAt    time.Time              `json:"created_at"`
-	Id           openapi_types.UUID     `json:"id"`
-	OriginalUrl  string                 `json:"original_url"`
-	ProcessedUrl *string                `json:"processed_url"`
-	Status       GetImageResponseStatus `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Format Image format detected from the file content
+	Format ImageFormat        `json:"format"`
+	Height int                `json:"height"`
+	Id     openapi_types.UUID `json:"id"`
+
+	// OriginalUrl Temporary URL of the original image, generated per request (null once retention deleted it, or if storage uses SSE-C)
+	OriginalUrl *string `json:"original_url"`
+
+	// ProcessedUrl Temporary URL of the processed image, generated per request (null if not processed yet, expired, or if storage uses SSE-C)
+	ProcessedUrl *string `json:"processed_url"`
+
+	// Renditions Downscaled copies of the original and processed images
+	Renditions []ImageRendition       `json:"renditions"`
+	Status     GetImageResponseStatus `json:"status"`
+	Width      int                    `json:"width"`
 }
 
 // GetImageResponseStatus defines model for GetImageResponse.Status.
@@ -75,11 +252,26 @@ type GetImageResponseStatus string
 
 // GetTaskResponse Информация о задаче обработки
 type GetTaskResponse struct {
-	CreatedAt    time.Time             `json:"created_at"`
-	ErrorMessage *string               `json:"error_message"`
-	Id           openapi_types.UUID    `json:"id"`
-	ImageId      openapi_types.UUID    `json:"image_id"`
-	Status       GetTaskResponseStatus `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	ErrorMessage *string   `json:"error_message"`
+
+	// EstimatedWaitSeconds Estimated wait of a pending task before processing starts, from the recent throughput of its lane.
+	// Omitted when no task of the lane finished recently.
+	EstimatedWaitSeconds *int               `json:"estimated_wait_seconds,omitempty"`
+	Id                   openapi_types.UUID `json:"id"`
+	ImageId              openapi_types.UUID `json:"image_id"`
+
+	// Options Bottle compositing options. All fields are optional, omitted fields are chosen by the worker.
+	// Identical uploads with identical options are deduplicated.
+	Options *ProcessingOptions `json:"options,omitempty"`
+
+	// Priority Processing lane of the task. Defaults to the tier of the API key (normal without a key).
+	// A client may request a lower priority than its tier, never a higher one.
+	Priority *TaskPriority `json:"priority,omitempty"`
+
+	// QueuePosition Place of a pending task in its lane, 1 is next
+	QueuePosition *int                  `json:"queue_position,omitempty"`
+	Status        GetTaskResponseStatus `json:"status"`
 }
 
 // GetTaskResponseStatus defines model for GetTaskResponse.Status.
@@ -93,6 +285,9 @@ type HealthResponse struct {
 	// Postgres Статус подключения к PostgreSQL
 	Postgres *HealthResponsePostgres `json:"postgres,omitempty"`
 
+	// QueueDepth Number of tasks waiting in each priority lane
+	QueueDepth *QueueLaneDepth `json:"queue_depth,omitempty"`
+
 	// Rabbitmq Статус подключения к RabbitMQ
 	Rabbitmq *HealthResponseRabbitmq `json:"rabbitmq,omitempty"`
 
@@ -112,8 +307,244 @@ type HealthResponseRabbitmq string
 // HealthResponseStatus Общий статус сервиса
 type HealthResponseStatus string
 
+// Image Image entity
+type Image struct {
+	// ClientId ID of the client that uploaded the image first, derived from its API key (null without a known key)
+	ClientId *string `json:"client_id,omitempty"`
+
+	// CreatedAt Creation date and time
+	CreatedAt time.Time `json:"created_at"`
+
+	// Format Image format detected from the file content
+	Format *ImageFormat `json:"format,omitempty"`
+
+	// Height Image height in pixels
+	Height *int `json:"height,omitempty"`
+
+	// Id Unique image identifier
+	Id openapi_types.UUID `json:"id"`
+
+	// OriginalUrl Temporary URL of the original image, generated per request (null once retention deleted it, or if storage uses SSE-C)
+	OriginalUrl *string `json:"original_url"`
+
+	// ProcessedUrl Temporary URL of the processed image, generated per request (null if not processed yet, expired, or if storage uses SSE-C)
+	ProcessedUrl *string `json:"processed_url,omitempty"`
+
+	// Status Image status (`expired` once retention deleted its files)
+	Status ImageStatus `json:"status"`
+
+	// UpdatedAt Last update date and time
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Width Image width in pixels
+	Width *int `json:"width,omitempty"`
+}
+
+// ImageFormat Image format detected from the file content
+type ImageFormat string
+
+// ImageRendition Downscaled copy of an image
+type ImageRendition struct {
+	// Format Image format detected from the file content
+	Format ImageFormat `json:"format"`
+	Height int         `json:"height"`
+
+	// Kind Which image the rendition was made from
+	Kind ImageRenditionKind `json:"kind"`
+
+	// Size Requested maximum width or height in pixels
+	Size int `json:"size"`
+
+	// TaskId Task whose processed result the rendition was made from, only set for processed renditions
+	TaskId *openapi_types.UUID `json:"task_id,omitempty"`
+
+	// Url Temporary URL of the rendition, generated per request (null if storage uses SSE-C)
+	Url   *string `json:"url"`
+	Width int     `json:"width"`
+}
+
+// ImageRenditionKind Which image the rendition was made from
+type ImageRenditionKind string
+
+// ImageStatus Image status (`expired` once retention deleted its files)
+type ImageStatus string
+
+// ListBottlesResponse defines model for ListBottlesResponse.
+type ListBottlesResponse struct {
+	Items []BottleAsset `json:"items"`
+}
+
+// ListImagesResponse defines model for ListImagesResponse.
+type ListImagesResponse struct {
+	Items []Image `json:"items"`
+
+	// NextCursor Cursor of the next page, null on the last page
+	NextCursor *string `json:"next_cursor"`
+}
+
+// ListSort Listing order by creation time, `-` for descending
+type ListSort string
+
+// ListTasksResponse defines model for ListTasksResponse.
+type ListTasksResponse struct {
+	Items []ProcessingTask `json:"items"`
+
+	// NextCursor Cursor of the next page, null on the last page
+	NextCursor *string `json:"next_cursor"`
+}
+
+// ProcessingOptions Bottle compositing options. All fields are optional, omitted fields are chosen by the worker.
+// Identical uploads with identical options are deduplicated.
+type ProcessingOptions struct {
+	// BottleStyle Bottle style slug from the bottle catalog
+	BottleStyle *string `json:"bottle_style,omitempty"`
+
+	// Count Number of bottles to add
+	Count *int `json:"count,omitempty"`
+
+	// Placement Placement hint, cannot be combined with position
+	Placement *ProcessingOptionsPlacement `json:"placement,omitempty"`
+
+	// Position Explicit bottle anchor relative to the image size, (0, 0) is the top-left corner
+	Position *BottlePosition `json:"position,omitempty"`
+
+	// Rotation Clockwise rotation in degrees
+	Rotation *float64 `json:"rotation,omitempty"`
+
+	// Scale Bottle size relative to its natural size in the scene
+	Scale *float64 `json:"scale,omitempty"`
+}
+
+// ProcessingOptionsPlacement Placement hint, cannot be combined with position
+type ProcessingOptionsPlacement string
+
+// ProcessingTask Image processing task entity
+type ProcessingTask struct {
+	// ClientId ID of the client that requested the task, derived from its API key (null without a known key)
+	ClientId *string `json:"client_id,omitempty"`
+
+	// CreatedAt Creation date and time
+	CreatedAt time.Time `json:"created_at"`
+
+	// ErrorMessage Error message (if status is failed)
+	ErrorMessage *string `json:"error_message,omitempty"`
+
+	// Id Unique task identifier
+	Id openapi_types.UUID `json:"id"`
+
+	// ImageId Associated image ID
+	ImageId openapi_types.UUID `json:"image_id"`
+
+	// Options Bottle compositing options. All fields are optional, omitted fields are chosen by the worker.
+	// Identical uploads with identical options are deduplicated.
+	Options *ProcessingOptions `json:"options,omitempty"`
+
+	// Priority Processing lane of the task. Defaults to the tier of the API key (normal without a key).
+	// A client may request a lower priority than its tier, never a higher one.
+	Priority *TaskPriority `json:"priority,omitempty"`
+
+	// Status Task processing status
+	Status TaskStatus `json:"status"`
+
+	// UpdatedAt Last update date and time
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// QueueLaneDepth Number of tasks waiting in each priority lane
+type QueueLaneDepth struct {
+	Bulk        int `json:"bulk"`
+	Interactive int `json:"interactive"`
+	Normal      int `json:"normal"`
+}
+
+// QueueLaneStats Backlog of one priority lane
+type QueueLaneStats struct {
+	Consumers int `json:"consumers"`
+
+	// EstimatedWaitSeconds Estimated wait of a task uploaded now, omitted when no task of the lane finished recently
+	EstimatedWaitSeconds *int `json:"estimated_wait_seconds,omitempty"`
+
+	// Ready Tasks waiting for a worker
+	Ready int `json:"ready"`
+
+	// ThroughputPerMinute Tasks of the lane finished per minute
+	ThroughputPerMinute float64 `json:"throughput_per_minute"`
+
+	// Unacked Tasks handed to consumers of the API process and not yet acknowledged
+	Unacked int `json:"unacked"`
+}
+
+// QueueStats Processing queue stats
+type QueueStats struct {
+	// DeadLetters Messages in the dead-letter queue
+	DeadLetters int `json:"dead_letters"`
+	Lanes       struct {
+		// Bulk Backlog of one priority lane
+		Bulk QueueLaneStats `json:"bulk"`
+
+		// Interactive Backlog of one priority lane
+		Interactive QueueLaneStats `json:"interactive"`
+
+		// Normal Backlog of one priority lane
+		Normal QueueLaneStats `json:"normal"`
+	} `json:"lanes"`
+
+	// Processing Tasks being processed by any worker
+	Processing int `json:"processing"`
+
+	// ThroughputWindowSeconds Window the throughput is measured over
+	ThroughputWindowSeconds int `json:"throughput_window_seconds"`
+}
+
+// ResultDelivery Delivery of a task result: `redirect` to a presigned storage URL or
+// `proxy` through the backend
+type ResultDelivery string
+
+// ResumableUpload State of a resumable upload
+type ResumableUpload struct {
+	// ChunkSize Size of every chunk but the last
+	ChunkSize int64 `json:"chunk_size"`
+
+	// Deduplicated True if identical content was uploaded before and the existing image and task were returned
+	Deduplicated *bool `json:"deduplicated,omitempty"`
+
+	// ExpiresAt The upload expires unless a chunk arrives before this time
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// ImageId Created image ID, once completed
+	ImageId *openapi_types.UUID `json:"image_id,omitempty"`
+
+	// Offset Bytes stored so far, the offset of the next chunk
+	Offset int64 `json:"offset"`
+
+	// Size Declared size of the file in bytes
+	Size int64 `json:"size"`
+
+	// Status Upload status
+	Status ResumableUploadStatus `json:"status"`
+
+	// TaskId Created processing task ID, once completed
+	TaskId *openapi_types.UUID `json:"task_id,omitempty"`
+
+	// UploadId Upload ID
+	UploadId openapi_types.UUID `json:"upload_id"`
+}
+
+// ResumableUploadStatus Upload status
+type ResumableUploadStatus string
+
+// TaskPriority Processing lane of the task. Defaults to the tier of the API key (normal without a key).
+// A client may request a lower priority than its tier, never a higher one.
+type TaskPriority string
+
+// TaskStatus Task processing status
+type TaskStatus string
+
 // UploadImageResponse Ответ на запрос загрузки изображения
 type UploadImageResponse struct {
+	// Deduplicated True if identical content was uploaded before and the existing image and task were returned
+	Deduplicated bool `json:"deduplicated"`
+
 	// ImageId ID созданного изображения
 	ImageId openapi_types.UUID `json:"image_id"`
 
@@ -121,11 +552,134 @@ type UploadImageResponse struct {
 	TaskId openapi_types.UUID `json:"task_id"`
 }
 
+// AppendUploadChunkParams defines parameters for AppendUploadChunk.
+type AppendUploadChunkParams struct {
+	// UploadOffset Offset of the chunk in the file
+	UploadOffset int64 `json:"Upload-Offset"`
+}
+
+// CreateResumableUploadParams defines parameters for CreateResumableUpload.
+type CreateResumableUploadParams struct {
+	// XAPIKey API key of the client. Its tier caps the priority the task may be queued with, and the image and task record the client ID derived from it.
+	XAPIKey *string `json:"X-API-Key,omitempty"`
+}
+
+// CreateUploadParams defines parameters for CreateUpload.
+type CreateUploadParams struct {
+	// XAPIKey API key of the client. Its tier caps the priority the task may be queued with, and the image and task record the client ID derived from it.
+	XAPIKey *string `json:"X-API-Key,omitempty"`
+}
+
+// GetTaskResultParams defines parameters for GetTaskResult.
+type GetTaskResultParams struct {
+	// Format Output format, overrides Accept header negotiation
+	Format *ImageFormat `form:"format,omitempty" json:"format,omitempty"`
+
+	// Quality JPEG quality (ignored for PNG and WebP, which are lossless)
+	Quality *int `form:"quality,omitempty" json:"quality,omitempty"`
+
+	// MaxDimension Maximum width or height in pixels, the image is never upscaled
+	MaxDimension *int `form:"max_dimension,omitempty" json:"max_dimension,omitempty"`
+
+	// Delivery How the image is served, overrides the configured default
+	Delivery *ResultDelivery `form:"delivery,omitempty" json:"delivery,omitempty"`
+
+	// Range A single byte range (`bytes=0-1023`, `bytes=1024-`, `bytes=-512`), honoured
+	// with proxy delivery. Multiple or malformed ranges return the whole image.
+	Range *string `json:"Range,omitempty"`
+}
+
+// ListImagesParams defines parameters for ListImages.
+type ListImagesParams struct {
+	// XAPIKey API key of the client. Required once API keys are configured, and then only the images of the client it identifies are listed.
+	XAPIKey *string `json:"X-API-Key,omitempty"`
+
+	// Status Only return items in this status
+	Status *ImageStatus `form:"status,omitempty" json:"status,omitempty"`
+
+	// ClientId Only return images uploaded by this client, including deduplicated uploads
+	ClientId *string `form:"client_id,omitempty" json:"client_id,omitempty"`
+
+	// CreatedAfter Only return items created at or after this time
+	CreatedAfter *time.Time `form:"created_after,omitempty" json:"created_after,omitempty"`
+
+	// CreatedBefore Only return items created before this time
+	CreatedBefore *time.Time `form:"created_before,omitempty" json:"created_before,omitempty"`
+
+	// Sort Order by creation time, ascending (`created_at`) or descending (`-created_at`)
+	Sort *ListSort `form:"sort,omitempty" json:"sort,omitempty"`
+
+	// Limit Maximum number of items in the page
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor The `next_cursor` of the previous page
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+}
+
+// ListTasksParams defines parameters for ListTasks.
+type ListTasksParams struct {
+	// XAPIKey API key of the client. Required once API keys are configured, and then only the tasks of the client it identifies are listed.
+	XAPIKey *string `json:"X-API-Key,omitempty"`
+
+	// Status Only return items in this status
+	Status *TaskStatus `form:"status,omitempty" json:"status,omitempty"`
+
+	// ClientId Only return items created by this client, see `client_id` of the items
+	ClientId *string `form:"client_id,omitempty" json:"client_id,omitempty"`
+
+	// CreatedAfter Only return items created at or after this time
+	CreatedAfter *time.Time `form:"created_after,omitempty" json:"created_after,omitempty"`
+
+	// CreatedBefore Only return items created before this time
+	CreatedBefore *time.Time `form:"created_before,omitempty" json:"created_before,omitempty"`
+
+	// Sort Order by creation time, ascending (`created_at`) or descending (`-created_at`)
+	Sort *ListSort `form:"sort,omitempty" json:"sort,omitempty"`
+
+	// Limit Maximum number of items in the page
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+
+	// Cursor The `next_cursor` of the previous page
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+}
+
+// UploadImageParams defines parameters for UploadImage.
+type UploadImageParams struct {
+	// XAPIKey API key of the client. Its tier caps the priority the task may be queued with, and the image and task record the client ID derived from it.
+	XAPIKey *string `json:"X-API-Key,omitempty"`
+}
+
+// AdminUploadBottleMultipartBody defines parameters for AdminUploadBottle.
+type AdminUploadBottleMultipartBody struct {
+	// File Overlay with transparency (PNG, WebP)
+	File openapi_types.File `json:"file"`
+
+	// Metadata Placement metadata of a bottle overlay, relative to the overlay size
+	Metadata BottleAssetMetadata `json:"metadata"`
+}
+
 // UploadImageMultipartBody defines parameters for UploadImage.
 type UploadImageMultipartBody struct {
 	// File Файл изображения (JPEG, PNG, WebP)
 	File openapi_types.File `json:"file"`
+
+	// Options Bottle compositing options. All fields are optional, omitted fields are chosen by the worker.
+	// Identical uploads with identical options are deduplicated.
+	Options *ProcessingOptions `json:"options,omitempty"`
+
+	// Priority Processing lane of the task. Defaults to the tier of the API key (normal without a key).
+	// A client may request a lower priority than its tier, never a higher one.
+	Priority *TaskPriority `json:"priority,omitempty"`
 }
 
+// AdminUploadBottleMultipartRequestBody defines body for AdminUploadBottle for multipart/form-data ContentType.
+type AdminUploadBottleMultipartRequestBody AdminUploadBottleMultipartBody
+
+// CreateResumableUploadJSONRequestBody defines body for CreateResumableUpload for application/json ContentType.
+type CreateResumableUploadJSONRequestBody = CreateUploadRequest
+
+// CreateUploadJSONRequestBody defines body for CreateUpload for application/json ContentType.
+type CreateUploadJSONRequestBody = CreateUploadRequest
+
 // UploadImageMultipartRequestBody defines body for UploadImage for multipart/form-data ContentType.
 type UploadImageMultipartRequestBody UploadImageMultipartBody
@@ -0,0 +1,34 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+)
+
+// Encode writes the image in the given format. Quality only applies to JPEG;
+// WebP is always encoded losslessly as there is no pure Go lossy encoder.
+func Encode(img image.Image, format Format, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	var err error
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	case FormatWebP:
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s image: %w", format, err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,512 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidExif = errors.New("invalid EXIF data")
+
+type exifIFD string
+
+const (
+	ifd0    exifIFD = "ifd0"
+	ifdExif exifIFD = "exif"
+	ifdGPS  exifIFD = "gps"
+)
+
+const (
+	tagOrientation   uint16 = 0x0112
+	tagMakerNote     uint16 = 0x927C
+	tagExifIFDPtr    uint16 = 0x8769
+	tagGPSIFDPtr     uint16 = 0x8825
+	tagInteropIFDPtr uint16 = 0xA005
+)
+
+const (
+	tiffHeaderLen  = 8
+	ifdEntryLen    = 12
+	maxIFDEntries  = 1024
+	inlineValueLen = 4
+)
+
+const (
+	exifTypeByte      uint16 = 1
+	exifTypeASCII     uint16 = 2
+	exifTypeShort     uint16 = 3
+	exifTypeLong      uint16 = 4
+	exifTypeRational  uint16 = 5
+	exifTypeSByte     uint16 = 6
+	exifTypeUndefined uint16 = 7
+	exifTypeSShort    uint16 = 8
+	exifTypeSLong     uint16 = 9
+	exifTypeSRational uint16 = 10
+	exifTypeFloat     uint16 = 11
+	exifTypeDouble    uint16 = 12
+)
+
+//nolint:gochecknoglobals // read-only lookup table
+var exifTypeSizes = map[uint16]int{
+	exifTypeByte:      1,
+	exifTypeASCII:     1,
+	exifTypeShort:     2,
+	exifTypeLong:      4,
+	exifTypeRational:  8,
+	exifTypeSByte:     1,
+	exifTypeUndefined: 1,
+	exifTypeSShort:    2,
+	exifTypeSLong:     4,
+	exifTypeSRational: 8,
+	exifTypeFloat:     4,
+	exifTypeDouble:    8,
+}
+
+//nolint:gochecknoglobals // read-only lookup table
+var exifTagNames = map[exifIFD]map[uint16]string{
+	ifd0: {
+		0x010E: "ImageDescription",
+		0x010F: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x011A: "XResolution",
+		0x011B: "YResolution",
+		0x0128: "ResolutionUnit",
+		0x0131: "Software",
+		0x0132: "DateTime",
+		0x013B: "Artist",
+		0x013E: "WhitePoint",
+		0x013F: "PrimaryChromaticities",
+		0x0211: "YCbCrCoefficients",
+		0x0213: "YCbCrPositioning",
+		0x8298: "Copyright",
+		0x8769: "ExifIFDPointer",
+		0x8825: "GPSInfoIFDPointer",
+	},
+	ifdExif: {
+		0x829A: "ExposureTime",
+		0x829D: "FNumber",
+		0x8822: "ExposureProgram",
+		0x8827: "ISOSpeedRatings",
+		0x9000: "ExifVersion",
+		0x9003: "DateTimeOriginal",
+		0x9004: "DateTimeDigitized",
+		0x9010: "OffsetTime",
+		0x9011: "OffsetTimeOriginal",
+		0x9101: "ComponentsConfiguration",
+		0x9201: "ShutterSpeedValue",
+		0x9202: "ApertureValue",
+		0x9203: "BrightnessValue",
+		0x9204: "ExposureBiasValue",
+		0x9205: "MaxApertureValue",
+		0x9207: "MeteringMode",
+		0x9208: "LightSource",
+		0x9209: "Flash",
+		0x920A: "FocalLength",
+		0x927C: "MakerNote",
+		0x9286: "UserComment",
+		0x9290: "SubSecTime",
+		0x9291: "SubSecTimeOriginal",
+		0x9292: "SubSecTimeDigitized",
+		0xA000: "FlashpixVersion",
+		0xA001: "ColorSpace",
+		0xA002: "PixelXDimension",
+		0xA003: "PixelYDimension",
+		0xA005: "InteroperabilityIFDPointer",
+		0xA217: "SensingMethod",
+		0xA401: "CustomRendered",
+		0xA402: "ExposureMode",
+		0xA403: "WhiteBalance",
+		0xA404: "DigitalZoomRatio",
+		0xA405: "FocalLengthIn35mmFilm",
+		0xA406: "SceneCaptureType",
+		0xA420: "ImageUniqueID",
+		0xA430: "CameraOwnerName",
+		0xA431: "BodySerialNumber",
+		0xA432: "LensSpecification",
+		0xA433: "LensMake",
+		0xA434: "LensModel",
+		0xA435: "LensSerialNumber",
+	},
+	ifdGPS: {
+		0x0000: "GPSVersionID",
+		0x0001: "GPSLatitudeRef",
+		0x0002: "GPSLatitude",
+		0x0003: "GPSLongitudeRef",
+		0x0004: "GPSLongitude",
+		0x0005: "GPSAltitudeRef",
+		0x0006: "GPSAltitude",
+		0x0007: "GPSTimeStamp",
+		0x0010: "GPSImgDirectionRef",
+		0x0011: "GPSImgDirection",
+		0x0012: "GPSMapDatum",
+		0x001D: "GPSDateStamp",
+	},
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// exifEntry is a single raw IFD entry. The value is kept in the byte order
+// of the source TIFF block so it can be written back unchanged.
+type exifEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// Exif is a parsed TIFF/EXIF block. Only IFD0, the Exif sub-IFD and the GPS
+// sub-IFD are read; thumbnails (IFD1) and maker notes are not interpreted.
+type Exif struct {
+	order byteOrder
+	ifds  map[exifIFD][]exifEntry
+}
+
+// ParseExif parses a raw TIFF block as found in a JPEG APP1 segment (after
+// the "Exif\x00\x00" prefix), a PNG eXIf chunk or a WebP EXIF chunk.
+func ParseExif(data []byte) (*Exif, error) {
+	if len(data) < tiffHeaderLen {
+		return nil, ErrInvalidExif
+	}
+
+	var order byteOrder
+	switch {
+	case data[0] == 'I' && data[1] == 'I':
+		order = binary.LittleEndian
+	case data[0] == 'M' && data[1] == 'M':
+		order = binary.BigEndian
+	default:
+		return nil, ErrInvalidExif
+	}
+
+	const tiffMagic = 42
+	if order.Uint16(data[2:4]) != tiffMagic {
+		return nil, ErrInvalidExif
+	}
+
+	x := &Exif{
+		order: order,
+		ifds:  make(map[exifIFD][]exifEntry),
+	}
+
+	entries, err := x.readIFD(data, order.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	x.ifds[ifd0] = entries
+
+	for _, sub := range []struct {
+		pointer uint16
+		ifd     exifIFD
+	}{
+		{tagExifIFDPtr, ifdExif},
+		{tagGPSIFDPtr, ifdGPS},
+	} {
+		offset, ok := x.pointer(ifd0, sub.pointer)
+		if !ok {
+			continue
+		}
+		// A broken sub-IFD should not prevent reading the rest of the block.
+		if subEntries, subErr := x.readIFD(data, offset); subErr == nil {
+			x.ifds[sub.ifd] = subEntries
+		}
+	}
+
+	return x, nil
+}
+
+func (x *Exif) readIFD(data []byte, offset uint32) ([]exifEntry, error) {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: IFD offset out of range", ErrInvalidExif)
+	}
+
+	count := int(x.order.Uint16(data[offset:]))
+	if count > maxIFDEntries {
+		return nil, fmt.Errorf("%w: too many IFD entries", ErrInvalidExif)
+	}
+
+	start := int(offset) + 2
+	if start+count*ifdEntryLen > len(data) {
+		return nil, fmt.Errorf("%w: IFD entries out of range", ErrInvalidExif)
+	}
+
+	entries := make([]exifEntry, 0, count)
+	for i := range count {
+		raw := data[start+i*ifdEntryLen : start+(i+1)*ifdEntryLen]
+		entry := exifEntry{
+			tag:   x.order.Uint16(raw[0:2]),
+			typ:   x.order.Uint16(raw[2:4]),
+			count: x.order.Uint32(raw[4:8]),
+		}
+
+		size, ok := exifTypeSizes[entry.typ]
+		if !ok {
+			continue
+		}
+
+		length := uint64(size) * uint64(entry.count)
+		if length <= inlineValueLen {
+			entry.value = slices.Clone(raw[8 : 8+length])
+		} else {
+			valueOffset := uint64(x.order.Uint32(raw[8:12]))
+			if valueOffset+length > uint64(len(data)) {
+				continue
+			}
+			entry.value = slices.Clone(data[valueOffset : valueOffset+length])
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (x *Exif) find(ifd exifIFD, tag uint16) (exifEntry, bool) {
+	for _, entry := range x.ifds[ifd] {
+		if entry.tag == tag {
+			return entry, true
+		}
+	}
+	return exifEntry{}, false
+}
+
+func (x *Exif) pointer(ifd exifIFD, tag uint16) (uint32, bool) {
+	entry, ok := x.find(ifd, tag)
+	if !ok || entry.typ != exifTypeLong || entry.count != 1 {
+		return 0, false
+	}
+	return x.order.Uint32(entry.value), true
+}
+
+// Orientation returns the EXIF orientation (1-8), or 1 if it is missing or invalid.
+func (x *Exif) Orientation() Orientation {
+	entry, ok := x.find(ifd0, tagOrientation)
+	if !ok || entry.typ != exifTypeShort || entry.count < 1 {
+		return OrientationNormal
+	}
+
+	orientation := Orientation(x.order.Uint16(entry.value))
+	if !orientation.IsValid() {
+		return OrientationNormal
+	}
+	return orientation
+}
+
+// Map returns a JSON-friendly representation of all readable tags grouped by IFD.
+func (x *Exif) Map() map[string]any {
+	result := make(map[string]any, len(x.ifds))
+	for ifd, entries := range x.ifds {
+		tags := make(map[string]any, len(entries))
+		for _, entry := range entries {
+			// Maker notes are large vendor-specific blobs that are not worth keeping.
+			if isPointerTag(entry.tag) || entry.tag == tagMakerNote {
+				continue
+			}
+			tags[tagName(ifd, entry.tag)] = x.decodeValue(entry)
+		}
+		if len(tags) > 0 {
+			result[string(ifd)] = tags
+		}
+	}
+	return result
+}
+
+// Filter returns a copy that keeps only the IFD0 and Exif sub-IFD tags whose
+// names are in the allowlist. GPS data and the orientation tag are always
+// dropped, as is everything the parser does not understand.
+func (x *Exif) Filter(allowlist []string) *Exif {
+	allowed := make(map[string]struct{}, len(allowlist))
+	for _, name := range allowlist {
+		allowed[strings.TrimSpace(name)] = struct{}{}
+	}
+
+	filtered := &Exif{
+		order: x.order,
+		ifds:  make(map[exifIFD][]exifEntry),
+	}
+
+	for _, ifd := range []exifIFD{ifd0, ifdExif} {
+		for _, entry := range x.ifds[ifd] {
+			if isPointerTag(entry.tag) || entry.tag == tagOrientation {
+				continue
+			}
+			if _, ok := allowed[tagName(ifd, entry.tag)]; !ok {
+				continue
+			}
+			filtered.ifds[ifd] = append(filtered.ifds[ifd], entry)
+		}
+	}
+
+	return filtered
+}
+
+// IsEmpty reports whether the block has no tags left.
+func (x *Exif) IsEmpty() bool {
+	for _, entries := range x.ifds {
+		if len(entries) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode serialises IFD0 and the Exif sub-IFD into a standalone TIFF block.
+// The GPS sub-IFD is never written.
+func (x *Exif) Encode() []byte {
+	// Pointers read from the source point into it and are rewritten below.
+	main := slices.DeleteFunc(slices.Clone(x.ifds[ifd0]), func(entry exifEntry) bool {
+		return isPointerTag(entry.tag)
+	})
+	sub := slices.DeleteFunc(slices.Clone(x.ifds[ifdExif]), func(entry exifEntry) bool {
+		return isPointerTag(entry.tag)
+	})
+
+	if len(sub) > 0 {
+		// The real offset is patched in once the IFD0 size is known.
+		main = append(main, exifEntry{tag: tagExifIFDPtr, typ: exifTypeLong, count: 1, value: make([]byte, inlineValueLen)})
+	}
+
+	slices.SortFunc(main, func(a, b exifEntry) int { return int(a.tag) - int(b.tag) })
+	slices.SortFunc(sub, func(a, b exifEntry) int { return int(a.tag) - int(b.tag) })
+
+	var buf bytes.Buffer
+	if x.order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	buf.Write(x.order.AppendUint16(nil, 42))
+	buf.Write(x.order.AppendUint32(nil, tiffHeaderLen))
+
+	mainOffset := uint32(tiffHeaderLen)
+	subOffset := mainOffset + ifdSize(main)
+	dataOffset := subOffset
+	if len(sub) > 0 {
+		dataOffset += ifdSize(sub)
+	}
+
+	for i := range main {
+		if main[i].tag == tagExifIFDPtr {
+			main[i].value = x.order.AppendUint32(nil, subOffset)
+		}
+	}
+
+	var data bytes.Buffer
+	x.writeIFD(&buf, &data, main, dataOffset)
+	if len(sub) > 0 {
+		x.writeIFD(&buf, &data, sub, dataOffset)
+	}
+	buf.Write(data.Bytes())
+
+	return buf.Bytes()
+}
+
+func (x *Exif) writeIFD(buf, data *bytes.Buffer, entries []exifEntry, dataOffset uint32) {
+	buf.Write(x.order.AppendUint16(nil, uint16(len(entries))))
+	for _, entry := range entries {
+		buf.Write(x.order.AppendUint16(nil, entry.tag))
+		buf.Write(x.order.AppendUint16(nil, entry.typ))
+		buf.Write(x.order.AppendUint32(nil, entry.count))
+
+		if len(entry.value) <= inlineValueLen {
+			inline := make([]byte, inlineValueLen)
+			copy(inline, entry.value)
+			buf.Write(inline)
+			continue
+		}
+
+		buf.Write(x.order.AppendUint32(nil, dataOffset+uint32(data.Len())))
+		data.Write(entry.value)
+		if data.Len()%2 != 0 {
+			data.WriteByte(0)
+		}
+	}
+	buf.Write(x.order.AppendUint32(nil, 0)) // no next IFD
+}
+
+func ifdSize(entries []exifEntry) uint32 {
+	return uint32(2 + len(entries)*ifdEntryLen + inlineValueLen)
+}
+
+func (x *Exif) decodeValue(entry exifEntry) any {
+	switch entry.typ {
+	case exifTypeASCII:
+		return strings.TrimRight(string(entry.value), "\x00 ")
+	case exifTypeShort, exifTypeLong, exifTypeSShort, exifTypeSLong, exifTypeByte, exifTypeSByte:
+		return collapse(x.integers(entry))
+	case exifTypeRational, exifTypeSRational:
+		return collapse(x.rationals(entry))
+	case exifTypeUndefined, exifTypeFloat, exifTypeDouble:
+		return fmt.Sprintf("%X", entry.value)
+	default:
+		return nil
+	}
+}
+
+func (x *Exif) integers(entry exifEntry) []int64 {
+	size := exifTypeSizes[entry.typ]
+	values := make([]int64, 0, entry.count)
+	for i := 0; i+size <= len(entry.value); i += size {
+		raw := entry.value[i : i+size]
+		switch entry.typ {
+		case exifTypeShort:
+			values = append(values, int64(x.order.Uint16(raw)))
+		case exifTypeSShort:
+			values = append(values, int64(int16(x.order.Uint16(raw))))
+		case exifTypeLong:
+			values = append(values, int64(x.order.Uint32(raw)))
+		case exifTypeSLong:
+			values = append(values, int64(int32(x.order.Uint32(raw))))
+		case exifTypeSByte:
+			values = append(values, int64(int8(raw[0])))
+		default:
+			values = append(values, int64(raw[0]))
+		}
+	}
+	return values
+}
+
+func (x *Exif) rationals(entry exifEntry) []float64 {
+	const rationalSize = 8
+	values := make([]float64, 0, entry.count)
+	for i := 0; i+rationalSize <= len(entry.value); i += rationalSize {
+		var num, den float64
+		if entry.typ == exifTypeSRational {
+			num = float64(int32(x.order.Uint32(entry.value[i:])))
+			den = float64(int32(x.order.Uint32(entry.value[i+4:])))
+		} else {
+			num = float64(x.order.Uint32(entry.value[i:]))
+			den = float64(x.order.Uint32(entry.value[i+4:]))
+		}
+		if den == 0 {
+			values = append(values, 0)
+			continue
+		}
+		values = append(values, num/den)
+	}
+	return values
+}
+
+func collapse[T any](values []T) any {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return values
+}
+
+func isPointerTag(tag uint16) bool {
+	return tag == tagExifIFDPtr || tag == tagGPSIFDPtr || tag == tagInteropIFDPtr
+}
+
+func tagName(ifd exifIFD, tag uint16) string {
+	if name, ok := exifTagNames[ifd][tag]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", tag)
+}
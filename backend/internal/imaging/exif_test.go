@@ -0,0 +1,350 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testTag is an IFD entry written by buildTIFF. Target, if set, is the
+// 1-based index of the IFD whose offset is written as the LONG value, so
+// tests can point sub-IFDs anywhere, including back at themselves.
+type testTag struct {
+	tag    uint16
+	typ    uint16
+	count  uint32
+	value  []byte
+	target int
+}
+
+// buildTIFF lays out a TIFF block with the IFDs one after another, followed
+// by the values that don't fit in an entry. The first IFD is IFD0.
+func buildTIFF(order byteOrder, ifds ...[]testTag) []byte {
+	offsets := make([]uint32, len(ifds))
+	next := uint32(tiffHeaderLen)
+	for i, tags := range ifds {
+		offsets[i] = next
+		next += ifdSize(make([]exifEntry, len(tags)))
+	}
+	dataOffset := next
+
+	var header, data []byte
+	if order == binary.LittleEndian {
+		header = append(header, 'I', 'I')
+	} else {
+		header = append(header, 'M', 'M')
+	}
+	header = order.AppendUint16(header, 42)
+	header = order.AppendUint32(header, tiffHeaderLen)
+
+	out := header
+	for _, tags := range ifds {
+		out = order.AppendUint16(out, uint16(len(tags)))
+		for _, tag := range tags {
+			value := tag.value
+			if tag.target > 0 {
+				value = order.AppendUint32(nil, offsets[tag.target-1])
+			}
+			out = order.AppendUint16(out, tag.tag)
+			out = order.AppendUint16(out, tag.typ)
+			out = order.AppendUint32(out, tag.count)
+			if len(value) <= inlineValueLen {
+				inline := make([]byte, inlineValueLen)
+				copy(inline, value)
+				out = append(out, inline...)
+				continue
+			}
+			out = order.AppendUint32(out, dataOffset+uint32(len(data)))
+			data = append(data, value...)
+		}
+		out = order.AppendUint32(out, 0)
+	}
+	return append(out, data...)
+}
+
+func asciiTag(tag uint16, value string) testTag {
+	raw := append([]byte(value), 0)
+	return testTag{tag: tag, typ: exifTypeASCII, count: uint32(len(raw)), value: raw}
+}
+
+func shortTag(order byteOrder, tag uint16, value uint16) testTag {
+	return testTag{tag: tag, typ: exifTypeShort, count: 1, value: order.AppendUint16(nil, value)}
+}
+
+func rationalTag(order byteOrder, tag uint16, num, den uint32) testTag {
+	return testTag{tag: tag, typ: exifTypeRational, count: 1, value: order.AppendUint32(order.AppendUint32(nil, num), den)}
+}
+
+func pointerTag(tag uint16, target int) testTag {
+	return testTag{tag: tag, typ: exifTypeLong, count: 1, target: target}
+}
+
+// cameraTIFF is a typical camera block: make, model and orientation in
+// IFD0, exposure settings and a maker note in the Exif sub-IFD, and a
+// position in the GPS sub-IFD.
+func cameraTIFF(order byteOrder, orientation Orientation) []byte {
+	return buildTIFF(order,
+		[]testTag{
+			asciiTag(0x010F, "Canon"),
+			asciiTag(0x0110, "EOS R5"),
+			shortTag(order, tagOrientation, uint16(orientation)),
+			pointerTag(tagExifIFDPtr, 2),
+			pointerTag(tagGPSIFDPtr, 3),
+		},
+		[]testTag{
+			rationalTag(order, 0x829A, 1, 250),
+			asciiTag(0x9003, "2024:11:22 10:00:00"),
+			{tag: tagMakerNote, typ: exifTypeUndefined, count: 6, value: []byte("vendor")},
+		},
+		[]testTag{
+			asciiTag(0x0001, "N"),
+			{tag: 0x0002, typ: exifTypeRational, count: 3, value: make([]byte, 24)},
+		},
+	)
+}
+
+func TestParseExifRejectsMalformedBlocks(t *testing.T) {
+	le := binary.LittleEndian
+	valid := buildTIFF(le, []testTag{asciiTag(0x010F, "Canon")})
+
+	withIFDOffset := func(offset uint32) []byte {
+		data := append([]byte(nil), valid...)
+		le.PutUint32(data[4:], offset)
+		return data
+	}
+	withEntryCount := func(count uint16) []byte {
+		data := append([]byte(nil), valid...)
+		le.PutUint16(data[tiffHeaderLen:], count)
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "truncated header", data: valid[:tiffHeaderLen-1]},
+		{name: "unknown byte order", data: append([]byte("XX"), valid[2:]...)},
+		{name: "bad magic", data: append([]byte{'I', 'I', 43, 0}, valid[4:]...)},
+		{name: "IFD offset past the end", data: withIFDOffset(uint32(len(valid)))},
+		{name: "IFD offset overflows", data: withIFDOffset(0xFFFFFFFF)},
+		{name: "too many entries", data: withEntryCount(maxIFDEntries + 1)},
+		{name: "entries past the end", data: withEntryCount(50)},
+		{name: "truncated entries", data: valid[:tiffHeaderLen+2+ifdEntryLen-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseExif(tt.data); !errors.Is(err, ErrInvalidExif) {
+				t.Errorf("ParseExif() error = %v, want %v", err, ErrInvalidExif)
+			}
+		})
+	}
+}
+
+func TestParseExifSkipsBrokenEntries(t *testing.T) {
+	le := binary.LittleEndian
+	data := buildTIFF(le, []testTag{
+		asciiTag(0x010F, "Canon"),
+		{tag: 0x0110, typ: 99, count: 1}, // unknown type
+		asciiTag(0x0131, "long enough to be stored out of line"),
+	})
+	// Point the out-of-line value past the end of the block.
+	entry := tiffHeaderLen + 2 + 2*ifdEntryLen
+	le.PutUint32(data[entry+8:], uint32(len(data)))
+
+	x, err := ParseExif(data)
+	if err != nil {
+		t.Fatalf("ParseExif: %v", err)
+	}
+	want := map[string]any{"ifd0": map[string]any{"Make": "Canon"}}
+	if got := x.Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+}
+
+// Sub-IFD pointers are followed once from IFD0 and never recursively, so
+// pointers back at an IFD can't make the parser loop.
+func TestParseExifIFDLoops(t *testing.T) {
+	le := binary.LittleEndian
+	tests := []struct {
+		name string
+		data []byte
+		want map[string]any
+	}{
+		{
+			name: "Exif IFD points at IFD0",
+			data: buildTIFF(le, []testTag{asciiTag(0x010F, "Canon"), pointerTag(tagExifIFDPtr, 1)}),
+			want: map[string]any{
+				"ifd0": map[string]any{"Make": "Canon"},
+				"exif": map[string]any{"0x010F": "Canon"},
+			},
+		},
+		{
+			name: "GPS and Exif IFDs point at each other",
+			data: buildTIFF(le,
+				[]testTag{pointerTag(tagExifIFDPtr, 2), pointerTag(tagGPSIFDPtr, 3)},
+				[]testTag{asciiTag(0x9003, "2024:11:22 10:00:00"), pointerTag(tagGPSIFDPtr, 3)},
+				[]testTag{asciiTag(0x0001, "N"), pointerTag(tagExifIFDPtr, 2)},
+			),
+			want: map[string]any{
+				"exif": map[string]any{"DateTimeOriginal": "2024:11:22 10:00:00"},
+				"gps":  map[string]any{"GPSLatitudeRef": "N"},
+			},
+		},
+		{
+			name: "sub-IFD points past the end",
+			data: buildTIFF(le, []testTag{asciiTag(0x010F, "Canon"), {
+				tag: tagExifIFDPtr, typ: exifTypeLong, count: 1, value: le.AppendUint32(nil, 0xFFFFFFF0),
+			}}),
+			want: map[string]any{"ifd0": map[string]any{"Make": "Canon"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := ParseExif(tt.data)
+			if err != nil {
+				t.Fatalf("ParseExif: %v", err)
+			}
+			if got := x.Map(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		for o := OrientationNormal; o <= OrientationRotate270; o++ {
+			x, err := ParseExif(buildTIFF(order, []testTag{shortTag(order, tagOrientation, uint16(o))}))
+			if err != nil {
+				t.Fatalf("ParseExif: %v", err)
+			}
+			if got := x.Orientation(); got != o {
+				t.Errorf("%v: Orientation() = %d, want %d", order, got, o)
+			}
+		}
+	}
+
+	le := binary.LittleEndian
+	tests := []struct {
+		name string
+		tags []testTag
+	}{
+		{name: "missing", tags: []testTag{asciiTag(0x010F, "Canon")}},
+		{name: "zero", tags: []testTag{shortTag(le, tagOrientation, 0)}},
+		{name: "out of range", tags: []testTag{shortTag(le, tagOrientation, 9)}},
+		{name: "wrong type", tags: []testTag{{tag: tagOrientation, typ: exifTypeLong, count: 1, value: le.AppendUint32(nil, 6)}}},
+		{name: "no values", tags: []testTag{{tag: tagOrientation, typ: exifTypeShort, count: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := ParseExif(buildTIFF(le, tt.tags))
+			if err != nil {
+				t.Fatalf("ParseExif: %v", err)
+			}
+			if got := x.Orientation(); got != OrientationNormal {
+				t.Errorf("Orientation() = %d, want %d", got, OrientationNormal)
+			}
+		})
+	}
+}
+
+func TestExifMapOmitsPointersAndMakerNotes(t *testing.T) {
+	x, err := ParseExif(cameraTIFF(binary.BigEndian, OrientationRotate90))
+	if err != nil {
+		t.Fatalf("ParseExif: %v", err)
+	}
+
+	want := map[string]any{
+		"ifd0": map[string]any{"Make": "Canon", "Model": "EOS R5", "Orientation": int64(OrientationRotate90)},
+		"exif": map[string]any{"ExposureTime": 0.004, "DateTimeOriginal": "2024:11:22 10:00:00"},
+		"gps":  map[string]any{"GPSLatitudeRef": "N", "GPSLatitude": []float64{0, 0, 0}},
+	}
+	if got := x.Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+}
+
+func TestExifFilterEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		want      map[string]any
+	}{
+		{
+			name:      "IFD0 and Exif tags",
+			allowlist: []string{"Make", " ExposureTime ", "DateTimeOriginal"},
+			want: map[string]any{
+				"ifd0": map[string]any{"Make": "Canon"},
+				"exif": map[string]any{"ExposureTime": 0.004, "DateTimeOriginal": "2024:11:22 10:00:00"},
+			},
+		},
+		{
+			name:      "IFD0 only",
+			allowlist: []string{"Model"},
+			want:      map[string]any{"ifd0": map[string]any{"Model": "EOS R5"}},
+		},
+		{
+			name:      "Exif only",
+			allowlist: []string{"ExposureTime"},
+			want:      map[string]any{"exif": map[string]any{"ExposureTime": 0.004}},
+		},
+		{
+			name:      "orientation, GPS and pointers are never kept",
+			allowlist: []string{"Orientation", "GPSLatitude", "GPSLatitudeRef", "ExifIFDPointer", "GPSInfoIFDPointer"},
+			want:      nil,
+		},
+	}
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		x, err := ParseExif(cameraTIFF(order, OrientationRotate90))
+		if err != nil {
+			t.Fatalf("ParseExif: %v", err)
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				filtered := x.Filter(tt.allowlist)
+				if tt.want == nil {
+					if !filtered.IsEmpty() {
+						t.Fatalf("Filter() kept %v", filtered.Map())
+					}
+					return
+				}
+
+				parsed, parseErr := ParseExif(filtered.Encode())
+				if parseErr != nil {
+					t.Fatalf("ParseExif(Encode()): %v", parseErr)
+				}
+				if got := parsed.Map(); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Map() = %v, want %v", got, tt.want)
+				}
+				if got := parsed.Orientation(); got != OrientationNormal {
+					t.Errorf("Orientation() = %d, want %d", got, OrientationNormal)
+				}
+			})
+		}
+	}
+}
+
+// Encoding a parsed block must not carry over pointers into the source.
+func TestExifEncodeRewritesPointers(t *testing.T) {
+	x, err := ParseExif(cameraTIFF(binary.LittleEndian, OrientationRotate90))
+	if err != nil {
+		t.Fatalf("ParseExif: %v", err)
+	}
+	encoded := x.Encode()
+
+	parsed, err := ParseExif(encoded)
+	if err != nil {
+		t.Fatalf("ParseExif(Encode()): %v", err)
+	}
+	want := x.Map()
+	delete(want, string(ifdGPS))
+	if got := parsed.Map(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Map() = %v, want %v", got, want)
+	}
+	if !bytes.Equal(parsed.Encode(), encoded) {
+		t.Errorf("Encode() is not stable across a round trip")
+	}
+}
@@ -0,0 +1,91 @@
+package imaging
+
+import (
+	"bytes"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+)
+
+const sniffLen = 12
+
+//nolint:gochecknoglobals // read-only magic byte signatures
+var (
+	jpegMagic = []byte{0xFF, 0xD8, 0xFF}
+	pngMagic  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+	riffMagic = []byte("RIFF")
+	webpMagic = []byte("WEBP")
+)
+
+// SniffFormat detects the image format from the leading magic bytes,
+// ignoring any client-provided content type.
+func SniffFormat(data []byte) (Format, bool) {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+
+	switch {
+	case bytes.HasPrefix(data, jpegMagic):
+		return FormatJPEG, true
+	case bytes.HasPrefix(data, pngMagic):
+		return FormatPNG, true
+	case len(data) >= sniffLen && bytes.Equal(data[0:4], riffMagic) && bytes.Equal(data[8:12], webpMagic):
+		return FormatWebP, true
+	default:
+		return "", false
+	}
+}
+
+// FormatFromContentType returns the format of a supported image media type.
+func FormatFromContentType(contentType string) (Format, bool) {
+	for _, f := range []Format{FormatJPEG, FormatPNG, FormatWebP} {
+		if f.ContentType() == contentType {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+func (f Format) IsValid() bool {
+	switch f {
+	case FormatJPEG, FormatPNG, FormatWebP:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	case FormatWebP:
+		return "image/webp"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatPNG:
+		return ".png"
+	case FormatWebP:
+		return ".webp"
+	default:
+		return ""
+	}
+}
+
+func (f Format) String() string {
+	return string(f)
+}
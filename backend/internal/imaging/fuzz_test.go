@@ -0,0 +1,60 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func FuzzParseExif(f *testing.F) {
+	f.Add(cameraTIFF(binary.BigEndian, OrientationRotate90))
+	f.Add(cameraTIFF(binary.LittleEndian, OrientationTransverse))
+	f.Add([]byte("II*\x00\x08\x00\x00\x00"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		exif, err := ParseExif(data)
+		if err != nil {
+			return
+		}
+		exif.Map()
+		exif.Orientation()
+		if _, err = ParseExif(exif.Encode()); err != nil {
+			t.Fatalf("ParseExif(Encode()) = %v", err)
+		}
+
+		filtered := exif.Filter([]string{"Make", "Model", "ExposureTime", "Orientation", "GPSLatitude"})
+		encoded := filtered.Encode()
+		reparsed, err := ParseExif(encoded)
+		if err != nil {
+			t.Fatalf("ParseExif(Encode()) = %v", err)
+		}
+		if !bytes.Equal(reparsed.Encode(), encoded) {
+			t.Errorf("Encode() is not stable across a round trip")
+		}
+	})
+}
+
+func FuzzReplaceMetadata(f *testing.F) {
+	tiff := cameraTIFF(binary.BigEndian, OrientationRotate90)
+	for i, format := range []Format{FormatJPEG, FormatPNG, FormatWebP} {
+		f.Add(uint8(i), photo(f, format, tiff), tiff)
+		f.Add(uint8(i), encodeTestImage(f, format, 2, 2), []byte(nil))
+	}
+
+	f.Fuzz(func(t *testing.T, format uint8, data, exif []byte) {
+		formats := []Format{FormatJPEG, FormatPNG, FormatWebP}
+		f := formats[int(format)%len(formats)]
+
+		out, err := ReplaceMetadata(data, f, exif)
+		if err != nil {
+			return
+		}
+		got, err := ExtractExif(out, f)
+		if err != nil {
+			t.Fatalf("ExtractExif(ReplaceMetadata()) = %v", err)
+		}
+		if len(exif) == 0 && got != nil || len(exif) > 0 && !bytes.Equal(got, exif) {
+			t.Errorf("embedded EXIF = %q, want %q", got, exif)
+		}
+	})
+}
@@ -0,0 +1,719 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var ErrMalformedContainer = errors.New("malformed image container")
+
+const (
+	jpegMarkerPrefix = 0xFF
+	jpegSOI          = 0xD8
+	jpegEOI          = 0xD9
+	jpegSOS          = 0xDA
+	jpegTEM          = 0x01
+	jpegSOF0         = 0xC0
+	jpegDHT          = 0xC4
+	jpegJPG          = 0xC8
+	jpegDAC          = 0xCC
+	jpegSOF15        = 0xCF
+	jpegRST0         = 0xD0
+	jpegRST7         = 0xD7
+	jpegAPP0         = 0xE0
+	jpegAPP1         = 0xE1
+	jpegAPP2         = 0xE2
+	jpegAPP14        = 0xEE
+	jpegAPP15        = 0xEF
+	jpegCOM          = 0xFE
+
+	jpegMaxSegmentLen = 0xFFFF
+
+	// jpegSOFComponents is the offset of the component count in a start of
+	// frame segment, after the precision and the dimensions.
+	jpegSOFComponents = 5
+	// jpegICCHeaderLen is the sequence number and count that precede each
+	// part of a profile split across APP2 segments.
+	jpegICCHeaderLen = 2
+)
+
+const (
+	// iccColorSpaceOffset and iccSignatureOffset locate the data colour space
+	// and the "acsp" signature in the header of an ICC profile.
+	iccColorSpaceOffset = 16
+	iccSignatureOffset  = 36
+	iccFieldLen         = 4
+
+	pngColorTypeOffset = 9
+	pngColorTypeGray   = 0
+	pngColorTypeGrayA  = 4
+
+	grayChannels  = 1
+	colorChannels = 3
+)
+
+//nolint:gochecknoglobals // read-only metadata signatures
+var (
+	jpegExifPrefix = []byte("Exif\x00\x00")
+	jpegICCPrefix  = []byte("ICC_PROFILE\x00")
+	iccSignature   = []byte("acsp")
+	pngDropChunks  = map[string]struct{}{"eXIf": {}, "tEXt": {}, "zTXt": {}, "iTXt": {}, "tIME": {}}
+	pngColorChunks = map[string]struct{}{"iCCP": {}, "sRGB": {}, "gAMA": {}, "cHRM": {}, "cICP": {}}
+)
+
+const (
+	webpHeaderLen  = 12
+	chunkHeaderLen = 8
+	pngCRCLen      = 4
+	webpVP8XLen    = 10
+	webpFlagICC    = 0x20
+	webpFlagAlpha  = 0x10
+	webpFlagEXIF   = 0x08
+	webpFlagXMP    = 0x04
+
+	webpVP8LSignature = 0x2F
+	webpVP8LHeaderLen = 5
+	webpVP8HeaderLen  = 10
+	webpMaxDimension  = 0x3FFF
+)
+
+//nolint:gochecknoglobals // read-only VP8 key frame start code
+var webpVP8StartCode = []byte{0x9D, 0x01, 0x2A}
+
+// ExtractExif returns the raw TIFF block embedded in the image, or nil if there is none.
+func ExtractExif(data []byte, format Format) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		return extractJPEGExif(data)
+	case FormatPNG:
+		return extractPNGExif(data)
+	case FormatWebP:
+		return extractWebPExif(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// ReplaceMetadata removes EXIF, XMP, IPTC and text metadata from the image
+// container without touching the pixel data, and embeds the given TIFF block
+// instead when it is not empty. Colour profiles are preserved.
+func ReplaceMetadata(data []byte, format Format, exif []byte) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		return replaceJPEGMetadata(data, exif)
+	case FormatPNG:
+		return replacePNGMetadata(data, exif)
+	case FormatWebP:
+		return replaceWebPMetadata(data, exif)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// copyColorProfile embeds the colour profile of src, if it has one, in dst
+// in place of its own. Both images must be in format. Re-encoding loses the
+// profile, and without it colours shift. A profile for another colour space
+// than dst was encoded in, such as the CMYK profile of a CMYK JPEG re-encoded
+// as YCbCr, would shift them more and is not copied.
+func copyColorProfile(dst, src []byte, format Format) ([]byte, error) {
+	switch format {
+	case FormatJPEG:
+		return copyJPEGColorProfile(dst, src)
+	case FormatPNG:
+		return copyPNGColorProfile(dst, src)
+	case FormatWebP:
+		return copyWebPColorProfile(dst, src)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+type jpegSegment struct {
+	marker  byte
+	payload []byte // without the marker and length bytes
+	raw     []byte // the whole segment including marker and length
+}
+
+// jpegSegments walks the header segments up to (not including) SOS and
+// returns them together with the offset at which SOS starts.
+func jpegSegments(data []byte) ([]jpegSegment, int, error) {
+	if len(data) < 2 || data[0] != jpegMarkerPrefix || data[1] != jpegSOI {
+		return nil, 0, ErrMalformedContainer
+	}
+
+	var segments []jpegSegment
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != jpegMarkerPrefix {
+			return nil, 0, fmt.Errorf("%w: expected JPEG marker at offset %d", ErrMalformedContainer, pos)
+		}
+		// Markers may be preceded by any number of 0xFF fill bytes.
+		for pos < len(data) && data[pos] == jpegMarkerPrefix {
+			pos++
+		}
+		if pos >= len(data) {
+			break
+		}
+
+		marker := data[pos]
+		start := pos - 1
+		pos++
+
+		if marker == jpegSOS || marker == jpegEOI {
+			return segments, start, nil
+		}
+		if marker == jpegTEM || (marker >= jpegRST0 && marker <= jpegRST7) {
+			continue
+		}
+
+		if pos+2 > len(data) {
+			return nil, 0, ErrMalformedContainer
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, 0, ErrMalformedContainer
+		}
+
+		segments = append(segments, jpegSegment{
+			marker:  marker,
+			payload: data[pos+2 : pos+length],
+			raw:     data[start : pos+length],
+		})
+		pos += length
+	}
+
+	return nil, 0, fmt.Errorf("%w: JPEG has no image data", ErrMalformedContainer)
+}
+
+func extractJPEGExif(data []byte) ([]byte, error) {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, segment := range segments {
+		if segment.marker == jpegAPP1 && bytes.HasPrefix(segment.payload, jpegExifPrefix) {
+			return segment.payload[len(jpegExifPrefix):], nil
+		}
+	}
+	return nil, nil
+}
+
+func replaceJPEGMetadata(data []byte, exif []byte) ([]byte, error) {
+	var insert []byte
+	if len(exif) > 0 {
+		var err error
+		if insert, err = jpegExifSegment(exif); err != nil {
+			return nil, err
+		}
+	}
+	return rewriteJPEG(data, keepJPEGSegment, insert)
+}
+
+func copyJPEGColorProfile(dst, src []byte) ([]byte, error) {
+	segments, _, err := jpegSegments(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// Large profiles are split across several APP2 segments.
+	var profile, icc []byte
+	for _, segment := range segments {
+		if isJPEGColorProfile(segment) {
+			profile = append(profile, segment.raw...)
+			icc = append(icc, segment.payload[min(len(jpegICCPrefix)+jpegICCHeaderLen, len(segment.payload)):]...)
+		}
+	}
+	if len(profile) == 0 {
+		return dst, nil
+	}
+	channels, err := jpegChannels(dst)
+	if err != nil {
+		return nil, err
+	}
+	if !iccFits(icc, channels) {
+		return dst, nil
+	}
+
+	return rewriteJPEG(dst, func(segment jpegSegment) bool {
+		return !isJPEGColorProfile(segment)
+	}, profile)
+}
+
+// rewriteJPEG rebuilds the header segments of a JPEG, keeping those keep
+// accepts and writing insert after the leading APP0 (JFIF) segments, where
+// the other APPn segments belong.
+func rewriteJPEG(data []byte, keep func(jpegSegment) bool, insert []byte) ([]byte, error) {
+	segments, sosOffset, err := jpegSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data) + len(insert))
+	out.Write([]byte{jpegMarkerPrefix, jpegSOI})
+
+	inserted := len(insert) == 0
+	for _, segment := range segments {
+		if !inserted && segment.marker != jpegAPP0 {
+			out.Write(insert)
+			inserted = true
+		}
+		if keep(segment) {
+			out.Write(segment.raw)
+		}
+	}
+	if !inserted {
+		out.Write(insert)
+	}
+
+	out.Write(data[sosOffset:])
+	return out.Bytes(), nil
+}
+
+// keepJPEGSegment keeps everything needed to decode and colour-manage the
+// image: JFIF (APP0), ICC profiles (APP2), Adobe colour transform (APP14) and
+// all non-APPn segments. EXIF/XMP (APP1), IPTC (APP13), other APPn and
+// comments are dropped.
+func keepJPEGSegment(segment jpegSegment) bool {
+	switch {
+	case segment.marker == jpegAPP0, segment.marker == jpegAPP14:
+		return true
+	case segment.marker == jpegAPP2:
+		return isJPEGColorProfile(segment)
+	case segment.marker >= jpegAPP0 && segment.marker <= jpegAPP15:
+		return false
+	case segment.marker == jpegCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// jpegChannels returns the number of colour components of a JPEG.
+func jpegChannels(data []byte) (int, error) {
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, segment := range segments {
+		if isJPEGFrame(segment.marker) && len(segment.payload) > jpegSOFComponents {
+			return int(segment.payload[jpegSOFComponents]), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: JPEG has no frame header", ErrMalformedContainer)
+}
+
+func isJPEGFrame(marker byte) bool {
+	return marker >= jpegSOF0 && marker <= jpegSOF15 && marker != jpegDHT && marker != jpegJPG && marker != jpegDAC
+}
+
+func isJPEGColorProfile(segment jpegSegment) bool {
+	return segment.marker == jpegAPP2 && bytes.HasPrefix(segment.payload, jpegICCPrefix)
+}
+
+func jpegExifSegment(exif []byte) ([]byte, error) {
+	length := 2 + len(jpegExifPrefix) + len(exif)
+	if length > jpegMaxSegmentLen {
+		return nil, fmt.Errorf("%w: EXIF block is too large for a JPEG segment", ErrInvalidExif)
+	}
+
+	segment := make([]byte, 0, 2+length)
+	segment = append(segment, jpegMarkerPrefix, jpegAPP1)
+	segment = binary.BigEndian.AppendUint16(segment, uint16(length))
+	segment = append(segment, jpegExifPrefix...)
+	return append(segment, exif...), nil
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+	raw  []byte
+}
+
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngMagic) {
+		return nil, ErrMalformedContainer
+	}
+
+	var chunks []pngChunk
+	pos := len(pngMagic)
+	for pos < len(data) {
+		if pos+chunkHeaderLen > len(data) {
+			return nil, ErrMalformedContainer
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + chunkHeaderLen + length + pngCRCLen
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformedContainer
+		}
+
+		chunks = append(chunks, pngChunk{
+			typ:  string(data[pos+4 : pos+chunkHeaderLen]),
+			data: data[pos+chunkHeaderLen : pos+chunkHeaderLen+length],
+			raw:  data[pos:end],
+		})
+		pos = end
+	}
+
+	return chunks, nil
+}
+
+func extractPNGExif(data []byte) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.typ == "eXIf" {
+			return chunk.data, nil
+		}
+	}
+	return nil, nil
+}
+
+func replacePNGMetadata(data []byte, exif []byte) ([]byte, error) {
+	chunks, err := pngChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	out.Write(pngMagic)
+
+	exifWritten := len(exif) == 0
+	for _, chunk := range chunks {
+		// The PNG spec requires eXIf to appear before the first IDAT chunk.
+		if !exifWritten && chunk.typ == "IDAT" {
+			writePNGChunk(&out, "eXIf", exif)
+			exifWritten = true
+		}
+		if _, drop := pngDropChunks[chunk.typ]; drop {
+			continue
+		}
+		out.Write(chunk.raw)
+	}
+	if !exifWritten {
+		return nil, fmt.Errorf("%w: PNG has no image data", ErrMalformedContainer)
+	}
+
+	return out.Bytes(), nil
+}
+
+// copyPNGColorProfile copies the ICC profile and the other colour space
+// chunks, which must come before PLTE and IDAT, right after IHDR.
+func copyPNGColorProfile(dst, src []byte) ([]byte, error) {
+	srcChunks, err := pngChunks(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile, icc []byte
+	for _, chunk := range srcChunks {
+		if _, ok := pngColorChunks[chunk.typ]; ok {
+			profile = append(profile, chunk.raw...)
+		}
+		if chunk.typ == "iCCP" {
+			icc = pngICCHeader(chunk.data)
+		}
+	}
+	if len(profile) == 0 {
+		return dst, nil
+	}
+
+	chunks, err := pngChunks(dst)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) <= pngColorTypeOffset {
+		return nil, fmt.Errorf("%w: PNG has no header", ErrMalformedContainer)
+	}
+	channels := colorChannels
+	if colorType := chunks[0].data[pngColorTypeOffset]; colorType == pngColorTypeGray || colorType == pngColorTypeGrayA {
+		channels = grayChannels
+	}
+	if !iccFits(icc, channels) {
+		return dst, nil
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(dst) + len(profile))
+	out.Write(pngMagic)
+	for _, chunk := range chunks {
+		if _, ok := pngColorChunks[chunk.typ]; ok {
+			continue
+		}
+		out.Write(chunk.raw)
+		if chunk.typ == "IHDR" {
+			out.Write(profile)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// pngICCHeader decompresses the start of the profile of an iCCP chunk, enough
+// to read its header, and returns nil if it can't.
+func pngICCHeader(data []byte) []byte {
+	// The profile name and the compression method precede the profile.
+	name := bytes.IndexByte(data, 0)
+	if name < 0 || name+2 > len(data) {
+		return nil
+	}
+	reader, err := zlib.NewReader(bytes.NewReader(data[name+2:]))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	header := make([]byte, iccSignatureOffset+iccFieldLen)
+	n, _ := io.ReadFull(reader, header)
+	return header[:n]
+}
+
+func writePNGChunk(out *bytes.Buffer, typ string, data []byte) {
+	out.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data))))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	out.WriteString(typ)
+	out.Write(data)
+	out.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+}
+
+type webpChunk struct {
+	fourCC string
+	data   []byte
+}
+
+func webpChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < webpHeaderLen || !bytes.Equal(data[0:4], riffMagic) || !bytes.Equal(data[8:12], webpMagic) {
+		return nil, ErrMalformedContainer
+	}
+
+	var chunks []webpChunk
+	pos := webpHeaderLen
+	for pos+chunkHeaderLen <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		start := pos + chunkHeaderLen
+		if length < 0 || start+length > len(data) {
+			return nil, ErrMalformedContainer
+		}
+
+		chunks = append(chunks, webpChunk{
+			fourCC: string(data[pos : pos+4]),
+			data:   data[start : start+length],
+		})
+		pos = start + length + length%2
+	}
+
+	return chunks, nil
+}
+
+func extractWebPExif(data []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range chunks {
+		if chunk.fourCC == "EXIF" {
+			// Some encoders keep the JPEG-style prefix in the WebP chunk.
+			return bytes.TrimPrefix(chunk.data, jpegExifPrefix), nil
+		}
+	}
+	return nil, nil
+}
+
+// replaceWebPMetadata rewrites extended (VP8X) files. A simple lossy or
+// lossless file is a single image chunk that can't carry metadata, so only
+// stray chunks after it are dropped, unless there is EXIF to embed, in
+// which case it is converted to an extended file.
+func replaceWebPMetadata(data []byte, exif []byte) ([]byte, error) {
+	chunks, err := webpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isExtendedWebP(chunks) {
+		if len(exif) == 0 {
+			if len(chunks) <= 1 {
+				return data, nil
+			}
+			return encodeWebP(chunks[:1]), nil
+		}
+		if chunks, err = extendWebP(chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]webpChunk, 0, len(chunks)+1)
+	for i, chunk := range chunks {
+		switch {
+		case i == 0:
+			header := bytes.Clone(chunk.data)
+			header[0] &^= webpFlagEXIF | webpFlagXMP
+			if len(exif) > 0 {
+				header[0] |= webpFlagEXIF
+			}
+			out = append(out, webpChunk{fourCC: chunk.fourCC, data: header})
+		case chunk.fourCC == "EXIF", chunk.fourCC == "XMP ":
+			continue
+		default:
+			out = append(out, chunk)
+		}
+	}
+
+	// EXIF must come after the image data in an extended WebP file.
+	if len(exif) > 0 {
+		out = append(out, webpChunk{fourCC: "EXIF", data: exif})
+	}
+
+	return encodeWebP(out), nil
+}
+
+// copyWebPColorProfile copies the ICCP chunk, which needs an extended file
+// and must come right after VP8X.
+func copyWebPColorProfile(dst, src []byte) ([]byte, error) {
+	srcChunks, err := webpChunks(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile []byte
+	for _, chunk := range srcChunks {
+		if chunk.fourCC == "ICCP" {
+			profile = chunk.data
+		}
+	}
+	if profile == nil || !iccFits(profile, colorChannels) {
+		return dst, nil
+	}
+
+	chunks, err := webpChunks(dst)
+	if err != nil {
+		return nil, err
+	}
+	if !isExtendedWebP(chunks) {
+		if chunks, err = extendWebP(chunks); err != nil {
+			return nil, err
+		}
+	}
+
+	header := bytes.Clone(chunks[0].data)
+	header[0] |= webpFlagICC
+	out := []webpChunk{{fourCC: "VP8X", data: header}, {fourCC: "ICCP", data: profile}}
+	for _, chunk := range chunks[1:] {
+		if chunk.fourCC != "ICCP" {
+			out = append(out, chunk)
+		}
+	}
+
+	return encodeWebP(out), nil
+}
+
+func isExtendedWebP(chunks []webpChunk) bool {
+	return len(chunks) > 0 && chunks[0].fourCC == "VP8X" && len(chunks[0].data) >= webpVP8XLen
+}
+
+// extendWebP converts the chunks of a simple file, a single VP8 or VP8L
+// chunk, into an extended file by prepending a VP8X header with the canvas
+// size taken from the image data. Stray chunks after the image are dropped.
+func extendWebP(chunks []webpChunk) ([]webpChunk, error) {
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: WebP has no image data", ErrMalformedContainer)
+	}
+
+	bitstream := chunks[0]
+	var width, height int
+	var flags byte
+	switch bitstream.fourCC {
+	case "VP8L":
+		if len(bitstream.data) < webpVP8LHeaderLen || bitstream.data[0] != webpVP8LSignature {
+			return nil, fmt.Errorf("%w: invalid VP8L header", ErrMalformedContainer)
+		}
+		const alphaBit = 28
+		bits := binary.LittleEndian.Uint32(bitstream.data[1:])
+		width = int(bits&webpMaxDimension) + 1
+		height = int((bits>>14)&webpMaxDimension) + 1
+		if bits>>alphaBit&1 != 0 {
+			flags |= webpFlagAlpha
+		}
+	case "VP8 ":
+		if len(bitstream.data) < webpVP8HeaderLen || !bytes.Equal(bitstream.data[3:6], webpVP8StartCode) {
+			return nil, fmt.Errorf("%w: invalid VP8 header", ErrMalformedContainer)
+		}
+		width = int(binary.LittleEndian.Uint16(bitstream.data[6:]) & webpMaxDimension)
+		height = int(binary.LittleEndian.Uint16(bitstream.data[8:]) & webpMaxDimension)
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q chunk in a simple WebP", ErrMalformedContainer, bitstream.fourCC)
+	}
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("%w: WebP has no canvas", ErrMalformedContainer)
+	}
+
+	// The canvas size is stored minus one in 24-bit little-endian fields.
+	header := make([]byte, webpVP8XLen)
+	header[0] = flags
+	putUint24(header[4:], uint32(width-1))
+	putUint24(header[7:], uint32(height-1))
+
+	return []webpChunk{{fourCC: "VP8X", data: header}, bitstream}, nil
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+func encodeWebP(chunks []webpChunk) []byte {
+	var body bytes.Buffer
+	body.Write(webpMagic)
+	for _, chunk := range chunks {
+		writeWebPChunk(&body, chunk.fourCC, chunk.data)
+	}
+
+	var out bytes.Buffer
+	out.Grow(body.Len() + chunkHeaderLen)
+	out.Write(riffMagic)
+	out.Write(binary.LittleEndian.AppendUint32(nil, uint32(body.Len())))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func writeWebPChunk(out *bytes.Buffer, fourCC string, data []byte) {
+	out.WriteString(fourCC)
+	out.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data))))
+	out.Write(data)
+	if len(data)%2 != 0 {
+		out.WriteByte(0)
+	}
+}
+
+// iccFits reports whether an ICC profile describes images with the given
+// number of colour channels. A profile without a readable header is given
+// the benefit of the doubt.
+func iccFits(profile []byte, channels int) bool {
+	if len(profile) < iccSignatureOffset+iccFieldLen ||
+		!bytes.Equal(profile[iccSignatureOffset:iccSignatureOffset+iccFieldLen], iccSignature) {
+		return true
+	}
+	space := string(profile[iccColorSpaceOffset : iccColorSpaceOffset+iccFieldLen])
+	switch channels {
+	case grayChannels:
+		return space == "GRAY"
+	case colorChannels:
+		return space == "RGB " || space == "YCbr"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,654 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// testImage returns an image whose pixels all differ, so orientation
+// mistakes show up as wrong colours.
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 60), G: uint8(y * 60), B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t testing.TB, format Format, width, height int) []byte {
+	t.Helper()
+
+	data, err := Encode(testImage(width, height), format, 100)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return data
+}
+
+func testJPEGSegment(marker byte, payload []byte) []byte {
+	segment := []byte{jpegMarkerPrefix, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// withJPEGSegments inserts segments right after SOI.
+func withJPEGSegments(data []byte, segments ...[]byte) []byte {
+	out := slices.Clone(data[:2])
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+func testPNGChunk(typ string, data []byte) []byte {
+	var out bytes.Buffer
+	writePNGChunk(&out, typ, data)
+	return out.Bytes()
+}
+
+// withPNGChunks inserts chunks right after IHDR.
+func withPNGChunks(t testing.TB, data []byte, chunks ...[]byte) []byte {
+	t.Helper()
+
+	parsed, err := pngChunks(data)
+	if err != nil || parsed[0].typ != "IHDR" {
+		t.Fatalf("unexpected PNG layout: %v", err)
+	}
+	end := len(pngMagic) + len(parsed[0].raw)
+	out := slices.Clone(data[:end])
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[end:]...)
+}
+
+func jpegMarkers(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	segments, _, err := jpegSegments(data)
+	if err != nil {
+		t.Fatalf("jpegSegments: %v", err)
+	}
+	markers := make([]byte, 0, len(segments))
+	for _, segment := range segments {
+		markers = append(markers, segment.marker)
+	}
+	return markers
+}
+
+func pngTypes(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	chunks, err := pngChunks(data)
+	if err != nil {
+		t.Fatalf("pngChunks: %v", err)
+	}
+	types := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		types = append(types, chunk.typ)
+	}
+	return types
+}
+
+func webpFourCCs(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	chunks, err := webpChunks(data)
+	if err != nil {
+		t.Fatalf("webpChunks: %v", err)
+	}
+	fourCCs := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		fourCCs = append(fourCCs, chunk.fourCC)
+	}
+	return fourCCs
+}
+
+// decodeTestImage checks that the output is still an image of the given
+// size.
+func decodeTestImage(t *testing.T, data []byte, width, height int) image.Image {
+	t.Helper()
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("image.Decode: %v", err)
+	}
+	if got := img.Bounds(); got.Dx() != width || got.Dy() != height {
+		t.Fatalf("decoded size = %dx%d, want %dx%d", got.Dx(), got.Dy(), width, height)
+	}
+	return img
+}
+
+// exifMap returns the tags of the EXIF embedded in data, nil if it has none.
+func exifMap(t *testing.T, data []byte, format Format) map[string]any {
+	t.Helper()
+
+	raw, err := ExtractExif(data, format)
+	if err != nil {
+		t.Fatalf("ExtractExif: %v", err)
+	}
+	if raw == nil {
+		return nil
+	}
+	x, err := ParseExif(raw)
+	if err != nil {
+		t.Fatalf("ParseExif: %v", err)
+	}
+	return x.Map()
+}
+
+// keptExif is cameraTIFF filtered down to the make and the exposure time.
+func keptExif(t *testing.T) ([]byte, map[string]any) {
+	t.Helper()
+
+	x, err := ParseExif(cameraTIFF(binary.LittleEndian, OrientationNormal))
+	if err != nil {
+		t.Fatalf("ParseExif: %v", err)
+	}
+	return x.Filter([]string{"Make", "ExposureTime"}).Encode(), map[string]any{
+		"ifd0": map[string]any{"Make": "Canon"},
+		"exif": map[string]any{"ExposureTime": 0.004},
+	}
+}
+
+func iccSegment(sequence, total byte, profile string) []byte {
+	payload := append(slices.Clone(jpegICCPrefix), sequence, total)
+	return testJPEGSegment(jpegAPP2, append(payload, profile...))
+}
+
+func TestMalformedContainers(t *testing.T) {
+	pngIHDR := append(slices.Clone(pngMagic), testPNGChunk("IHDR", make([]byte, 13))...)
+	webpHeader := func(chunks ...byte) []byte {
+		return append([]byte("RIFF\x00\x00\x00\x00WEBP"), chunks...)
+	}
+
+	tests := []struct {
+		name   string
+		format Format
+		data   []byte
+	}{
+		{name: "JPEG without SOI", format: FormatJPEG, data: []byte{0xFF, 0xD9}},
+		{name: "JPEG truncated after SOI", format: FormatJPEG, data: []byte{0xFF, 0xD8}},
+		{name: "JPEG truncated marker", format: FormatJPEG, data: []byte{0xFF, 0xD8, 0xFF}},
+		{name: "JPEG truncated length", format: FormatJPEG, data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00}},
+		{name: "JPEG length below 2", format: FormatJPEG, data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}},
+		{name: "JPEG oversized segment", format: FormatJPEG, data: []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 0x00}},
+		{name: "JPEG garbage between segments", format: FormatJPEG, data: []byte{0xFF, 0xD8, 0x00, 0xFF, 0xDA}},
+		{
+			name:   "JPEG without image data",
+			format: FormatJPEG,
+			data:   append([]byte{0xFF, 0xD8}, testJPEGSegment(jpegAPP0, []byte("JFIF\x00"))...),
+		},
+		{name: "PNG without magic", format: FormatPNG, data: []byte("\x89PNX\r\n\x1a\n")},
+		{name: "PNG truncated chunk header", format: FormatPNG, data: append(slices.Clone(pngMagic), 0, 0, 0, 0)},
+		{
+			name:   "PNG oversized chunk",
+			format: FormatPNG,
+			data:   append(slices.Clone(pngMagic), 0xFF, 0xFF, 0xFF, 0xFF, 'I', 'D', 'A', 'T', 0, 0, 0, 0),
+		},
+		{name: "PNG chunk without CRC", format: FormatPNG, data: pngIHDR[:len(pngIHDR)-pngCRCLen]},
+		{name: "WebP too short", format: FormatWebP, data: []byte("RIFF\x00\x00\x00\x00WEB")},
+		{name: "WebP without RIFF", format: FormatWebP, data: []byte("RIFX\x00\x00\x00\x00WEBP")},
+		{name: "WebP wrong form type", format: FormatWebP, data: []byte("RIFF\x00\x00\x00\x00WAVE")},
+		{name: "WebP oversized chunk", format: FormatWebP, data: webpHeader('V', 'P', '8', 'L', 0xFF, 0xFF, 0xFF, 0xFF, 0)},
+		{name: "WebP truncated chunk", format: FormatWebP, data: webpHeader('V', 'P', '8', 'L', 4, 0, 0, 0, 0x2F)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ExtractExif(tt.data, tt.format); !errors.Is(err, ErrMalformedContainer) {
+				t.Errorf("ExtractExif() error = %v, want %v", err, ErrMalformedContainer)
+			}
+			if _, err := ReplaceMetadata(tt.data, tt.format, []byte("II*\x00")); !errors.Is(err, ErrMalformedContainer) {
+				t.Errorf("ReplaceMetadata() error = %v, want %v", err, ErrMalformedContainer)
+			}
+		})
+	}
+}
+
+func TestReplacePNGMetadataWithoutImageData(t *testing.T) {
+	data := append(slices.Clone(pngMagic), testPNGChunk("IHDR", make([]byte, 13))...)
+	data = append(data, testPNGChunk("IEND", nil)...)
+
+	if _, err := ReplaceMetadata(data, FormatPNG, []byte("II*\x00")); !errors.Is(err, ErrMalformedContainer) {
+		t.Errorf("ReplaceMetadata() error = %v, want %v", err, ErrMalformedContainer)
+	}
+	if _, err := ReplaceMetadata(data, FormatPNG, nil); err != nil {
+		t.Errorf("ReplaceMetadata() without EXIF error = %v", err)
+	}
+}
+
+func TestReplaceJPEGMetadata(t *testing.T) {
+	exif, wantExif := keptExif(t)
+	base := encodeTestImage(t, FormatJPEG, 4, 2)
+	data := withJPEGSegments(base,
+		testJPEGSegment(jpegAPP0, []byte("JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00")),
+		testJPEGSegment(jpegAPP1, append(slices.Clone(jpegExifPrefix), cameraTIFF(binary.BigEndian, OrientationNormal)...)),
+		testJPEGSegment(jpegAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")),
+		testJPEGSegment(0xED, []byte("Photoshop 3.0\x00")),
+		iccSegment(1, 1, "profile"),
+		testJPEGSegment(jpegAPP14, []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")),
+		testJPEGSegment(jpegAPP15, []byte("vendor")),
+		testJPEGSegment(jpegCOM, []byte("comment")),
+	)
+	baseMarkers := jpegMarkers(t, base)
+
+	tests := []struct {
+		name     string
+		exif     []byte
+		markers  []byte
+		wantExif map[string]any
+	}{
+		{
+			name:     "with EXIF",
+			exif:     exif,
+			markers:  append([]byte{jpegAPP0, jpegAPP1, jpegAPP2, jpegAPP14}, baseMarkers...),
+			wantExif: wantExif,
+		},
+		{
+			name:    "without EXIF",
+			markers: append([]byte{jpegAPP0, jpegAPP2, jpegAPP14}, baseMarkers...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ReplaceMetadata(data, FormatJPEG, tt.exif)
+			if err != nil {
+				t.Fatalf("ReplaceMetadata: %v", err)
+			}
+
+			if got := jpegMarkers(t, out); !bytes.Equal(got, tt.markers) {
+				t.Errorf("markers = % X, want % X", got, tt.markers)
+			}
+			if got := exifMap(t, out, FormatJPEG); !reflect.DeepEqual(got, tt.wantExif) {
+				t.Errorf("EXIF = %v, want %v", got, tt.wantExif)
+			}
+			if !bytes.Contains(out, iccSegment(1, 1, "profile")) {
+				t.Error("ICC profile was dropped")
+			}
+			// The entropy-coded data is copied unchanged.
+			_, sos, _ := jpegSegments(base)
+			if !bytes.HasSuffix(out, base[sos:]) {
+				t.Error("image data was changed")
+			}
+			decodeTestImage(t, out, 4, 2)
+		})
+	}
+}
+
+func TestReplaceJPEGMetadataRejectsOversizedExif(t *testing.T) {
+	data := encodeTestImage(t, FormatJPEG, 2, 2)
+	if _, err := ReplaceMetadata(data, FormatJPEG, make([]byte, jpegMaxSegmentLen)); !errors.Is(err, ErrInvalidExif) {
+		t.Errorf("ReplaceMetadata() error = %v, want %v", err, ErrInvalidExif)
+	}
+}
+
+func TestReplacePNGMetadata(t *testing.T) {
+	exif, wantExif := keptExif(t)
+	base := encodeTestImage(t, FormatPNG, 4, 2)
+	data := withPNGChunks(t, base,
+		testPNGChunk("iCCP", []byte("profile\x00\x00compressed")),
+		testPNGChunk("gAMA", []byte{0, 0, 0xB1, 0x8F}),
+		testPNGChunk("eXIf", cameraTIFF(binary.BigEndian, OrientationNormal)),
+		testPNGChunk("tEXt", []byte("Comment\x00hello")),
+		testPNGChunk("zTXt", []byte("Comment\x00\x00compressed")),
+		testPNGChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")),
+		testPNGChunk("tIME", []byte{0x07, 0xE8, 11, 22, 10, 0, 0}),
+	)
+	baseTypes := pngTypes(t, base)
+
+	tests := []struct {
+		name     string
+		exif     []byte
+		types    []string
+		wantExif map[string]any
+	}{
+		{
+			name:     "with EXIF",
+			exif:     exif,
+			types:    append([]string{"IHDR", "iCCP", "gAMA", "eXIf"}, baseTypes[1:]...),
+			wantExif: wantExif,
+		},
+		{
+			name:  "without EXIF",
+			types: append([]string{"IHDR", "iCCP", "gAMA"}, baseTypes[1:]...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ReplaceMetadata(data, FormatPNG, tt.exif)
+			if err != nil {
+				t.Fatalf("ReplaceMetadata: %v", err)
+			}
+
+			if got := pngTypes(t, out); !slices.Equal(got, tt.types) {
+				t.Errorf("chunks = %v, want %v", got, tt.types)
+			}
+			if got := exifMap(t, out, FormatPNG); !reflect.DeepEqual(got, tt.wantExif) {
+				t.Errorf("EXIF = %v, want %v", got, tt.wantExif)
+			}
+			// The decoder checks the CRC of every chunk.
+			decodeTestImage(t, out, 4, 2)
+		})
+	}
+}
+
+func TestReplaceWebPMetadata(t *testing.T) {
+	exif, wantExif := keptExif(t)
+	simple := encodeTestImage(t, FormatWebP, 4, 2)
+	simpleChunks, err := webpChunks(simple)
+	if err != nil {
+		t.Fatalf("webpChunks: %v", err)
+	}
+	extended, err := extendWebP(simpleChunks)
+	if err != nil {
+		t.Fatalf("extendWebP: %v", err)
+	}
+	header := slices.Clone(extended[0].data)
+	header[0] |= webpFlagICC | webpFlagEXIF | webpFlagXMP
+	withMetadata := encodeWebP([]webpChunk{
+		{fourCC: "VP8X", data: header},
+		{fourCC: "ICCP", data: []byte("profile")},
+		extended[1],
+		{fourCC: "EXIF", data: cameraTIFF(binary.BigEndian, OrientationNormal)},
+		{fourCC: "XMP ", data: []byte("<x:xmpmeta/>")},
+	})
+	withStrayExif := encodeWebP([]webpChunk{
+		simpleChunks[0],
+		{fourCC: "EXIF", data: cameraTIFF(binary.BigEndian, OrientationNormal)},
+	})
+
+	tests := []struct {
+		name     string
+		data     []byte
+		exif     []byte
+		fourCCs  []string
+		flags    byte
+		wantExif map[string]any
+	}{
+		{
+			name:     "simple with EXIF",
+			data:     simple,
+			exif:     exif,
+			fourCCs:  []string{"VP8X", "VP8L", "EXIF"},
+			flags:    webpFlagEXIF,
+			wantExif: wantExif,
+		},
+		{
+			name:    "simple without EXIF",
+			data:    simple,
+			fourCCs: []string{"VP8L"},
+		},
+		{
+			name:    "simple with stray EXIF",
+			data:    withStrayExif,
+			fourCCs: []string{"VP8L"},
+		},
+		{
+			name:     "extended with EXIF",
+			data:     withMetadata,
+			exif:     exif,
+			fourCCs:  []string{"VP8X", "ICCP", "VP8L", "EXIF"},
+			flags:    webpFlagICC | webpFlagEXIF,
+			wantExif: wantExif,
+		},
+		{
+			name:    "extended without EXIF",
+			data:    withMetadata,
+			fourCCs: []string{"VP8X", "ICCP", "VP8L"},
+			flags:   webpFlagICC,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, replaceErr := ReplaceMetadata(tt.data, FormatWebP, tt.exif)
+			if replaceErr != nil {
+				t.Fatalf("ReplaceMetadata: %v", replaceErr)
+			}
+
+			if got := webpFourCCs(t, out); !slices.Equal(got, tt.fourCCs) {
+				t.Errorf("chunks = %v, want %v", got, tt.fourCCs)
+			}
+			if tt.fourCCs[0] == "VP8X" {
+				chunks, _ := webpChunks(out)
+				if got := chunks[0].data[0]; got != tt.flags {
+					t.Errorf("VP8X flags = %#x, want %#x", got, tt.flags)
+				}
+			}
+			if got := exifMap(t, out, FormatWebP); !reflect.DeepEqual(got, tt.wantExif) {
+				t.Errorf("EXIF = %v, want %v", got, tt.wantExif)
+			}
+			if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-chunkHeaderLen {
+				t.Errorf("RIFF size = %d, want %d", size, len(out)-chunkHeaderLen)
+			}
+			decodeTestImage(t, out, 4, 2)
+		})
+	}
+}
+
+func TestExtendWebP(t *testing.T) {
+	vp8 := func(width, height uint16) []byte {
+		data := []byte{0x50, 0x01, 0x00, 0x9D, 0x01, 0x2A}
+		data = binary.LittleEndian.AppendUint16(data, width)
+		return binary.LittleEndian.AppendUint16(data, height)
+	}
+	vp8l := func(width, height uint32, alpha bool) []byte {
+		bits := (width - 1) | (height-1)<<14
+		if alpha {
+			bits |= 1 << 28
+		}
+		return binary.LittleEndian.AppendUint32([]byte{webpVP8LSignature}, bits)
+	}
+
+	tests := []struct {
+		name   string
+		chunks []webpChunk
+		width  int
+		height int
+		flags  byte
+		err    bool
+	}{
+		{name: "lossless", chunks: []webpChunk{{"VP8L", vp8l(640, 480, false)}}, width: 640, height: 480},
+		{name: "lossless with alpha", chunks: []webpChunk{{"VP8L", vp8l(1, 16384, true)}}, width: 1, height: 16384, flags: webpFlagAlpha},
+		{name: "lossy", chunks: []webpChunk{{"VP8 ", vp8(800, 600)}}, width: 800, height: 600},
+		// The top two bits of the VP8 dimensions are the scaling mode.
+		{name: "lossy with scaling", chunks: []webpChunk{{"VP8 ", vp8(0xC000|800, 0x4000|600)}}, width: 800, height: 600},
+		{name: "stray chunks dropped", chunks: []webpChunk{{"VP8L", vp8l(2, 2, false)}, {"EXIF", []byte("II")}}, width: 2, height: 2},
+		{name: "no chunks", err: true},
+		{name: "bad VP8L signature", chunks: []webpChunk{{"VP8L", []byte{0x2E, 0, 0, 0, 0}}}, err: true},
+		{name: "truncated VP8L", chunks: []webpChunk{{"VP8L", []byte{webpVP8LSignature, 0}}}, err: true},
+		{name: "bad VP8 start code", chunks: []webpChunk{{"VP8 ", append([]byte{0, 0, 0, 0, 0, 0}, 1, 0, 1, 0)}}, err: true},
+		{name: "truncated VP8", chunks: []webpChunk{{"VP8 ", vp8(1, 1)[:8]}}, err: true},
+		{name: "zero-sized VP8", chunks: []webpChunk{{"VP8 ", vp8(0, 10)}}, err: true},
+		{name: "not an image", chunks: []webpChunk{{"ALPH", []byte{0}}}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := extendWebP(tt.chunks)
+			if tt.err {
+				if !errors.Is(err, ErrMalformedContainer) {
+					t.Fatalf("extendWebP() error = %v, want %v", err, ErrMalformedContainer)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extendWebP: %v", err)
+			}
+
+			if len(chunks) != 2 || chunks[0].fourCC != "VP8X" || chunks[1].fourCC != tt.chunks[0].fourCC {
+				t.Fatalf("chunks = %v, want VP8X and %s", chunks, tt.chunks[0].fourCC)
+			}
+			header := chunks[0].data
+			width := int(header[4]) | int(header[5])<<8 | int(header[6])<<16
+			height := int(header[7]) | int(header[8])<<8 | int(header[9])<<16
+			if width+1 != tt.width || height+1 != tt.height || header[0] != tt.flags {
+				t.Errorf("VP8X = %dx%d flags %#x, want %dx%d flags %#x",
+					width+1, height+1, header[0], tt.width, tt.height, tt.flags)
+			}
+		})
+	}
+}
+
+func TestCopyColorProfile(t *testing.T) {
+	jpegSrc := withJPEGSegments(encodeTestImage(t, FormatJPEG, 4, 2),
+		iccSegment(1, 2, "first half"), iccSegment(2, 2, "second half"))
+	jpegDst := withJPEGSegments(encodeTestImage(t, FormatJPEG, 2, 4),
+		testJPEGSegment(jpegAPP0, []byte("JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00")),
+		iccSegment(1, 1, "other"))
+
+	pngSrc := withPNGChunks(t, encodeTestImage(t, FormatPNG, 4, 2),
+		testPNGChunk("iCCP", []byte("profile\x00\x00compressed")),
+		testPNGChunk("cHRM", make([]byte, 32)))
+	pngDst := withPNGChunks(t, encodeTestImage(t, FormatPNG, 2, 4), testPNGChunk("sRGB", []byte{0}))
+
+	webpSrc, err := ReplaceMetadata(encodeTestImage(t, FormatWebP, 4, 2), FormatWebP, []byte("II*\x00"))
+	if err != nil {
+		t.Fatalf("ReplaceMetadata: %v", err)
+	}
+	webpSrcChunks, _ := webpChunks(webpSrc)
+	webpSrcChunks[0].data[0] |= webpFlagICC
+	webpSrc = encodeWebP(slices.Insert(webpSrcChunks, 1, webpChunk{fourCC: "ICCP", data: []byte("profile")}))
+
+	tests := []struct {
+		name   string
+		format Format
+		src    []byte
+		dst    []byte
+		check  func(t *testing.T, out []byte)
+	}{
+		{
+			name:   "JPEG",
+			format: FormatJPEG,
+			src:    jpegSrc,
+			dst:    jpegDst,
+			check: func(t *testing.T, out []byte) {
+				profile := append(iccSegment(1, 2, "first half"), iccSegment(2, 2, "second half")...)
+				if !bytes.Contains(out, profile) || bytes.Contains(out, []byte("other")) {
+					t.Error("profile was not replaced")
+				}
+				if got := jpegMarkers(t, out)[:3]; !bytes.Equal(got, []byte{jpegAPP0, jpegAPP2, jpegAPP2}) {
+					t.Errorf("leading markers = % X, want APP0 APP2 APP2", got)
+				}
+			},
+		},
+		{
+			name:   "PNG",
+			format: FormatPNG,
+			src:    pngSrc,
+			dst:    pngDst,
+			check: func(t *testing.T, out []byte) {
+				if got := pngTypes(t, out)[:3]; !slices.Equal(got, []string{"IHDR", "iCCP", "cHRM"}) {
+					t.Errorf("leading chunks = %v, want IHDR iCCP cHRM", got)
+				}
+				if slices.Contains(pngTypes(t, out), "sRGB") {
+					t.Error("profile was not replaced")
+				}
+			},
+		},
+		{
+			name:   "WebP",
+			format: FormatWebP,
+			src:    webpSrc,
+			dst:    encodeTestImage(t, FormatWebP, 2, 4),
+			check: func(t *testing.T, out []byte) {
+				if got := webpFourCCs(t, out); !slices.Equal(got, []string{"VP8X", "ICCP", "VP8L"}) {
+					t.Errorf("chunks = %v, want VP8X ICCP VP8L", got)
+				}
+				chunks, _ := webpChunks(out)
+				if chunks[0].data[0] != webpFlagICC || string(chunks[1].data) != "profile" {
+					t.Errorf("VP8X flags = %#x, ICCP = %q", chunks[0].data[0], chunks[1].data)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, copyErr := copyColorProfile(tt.dst, tt.src, tt.format)
+			if copyErr != nil {
+				t.Fatalf("copyColorProfile: %v", copyErr)
+			}
+			tt.check(t, out)
+			decodeTestImage(t, out, 2, 4)
+
+			// Without a profile in the source the image is left alone.
+			plain := encodeTestImage(t, tt.format, 4, 2)
+			unchanged, copyErr := copyColorProfile(tt.dst, plain, tt.format)
+			if copyErr != nil || !bytes.Equal(unchanged, tt.dst) {
+				t.Errorf("copyColorProfile() without profile changed the image, error = %v", copyErr)
+			}
+		})
+	}
+}
+
+// iccProfile returns the header of an ICC profile for the colour space.
+func iccProfile(space string) []byte {
+	profile := make([]byte, 128)
+	copy(profile[iccColorSpaceOffset:], space)
+	copy(profile[iccSignatureOffset:], iccSignature)
+	return profile
+}
+
+func TestCopyColorProfileSkipsOtherColorSpaces(t *testing.T) {
+	jpegWith := func(space string) []byte {
+		return withJPEGSegments(encodeTestImage(t, FormatJPEG, 4, 2), iccSegment(1, 1, string(iccProfile(space))))
+	}
+	var grayJPEG bytes.Buffer
+	if err := jpeg.Encode(&grayJPEG, image.NewGray(image.Rect(0, 0, 2, 4)), nil); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	pngWith := func(space string) []byte {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		if _, err := w.Write(iccProfile(space)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		return withPNGChunks(t, encodeTestImage(t, FormatPNG, 4, 2),
+			testPNGChunk("iCCP", append([]byte("profile\x00\x00"), compressed.Bytes()...)))
+	}
+	webpWith := func(space string) []byte {
+		chunks, _ := webpChunks(encodeTestImage(t, FormatWebP, 4, 2))
+		chunks, _ = extendWebP(chunks)
+		chunks[0].data[0] |= webpFlagICC
+		return encodeWebP(slices.Insert(chunks, 1, webpChunk{fourCC: "ICCP", data: iccProfile(space)}))
+	}
+
+	tests := []struct {
+		name   string
+		format Format
+		src    []byte
+		dst    []byte
+		want   bool
+	}{
+		{name: "JPEG RGB", format: FormatJPEG, src: jpegWith("RGB "), dst: encodeTestImage(t, FormatJPEG, 2, 4), want: true},
+		{name: "JPEG CMYK", format: FormatJPEG, src: jpegWith("CMYK"), dst: encodeTestImage(t, FormatJPEG, 2, 4)},
+		{name: "JPEG gray", format: FormatJPEG, src: jpegWith("GRAY"), dst: grayJPEG.Bytes(), want: true},
+		{name: "JPEG RGB on gray", format: FormatJPEG, src: jpegWith("RGB "), dst: grayJPEG.Bytes()},
+		{name: "PNG RGB", format: FormatPNG, src: pngWith("RGB "), dst: encodeTestImage(t, FormatPNG, 2, 4), want: true},
+		{name: "PNG gray", format: FormatPNG, src: pngWith("GRAY"), dst: encodeTestImage(t, FormatPNG, 2, 4)},
+		{name: "WebP RGB", format: FormatWebP, src: webpWith("RGB "), dst: encodeTestImage(t, FormatWebP, 2, 4), want: true},
+		{name: "WebP CMYK", format: FormatWebP, src: webpWith("CMYK"), dst: encodeTestImage(t, FormatWebP, 2, 4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := copyColorProfile(tt.dst, tt.src, tt.format)
+			if err != nil {
+				t.Fatalf("copyColorProfile: %v", err)
+			}
+			if copied := !bytes.Equal(out, tt.dst); copied != tt.want {
+				t.Errorf("copyColorProfile() copied the profile = %v, want %v", copied, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Orientation is the EXIF orientation tag value.
+type Orientation uint16
+
+const (
+	OrientationNormal     Orientation = 1
+	OrientationFlipH      Orientation = 2
+	OrientationRotate180  Orientation = 3
+	OrientationFlipV      Orientation = 4
+	OrientationTranspose  Orientation = 5
+	OrientationRotate90   Orientation = 6 // rotate 90° clockwise to display
+	OrientationTransverse Orientation = 7
+	OrientationRotate270  Orientation = 8 // rotate 90° counter-clockwise to display
+)
+
+func (o Orientation) IsValid() bool {
+	return o >= OrientationNormal && o <= OrientationRotate270
+}
+
+// SwapsDimensions reports whether applying the orientation swaps width and height.
+func (o Orientation) SwapsDimensions() bool {
+	return o >= OrientationTranspose && o <= OrientationRotate270
+}
+
+// ApplyOrientation returns the image as it should be displayed, so that the
+// EXIF orientation tag can be dropped.
+func ApplyOrientation(img image.Image, o Orientation) image.Image {
+	if o == OrientationNormal || !o.IsValid() {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	width, height := bounds.Dx(), bounds.Dy()
+	dstWidth, dstHeight := width, height
+	if o.SwapsDimensions() {
+		dstWidth, dstHeight = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	const bytesPerPixel = 4
+	for y := range height {
+		for x := range width {
+			dx, dy := orientedPoint(o, x, y, width, height)
+			srcOffset := src.PixOffset(x, y)
+			dstOffset := dst.PixOffset(dx, dy)
+			copy(dst.Pix[dstOffset:dstOffset+bytesPerPixel], src.Pix[srcOffset:srcOffset+bytesPerPixel])
+		}
+	}
+
+	return dst
+}
+
+// orientedPoint maps a stored pixel position to its display position.
+func orientedPoint(o Orientation, x, y, width, height int) (int, int) {
+	switch o {
+	case OrientationFlipH:
+		return width - 1 - x, y
+	case OrientationRotate180:
+		return width - 1 - x, height - 1 - y
+	case OrientationFlipV:
+		return x, height - 1 - y
+	case OrientationTranspose:
+		return y, x
+	case OrientationRotate90:
+		return height - 1 - y, x
+	case OrientationTransverse:
+		return height - 1 - y, width - 1 - x
+	case OrientationRotate270:
+		return y, width - 1 - x
+	case OrientationNormal:
+		return x, y
+	default:
+		return x, y
+	}
+}
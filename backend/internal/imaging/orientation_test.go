@@ -0,0 +1,69 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	// The stored image is 3x2 with a distinct grey level per pixel:
+	//
+	//	a b c
+	//	d e f
+	const a, b, c, d, e, f = 10, 20, 30, 40, 50, 60
+	stored := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i, level := range []uint8{a, b, c, d, e, f} {
+		stored.SetGray(i%3, i/3, color.Gray{Y: level})
+	}
+
+	tests := []struct {
+		orientation Orientation
+		want        [][]uint8 // rows as displayed
+	}{
+		{OrientationNormal, [][]uint8{{a, b, c}, {d, e, f}}},
+		{OrientationFlipH, [][]uint8{{c, b, a}, {f, e, d}}},
+		{OrientationRotate180, [][]uint8{{f, e, d}, {c, b, a}}},
+		{OrientationFlipV, [][]uint8{{d, e, f}, {a, b, c}}},
+		{OrientationTranspose, [][]uint8{{a, d}, {b, e}, {c, f}}},
+		{OrientationRotate90, [][]uint8{{d, a}, {e, b}, {f, c}}},
+		{OrientationTransverse, [][]uint8{{f, c}, {e, b}, {d, a}}},
+		{OrientationRotate270, [][]uint8{{c, f}, {b, e}, {a, d}}},
+		{Orientation(0), [][]uint8{{a, b, c}, {d, e, f}}},
+		{Orientation(9), [][]uint8{{a, b, c}, {d, e, f}}},
+	}
+	for _, tt := range tests {
+		got := ApplyOrientation(stored, tt.orientation)
+
+		bounds := got.Bounds()
+		if bounds.Dx() != len(tt.want[0]) || bounds.Dy() != len(tt.want) {
+			t.Errorf("orientation %d: size = %dx%d, want %dx%d",
+				tt.orientation, bounds.Dx(), bounds.Dy(), len(tt.want[0]), len(tt.want))
+			continue
+		}
+		if swaps := bounds.Dx() != stored.Bounds().Dx(); swaps != tt.orientation.SwapsDimensions() {
+			t.Errorf("orientation %d: SwapsDimensions() = %v", tt.orientation, tt.orientation.SwapsDimensions())
+		}
+		for y, row := range tt.want {
+			for x, level := range row {
+				if gray := color.GrayModel.Convert(got.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray); gray.Y != level {
+					t.Errorf("orientation %d: pixel (%d, %d) = %d, want %d", tt.orientation, x, y, gray.Y, level)
+				}
+			}
+		}
+	}
+}
+
+// Images decoded from a sub-rectangle don't start at the origin.
+func TestApplyOrientationOffsetBounds(t *testing.T) {
+	img := image.NewGray(image.Rect(5, 7, 8, 9))
+	img.SetGray(5, 7, color.Gray{Y: 10})
+
+	got := ApplyOrientation(img, OrientationRotate90)
+	if bounds := got.Bounds(); bounds != image.Rect(0, 0, 2, 3) {
+		t.Fatalf("bounds = %v, want %v", bounds, image.Rect(0, 0, 2, 3))
+	}
+	if gray := color.GrayModel.Convert(got.At(1, 0)).(color.Gray); gray.Y != 10 {
+		t.Errorf("top-left stored pixel ended up with %d at the top right, want 10", gray.Y)
+	}
+}
@@ -0,0 +1,35 @@
+package imaging
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Fit scales the image down so that neither side exceeds maxDimension,
+// keeping the aspect ratio. Images that already fit are returned unchanged.
+func Fit(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return img
+	}
+
+	dstWidth, dstHeight := FitDimensions(width, height, maxDimension)
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// FitDimensions returns the size of a width x height image scaled down to fit
+// into a maxDimension square.
+func FitDimensions(width, height, maxDimension int) (int, int) {
+	if maxDimension <= 0 || (width <= maxDimension && height <= maxDimension) {
+		return width, height
+	}
+
+	if width >= height {
+		return maxDimension, max(1, height*maxDimension/width)
+	}
+	return max(1, width*maxDimension/height), maxDimension
+}
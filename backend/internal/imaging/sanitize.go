@@ -0,0 +1,82 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+// Sanitized is an image ready to be stored: the EXIF orientation has been
+// applied to the pixels and only allowlisted metadata is left.
+type Sanitized struct {
+	Data   []byte
+	Format Format
+	Width  int
+	Height int
+	// Exif holds all readable tags of the original file, nil if it had none.
+	Exif map[string]any
+}
+
+type Sanitizer struct {
+	cfg *config.ImageConfig
+}
+
+func NewSanitizer(cfg *config.ImageConfig) *Sanitizer {
+	return &Sanitizer{cfg: cfg}
+}
+
+// Sanitize normalises the orientation of a validated image and strips GPS and
+// any other metadata that is not in the configured allowlist. The pixel data
+// is only re-encoded when the orientation has to be applied, keeping the
+// colour profile of the original.
+func (s *Sanitizer) Sanitize(data []byte, info *Info) (*Sanitized, error) {
+	result := &Sanitized{
+		Data:   data,
+		Format: info.Format,
+		Width:  info.Width,
+		Height: info.Height,
+	}
+
+	rawExif, err := ExtractExif(data, info.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract EXIF: %w", err)
+	}
+
+	var keptExif []byte
+	orientation := OrientationNormal
+	// Unreadable EXIF is simply dropped along with the rest of the metadata.
+	if exif, parseErr := ParseExif(rawExif); len(rawExif) > 0 && parseErr == nil {
+		result.Exif = exif.Map()
+		orientation = exif.Orientation()
+		if filtered := exif.Filter(s.cfg.ExifAllowlist); !filtered.IsEmpty() {
+			keptExif = filtered.Encode()
+		}
+	}
+
+	if orientation != OrientationNormal {
+		img, _, decodeErr := image.Decode(bytes.NewReader(data))
+		if decodeErr != nil {
+			return nil, fmt.Errorf("failed to decode image: %w", decodeErr)
+		}
+
+		oriented := ApplyOrientation(img, orientation)
+		result.Data, err = Encode(oriented, info.Format, s.cfg.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		if result.Data, err = copyColorProfile(result.Data, data, info.Format); err != nil {
+			return nil, fmt.Errorf("failed to keep colour profile: %w", err)
+		}
+		result.Width = oriented.Bounds().Dx()
+		result.Height = oriented.Bounds().Dy()
+	}
+
+	result.Data, err = ReplaceMetadata(result.Data, info.Format, keptExif)
+	if err != nil {
+		return nil, fmt.Errorf("failed to strip metadata: %w", err)
+	}
+
+	return result, nil
+}
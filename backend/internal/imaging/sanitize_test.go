@@ -0,0 +1,135 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+// photo returns a 4x2 image in format carrying tiff as its EXIF and an ICC
+// profile, laid out the way cameras and editors write them.
+func photo(t testing.TB, format Format, tiff []byte) []byte {
+	t.Helper()
+
+	data := encodeTestImage(t, format, 4, 2)
+	switch format {
+	case FormatJPEG:
+		return withJPEGSegments(data,
+			testJPEGSegment(jpegAPP1, append(slices.Clone(jpegExifPrefix), tiff...)),
+			iccSegment(1, 1, "profile"))
+	case FormatPNG:
+		return withPNGChunks(t, data,
+			testPNGChunk("iCCP", []byte("profile\x00\x00compressed")),
+			testPNGChunk("eXIf", tiff))
+	case FormatWebP:
+		chunks, err := webpChunks(data)
+		if err != nil {
+			t.Fatalf("webpChunks: %v", err)
+		}
+		if chunks, err = extendWebP(chunks); err != nil {
+			t.Fatalf("extendWebP: %v", err)
+		}
+		chunks[0].data[0] |= webpFlagICC | webpFlagEXIF
+		return encodeWebP([]webpChunk{
+			chunks[0],
+			{fourCC: "ICCP", data: []byte("profile")},
+			chunks[1],
+			{fourCC: "EXIF", data: tiff},
+		})
+	default:
+		t.Fatalf("unexpected format %s", format)
+		return nil
+	}
+}
+
+func hasColorProfile(t *testing.T, data []byte, format Format) bool {
+	t.Helper()
+
+	switch format {
+	case FormatJPEG:
+		return bytes.Contains(data, iccSegment(1, 1, "profile"))
+	case FormatPNG:
+		return slices.Contains(pngTypes(t, data), "iCCP")
+	default:
+		return slices.Contains(webpFourCCs(t, data), "ICCP")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	sanitizer := NewSanitizer(&config.ImageConfig{
+		JPEGQuality:   95,
+		ExifAllowlist: []string{"Make", "ExposureTime", "Orientation", "GPSLatitude"},
+	})
+	wantKept := map[string]any{
+		"ifd0": map[string]any{"Make": "Canon"},
+		"exif": map[string]any{"ExposureTime": 0.004},
+	}
+
+	for _, format := range []Format{FormatJPEG, FormatPNG, FormatWebP} {
+		t.Run(string(format), func(t *testing.T) {
+			for _, orientation := range []Orientation{OrientationNormal, OrientationRotate90} {
+				data := photo(t, format, cameraTIFF(binary.BigEndian, orientation))
+				result, err := sanitizer.Sanitize(data, &Info{Format: format, Width: 4, Height: 2})
+				if err != nil {
+					t.Fatalf("Sanitize: %v", err)
+				}
+
+				original, _ := ParseExif(cameraTIFF(binary.BigEndian, orientation))
+				if !reflect.DeepEqual(result.Exif, original.Map()) {
+					t.Errorf("orientation %d: Exif = %v, want all original tags", orientation, result.Exif)
+				}
+				if got := exifMap(t, result.Data, format); !reflect.DeepEqual(got, wantKept) {
+					t.Errorf("orientation %d: stored EXIF = %v, want %v", orientation, got, wantKept)
+				}
+				if !hasColorProfile(t, result.Data, format) {
+					t.Errorf("orientation %d: colour profile was dropped", orientation)
+				}
+
+				if orientation == OrientationNormal {
+					// Without an orientation only the metadata is rewritten.
+					kept, _ := ExtractExif(result.Data, format)
+					want, _ := ReplaceMetadata(data, format, kept)
+					if !bytes.Equal(result.Data, want) || result.Width != 4 || result.Height != 2 {
+						t.Errorf("unoriented image was re-encoded")
+					}
+					continue
+				}
+
+				if result.Width != 2 || result.Height != 4 {
+					t.Errorf("size = %dx%d, want 2x4", result.Width, result.Height)
+				}
+				img := decodeTestImage(t, result.Data, 2, 4)
+				if format == FormatJPEG {
+					continue // lossy
+				}
+				// Rotating 90° clockwise moves the stored top-left pixel to the top right.
+				want := testImage(4, 2).NRGBAAt(0, 0)
+				if got := color.NRGBAModel.Convert(img.At(1, 0)); got != want {
+					t.Errorf("top-right pixel = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSanitizeDropsUnreadableExif(t *testing.T) {
+	sanitizer := NewSanitizer(&config.ImageConfig{JPEGQuality: 95, ExifAllowlist: []string{"Make"}})
+	data := photo(t, FormatJPEG, []byte("MM\x00\x2A garbage"))
+
+	result, err := sanitizer.Sanitize(data, &Info{Format: FormatJPEG, Width: 4, Height: 2})
+	if err != nil {
+		t.Fatalf("Sanitize: %v", err)
+	}
+	if result.Exif != nil {
+		t.Errorf("Exif = %v, want nil", result.Exif)
+	}
+	if got := exifMap(t, result.Data, FormatJPEG); got != nil {
+		t.Errorf("stored EXIF = %v, want none", got)
+	}
+	decodeTestImage(t, result.Data, 4, 2)
+}
@@ -0,0 +1,161 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+
+	_ "golang.org/x/image/webp" // register WebP decoder
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+var (
+	ErrUnsupportedFormat  = errors.New("unsupported image format")
+	ErrFileTooLarge       = errors.New("image file is too large")
+	ErrDimensionsTooLarge = errors.New("image dimensions exceed limits")
+	ErrCorruptImage       = errors.New("image data is corrupt")
+	ErrEmptyFile          = errors.New("image file is empty")
+)
+
+// ValidationError describes why an uploaded image was rejected.
+// Details are safe to return to the client as-is.
+type ValidationError struct {
+	Err     error
+	Details map[string]any
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Info holds the validated properties of an image.
+type Info struct {
+	Format Format
+	Width  int
+	Height int
+	Size   int64
+}
+
+type Validator struct {
+	cfg *config.ImageConfig
+}
+
+func NewValidator(cfg *config.ImageConfig) *Validator {
+	return &Validator{cfg: cfg}
+}
+
+// ReadLimited reads the whole upload into memory, refusing to read more than
+// the configured maximum number of bytes.
+func (v *Validator) ReadLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, v.cfg.MaxUploadBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	if int64(len(data)) > v.cfg.MaxUploadBytes {
+		return nil, &ValidationError{
+			Err: ErrFileTooLarge,
+			Details: map[string]any{
+				"max_bytes": v.cfg.MaxUploadBytes,
+			},
+		}
+	}
+
+	return data, nil
+}
+
+// Validate checks the image content: the format is detected by magic bytes,
+// the header is decoded to get the dimensions, and the dimensions are checked
+// against the configured limits before the pixel data is fully decoded.
+func (v *Validator) Validate(data []byte) (*Info, error) {
+	size := int64(len(data))
+	if size == 0 {
+		return nil, &ValidationError{Err: ErrEmptyFile}
+	}
+
+	if size > v.cfg.MaxUploadBytes {
+		return nil, &ValidationError{
+			Err: ErrFileTooLarge,
+			Details: map[string]any{
+				"size":      size,
+				"max_bytes": v.cfg.MaxUploadBytes,
+			},
+		}
+	}
+
+	format, ok := SniffFormat(data)
+	if !ok {
+		return nil, &ValidationError{
+			Err: ErrUnsupportedFormat,
+			Details: map[string]any{
+				"supported_formats": []string{FormatJPEG.String(), FormatPNG.String(), FormatWebP.String()},
+			},
+		}
+	}
+
+	cfg, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || Format(decodedFormat) != format {
+		return nil, &ValidationError{
+			Err: ErrCorruptImage,
+			Details: map[string]any{
+				"format": format.String(),
+				"reason": "failed to decode image header",
+			},
+		}
+	}
+
+	if err = v.checkDimensions(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+
+	// The dimensions are bounded at this point, so decoding the pixel data
+	// cannot be used as a decompression bomb.
+	if _, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, &ValidationError{
+			Err: ErrCorruptImage,
+			Details: map[string]any{
+				"format": format.String(),
+				"reason": "failed to decode image data",
+			},
+		}
+	}
+
+	return &Info{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		Size:   size,
+	}, nil
+}
+
+func (v *Validator) checkDimensions(width, height int) error {
+	details := map[string]any{
+		"width":         width,
+		"height":        height,
+		"max_dimension": v.cfg.MaxDimension,
+		"max_pixels":    v.cfg.MaxPixels,
+	}
+
+	if width <= 0 || height <= 0 {
+		return &ValidationError{Err: ErrCorruptImage, Details: details}
+	}
+
+	if width > v.cfg.MaxDimension || height > v.cfg.MaxDimension {
+		return &ValidationError{Err: ErrDimensionsTooLarge, Details: details}
+	}
+
+	if int64(width)*int64(height) > v.cfg.MaxPixels {
+		return &ValidationError{Err: ErrDimensionsTooLarge, Details: details}
+	}
+
+	return nil
+}
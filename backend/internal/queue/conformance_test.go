@@ -0,0 +1,195 @@
+package queue_test
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/database"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+	"github.com/Helltale/beer-mania/backend/internal/queue/queuetest"
+	"github.com/Helltale/beer-mania/backend/migrations"
+
+	"github.com/google/uuid"
+	"github.com/ilyakaznacheev/cleanenv"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// The broker and database suites empty the queues they run against, so they
+// only run when asked for. Once asked for, an unreachable broker or database
+// fails the suite rather than skipping it, so CI can't pass without running
+// it.
+//
+//nolint:gochecknoglobals // test flags
+var (
+	withRabbitMQ = flag.Bool("rabbitmq", false,
+		"run the conformance suite against the broker from RABBITMQ_* (purges its processing queues and DLQ)")
+	withPostgres = flag.Bool("postgres", false,
+		"run the conformance suite against the database from POSTGRES_* (deletes every queue job)")
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
+
+func TestMemoryQueueConformance(t *testing.T) {
+	queuetest.Run(t, func(t *testing.T, consumer *config.ConsumerConfig) *queuetest.Harness {
+		q := queue.NewMemoryQueue(consumer, testLogger())
+		t.Cleanup(func() {
+			if err := q.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		})
+
+		return &queuetest.Harness{
+			Queue: q,
+			PublishRaw: func(_ context.Context, body []byte) error {
+				return q.PublishRaw(entity.TaskPriorityNormal, body)
+			},
+		}
+	})
+}
+
+func TestRabbitMQQueueConformance(t *testing.T) {
+	if !*withRabbitMQ {
+		t.Skip("pass -rabbitmq to run against a local broker")
+	}
+
+	var cfg config.RabbitMQConfig
+	if err := cleanenv.ReadEnv(&cfg); err != nil {
+		t.Fatalf("failed to load rabbitmq configuration: %v", err)
+	}
+
+	conn, err := amqp.Dial(fmt.Sprintf("amqp://%s:%s@%s%s",
+		url.QueryEscape(cfg.User),
+		url.QueryEscape(cfg.Password),
+		net.JoinHostPort(cfg.Host, cfg.Port),
+		cfg.VHost))
+	if err != nil {
+		t.Fatalf("RabbitMQ is not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if closeErr := conn.Close(); closeErr != nil {
+			t.Errorf("failed to close connection: %v", closeErr)
+		}
+	})
+
+	queuetest.Run(t, func(t *testing.T, consumer *config.ConsumerConfig) *queuetest.Harness {
+		qcfg := cfg
+		qcfg.Prefetch = consumer.Concurrency
+
+		q, newErr := queue.NewRabbitMQQueueWithLogger(&qcfg, consumer, testLogger())
+		if newErr != nil {
+			t.Fatalf("NewRabbitMQQueue: %v", newErr)
+		}
+
+		channel, chErr := conn.Channel()
+		if chErr != nil {
+			t.Fatalf("failed to open channel: %v", chErr)
+		}
+		purge := func() {
+			for _, name := range []string{
+				queue.LaneQueueName(entity.TaskPriorityInteractive),
+				queue.LaneQueueName(entity.TaskPriorityNormal),
+				queue.LaneQueueName(entity.TaskPriorityBulk),
+				queue.DLQName,
+			} {
+				if _, purgeErr := channel.QueuePurge(name, false); purgeErr != nil {
+					t.Fatalf("failed to purge %s: %v", name, purgeErr)
+				}
+			}
+		}
+		purge()
+		t.Cleanup(func() {
+			if closeErr := q.Close(); closeErr != nil {
+				t.Errorf("Close: %v", closeErr)
+			}
+			purge()
+			if closeErr := channel.Close(); closeErr != nil {
+				t.Errorf("failed to close channel: %v", closeErr)
+			}
+		})
+
+		return &queuetest.Harness{
+			Queue: q,
+			PublishRaw: func(ctx context.Context, body []byte) error {
+				return channel.PublishWithContext(ctx, queue.ExchangeName, queue.RoutingKey, false, false,
+					amqp.Publishing{
+						ContentType:  "application/json",
+						Body:         body,
+						DeliveryMode: amqp.Persistent,
+						MessageId:    uuid.NewString(),
+					})
+			},
+		}
+	})
+}
+
+func TestPostgresQueueConformance(t *testing.T) {
+	if !*withPostgres {
+		t.Skip("pass -postgres to run against a local database")
+	}
+
+	var cfg config.Config
+	if err := cleanenv.ReadEnv(&cfg.Database); err != nil {
+		t.Fatalf("failed to load database configuration: %v", err)
+	}
+	if err := cleanenv.ReadEnv(&cfg.Queue); err != nil {
+		t.Fatalf("failed to load queue configuration: %v", err)
+	}
+
+	db, err := database.NewDB(&cfg.Database)
+	if err != nil {
+		t.Fatalf("PostgreSQL is not available: %v", err)
+	}
+	if err = db.Ping(t.Context()); err != nil {
+		t.Fatalf("PostgreSQL is not available: %v", err)
+	}
+	t.Cleanup(func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Errorf("failed to close database: %v", closeErr)
+		}
+	})
+
+	if err = migrations.RunMigrations(db.DB); err != nil {
+		t.Fatalf("RunMigrations: %v", err)
+	}
+
+	queuetest.Run(t, func(t *testing.T, consumer *config.ConsumerConfig) *queuetest.Harness {
+		purge := func() {
+			if purgeErr := db.Exec("DELETE FROM queue_jobs").Error; purgeErr != nil {
+				t.Fatalf("failed to delete queue jobs: %v", purgeErr)
+			}
+		}
+		purge()
+
+		qcfg := cfg
+		qcfg.Queue.Consumer = *consumer
+		q := queue.NewPostgresQueue(db.DB, &qcfg, testLogger())
+		t.Cleanup(func() {
+			if closeErr := q.Close(); closeErr != nil {
+				t.Errorf("Close: %v", closeErr)
+			}
+			purge()
+		})
+
+		return &queuetest.Harness{
+			Queue: q,
+			PublishRaw: func(ctx context.Context, body []byte) error {
+				return db.WithContext(ctx).Create(&entity.QueueJob{
+					MessageID: uuid.New(),
+					Lane:      entity.TaskPriorityNormal,
+					Status:    entity.QueueJobStatusReady,
+					Body:      body,
+				}).Error
+			},
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+)
+
+// Action tells the queue what to do with a delivery once it is handled.
+type Action int
+
+const (
+	// ActionAck removes the message from the queue.
+	ActionAck Action = iota
+	// ActionRetry puts the message back for another attempt, unless it has
+	// run out of attempts, in which case it is dead-lettered.
+	ActionRetry
+	// ActionDeadLetter moves the message to the DLQ without further attempts.
+	ActionDeadLetter
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAck:
+		return "ack"
+	case ActionRetry:
+		return "retry"
+	case ActionDeadLetter:
+		return "dead_letter"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is returned by a Handler. Err is recorded as the failure reason of
+// retried and dead-lettered messages.
+type Result struct {
+	Action Action
+	Err    error
+}
+
+func Ack() Result {
+	return Result{Action: ActionAck}
+}
+
+func Retry(err error) Result {
+	return Result{Action: ActionRetry, Err: err}
+}
+
+func DeadLetter(err error) Result {
+	return Result{Action: ActionDeadLetter, Err: err}
+}
+
+// Reason returns the failure reason to record with the message.
+func (r Result) Reason() string {
+	if r.Err == nil {
+		return r.Action.String()
+	}
+	return r.Err.Error()
+}
+
+// Handler processes one delivery. A handler interrupted by shutdown (its
+// context is cancelled) has its message redelivered whatever it returns,
+// except for Ack.
+type Handler func(d *Delivery) Result
+
+// Delivery is a message handed to a Handler together with its transport
+// metadata.
+type Delivery struct {
+	ctx context.Context //nolint:containedctx // scoped to a single handler call
+
+	Message *ProcessingMessage
+	// Attempt is 1 for the first delivery and grows with every retry and
+	// every redelivery after a consumer went away without acking.
+	Attempt       int
+	Redelivered   bool
+	Headers       map[string]any
+	CorrelationID string
+}
+
+func newDelivery(
+	ctx context.Context,
+	msg *ProcessingMessage,
+	attempt int,
+	redelivered bool,
+	headers map[string]any,
+	correlationID string,
+) *Delivery {
+	if correlationID == "" {
+		correlationID = msg.CorrelationID
+	}
+	if headers == nil {
+		headers = map[string]any{}
+	}
+	return &Delivery{
+		ctx:           ctx,
+		Message:       msg,
+		Attempt:       attempt,
+		Redelivered:   redelivered,
+		Headers:       headers,
+		CorrelationID: correlationID,
+	}
+}
+
+// Context is cancelled when the consumer shuts down and stops waiting for
+// the handler.
+func (d *Delivery) Context() context.Context {
+	return d.ctx
+}
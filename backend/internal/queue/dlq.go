@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// HeaderReplayCount counts how many times a message was replayed from the DLQ.
+	HeaderReplayCount = "x-replay-count"
+
+	headerDeath = "x-death"
+)
+
+// DeathRecord is one entry of the x-death header RabbitMQ adds when it
+// dead-letters a message itself (rejection, expiry, length limit).
+type DeathRecord struct {
+	Queue       string    `json:"queue"`
+	Reason      string    `json:"reason"`
+	Count       int64     `json:"count"`
+	Exchange    string    `json:"exchange,omitempty"`
+	RoutingKeys []string  `json:"routing_keys,omitempty"`
+	Time        time.Time `json:"time,omitzero"`
+}
+
+// DeadLetterMessage is a message found in the DLQ.
+type DeadLetterMessage struct {
+	MessageID     string             `json:"message_id,omitempty"`
+	CorrelationID string             `json:"correlation_id,omitempty"`
+	Timestamp     time.Time          `json:"timestamp,omitzero"`
+	Reason        string             `json:"reason,omitempty"`
+	ReplayCount   int64              `json:"replay_count,omitempty"`
+	Deaths        []DeathRecord      `json:"deaths,omitempty"`
+	Headers       map[string]any     `json:"headers,omitempty"`
+	ContentType   string             `json:"content_type,omitempty"`
+	Body          json.RawMessage    `json:"body,omitempty"`     // set when the body is valid JSON
+	RawBody       []byte             `json:"raw_body,omitempty"` // set otherwise, base64 in JSON
+	Message       *ProcessingMessage `json:"-"`
+	DecodeError   string             `json:"decode_error,omitempty"`
+}
+
+// ListDeadLetters returns up to limit messages from the head of the DLQ
+// (all of them if limit is 0) without removing them.
+func (q *RabbitMQQueue) ListDeadLetters(ctx context.Context, limit int) ([]DeadLetterMessage, error) {
+	var letters []DeadLetterMessage
+	err := q.browseDeadLetters(ctx, limit, func(delivery amqp.Delivery) (bool, error) {
+		letters = append(letters, newDeadLetterMessage(delivery))
+		return false, nil
+	})
+	return letters, err
+}
+
+// ReplayDeadLetters publishes the dead letters accepted by match back to the
+// lane they came from and removes them from the DLQ. The others are left in
+// place. It returns the number of replayed messages.
+func (q *RabbitMQQueue) ReplayDeadLetters(ctx context.Context, match func(*DeadLetterMessage) bool) (int, error) {
+	replayed := 0
+	err := q.browseDeadLetters(ctx, 0, func(delivery amqp.Delivery) (bool, error) {
+		letter := newDeadLetterMessage(delivery)
+		if !match(&letter) {
+			return false, nil
+		}
+
+		routingKey := RoutingKey
+		if letter.Message != nil {
+			routingKey = LaneRoutingKey(letter.Message.Lane())
+		}
+
+		if err := q.channel.PublishWithContext(
+			ctx,
+			ExchangeName, // exchange
+			routingKey,   // routing key
+			false,        // mandatory
+			false,        // immediate
+			amqp.Publishing{
+				ContentType:   delivery.ContentType,
+				Body:          delivery.Body,
+				DeliveryMode:  amqp.Persistent,
+				MessageId:     delivery.MessageId,
+				CorrelationId: delivery.CorrelationId,
+				Timestamp:     delivery.Timestamp,
+				Headers:       replayHeaders(delivery.Headers, letter.ReplayCount+1),
+			},
+		); err != nil {
+			return false, fmt.Errorf("failed to replay message %s: %w", delivery.MessageId, err)
+		}
+
+		replayed++
+		q.logger.InfoContext(ctx, "Replayed dead letter",
+			"message_id", delivery.MessageId,
+			"correlation_id", delivery.CorrelationId)
+		return true, nil
+	})
+	return replayed, err
+}
+
+// PurgeDeadLetters drops every message in the DLQ and returns their number.
+func (q *RabbitMQQueue) PurgeDeadLetters(ctx context.Context) (int, error) {
+	count, err := q.channel.QueuePurge(DLQName, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge DLQ: %w", err)
+	}
+
+	q.logger.InfoContext(ctx, "Purged DLQ", "count", count)
+	return count, nil
+}
+
+// browseDeadLetters fetches DLQ messages one by one and hands them to visit,
+// which reports whether the message was consumed. Consumed messages are
+// acked; the rest are held unacked until the end and then requeued in one
+// go, so each message is visited exactly once and keeps its position.
+func (q *RabbitMQQueue) browseDeadLetters(
+	ctx context.Context,
+	limit int,
+	visit func(amqp.Delivery) (bool, error),
+) error {
+	var held []amqp.Delivery
+	defer func() {
+		for _, delivery := range held {
+			if err := delivery.Nack(false, true); err != nil {
+				q.logger.ErrorContext(ctx, "Failed to requeue dead letter", "message_id", delivery.MessageId, "error", err)
+			}
+		}
+	}()
+
+	for visited := 0; limit == 0 || visited < limit; visited++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		delivery, ok, err := q.channel.Get(DLQName, false)
+		if err != nil {
+			return fmt.Errorf("failed to get message from DLQ: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		consumed, err := visit(delivery)
+		if err != nil {
+			held = append(held, delivery)
+			return err
+		}
+
+		if !consumed {
+			held = append(held, delivery)
+			continue
+		}
+
+		if err = delivery.Ack(false); err != nil {
+			return fmt.Errorf("failed to remove message %s from DLQ: %w", delivery.MessageId, err)
+		}
+	}
+
+	return nil
+}
+
+func newDeadLetterMessage(delivery amqp.Delivery) DeadLetterMessage {
+	letter := DeadLetterMessage{
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		Timestamp:     delivery.Timestamp,
+		Headers:       delivery.Headers,
+		ContentType:   delivery.ContentType,
+		Deaths:        parseDeaths(delivery.Headers),
+	}
+
+	if json.Valid(delivery.Body) {
+		letter.Body = delivery.Body
+	} else {
+		letter.RawBody = delivery.Body
+	}
+
+	if reason, ok := delivery.Headers[HeaderDeadLetterReason].(string); ok {
+		letter.Reason = reason
+	} else if len(letter.Deaths) > 0 {
+		letter.Reason = letter.Deaths[0].Reason
+	}
+	letter.ReplayCount = headerInt(delivery.Headers[HeaderReplayCount])
+
+	msg, err := UnmarshalProcessingMessage(delivery.Body)
+	if err != nil {
+		letter.DecodeError = err.Error()
+	} else {
+		letter.Message = msg
+	}
+
+	return letter
+}
+
+func parseDeaths(headers amqp.Table) []DeathRecord {
+	entries, ok := headers[headerDeath].([]any)
+	if !ok {
+		return nil
+	}
+
+	deaths := make([]DeathRecord, 0, len(entries))
+	for _, entry := range entries {
+		table, isTable := entry.(amqp.Table)
+		if !isTable {
+			continue
+		}
+
+		death := DeathRecord{Count: headerInt(table["count"])}
+		death.Queue, _ = table["queue"].(string)
+		death.Reason, _ = table["reason"].(string)
+		death.Exchange, _ = table["exchange"].(string)
+		death.Time, _ = table["time"].(time.Time)
+		if keys, isList := table["routing-keys"].([]any); isList {
+			for _, key := range keys {
+				if s, isString := key.(string); isString {
+					death.RoutingKeys = append(death.RoutingKeys, s)
+				}
+			}
+		}
+		deaths = append(deaths, death)
+	}
+	return deaths
+}
+
+// replayHeaders drops the dead-lettering and retry headers so a replayed
+// message starts over with a full set of attempts, and records the replay
+// count.
+func replayHeaders(headers amqp.Table, replayCount int64) amqp.Table {
+	replay := amqp.Table{}
+	maps.Copy(replay, headers)
+
+	for key := range replay {
+		switch {
+		case key == headerDeath, key == HeaderDeadLetterReason, key == HeaderAttempt, key == HeaderLastError,
+			strings.HasPrefix(key, "x-first-death-"), strings.HasPrefix(key, "x-last-death-"):
+			delete(replay, key)
+		}
+	}
+	replay[HeaderReplayCount] = replayCount
+
+	return replay
+}
+
+func headerInt(value any) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+)
+
+// Lanes lists the priority lanes from the most to the least urgent. Each lane
+// is a separate queue, so a bulk import never sits in front of an interactive
+// request. The normal lane keeps the original queue name and routing key.
+//
+//nolint:gochecknoglobals // read-only lane table
+var Lanes = [...]entity.TaskPriority{
+	entity.TaskPriorityInteractive,
+	entity.TaskPriorityNormal,
+	entity.TaskPriorityBulk,
+}
+
+const laneCount = len(Lanes)
+
+// LaneQueueName returns the queue that holds tasks of the given priority.
+func LaneQueueName(priority entity.TaskPriority) string {
+	switch priority {
+	case entity.TaskPriorityInteractive, entity.TaskPriorityBulk:
+		return QueueName + "." + priority.String()
+	case entity.TaskPriorityNormal:
+		return QueueName
+	default:
+		return QueueName
+	}
+}
+
+// LaneRoutingKey returns the routing key that targets the given lane.
+func LaneRoutingKey(priority entity.TaskPriority) string {
+	switch priority {
+	case entity.TaskPriorityInteractive, entity.TaskPriorityBulk:
+		return RoutingKey + "." + priority.String()
+	case entity.TaskPriorityNormal:
+		return RoutingKey
+	default:
+		return RoutingKey
+	}
+}
+
+// laneSchedule spreads the lane indexes over one round in proportion to their
+// weights, interleaved (smooth weighted round-robin) so that a heavy lane
+// doesn't get all of its turns in a row. Weights 6,3,1 yield a round of ten
+// turns: six interactive, three normal and one bulk.
+func laneSchedule(weights []int) []int {
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+
+	schedule := make([]int, 0, total)
+	current := make([]int, len(weights))
+	for range total {
+		best := 0
+		for i, weight := range weights {
+			current[i] += weight
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		schedule = append(schedule, best)
+	}
+	return schedule
+}
@@ -0,0 +1,360 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+)
+
+var (
+	ErrQueueClosed = errors.New("queue is closed")
+)
+
+// MemoryQueue is an in-process Queue with the semantics of RabbitMQQueue:
+// priority lanes served by weight, retries at the tail of the lane, a
+// dead-letter list and draining shutdown. Messages are lost with the process,
+// so it is meant for tests and local runs only.
+type MemoryQueue struct {
+	cfg    *config.ConsumerConfig
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	lanes       [laneCount][]memoryMessage
+	unacked     [laneCount]int
+	deadLetters []DeadLetterMessage
+	// published is closed and replaced whenever a message becomes ready,
+	// which wakes idle workers.
+	published      chan struct{}
+	closed         bool
+	stopConsuming  context.CancelFunc
+	cancelHandlers context.CancelFunc
+	handlers       sync.WaitGroup
+}
+
+type memoryMessage struct {
+	body          []byte
+	correlationID string
+	attempt       int
+	redelivered   bool
+	lastError     string
+}
+
+func NewMemoryQueue(cfg *config.ConsumerConfig, logger *slog.Logger) *MemoryQueue {
+	return &MemoryQueue{
+		cfg:       cfg,
+		logger:    logger,
+		published: make(chan struct{}),
+	}
+}
+
+func (q *MemoryQueue) PublishTask(ctx context.Context, msg *ProcessingMessage) error {
+	body, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	if err = q.publish(msg.Lane(), memoryMessage{body: body, correlationID: msg.CorrelationID, attempt: 1}); err != nil {
+		return err
+	}
+
+	q.logger.InfoContext(ctx, "Published task",
+		"task_id", msg.TaskID,
+		"image_id", msg.ImageID,
+		"priority", msg.Lane(),
+		"message_id", msg.MessageID)
+	return nil
+}
+
+// PublishRaw queues body as is, without validating it, so that tests can
+// feed the consumer malformed messages.
+func (q *MemoryQueue) PublishRaw(lane entity.TaskPriority, body []byte) error {
+	return q.publish(lane, memoryMessage{body: body, attempt: 1})
+}
+
+func (q *MemoryQueue) publish(lane entity.TaskPriority, msg memoryMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+	i := laneIndex(lane)
+	q.lanes[i] = append(q.lanes[i], msg)
+	q.signalLocked()
+	return nil
+}
+
+// ConsumeTasks starts the configured number of handler goroutines and
+// returns. Shutdown drains them like RabbitMQQueue does.
+func (q *MemoryQueue) ConsumeTasks(ctx context.Context, handler Handler) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrQueueClosed
+	}
+	if q.stopConsuming != nil {
+		q.mu.Unlock()
+		return ErrAlreadyConsuming
+	}
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	// Handlers outlive ctx so they can drain; they are cancelled separately.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	q.stopConsuming, q.cancelHandlers = stopConsuming, cancelHandlers
+	q.mu.Unlock()
+
+	schedule := laneSchedule(q.cfg.LaneWeights)
+	for worker := range q.cfg.Concurrency {
+		q.handlers.Add(1)
+		go q.processMessages(consumeCtx, handlerCtx, schedule, worker, handler)
+	}
+
+	go func() {
+		<-consumeCtx.Done()
+		// Close stops consuming itself; only ctx needs handling here.
+		if ctx.Err() != nil {
+			q.shutdown(ctx)
+		}
+	}()
+
+	return nil
+}
+
+func (q *MemoryQueue) processMessages(
+	ctx context.Context,
+	handlerCtx context.Context,
+	schedule []int,
+	turn int,
+	handler Handler,
+) {
+	defer q.handlers.Done()
+
+	for ; ctx.Err() == nil; turn++ {
+		msg, lane, published, ok := q.next(schedule[turn%len(schedule)])
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-published:
+			}
+			continue
+		}
+
+		q.handleMessage(handlerCtx, msg, lane, handler)
+
+		q.mu.Lock()
+		q.unacked[lane]--
+		q.mu.Unlock()
+	}
+}
+
+// next takes a message from the preferred lane, otherwise from the most
+// urgent lane that has one. When every lane is empty it returns the channel
+// that is closed on the next publish.
+func (q *MemoryQueue) next(preferred int) (memoryMessage, int, <-chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	order := make([]int, 0, laneCount)
+	order = append(order, preferred)
+	for i := range laneCount {
+		if i != preferred {
+			order = append(order, i)
+		}
+	}
+
+	for _, i := range order {
+		if len(q.lanes[i]) > 0 {
+			msg := q.lanes[i][0]
+			q.lanes[i] = q.lanes[i][1:]
+			q.unacked[i]++
+			return msg, i, nil, true
+		}
+	}
+	return memoryMessage{}, 0, q.published, false
+}
+
+func (q *MemoryQueue) handleMessage(ctx context.Context, msg memoryMessage, lane int, handler Handler) {
+	processingMsg, unmarshalErr := UnmarshalProcessingMessage(msg.body)
+	if unmarshalErr != nil {
+		q.logger.WarnContext(ctx, "Failed to unmarshal message, sending to DLQ",
+			"unsupported_version", errors.Is(unmarshalErr, ErrUnsupportedSchemaVersion),
+			"error", unmarshalErr)
+		q.deadLetter(msg, unmarshalErr.Error())
+		return
+	}
+
+	headers := map[string]any{HeaderAttempt: int64(msg.attempt)}
+	if msg.lastError != "" {
+		headers[HeaderLastError] = msg.lastError
+	}
+
+	delivery := newDelivery(ctx, processingMsg, msg.attempt, msg.redelivered, headers, msg.correlationID)
+	result := handler(delivery)
+
+	if result.Action != ActionAck && ctx.Err() != nil {
+		// Aborted by shutdown, not a processing failure. Like a broker
+		// redelivery, it goes back to the head of its lane.
+		q.logger.WarnContext(ctx, "Task interrupted by shutdown, requeueing",
+			"task_id", processingMsg.TaskID,
+			"error", result.Err)
+		msg.attempt++
+		msg.redelivered = true
+		q.mu.Lock()
+		q.lanes[lane] = append([]memoryMessage{msg}, q.lanes[lane]...)
+		q.signalLocked()
+		q.mu.Unlock()
+		return
+	}
+
+	switch result.Action {
+	case ActionAck:
+		q.logger.InfoContext(ctx, "Task processed successfully", "task_id", processingMsg.TaskID)
+	case ActionRetry:
+		if msg.attempt >= q.cfg.MaxAttempts {
+			q.logger.WarnContext(ctx, "Task out of attempts, sending to DLQ",
+				"task_id", processingMsg.TaskID,
+				"attempt", msg.attempt,
+				"error", result.Err)
+			q.deadLetter(msg, fmt.Sprintf("gave up after %d attempts: %s", msg.attempt, result.Reason()))
+			return
+		}
+		q.logger.WarnContext(ctx, "Task processing failed, retrying",
+			"task_id", processingMsg.TaskID,
+			"attempt", msg.attempt,
+			"error", result.Err)
+		msg.attempt++
+		msg.redelivered = false
+		msg.lastError = result.Reason()
+		if err := q.publish(processingMsg.Lane(), msg); err != nil {
+			q.logger.ErrorContext(ctx, "Failed to requeue message for retry", "error", err)
+		}
+	case ActionDeadLetter:
+		q.logger.WarnContext(ctx, "Task processing failed, sending to DLQ",
+			"task_id", processingMsg.TaskID,
+			"attempt", msg.attempt,
+			"error", result.Err)
+		q.deadLetter(msg, result.Reason())
+	default:
+		q.logger.ErrorContext(ctx, "Unknown handler result, sending to DLQ", "action", result.Action)
+		q.deadLetter(msg, "unknown handler result "+result.Action.String())
+	}
+}
+
+func (q *MemoryQueue) deadLetter(msg memoryMessage, reason string) {
+	letter := DeadLetterMessage{
+		CorrelationID: msg.correlationID,
+		Timestamp:     time.Now().UTC(),
+		Reason:        reason,
+		ContentType:   "application/json",
+	}
+	if processingMsg, err := UnmarshalProcessingMessage(msg.body); err != nil {
+		letter.RawBody = msg.body
+		letter.DecodeError = err.Error()
+	} else {
+		letter.MessageID = processingMsg.MessageID.String()
+		letter.Body = msg.body
+		letter.Message = processingMsg
+	}
+
+	q.mu.Lock()
+	q.deadLetters = append(q.deadLetters, letter)
+	q.mu.Unlock()
+}
+
+// DeadLetters returns a copy of the dead-lettered messages.
+func (q *MemoryQueue) DeadLetters() []DeadLetterMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]DeadLetterMessage(nil), q.deadLetters...)
+}
+
+func (q *MemoryQueue) Stats(ctx context.Context) (*Stats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	consumers := 0
+	if q.stopConsuming != nil {
+		consumers = 1
+	}
+
+	stats := &Stats{
+		Lanes:       make(map[entity.TaskPriority]LaneStats, laneCount),
+		DeadLetters: len(q.deadLetters),
+	}
+	for i, lane := range Lanes {
+		stats.Lanes[lane] = LaneStats{
+			Ready:     len(q.lanes[i]),
+			Unacked:   q.unacked[i],
+			Consumers: consumers,
+		}
+	}
+	return stats, nil
+}
+
+// shutdown stops consuming and drains in-flight handlers. It is safe to call
+// more than once and before ConsumeTasks.
+func (q *MemoryQueue) shutdown(ctx context.Context) {
+	q.mu.Lock()
+	stopConsuming, cancelHandlers := q.stopConsuming, q.cancelHandlers
+	q.stopConsuming, q.cancelHandlers = nil, nil
+	q.mu.Unlock()
+
+	if cancelHandlers == nil {
+		return
+	}
+
+	stopConsuming()
+
+	drained := make(chan struct{})
+	go func() {
+		q.handlers.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(q.cfg.ShutdownTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		q.logger.WarnContext(ctx, "Shutdown timeout reached, cancelling in-flight handlers",
+			"timeout", q.cfg.ShutdownTimeout())
+		cancelHandlers()
+		<-drained
+	}
+	cancelHandlers()
+}
+
+// Close drains the consumer, if any. Messages still queued are dropped.
+func (q *MemoryQueue) Close() error {
+	q.shutdown(context.Background())
+
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	return nil
+}
+
+func (q *MemoryQueue) signalLocked() {
+	close(q.published)
+	q.published = make(chan struct{})
+}
+
+func laneIndex(lane entity.TaskPriority) int {
+	for i, l := range Lanes {
+		if l == lane {
+			return i
+		}
+	}
+	return laneIndex(entity.TaskPriorityNormal)
+}
@@ -4,13 +4,75 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
 
 	"github.com/google/uuid"
 )
 
+// Message schema versions. Version 1 is the bare payload published before the
+// envelope existed; it has no schema_version field. Consumers must be able to
+// decode every version still in flight, so old decoders are only removed once
+// no producer publishes them any more.
+const (
+	SchemaVersionLegacy  = 1
+	SchemaVersionCurrent = 2
+)
+
+var (
+	ErrUnsupportedSchemaVersion = errors.New("unsupported message schema version")
+)
+
+// Envelope wraps every message published to the queue. Metadata lives in the
+// envelope so that payloads can evolve independently.
+type Envelope struct {
+	SchemaVersion int             `json:"schema_version"`
+	MessageID     uuid.UUID       `json:"message_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// ProcessingMessage asks the worker to process an image. The envelope fields
+// are not part of the payload; they are filled in on decode.
 type ProcessingMessage struct {
-	TaskID  uuid.UUID `json:"task_id"`
-	ImageID uuid.UUID `json:"image_id"`
+	MessageID     uuid.UUID `json:"-"`
+	CreatedAt     time.Time `json:"-"`
+	CorrelationID string    `json:"-"`
+	SchemaVersion int       `json:"-"` // version the message was decoded from
+
+	TaskID         uuid.UUID                 `json:"task_id"`
+	ImageID        uuid.UUID                 `json:"image_id"`
+	Priority       entity.TaskPriority       `json:"priority,omitempty"` // empty means normal
+	OptionsVersion int                       `json:"options_version,omitempty"`
+	Options        *entity.ProcessingOptions `json:"options,omitempty"`
+}
+
+// NewProcessingMessage creates a message with a fresh ID. The task ID is used
+// as correlation ID, so every delivery and replay of a task can be traced.
+func NewProcessingMessage(taskID, imageID uuid.UUID, options *entity.ProcessingOptions) *ProcessingMessage {
+	msg := &ProcessingMessage{
+		MessageID:     uuid.New(),
+		CreatedAt:     time.Now().UTC(),
+		CorrelationID: taskID.String(),
+		SchemaVersion: SchemaVersionCurrent,
+		TaskID:        taskID,
+		ImageID:       imageID,
+	}
+	if options != nil {
+		msg.OptionsVersion = entity.ProcessingOptionsVersion
+		msg.Options = options
+	}
+	return msg
+}
+
+// Lane returns the priority lane of the message.
+func (m *ProcessingMessage) Lane() entity.TaskPriority {
+	if m.Priority == "" {
+		return entity.TaskPriorityNormal
+	}
+	return m.Priority
 }
 
 func (m *ProcessingMessage) Validate() error {
@@ -20,25 +82,115 @@ func (m *ProcessingMessage) Validate() error {
 	if m.ImageID == uuid.Nil {
 		return errors.New("image_id cannot be nil")
 	}
+	if m.Priority != "" && !m.Priority.IsValid() {
+		return fmt.Errorf("unsupported priority %q", m.Priority)
+	}
+	if m.Options != nil {
+		if m.OptionsVersion != entity.ProcessingOptionsVersion {
+			return fmt.Errorf("unsupported options_version %d", m.OptionsVersion)
+		}
+		if err := m.Options.Validate(); err != nil {
+			return fmt.Errorf("invalid options: %w", err)
+		}
+	}
 	return nil
 }
 
+// Marshal encodes the message in the current envelope version.
 func (m *ProcessingMessage) Marshal() ([]byte, error) {
 	if err := m.Validate(); err != nil {
 		return nil, fmt.Errorf("message validation failed: %w", err)
 	}
-	return json.Marshal(m)
+
+	if m.MessageID == uuid.Nil {
+		m.MessageID = uuid.New()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	return json.Marshal(Envelope{
+		SchemaVersion: SchemaVersionCurrent,
+		MessageID:     m.MessageID,
+		CreatedAt:     m.CreatedAt,
+		CorrelationID: m.CorrelationID,
+		Payload:       payload,
+	})
 }
 
+// UnmarshalProcessingMessage decodes a message of any supported schema
+// version. A version newer than SchemaVersionCurrent is reported with
+// ErrUnsupportedSchemaVersion, so the consumer can dead-letter it instead of
+// guessing at its meaning.
 func UnmarshalProcessingMessage(data []byte) (*ProcessingMessage, error) {
-	var msg ProcessingMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
+	var probe struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal processing message: %w", err)
+	}
+
+	version := SchemaVersionLegacy
+	if probe.SchemaVersion != nil {
+		version = *probe.SchemaVersion
+	}
+
+	var (
+		msg *ProcessingMessage
+		err error
+	)
+	switch version {
+	case SchemaVersionLegacy:
+		msg, err = decodeLegacy(data)
+	case SchemaVersionCurrent:
+		msg, err = decodeEnvelope(data)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedSchemaVersion, version)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal processing message: %w", err)
 	}
+	msg.SchemaVersion = version
 
-	if err := msg.Validate(); err != nil {
+	if err = msg.Validate(); err != nil {
 		return nil, fmt.Errorf("unmarshaled message validation failed: %w", err)
 	}
 
+	return msg, nil
+}
+
+// decodeLegacy reads the bare payload of version 1. It carries no envelope
+// metadata; the task ID doubles as correlation ID like for new messages.
+func decodeLegacy(data []byte) (*ProcessingMessage, error) {
+	var msg ProcessingMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	msg.CorrelationID = msg.TaskID.String()
+	return &msg, nil
+}
+
+func decodeEnvelope(data []byte) (*ProcessingMessage, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if len(envelope.Payload) == 0 {
+		return nil, errors.New("envelope has no payload")
+	}
+
+	var msg ProcessingMessage
+	if err := json.Unmarshal(envelope.Payload, &msg); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	msg.MessageID = envelope.MessageID
+	msg.CreatedAt = envelope.CreatedAt
+	msg.CorrelationID = envelope.CorrelationID
 	return &msg, nil
 }
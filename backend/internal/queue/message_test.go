@@ -0,0 +1,156 @@
+package queue
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+//nolint:gochecknoglobals // test flag
+var update = flag.Bool("update", false, "rewrite golden files")
+
+//nolint:gochecknoglobals // fixed IDs shared by the golden files
+var (
+	goldenTaskID    = uuid.MustParse("6f1c3c1e-2d0b-4c55-9a4e-0c8f3e6b7a10")
+	goldenImageID   = uuid.MustParse("0b9e2f4a-7c1d-4e8b-a3f5-5d6c7b8a9e01")
+	goldenMessageID = uuid.MustParse("a4d7e8f9-1b2c-4d3e-8f5a-6b7c8d9e0f12")
+	goldenCreatedAt = time.Date(2025, time.January, 15, 10, 30, 0, 0, time.UTC)
+	goldenOptions   = entity.ProcessingOptions{
+		BottleStyle: "classic-lager",
+		Placement:   entity.BottlePlacementHand,
+		Scale:       1.2,
+	}
+)
+
+func readGolden(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	return bytes.TrimSpace(data)
+}
+
+func TestMarshalMatchesGolden(t *testing.T) {
+	options := goldenOptions
+	msg := NewProcessingMessage(goldenTaskID, goldenImageID, &options)
+	msg.MessageID = goldenMessageID
+	msg.CreatedAt = goldenCreatedAt
+
+	got, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	const name = "processing_message_v2.golden.json"
+	if *update {
+		if err = os.WriteFile(filepath.Join("testdata", name), append(got, '\n'), 0o600); err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+	}
+
+	if want := readGolden(t, name); !bytes.Equal(got, want) {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnmarshalGolden(t *testing.T) {
+	tests := []struct {
+		name          string
+		file          string
+		version       int
+		messageID     uuid.UUID
+		createdAt     time.Time
+		correlationID string
+		options       *entity.ProcessingOptions
+	}{
+		{
+			name:          "v1 without options",
+			file:          "processing_message_v1.golden.json",
+			version:       SchemaVersionLegacy,
+			correlationID: goldenTaskID.String(),
+		},
+		{
+			name:          "v1 with options",
+			file:          "processing_message_v1_options.golden.json",
+			version:       SchemaVersionLegacy,
+			correlationID: goldenTaskID.String(),
+			options:       &goldenOptions,
+		},
+		{
+			name:          "v2 envelope",
+			file:          "processing_message_v2.golden.json",
+			version:       SchemaVersionCurrent,
+			messageID:     goldenMessageID,
+			createdAt:     goldenCreatedAt,
+			correlationID: goldenTaskID.String(),
+			options:       &goldenOptions,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := UnmarshalProcessingMessage(readGolden(t, tt.file))
+			if err != nil {
+				t.Fatalf("UnmarshalProcessingMessage: %v", err)
+			}
+
+			if msg.SchemaVersion != tt.version {
+				t.Errorf("SchemaVersion = %d, want %d", msg.SchemaVersion, tt.version)
+			}
+			if msg.TaskID != goldenTaskID || msg.ImageID != goldenImageID {
+				t.Errorf("IDs = %s/%s, want %s/%s", msg.TaskID, msg.ImageID, goldenTaskID, goldenImageID)
+			}
+			if msg.MessageID != tt.messageID {
+				t.Errorf("MessageID = %s, want %s", msg.MessageID, tt.messageID)
+			}
+			if !msg.CreatedAt.Equal(tt.createdAt) {
+				t.Errorf("CreatedAt = %s, want %s", msg.CreatedAt, tt.createdAt)
+			}
+			if msg.CorrelationID != tt.correlationID {
+				t.Errorf("CorrelationID = %q, want %q", msg.CorrelationID, tt.correlationID)
+			}
+
+			switch {
+			case tt.options == nil && msg.Options != nil:
+				t.Errorf("Options = %+v, want nil", msg.Options)
+			case tt.options != nil && (msg.Options == nil || *msg.Options != *tt.options):
+				t.Errorf("Options = %+v, want %+v", msg.Options, tt.options)
+			}
+		})
+	}
+}
+
+func TestUnmarshalUnknownVersion(t *testing.T) {
+	_, err := UnmarshalProcessingMessage(readGolden(t, "processing_message_v3.golden.json"))
+	if !errors.Is(err, ErrUnsupportedSchemaVersion) {
+		t.Fatalf("error = %v, want ErrUnsupportedSchemaVersion", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	msg := NewProcessingMessage(goldenTaskID, goldenImageID, nil)
+
+	data, err := msg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	got, err := UnmarshalProcessingMessage(data)
+	if err != nil {
+		t.Fatalf("UnmarshalProcessingMessage: %v", err)
+	}
+
+	if got.MessageID != msg.MessageID || got.TaskID != msg.TaskID || got.Options != nil {
+		t.Errorf("round trip = %+v, want %+v", got, msg)
+	}
+}
@@ -0,0 +1,508 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// NotifyChannel is the LISTEN/NOTIFY channel signalled whenever a job
+// becomes ready. The payload is the lane.
+const NotifyChannel = "queue_jobs"
+
+var (
+	ErrAlreadyConsuming = errors.New("queue is already consuming")
+)
+
+// PostgresQueue keeps jobs in the queue_jobs table of the application
+// database, for deployments without a broker. Workers claim jobs with
+// SELECT ... FOR UPDATE SKIP LOCKED and hold them under a lease that is
+// renewed while the handler runs; a job whose lease runs out (the worker
+// died) is handed out again. Dead-lettered jobs stay in the table with the
+// dead status.
+type PostgresQueue struct {
+	db       *gorm.DB
+	dsn      string
+	cfg      *config.QueueConfig
+	consumer *config.ConsumerConfig
+	logger   *slog.Logger
+
+	mu             sync.Mutex
+	stopConsuming  context.CancelFunc
+	cancelHandlers context.CancelFunc
+	handlers       sync.WaitGroup
+	listener       sync.WaitGroup
+}
+
+// claimedJob is a job together with whether it was taken over from a
+// consumer whose lease ran out.
+type claimedJob struct {
+	entity.QueueJob
+	Redelivered bool
+}
+
+func NewPostgresQueue(db *gorm.DB, cfg *config.Config, logger *slog.Logger) *PostgresQueue {
+	return &PostgresQueue{
+		db:       db,
+		dsn:      cfg.Database.DSN(),
+		cfg:      &cfg.Queue,
+		consumer: &cfg.Queue.Consumer,
+		logger:   logger,
+	}
+}
+
+func (q *PostgresQueue) PublishTask(ctx context.Context, msg *ProcessingMessage) error {
+	body, err := msg.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	job := &entity.QueueJob{
+		MessageID:     msg.MessageID,
+		CorrelationID: msg.CorrelationID,
+		Lane:          msg.Lane(),
+		Status:        entity.QueueJobStatusReady,
+		Body:          body,
+	}
+
+	// The notification is only delivered once the insert commits.
+	err = q.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if createErr := tx.Create(job).Error; createErr != nil {
+			return createErr
+		}
+		return notify(tx, job.Lane)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	q.logger.InfoContext(ctx, "Published task",
+		"task_id", msg.TaskID,
+		"image_id", msg.ImageID,
+		"priority", msg.Lane(),
+		"message_id", msg.MessageID)
+	return nil
+}
+
+// ConsumeTasks starts the configured number of workers. They are woken by
+// NOTIFY when a job is published and poll as a fallback. Shutdown follows
+// RabbitMQQueue: in-flight handlers are drained, and the jobs of handlers
+// cancelled after the shutdown timeout are released for redelivery.
+func (q *PostgresQueue) ConsumeTasks(ctx context.Context, handler Handler) error {
+	q.mu.Lock()
+	if q.stopConsuming != nil {
+		q.mu.Unlock()
+		return ErrAlreadyConsuming
+	}
+	consumeCtx, stopConsuming := context.WithCancel(ctx)
+	// Handlers outlive ctx so they can drain; they are cancelled separately.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	q.stopConsuming, q.cancelHandlers = stopConsuming, cancelHandlers
+	q.mu.Unlock()
+
+	wake := make(chan struct{}, q.consumer.Concurrency)
+	q.listener.Add(1)
+	go q.listen(consumeCtx, wake)
+
+	schedule := laneSchedule(q.consumer.LaneWeights)
+	for worker := range q.consumer.Concurrency {
+		q.handlers.Add(1)
+		// Offset the schedule so workers don't all favour the same lane at once.
+		go q.processJobs(consumeCtx, handlerCtx, wake, schedule, worker, handler)
+	}
+
+	go func() {
+		<-consumeCtx.Done()
+		// Close stops consuming itself; only ctx needs handling here.
+		if ctx.Err() != nil {
+			q.shutdown(ctx)
+		}
+	}()
+
+	q.logger.InfoContext(ctx, "Started consuming from queue",
+		"table", entity.QueueJob{}.TableName(),
+		"concurrency", q.consumer.Concurrency,
+		"lane_weights", q.consumer.LaneWeights)
+
+	return nil
+}
+
+func (q *PostgresQueue) processJobs(
+	ctx context.Context,
+	handlerCtx context.Context,
+	wake <-chan struct{},
+	schedule []int,
+	turn int,
+	handler Handler,
+) {
+	defer q.handlers.Done()
+
+	for ; ctx.Err() == nil; turn++ {
+		job, err := q.claim(ctx, schedule[turn%len(schedule)])
+		if err != nil && ctx.Err() == nil {
+			q.logger.ErrorContext(ctx, "Failed to claim job", "error", err)
+		}
+		if job != nil {
+			q.handleJob(handlerCtx, job, handler)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-wake:
+		case <-time.After(q.cfg.PollInterval()):
+		}
+	}
+}
+
+// claim takes the next visible job from the preferred lane, otherwise from
+// the most urgent lane that has one. It returns nil if every lane is empty.
+func (q *PostgresQueue) claim(ctx context.Context, preferred int) (*claimedJob, error) {
+	order := make([]int, 0, laneCount)
+	order = append(order, preferred)
+	for i := range laneCount {
+		if i != preferred {
+			order = append(order, i)
+		}
+	}
+
+	for _, i := range order {
+		job, err := q.claimLane(ctx, Lanes[i])
+		if err != nil || job != nil {
+			return job, err
+		}
+	}
+	return nil, nil
+}
+
+// claimLane leases the oldest visible job of the lane. A job that still had
+// a lease was abandoned by its consumer, which makes this a redelivery.
+func (q *PostgresQueue) claimLane(ctx context.Context, lane entity.TaskPriority) (*claimedJob, error) {
+	var jobs []claimedJob
+	err := q.db.WithContext(ctx).Raw(`
+		WITH next AS (
+			SELECT id, lease IS NOT NULL AS redelivered
+			FROM queue_jobs
+			WHERE status = ? AND lane = ? AND visible_at <= now()
+			ORDER BY visible_at, seq
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE queue_jobs AS j
+		SET lease = ?,
+			attempt = j.attempt + 1,
+			visible_at = now() + make_interval(secs => ?),
+			updated_at = now()
+		FROM next
+		WHERE j.id = next.id
+		RETURNING j.*, next.redelivered`,
+		entity.QueueJobStatusReady, lane, uuid.New(), q.cfg.VisibilityTimeout().Seconds(),
+	).Scan(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+	return &jobs[0], nil
+}
+
+func (q *PostgresQueue) handleJob(ctx context.Context, job *claimedJob, handler Handler) {
+	processingMsg, unmarshalErr := UnmarshalProcessingMessage(job.Body)
+	if unmarshalErr != nil {
+		q.logger.WarnContext(ctx, "Failed to unmarshal message, sending to DLQ",
+			"message_id", job.MessageID,
+			"unsupported_version", errors.Is(unmarshalErr, ErrUnsupportedSchemaVersion),
+			"error", unmarshalErr)
+		q.deadLetter(ctx, job, unmarshalErr.Error())
+		return
+	}
+
+	headers := map[string]any{HeaderAttempt: int64(job.Attempt)}
+	if job.LastError != nil {
+		headers[HeaderLastError] = *job.LastError
+	}
+
+	stopRenewing := q.renewLease(ctx, job)
+	delivery := newDelivery(ctx, processingMsg, job.Attempt, job.Redelivered, headers, job.CorrelationID)
+	result := handler(delivery)
+	stopRenewing()
+
+	if result.Action != ActionAck && ctx.Err() != nil {
+		// Aborted by shutdown, not a processing failure.
+		q.logger.WarnContext(ctx, "Task interrupted by shutdown, requeueing",
+			"task_id", processingMsg.TaskID,
+			"error", result.Err)
+		q.release(ctx, job, job.LastError)
+		return
+	}
+
+	switch result.Action {
+	case ActionAck:
+		if err := q.ack(ctx, job); err != nil {
+			q.logger.ErrorContext(ctx, "Failed to acknowledge message", "error", err)
+		} else {
+			q.logger.InfoContext(ctx, "Task processed successfully", "task_id", processingMsg.TaskID)
+		}
+	case ActionRetry:
+		if job.Attempt >= q.consumer.MaxAttempts {
+			q.logger.WarnContext(ctx, "Task out of attempts, sending to DLQ",
+				"task_id", processingMsg.TaskID,
+				"attempt", job.Attempt,
+				"error", result.Err)
+			q.deadLetter(ctx, job, fmt.Sprintf("gave up after %d attempts: %s", job.Attempt, result.Reason()))
+			return
+		}
+		q.logger.WarnContext(ctx, "Task processing failed, retrying",
+			"task_id", processingMsg.TaskID,
+			"attempt", job.Attempt,
+			"error", result.Err)
+		reason := result.Reason()
+		q.release(ctx, job, &reason)
+	case ActionDeadLetter:
+		q.logger.WarnContext(ctx, "Task processing failed, sending to DLQ",
+			"task_id", processingMsg.TaskID,
+			"attempt", job.Attempt,
+			"error", result.Err)
+		q.deadLetter(ctx, job, result.Reason())
+	default:
+		q.logger.ErrorContext(ctx, "Unknown handler result, sending to DLQ", "action", result.Action)
+		q.deadLetter(ctx, job, "unknown handler result "+result.Action.String())
+	}
+}
+
+// renewLease pushes the visibility of the job forward while its handler
+// runs, so that slow handlers keep their job. The returned function stops
+// the renewal.
+func (q *PostgresQueue) renewLease(ctx context.Context, job *claimedJob) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(q.cfg.VisibilityTimeout() / 3) //nolint:mnd // renew well before expiry
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				result := q.db.WithContext(context.WithoutCancel(ctx)).Exec(`
+					UPDATE queue_jobs
+					SET visible_at = now() + make_interval(secs => ?), updated_at = now()
+					WHERE id = ? AND lease = ?`,
+					q.cfg.VisibilityTimeout().Seconds(), job.ID, job.Lease)
+				if result.Error != nil {
+					q.logger.WarnContext(ctx, "Failed to renew job lease", "message_id", job.MessageID, "error", result.Error)
+				} else if result.RowsAffected == 0 {
+					q.logger.WarnContext(ctx, "Job lease lost, it may be processed twice", "message_id", job.MessageID)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (q *PostgresQueue) ack(ctx context.Context, job *claimedJob) error {
+	result := q.db.WithContext(context.WithoutCancel(ctx)).
+		Where("id = ? AND lease = ?", job.ID, job.Lease).
+		Delete(&entity.QueueJob{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("lease of message %s expired before it was acked", job.MessageID)
+	}
+	return nil
+}
+
+// release makes the job visible again at the tail of its lane, recording
+// lastError as the reason of the failed attempt.
+func (q *PostgresQueue) release(ctx context.Context, job *claimedJob, lastError *string) {
+	err := q.db.WithContext(context.WithoutCancel(ctx)).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`
+			UPDATE queue_jobs
+			SET lease = NULL, visible_at = now(), last_error = ?, updated_at = now()
+			WHERE id = ? AND lease = ?`,
+			lastError, job.ID, job.Lease).Error; err != nil {
+			return err
+		}
+		return notify(tx, job.Lane)
+	})
+	if err != nil {
+		// The lease runs out and the job is handed out again anyway.
+		q.logger.ErrorContext(ctx, "Failed to release job", "message_id", job.MessageID, "error", err)
+	}
+}
+
+// deadLetter keeps the job with the dead status and the reason. If that
+// fails the lease runs out and the job is retried instead.
+func (q *PostgresQueue) deadLetter(ctx context.Context, job *claimedJob, reason string) {
+	err := q.db.WithContext(context.WithoutCancel(ctx)).Exec(`
+		UPDATE queue_jobs
+		SET status = ?, lease = NULL, dead_reason = ?, updated_at = now()
+		WHERE id = ? AND lease = ?`,
+		entity.QueueJobStatusDead, reason, job.ID, job.Lease).Error
+	if err != nil {
+		q.logger.ErrorContext(ctx, "Failed to dead-letter job", "message_id", job.MessageID, "error", err)
+	}
+}
+
+// listen wakes idle workers on NOTIFY. It needs a dedicated connection, which
+// is reopened after a failure; in the meantime workers fall back to polling.
+func (q *PostgresQueue) listen(ctx context.Context, wake chan<- struct{}) {
+	defer q.listener.Done()
+
+	for ctx.Err() == nil {
+		if err := q.waitForNotifications(ctx, wake); err != nil && ctx.Err() == nil {
+			q.logger.WarnContext(ctx, "Queue listener failed, polling until it reconnects", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.cfg.PollInterval()):
+			}
+		}
+	}
+}
+
+func (q *PostgresQueue) waitForNotifications(ctx context.Context, wake chan<- struct{}) error {
+	conn, err := pgx.Connect(ctx, q.dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() {
+		if closeErr := conn.Close(context.WithoutCancel(ctx)); closeErr != nil {
+			q.logger.WarnContext(ctx, "Failed to close queue listener connection", "error", closeErr)
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	for {
+		if _, err = conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		// Wake every idle worker; busy ones find the job on their next claim.
+		for range cap(wake) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Stats counts jobs per lane: visible jobs are ready and leased ones are
+// unacked, whichever process holds them. Consumers only reflects this
+// instance, as workers of other processes are not registered anywhere.
+func (q *PostgresQueue) Stats(ctx context.Context) (*Stats, error) {
+	var rows []struct {
+		Lane    entity.TaskPriority
+		Status  entity.QueueJobStatus
+		Ready   int
+		Unacked int
+		Total   int
+	}
+	err := q.db.WithContext(ctx).Raw(`
+		SELECT lane, status,
+			COUNT(*) FILTER (WHERE lease IS NULL OR visible_at <= now()) AS ready,
+			COUNT(*) FILTER (WHERE lease IS NOT NULL AND visible_at > now()) AS unacked,
+			COUNT(*) AS total
+		FROM queue_jobs
+		GROUP BY lane, status`).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	q.mu.Lock()
+	consumers := 0
+	if q.stopConsuming != nil {
+		consumers = 1
+	}
+	q.mu.Unlock()
+
+	stats := &Stats{Lanes: make(map[entity.TaskPriority]LaneStats, laneCount)}
+	for _, lane := range Lanes {
+		stats.Lanes[lane] = LaneStats{Consumers: consumers}
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case entity.QueueJobStatusDead:
+			stats.DeadLetters += row.Total
+		case entity.QueueJobStatusReady:
+			lane := stats.Lanes[row.Lane]
+			lane.Ready += row.Ready
+			lane.Unacked += row.Unacked
+			stats.Lanes[row.Lane] = lane
+		}
+	}
+
+	return stats, nil
+}
+
+// shutdown stops claiming and drains in-flight handlers. It is safe to call
+// more than once and before ConsumeTasks.
+func (q *PostgresQueue) shutdown(ctx context.Context) {
+	q.mu.Lock()
+	stopConsuming, cancelHandlers := q.stopConsuming, q.cancelHandlers
+	q.stopConsuming, q.cancelHandlers = nil, nil
+	q.mu.Unlock()
+
+	if cancelHandlers == nil {
+		return
+	}
+
+	q.logger.InfoContext(ctx, "Stopping consumer", "table", entity.QueueJob{}.TableName())
+	stopConsuming()
+
+	drained := make(chan struct{})
+	go func() {
+		q.handlers.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(q.consumer.ShutdownTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		q.logger.WarnContext(ctx, "Shutdown timeout reached, cancelling in-flight handlers",
+			"timeout", q.consumer.ShutdownTimeout())
+		cancelHandlers()
+		<-drained
+	}
+	cancelHandlers()
+	q.listener.Wait()
+
+	q.logger.InfoContext(ctx, "Consumer stopped", "table", entity.QueueJob{}.TableName())
+}
+
+// Close drains the consumer, if any. The database connection belongs to the
+// caller and stays open.
+func (q *PostgresQueue) Close() error {
+	q.shutdown(context.Background())
+	return nil
+}
+
+func notify(tx *gorm.DB, lane entity.TaskPriority) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", NotifyChannel, lane.String()).Error
+}
@@ -2,12 +2,35 @@ package queue
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 
-	"github.com/google/uuid"
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"gorm.io/gorm"
 )
 
 type Queue interface {
-	PublishTask(ctx context.Context, taskID uuid.UUID, imageID uuid.UUID) error
-	ConsumeTasks(ctx context.Context, handler func(taskID uuid.UUID, imageID uuid.UUID) error) error
+	PublishTask(ctx context.Context, msg *ProcessingMessage) error
+	// ConsumeTasks runs handler for each task until ctx is cancelled and acts
+	// on the Result it returns. The delivery context is cancelled when a
+	// shutdown gives up waiting for the handler; the task is then redelivered
+	// instead of retried or dead-lettered.
+	ConsumeTasks(ctx context.Context, handler Handler) error
+	// Stats reports the backlog of every lane and of the dead-letter queue.
+	Stats(ctx context.Context) (*Stats, error)
 	Close() error
 }
+
+// New opens the queue backend selected by QUEUE_BACKEND. The postgres
+// backend keeps its jobs in db.
+func New(cfg *config.Config, db *gorm.DB, logger *slog.Logger) (Queue, error) {
+	switch cfg.Queue.Backend {
+	case config.QueueBackendPostgres:
+		return NewPostgresQueue(db, cfg, logger), nil
+	case config.QueueBackendRabbitMQ:
+		return NewRabbitMQQueueWithLogger(&cfg.RabbitMQ, &cfg.Queue.Consumer, logger)
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.Queue.Backend)
+	}
+}
@@ -0,0 +1,381 @@
+// Package queuetest is the conformance suite of queue.Queue. Every
+// implementation runs it from its own test with a Factory that returns a
+// fresh, empty queue:
+//
+//	queuetest.Run(t, func(t *testing.T, consumer *config.ConsumerConfig) *queuetest.Harness {
+//		q := queue.NewMemoryQueue(consumer, slog.Default())
+//		t.Cleanup(func() { _ = q.Close() })
+//		return &queuetest.Harness{Queue: q, PublishRaw: ...}
+//	})
+package queuetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxAttempts is the attempt limit of the suite's consumer settings.
+	MaxAttempts = 3
+
+	waitTimeout  = 15 * time.Second
+	pollInterval = 20 * time.Millisecond
+	// settleTime is how long the suite waits to make sure something does not
+	// happen, such as a redelivery after an ack.
+	settleTime = 500 * time.Millisecond
+)
+
+// Harness is a queue under test.
+type Harness struct {
+	Queue queue.Queue
+	// PublishRaw publishes body to the normal lane as is, bypassing message
+	// validation, to check how the consumer handles malformed payloads.
+	PublishRaw func(ctx context.Context, body []byte) error
+}
+
+// Factory returns an empty queue that consumes with the given settings and
+// registers its cleanup with t. The suite calls Close itself as well, so
+// cleanup must tolerate a closed queue.
+type Factory func(t *testing.T, consumer *config.ConsumerConfig) *Harness
+
+// ConsumerConfig returns the consumer settings the suite runs with: one
+// handler, so that delivery order is observable, and a short shutdown
+// timeout.
+func ConsumerConfig() *config.ConsumerConfig {
+	return &config.ConsumerConfig{
+		Concurrency:            1,
+		ShutdownTimeoutSeconds: 1,
+		MaxAttempts:            MaxAttempts,
+		LaneWeights:            []int{6, 3, 1}, //nolint:mnd // default lane weights
+	}
+}
+
+// Run runs every conformance test against queues from factory.
+func Run(t *testing.T, factory Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		run  func(t *testing.T, h *Harness)
+	}{
+		{"PublishConsumeOrder", testPublishConsumeOrder},
+		{"Ack", testAck},
+		{"DeadLetter", testDeadLetter},
+		{"RetryUntilDeadLetter", testRetryUntilDeadLetter},
+		{"InvalidPayload", testInvalidPayload},
+		{"ContextCancellationStopsConsuming", testContextCancellation},
+		{"CloseIsIdempotent", testCloseIsIdempotent},
+		{"ConcurrentPublishers", testConcurrentPublishers},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, factory(t, ConsumerConfig()))
+		})
+	}
+}
+
+func testPublishConsumeOrder(t *testing.T, h *Harness) {
+	want := publish(t, h, 5) //nolint:mnd // a handful of messages
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.Ack()))
+
+	got := recorder.waitFor(t, len(want))
+	if !slices.Equal(taskIDs(got), want) {
+		t.Fatalf("delivered %v, want %v in publish order", taskIDs(got), want)
+	}
+	waitForStats(t, h, "empty queue", func(stats *queue.Stats) bool {
+		return stats.Ready() == 0 && stats.DeadLetters == 0
+	})
+}
+
+func testAck(t *testing.T, h *Harness) {
+	want := publish(t, h, 1)
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.Ack()))
+
+	got := recorder.waitFor(t, 1)
+	if got[0].taskID != want[0] {
+		t.Fatalf("delivered task %s, want %s", got[0].taskID, want[0])
+	}
+	if got[0].attempt != 1 {
+		t.Errorf("first delivery has attempt %d, want 1", got[0].attempt)
+	}
+
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != 1 {
+		t.Fatalf("acked message delivered %d times, want once", n)
+	}
+	waitForStats(t, h, "acked message removed", func(stats *queue.Stats) bool {
+		return stats.Ready() == 0 && unacked(stats) == 0 && stats.DeadLetters == 0
+	})
+}
+
+func testDeadLetter(t *testing.T, h *Harness) {
+	publish(t, h, 1)
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.DeadLetter(errors.New("poison message"))))
+
+	recorder.waitFor(t, 1)
+	waitForStats(t, h, "message dead-lettered", func(stats *queue.Stats) bool {
+		return stats.DeadLetters == 1 && stats.Ready() == 0
+	})
+
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != 1 {
+		t.Fatalf("dead-lettered message delivered %d times, want once", n)
+	}
+}
+
+func testRetryUntilDeadLetter(t *testing.T, h *Harness) {
+	want := publish(t, h, 1)
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.Retry(errors.New("temporary failure"))))
+
+	got := recorder.waitFor(t, MaxAttempts)
+	for i, d := range got {
+		if d.taskID != want[0] {
+			t.Fatalf("delivery %d is task %s, want %s", i, d.taskID, want[0])
+		}
+		if d.attempt != i+1 {
+			t.Errorf("delivery %d has attempt %d, want %d", i, d.attempt, i+1)
+		}
+	}
+
+	waitForStats(t, h, "message dead-lettered after the last attempt", func(stats *queue.Stats) bool {
+		return stats.DeadLetters == 1 && stats.Ready() == 0
+	})
+
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != MaxAttempts {
+		t.Fatalf("message delivered %d times, want %d", n, MaxAttempts)
+	}
+}
+
+func testInvalidPayload(t *testing.T, h *Harness) {
+	if err := h.PublishRaw(t.Context(), []byte("not a message")); err != nil {
+		t.Fatalf("PublishRaw: %v", err)
+	}
+	want := publish(t, h, 1)
+
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.Ack()))
+
+	got := recorder.waitFor(t, 1)
+	if got[0].taskID != want[0] {
+		t.Fatalf("delivered task %s, want %s", got[0].taskID, want[0])
+	}
+	waitForStats(t, h, "invalid payload dead-lettered", func(stats *queue.Stats) bool {
+		return stats.DeadLetters == 1 && stats.Ready() == 0
+	})
+
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != 1 {
+		t.Fatalf("handler called %d times, want once (the invalid payload must not reach it)", n)
+	}
+}
+
+func testContextCancellation(t *testing.T, h *Harness) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	recorder := &recorder{}
+	if err := h.Queue.ConsumeTasks(ctx, recorder.handle(queue.Ack())); err != nil {
+		t.Fatalf("ConsumeTasks: %v", err)
+	}
+
+	publish(t, h, 1)
+	recorder.waitFor(t, 1)
+
+	cancel()
+	waitForStats(t, h, "consumer stopped", func(stats *queue.Stats) bool {
+		return stats.Consumers() == 0
+	})
+
+	publish(t, h, 1)
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != 1 {
+		t.Fatalf("handler called %d times after the context was cancelled, want no new calls", n-1)
+	}
+	waitForStats(t, h, "message left in the queue", func(stats *queue.Stats) bool {
+		return stats.Ready() == 1
+	})
+}
+
+func testCloseIsIdempotent(t *testing.T, h *Harness) {
+	consume(t, h, (&recorder{}).handle(queue.Ack()))
+
+	if err := h.Queue.Close(); err != nil {
+		t.Fatalf("first Close: %v", err)
+	}
+	if err := h.Queue.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+}
+
+func testConcurrentPublishers(t *testing.T, h *Harness) {
+	const (
+		publishers = 8
+		perWorker  = 10
+	)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		published []uuid.UUID
+		errs      = make(chan error, publishers)
+	)
+	for range publishers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				msg := queue.NewProcessingMessage(uuid.New(), uuid.New(), nil)
+				if err := h.Queue.PublishTask(t.Context(), msg); err != nil {
+					errs <- err
+					return
+				}
+				mu.Lock()
+				published = append(published, msg.TaskID)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("PublishTask: %v", err)
+	}
+
+	recorder := &recorder{}
+	consume(t, h, recorder.handle(queue.Ack()))
+	got := taskIDs(recorder.waitFor(t, publishers*perWorker))
+
+	time.Sleep(settleTime)
+	if n := recorder.count(); n != publishers*perWorker {
+		t.Fatalf("handler called %d times, want %d", n, publishers*perWorker)
+	}
+
+	slices.SortFunc(got, compareUUID)
+	slices.SortFunc(published, compareUUID)
+	if !slices.Equal(got, published) {
+		t.Fatal("delivered tasks differ from the published ones")
+	}
+}
+
+type delivered struct {
+	taskID  uuid.UUID
+	attempt int
+}
+
+// recorder is a handler that records its deliveries and returns a fixed
+// result.
+type recorder struct {
+	mu         sync.Mutex
+	deliveries []delivered
+}
+
+func (r *recorder) handle(result queue.Result) queue.Handler {
+	return func(d *queue.Delivery) queue.Result {
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, delivered{taskID: d.Message.TaskID, attempt: d.Attempt})
+		r.mu.Unlock()
+		return result
+	}
+}
+
+func (r *recorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.deliveries)
+}
+
+func (r *recorder) waitFor(t *testing.T, n int) []delivered {
+	t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.deliveries) >= n {
+			got := slices.Clone(r.deliveries)
+			r.mu.Unlock()
+			return got
+		}
+		r.mu.Unlock()
+		time.Sleep(pollInterval)
+	}
+	t.Fatalf("got %d deliveries within %s, want %d", r.count(), waitTimeout, n)
+	return nil
+}
+
+func publish(t *testing.T, h *Harness, n int) []uuid.UUID {
+	t.Helper()
+
+	ids := make([]uuid.UUID, 0, n)
+	for range n {
+		msg := queue.NewProcessingMessage(uuid.New(), uuid.New(), nil)
+		if err := h.Queue.PublishTask(t.Context(), msg); err != nil {
+			t.Fatalf("PublishTask: %v", err)
+		}
+		ids = append(ids, msg.TaskID)
+	}
+	return ids
+}
+
+func consume(t *testing.T, h *Harness, handler queue.Handler) {
+	t.Helper()
+
+	if err := h.Queue.ConsumeTasks(t.Context(), handler); err != nil {
+		t.Fatalf("ConsumeTasks: %v", err)
+	}
+}
+
+func waitForStats(t *testing.T, h *Harness, what string, ok func(*queue.Stats) bool) {
+	t.Helper()
+
+	var (
+		stats *queue.Stats
+		err   error
+	)
+	deadline := time.Now().Add(waitTimeout)
+	for time.Now().Before(deadline) {
+		stats, err = h.Queue.Stats(t.Context())
+		if err == nil && ok(stats) {
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+	if err != nil {
+		t.Fatalf("waiting for %s: Stats: %v", what, err)
+	}
+	t.Fatalf("waiting for %s: last stats %+v", what, *stats)
+}
+
+func unacked(stats *queue.Stats) int {
+	total := 0
+	for _, lane := range stats.Lanes {
+		total += lane.Unacked
+	}
+	return total
+}
+
+func taskIDs(deliveries []delivered) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(deliveries))
+	for _, d := range deliveries {
+		ids = append(ids, d.taskID)
+	}
+	return ids
+}
+
+func compareUUID(a, b uuid.UUID) int {
+	return slices.Compare(a[:], b[:])
+}
@@ -2,14 +2,20 @@ package queue
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 
 	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
 
 	"github.com/google/uuid"
 )
@@ -21,18 +27,41 @@ const (
 	RoutingKey   = "image.processing"
 )
 
+const (
+	// HeaderSchemaVersion mirrors the envelope version for tooling that
+	// doesn't parse the body.
+	HeaderSchemaVersion = "x-schema-version"
+	// HeaderDeadLetterReason records why the consumer moved a message to the DLQ.
+	HeaderDeadLetterReason = "x-dead-letter-reason"
+	// HeaderAttempt is the attempt number of a retried message.
+	HeaderAttempt = "x-attempt"
+	// HeaderLastError records why the previous attempt failed.
+	HeaderLastError = "x-last-error"
+)
+
 type RabbitMQQueue struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-	cfg     *config.RabbitMQConfig
-	logger  *slog.Logger
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	cfg      *config.RabbitMQConfig
+	consumer *config.ConsumerConfig
+	logger   *slog.Logger
+
+	mu             sync.Mutex
+	consumerTags   []string
+	cancelHandlers context.CancelFunc
+	handlers       sync.WaitGroup
+	inFlight       [laneCount]atomic.Int64
 }
 
-func NewRabbitMQQueue(cfg *config.RabbitMQConfig) (*RabbitMQQueue, error) {
-	return NewRabbitMQQueueWithLogger(cfg, slog.Default())
+func NewRabbitMQQueue(cfg *config.RabbitMQConfig, consumer *config.ConsumerConfig) (*RabbitMQQueue, error) {
+	return NewRabbitMQQueueWithLogger(cfg, consumer, slog.Default())
 }
 
-func NewRabbitMQQueueWithLogger(cfg *config.RabbitMQConfig, logger *slog.Logger) (*RabbitMQQueue, error) {
+func NewRabbitMQQueueWithLogger(
+	cfg *config.RabbitMQConfig,
+	consumer *config.ConsumerConfig,
+	logger *slog.Logger,
+) (*RabbitMQQueue, error) {
 	hostPort := net.JoinHostPort(cfg.Host, cfg.Port)
 	amqpURL := fmt.Sprintf("amqp://%s:%s@%s%s",
 		url.QueryEscape(cfg.User),
@@ -54,10 +83,11 @@ func NewRabbitMQQueueWithLogger(cfg *config.RabbitMQConfig, logger *slog.Logger)
 	}
 
 	queue := &RabbitMQQueue{
-		conn:    conn,
-		channel: channel,
-		cfg:     cfg,
-		logger:  logger,
+		conn:     conn,
+		channel:  channel,
+		cfg:      cfg,
+		consumer: consumer,
+		logger:   logger,
 	}
 
 	if setupErr := queue.setup(); setupErr != nil {
@@ -101,45 +131,53 @@ func (q *RabbitMQQueue) setup() error {
 		return fmt.Errorf("failed to declare DLQ: %w", err)
 	}
 
-	_, err = q.channel.QueueDeclare(
-		QueueName, // name
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
+	for _, lane := range Lanes {
+		if err = q.declareLane(lane); err != nil {
+			return err
+		}
+	}
+
+	q.logger.Info("RabbitMQ setup completed",
+		"exchange", ExchangeName,
+		"queue", QueueName,
+		"dlq", DLQName)
+
+	return nil
+}
+
+func (q *RabbitMQQueue) declareLane(lane entity.TaskPriority) error {
+	name := LaneQueueName(lane)
+
+	_, err := q.channel.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
 		amqp.Table{
 			"x-dead-letter-exchange":    "", // Use default exchange for DLQ
 			"x-dead-letter-routing-key": DLQName,
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to declare queue: %w", err)
+		return fmt.Errorf("failed to declare queue %s: %w", name, err)
 	}
+
 	err = q.channel.QueueBind(
-		QueueName,    // queue name
-		RoutingKey,   // routing key
-		ExchangeName, // exchange
+		name,                 // queue name
+		LaneRoutingKey(lane), // routing key
+		ExchangeName,         // exchange
 		false,
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to bind queue: %w", err)
+		return fmt.Errorf("failed to bind queue %s: %w", name, err)
 	}
 
-	q.logger.Info("RabbitMQ setup completed",
-		"exchange", ExchangeName,
-		"queue", QueueName,
-		"dlq", DLQName)
-
 	return nil
 }
 
-func (q *RabbitMQQueue) PublishTask(ctx context.Context, taskID uuid.UUID, imageID uuid.UUID) error {
-	msg := &ProcessingMessage{
-		TaskID:  taskID,
-		ImageID: imageID,
-	}
-
+func (q *RabbitMQQueue) PublishTask(ctx context.Context, msg *ProcessingMessage) error {
 	body, err := msg.Marshal()
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
@@ -147,14 +185,20 @@ func (q *RabbitMQQueue) PublishTask(ctx context.Context, taskID uuid.UUID, image
 
 	err = q.channel.PublishWithContext(
 		ctx,
-		ExchangeName, // exchange
-		RoutingKey,   // routing key
-		false,        // mandatory
-		false,        // immediate
+		ExchangeName,               // exchange
+		LaneRoutingKey(msg.Lane()), // routing key
+		false,                      // mandatory
+		false,                      // immediate
 		amqp.Publishing{
-			ContentType:  "application/json",
-			Body:         body,
-			DeliveryMode: amqp.Persistent, // Make message persistent
+			ContentType:   "application/json",
+			Body:          body,
+			DeliveryMode:  amqp.Persistent, // Make message persistent
+			MessageId:     msg.MessageID.String(),
+			CorrelationId: msg.CorrelationID,
+			Timestamp:     msg.CreatedAt,
+			Headers: amqp.Table{
+				HeaderSchemaVersion: int32(SchemaVersionCurrent),
+			},
 		},
 	)
 	if err != nil {
@@ -162,95 +206,388 @@ func (q *RabbitMQQueue) PublishTask(ctx context.Context, taskID uuid.UUID, image
 	}
 
 	q.logger.InfoContext(ctx, "Published task",
-		"task_id", taskID,
-		"image_id", imageID)
+		"task_id", msg.TaskID,
+		"image_id", msg.ImageID,
+		"priority", msg.Lane(),
+		"message_id", msg.MessageID)
 	return nil
 }
 
+// ConsumeTasks starts the configured number of handler goroutines. When ctx
+// is cancelled (or Close is called) the queue stops taking new deliveries and
+// waits for in-flight handlers to finish; handlers still running after the
+// shutdown timeout see their context cancelled and their messages are
+// requeued for redelivery.
 func (q *RabbitMQQueue) ConsumeTasks(
 	ctx context.Context,
-	handler func(taskID uuid.UUID, imageID uuid.UUID) error,
+	handler Handler,
 ) error {
 	if err := q.channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
+		q.cfg.Prefetch, // prefetch count
+		0,              // prefetch size
+		false,          // global
 	); err != nil {
 		return fmt.Errorf("failed to set QoS: %w", err)
 	}
 
-	msgs, err := q.channel.Consume(
-		QueueName, // queue
-		"",        // consumer tag (empty = auto-generate)
-		false,     // auto-ack (false = manual ack)
-		false,     // exclusive
-		false,     // no-local
-		false,     // no-wait
-		nil,       // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register consumer: %w", err)
+	consumerTag := "beer-mania-" + uuid.NewString()
+	var lanes [laneCount]<-chan amqp.Delivery
+	consumerTags := make([]string, 0, laneCount)
+	for i, lane := range Lanes {
+		tag := consumerTag + "-" + lane.String()
+		msgs, err := q.channel.Consume(
+			LaneQueueName(lane), // queue
+			tag,                 // consumer tag
+			false,               // auto-ack (false = manual ack)
+			false,               // exclusive
+			false,               // no-local
+			false,               // no-wait
+			nil,                 // args
+		)
+		if err != nil {
+			q.cancelConsumers(ctx, consumerTags)
+			return fmt.Errorf("failed to register consumer for %s: %w", LaneQueueName(lane), err)
+		}
+		lanes[i] = msgs
+		consumerTags = append(consumerTags, tag)
 	}
 
-	q.logger.InfoContext(ctx, "Started consuming from queue", "queue", QueueName)
+	// Handlers outlive ctx so they can drain; they are cancelled separately.
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
 
-	go q.processMessages(ctx, msgs, handler)
+	q.mu.Lock()
+	q.consumerTags = consumerTags
+	q.cancelHandlers = cancelHandlers
+	q.mu.Unlock()
+
+	schedule := laneSchedule(q.consumer.LaneWeights)
+	for worker := range q.consumer.Concurrency {
+		q.handlers.Add(1)
+		// Offset the schedule so workers don't all favour the same lane at once.
+		go q.processMessages(handlerCtx, lanes, schedule, worker, handler)
+	}
+
+	go func() {
+		<-ctx.Done()
+		q.shutdown(ctx)
+	}()
+
+	q.logger.InfoContext(ctx, "Started consuming from queue",
+		"queue", QueueName,
+		"prefetch", q.cfg.Prefetch,
+		"concurrency", q.consumer.Concurrency,
+		"lane_weights", q.consumer.LaneWeights)
 
 	return nil
 }
 
 func (q *RabbitMQQueue) processMessages(
 	ctx context.Context,
-	msgs <-chan amqp.Delivery,
-	handler func(taskID uuid.UUID, imageID uuid.UUID) error,
+	lanes [laneCount]<-chan amqp.Delivery,
+	schedule []int,
+	turn int,
+	handler Handler,
 ) {
+	defer q.handlers.Done()
+
+	// Lane channels are closed once the consumers are cancelled and the
+	// deliveries already prefetched have been handed out.
+	for ; ; turn++ {
+		msg, lane, ok := nextDelivery(&lanes, schedule[turn%len(schedule)])
+		if !ok {
+			return
+		}
+		q.inFlight[lane].Add(1)
+		q.handleMessage(ctx, msg, handler)
+		q.inFlight[lane].Add(-1)
+	}
+}
+
+// nextDelivery takes a delivery from the preferred lane if one is waiting,
+// otherwise from the most urgent lane that has one, otherwise it waits for
+// the first delivery on any lane. It returns the delivery with the index of
+// its lane. Closed lanes are set to nil; it returns false once all of them
+// are closed.
+func nextDelivery(lanes *[laneCount]<-chan amqp.Delivery, preferred int) (amqp.Delivery, int, bool) {
+	order := make([]int, 0, laneCount)
+	order = append(order, preferred)
+	for i := range laneCount {
+		if i != preferred {
+			order = append(order, i)
+		}
+	}
+
 	for {
+		for _, i := range order {
+			select {
+			case msg, ok := <-lanes[i]:
+				if ok {
+					return msg, i, true
+				}
+				lanes[i] = nil
+			default:
+			}
+		}
+
+		if lanes[0] == nil && lanes[1] == nil && lanes[2] == nil {
+			return amqp.Delivery{}, 0, false
+		}
+
 		select {
-		case <-ctx.Done():
-			q.logger.InfoContext(ctx, "Stopping consumer", "error", ctx.Err())
-			return
-		case msg, ok := <-msgs:
-			if !ok {
-				q.logger.InfoContext(ctx, "Message channel closed")
-				return
+		case msg, ok := <-lanes[0]:
+			if ok {
+				return msg, 0, true
+			}
+			lanes[0] = nil
+		case msg, ok := <-lanes[1]:
+			if ok {
+				return msg, 1, true
 			}
+			lanes[1] = nil
+		case msg, ok := <-lanes[2]:
+			if ok {
+				return msg, 2, true
+			}
+			lanes[2] = nil
+		}
+	}
+}
+
+// shutdown stops consuming and drains in-flight handlers. It is safe to call
+// more than once and before ConsumeTasks.
+func (q *RabbitMQQueue) shutdown(ctx context.Context) {
+	q.mu.Lock()
+	consumerTags, cancelHandlers := q.consumerTags, q.cancelHandlers
+	q.consumerTags, q.cancelHandlers = nil, nil
+	q.mu.Unlock()
+
+	if len(consumerTags) == 0 {
+		return
+	}
+
+	q.logger.InfoContext(ctx, "Stopping consumer", "queue", QueueName)
+	q.cancelConsumers(ctx, consumerTags)
+
+	drained := make(chan struct{})
+	go func() {
+		q.handlers.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(q.consumer.ShutdownTimeout())
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		q.logger.WarnContext(ctx, "Shutdown timeout reached, cancelling in-flight handlers",
+			"timeout", q.consumer.ShutdownTimeout())
+		cancelHandlers()
+		<-drained
+	}
+	cancelHandlers()
 
-			q.handleMessage(msg, handler)
+	q.logger.InfoContext(ctx, "Consumer stopped", "queue", QueueName)
+}
+
+func (q *RabbitMQQueue) cancelConsumers(ctx context.Context, consumerTags []string) {
+	for _, tag := range consumerTags {
+		if err := q.channel.Cancel(tag, false); err != nil {
+			q.logger.WarnContext(ctx, "Failed to cancel consumer", "consumer", tag, "error", err)
 		}
 	}
 }
 
 func (q *RabbitMQQueue) handleMessage(
+	ctx context.Context,
 	msg amqp.Delivery,
-	handler func(taskID uuid.UUID, imageID uuid.UUID) error,
+	handler Handler,
 ) {
 	processingMsg, unmarshalErr := UnmarshalProcessingMessage(msg.Body)
 	if unmarshalErr != nil {
-		q.logger.Warn("Failed to unmarshal message, sending to DLQ", "error", unmarshalErr)
-		if nackErr := msg.Nack(false, false); nackErr != nil {
-			q.logger.Error("Failed to nack invalid message", "error", nackErr)
+		q.logger.WarnContext(ctx, "Failed to unmarshal message, sending to DLQ",
+			"message_id", msg.MessageId,
+			"unsupported_version", errors.Is(unmarshalErr, ErrUnsupportedSchemaVersion),
+			"error", unmarshalErr)
+		q.deadLetter(msg, unmarshalErr.Error())
+		return
+	}
+
+	attempt := deliveryAttempt(msg)
+	delivery := newDelivery(ctx, processingMsg, attempt, msg.Redelivered, msg.Headers, msg.CorrelationId)
+	result := handler(delivery)
+
+	if result.Action != ActionAck && ctx.Err() != nil {
+		// Aborted by shutdown, not a processing failure.
+		q.logger.WarnContext(ctx, "Task interrupted by shutdown, requeueing",
+			"task_id", processingMsg.TaskID,
+			"error", result.Err)
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			q.logger.ErrorContext(ctx, "Failed to requeue interrupted message", "error", nackErr)
 		}
 		return
 	}
 
-	if handlerErr := handler(processingMsg.TaskID, processingMsg.ImageID); handlerErr != nil {
-		q.logger.Warn("Task processing failed, sending to DLQ",
+	switch result.Action {
+	case ActionAck:
+		if ackErr := msg.Ack(false); ackErr != nil {
+			q.logger.ErrorContext(ctx, "Failed to acknowledge message", "error", ackErr)
+		} else {
+			q.logger.InfoContext(ctx, "Task processed successfully", "task_id", processingMsg.TaskID)
+		}
+	case ActionRetry:
+		if attempt >= q.consumer.MaxAttempts {
+			q.logger.WarnContext(ctx, "Task out of attempts, sending to DLQ",
+				"task_id", processingMsg.TaskID,
+				"attempt", attempt,
+				"error", result.Err)
+			q.deadLetter(msg, fmt.Sprintf("gave up after %d attempts: %s", attempt, result.Reason()))
+			return
+		}
+		q.logger.WarnContext(ctx, "Task processing failed, retrying",
 			"task_id", processingMsg.TaskID,
-			"error", handlerErr)
+			"attempt", attempt,
+			"error", result.Err)
+		q.retry(msg, processingMsg.Lane(), attempt+1, result.Reason())
+	case ActionDeadLetter:
+		q.logger.WarnContext(ctx, "Task processing failed, sending to DLQ",
+			"task_id", processingMsg.TaskID,
+			"attempt", attempt,
+			"error", result.Err)
+		q.deadLetter(msg, result.Reason())
+	default:
+		q.logger.ErrorContext(ctx, "Unknown handler result, sending to DLQ", "action", result.Action)
+		q.deadLetter(msg, "unknown handler result "+result.Action.String())
+	}
+}
+
+// Stats inspects the lane queues and the DLQ with passive declares, which
+// report ready messages and consumers. The broker doesn't expose unacked
+// counts over AMQP, so Unacked only covers this instance's handlers.
+func (q *RabbitMQQueue) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{Lanes: make(map[entity.TaskPriority]LaneStats, laneCount)}
+	for i, lane := range Lanes {
+		info, err := q.inspect(ctx, LaneQueueName(lane))
+		if err != nil {
+			return nil, err
+		}
+		stats.Lanes[lane] = LaneStats{
+			Ready:     info.Messages,
+			Unacked:   int(q.inFlight[i].Load()),
+			Consumers: info.Consumers,
+		}
+	}
+
+	info, err := q.inspect(ctx, DLQName)
+	if err != nil {
+		return nil, err
+	}
+	stats.DeadLetters = info.Messages
+
+	return stats, nil
+}
+
+// inspect declares an existing queue passively. All queues are declared by
+// setup, so a missing queue means the topology was changed under us.
+func (q *RabbitMQQueue) inspect(ctx context.Context, name string) (amqp.Queue, error) {
+	if err := ctx.Err(); err != nil {
+		return amqp.Queue{}, err
+	}
+
+	info, err := q.channel.QueueDeclarePassive(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to inspect queue %s: %w", name, err)
+	}
+	return info, nil
+}
+
+// deliveryAttempt derives the attempt number from the attempt header set by
+// retry. A broker redelivery (the consumer died or was shut down without
+// acking) counts as another attempt.
+func deliveryAttempt(msg amqp.Delivery) int {
+	attempt := max(int(headerInt(msg.Headers[HeaderAttempt])), 1)
+	if msg.Redelivered {
+		attempt++
+	}
+	return attempt
+}
+
+// retry publishes a copy of the delivery to the tail of its lane with the
+// next attempt number and the failure reason, then acks the
+// original. If publishing fails the delivery is requeued as is.
+func (q *RabbitMQQueue) retry(msg amqp.Delivery, lane entity.TaskPriority, nextAttempt int, reason string) {
+	headers := amqp.Table{}
+	maps.Copy(headers, msg.Headers)
+	headers[HeaderAttempt] = int64(nextAttempt)
+	headers[HeaderLastError] = reason
+
+	if err := q.republish(msg, ExchangeName, LaneRoutingKey(lane), headers); err != nil {
+		q.logger.Error("Failed to republish message for retry, requeueing", "error", err)
+		if nackErr := msg.Nack(false, true); nackErr != nil {
+			q.logger.Error("Failed to requeue message", "error", nackErr)
+		}
+		return
+	}
+
+	if ackErr := msg.Ack(false); ackErr != nil {
+		q.logger.Error("Failed to acknowledge retried message", "error", ackErr)
+	}
+}
+
+// deadLetter moves a delivery to the DLQ with the reason recorded in a header.
+// The copy is published before the original is acked; if that fails the
+// delivery is rejected instead, which dead-letters it without the reason.
+func (q *RabbitMQQueue) deadLetter(msg amqp.Delivery, reason string) {
+	headers := amqp.Table{}
+	maps.Copy(headers, msg.Headers)
+	headers[HeaderDeadLetterReason] = reason
+
+	if err := q.republish(msg, "", DLQName, headers); err != nil {
+		q.logger.Error("Failed to publish to DLQ, rejecting message", "error", err)
 		if nackErr := msg.Nack(false, false); nackErr != nil {
-			q.logger.Error("Failed to nack failed message", "error", nackErr)
+			q.logger.Error("Failed to nack message", "error", nackErr)
 		}
 		return
 	}
 
 	if ackErr := msg.Ack(false); ackErr != nil {
-		q.logger.Error("Failed to acknowledge message", "error", ackErr)
-	} else {
-		q.logger.Info("Task processed successfully", "task_id", processingMsg.TaskID)
+		q.logger.Error("Failed to acknowledge dead-lettered message", "error", ackErr)
 	}
 }
 
+// republish publishes a copy of the delivery with new headers, keeping its
+// body and properties.
+func (q *RabbitMQQueue) republish(msg amqp.Delivery, exchange, routingKey string, headers amqp.Table) error {
+	return q.channel.PublishWithContext(
+		context.Background(),
+		exchange,
+		routingKey,
+		false, // mandatory
+		false, // immediate
+		amqp.Publishing{
+			ContentType:   msg.ContentType,
+			Body:          msg.Body,
+			DeliveryMode:  amqp.Persistent,
+			MessageId:     msg.MessageId,
+			CorrelationId: msg.CorrelationId,
+			Timestamp:     msg.Timestamp,
+			Headers:       headers,
+		},
+	)
+}
+
+// Close drains the consumer, if any, before closing the channel and the
+// connection. Closing a closed queue does nothing.
 func (q *RabbitMQQueue) Close() error {
+	q.shutdown(context.Background())
+
 	var errs []error
 
 	if q.channel != nil {
@@ -259,7 +596,7 @@ func (q *RabbitMQQueue) Close() error {
 		}
 	}
 
-	if q.conn != nil {
+	if q.conn != nil && !q.conn.IsClosed() {
 		if err := q.conn.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to close connection: %w", err))
 		}
@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+)
+
+// LaneStats is a snapshot of one priority lane.
+type LaneStats struct {
+	// Ready is the number of messages waiting for a consumer.
+	Ready int
+	// Unacked is the number of messages handed to handlers of this queue
+	// instance and not yet acked. Other processes' deliveries are not
+	// included.
+	Unacked   int
+	Consumers int
+}
+
+// Stats is a snapshot of the processing lanes and the dead-letter queue.
+type Stats struct {
+	Lanes       map[entity.TaskPriority]LaneStats
+	DeadLetters int
+}
+
+// Ready returns the number of messages waiting in all lanes.
+func (s *Stats) Ready() int {
+	total := 0
+	for _, lane := range s.Lanes {
+		total += lane.Ready
+	}
+	return total
+}
+
+// Consumers returns the number of consumers of the queue. A worker consumes
+// every lane and is reported by each of them, so it is the most any lane
+// reports rather than their sum.
+func (s *Stats) Consumers() int {
+	most := 0
+	for _, lane := range s.Lanes {
+		most = max(most, lane.Consumers)
+	}
+	return most
+}
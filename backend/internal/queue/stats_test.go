@@ -0,0 +1,51 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+)
+
+func TestStatsConsumers(t *testing.T) {
+	tests := []struct {
+		name  string
+		lanes map[entity.TaskPriority]LaneStats
+		want  int
+	}{
+		{name: "no lanes"},
+		{
+			name: "idle",
+			lanes: map[entity.TaskPriority]LaneStats{
+				entity.TaskPriorityInteractive: {},
+				entity.TaskPriorityNormal:      {},
+				entity.TaskPriorityBulk:        {},
+			},
+		},
+		{
+			name: "every worker on every lane",
+			lanes: map[entity.TaskPriority]LaneStats{
+				entity.TaskPriorityInteractive: {Consumers: 2},
+				entity.TaskPriorityNormal:      {Consumers: 2},
+				entity.TaskPriorityBulk:        {Consumers: 2},
+			},
+			want: 2,
+		},
+		{
+			name: "a worker still registering its lanes",
+			lanes: map[entity.TaskPriority]LaneStats{
+				entity.TaskPriorityInteractive: {Consumers: 3},
+				entity.TaskPriorityNormal:      {Consumers: 3},
+				entity.TaskPriorityBulk:        {Consumers: 2},
+			},
+			want: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &Stats{Lanes: tt.lanes}
+			if got := stats.Consumers(); got != tt.want {
+				t.Errorf("Consumers() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
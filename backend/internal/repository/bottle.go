@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBottleAssetNotFound = errors.New("bottle asset not found")
+)
+
+type BottleRepository interface {
+	Create(ctx context.Context, asset *entity.BottleAsset) error
+	GetByID(ctx context.Context, id uuid.UUID) (*entity.BottleAsset, error)
+	GetByStyle(ctx context.Context, style string) (*entity.BottleAsset, error)
+	List(ctx context.Context, includeDisabled bool) ([]entity.BottleAsset, error)
+	Update(ctx context.Context, asset *entity.BottleAsset) error
+	SetEnabled(ctx context.Context, id uuid.UUID, enabled bool) error
+	// LastModified returns the most recent update time across the catalog,
+	// used by caches to detect changes cheaply.
+	LastModified(ctx context.Context) (time.Time, error)
+}
+
+type bottleRepository struct {
+	db *gorm.DB
+}
+
+func NewBottleRepository(db *gorm.DB) BottleRepository {
+	return &bottleRepository{db: db}
+}
+
+func (r *bottleRepository) Create(ctx context.Context, asset *entity.BottleAsset) error {
+	if err := r.db.WithContext(ctx).Create(asset).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *bottleRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.BottleAsset, error) {
+	var asset entity.BottleAsset
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&asset).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBottleAssetNotFound
+		}
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r *bottleRepository) GetByStyle(ctx context.Context, style string) (*entity.BottleAsset, error) {
+	var asset entity.BottleAsset
+	if err := r.db.WithContext(ctx).Where("style = ?", style).First(&asset).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBottleAssetNotFound
+		}
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (r *bottleRepository) List(ctx context.Context, includeDisabled bool) ([]entity.BottleAsset, error) {
+	query := r.db.WithContext(ctx).Order("style")
+	if !includeDisabled {
+		query = query.Where("enabled = ?", true)
+	}
+
+	var assets []entity.BottleAsset
+	if err := query.Find(&assets).Error; err != nil {
+		return nil, err
+	}
+	return assets, nil
+}
+
+func (r *bottleRepository) Update(ctx context.Context, asset *entity.BottleAsset) error {
+	asset.UpdatedAt = time.Now()
+	if err := r.db.WithContext(ctx).Save(asset).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *bottleRepository) SetEnabled(ctx context.Context, id uuid.UUID, enabled bool) error {
+	result := r.db.WithContext(ctx).Model(&entity.BottleAsset{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"enabled":    enabled,
+			"updated_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrBottleAssetNotFound
+	}
+
+	return nil
+}
+
+func (r *bottleRepository) LastModified(ctx context.Context) (time.Time, error) {
+	var lastModified *time.Time
+	if err := r.db.WithContext(ctx).Model(&entity.BottleAsset{}).
+		Select("MAX(updated_at)").
+		Scan(&lastModified).Error; err != nil {
+		return time.Time{}, err
+	}
+
+	if lastModified == nil {
+		return time.Time{}, nil
+	}
+	return *lastModified, nil
+}
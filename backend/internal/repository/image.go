@@ -9,17 +9,73 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
-	ErrImageNotFound = errors.New("image not found")
+	ErrImageNotFound      = errors.New("image not found")
+	ErrImageAlreadyExists = errors.New("image with the same content already exists")
+	// ErrImageStatusChanged is returned when an image left the status a
+	// retention update expected, for example because it was uploaded again.
+	ErrImageStatusChanged = errors.New("image status changed")
 )
 
 type ImageRepository interface {
 	Create(ctx context.Context, image *entity.Image) error
 	GetByID(ctx context.Context, id uuid.UUID) (*entity.Image, error)
+	GetByContentHash(ctx context.Context, hash string) (*entity.Image, error)
 	Update(ctx context.Context, image *entity.Image) error
+	// UpdateStatus changes the status of an image and records when it
+	// finished if the status is completed or failed.
 	UpdateStatus(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error
+	// ListFinishedBefore returns up to limit images in status that finished
+	// before the given time, oldest first. With originalStored only images
+	// whose original was not deleted yet are returned.
+	ListFinishedBefore(
+		ctx context.Context,
+		status entity.ImageStatus,
+		before time.Time,
+		originalStored bool,
+		limit int,
+	) ([]entity.Image, error)
+	// AddClient records that the client uploaded the image. Recording the
+	// same client again does nothing.
+	AddClient(ctx context.Context, imageID uuid.UUID, clientID string) error
+	// List returns a page of the images matching filter.
+	List(ctx context.Context, filter ImageFilter, page Page) ([]entity.Image, error)
+	// Delete removes an image, with its tasks and renditions, clears the
+	// references uploads hold to them and records the tombstones of its
+	// stored objects, built from the image and its tasks, in the same
+	// transaction. The image and its tasks are locked first, so a result
+	// recorded concurrently is either among the tasks or fails with
+	// ErrTaskNotFound. It returns the recorded tombstones.
+	Delete(
+		ctx context.Context,
+		id uuid.UUID,
+		tombstones func(image *entity.Image, tasks []entity.ProcessingTask) []entity.ObjectTombstone,
+	) ([]entity.ObjectTombstone, error)
+	// ReferencesOriginal reports whether an image has the object as its
+	// stored original.
+	ReferencesOriginal(ctx context.Context, bucket, key string) (bool, error)
+	// WithOriginalLock runs fn while holding a lock on the stored original
+	// bucket/key. Originals are content-addressed and shared by uploads of
+	// the same content, so storing and referencing one must not interleave
+	// with checking its references and deleting it.
+	WithOriginalLock(ctx context.Context, bucket, key string, fn func(ctx context.Context) error) error
+	// MarkOriginalDeleted records that the original of an image in status was
+	// deleted, or returns ErrImageStatusChanged if the image left that status.
+	MarkOriginalDeleted(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error
+	// MarkExpired moves an image from status to expired and forgets its
+	// files, or returns ErrImageStatusChanged if the image left that status.
+	MarkExpired(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error
+}
+
+// ImageFilter selects the images List returns. Zero fields match every
+// image. ClientID matches every image the client uploaded, see AddClient.
+type ImageFilter struct {
+	Status   entity.ImageStatus
+	ClientID string
+	Created  CreatedFilter
 }
 
 type imageRepository struct {
@@ -32,6 +88,9 @@ func NewImageRepository(db *gorm.DB) ImageRepository {
 
 func (r *imageRepository) Create(ctx context.Context, image *entity.Image) error {
 	if err := r.db.WithContext(ctx).Create(image).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrImageAlreadyExists
+		}
 		return err
 	}
 	return nil
@@ -48,6 +107,17 @@ func (r *imageRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Im
 	return &image, nil
 }
 
+func (r *imageRepository) GetByContentHash(ctx context.Context, hash string) (*entity.Image, error) {
+	var image entity.Image
+	if err := r.db.WithContext(ctx).Where("content_hash = ?", hash).First(&image).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
 func (r *imageRepository) Update(ctx context.Context, image *entity.Image) error {
 	image.UpdatedAt = time.Now()
 	if err := r.db.WithContext(ctx).Save(image).Error; err != nil {
@@ -57,12 +127,18 @@ func (r *imageRepository) Update(ctx context.Context, image *entity.Image) error
 }
 
 func (r *imageRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error {
+	now := time.Now()
+	updates := map[string]any{
+		"status":     status,
+		"updated_at": now,
+	}
+	if status == entity.ImageStatusCompleted || status == entity.ImageStatusFailed {
+		updates["finished_at"] = now
+	}
+
 	result := r.db.WithContext(ctx).Model(&entity.Image{}).
 		Where("id = ?", id).
-		Updates(map[string]any{
-			"status":     status,
-			"updated_at": time.Now(),
-		})
+		Updates(updates)
 
 	if result.Error != nil {
 		return result.Error
@@ -74,3 +150,161 @@ func (r *imageRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status
 
 	return nil
 }
+
+func (r *imageRepository) Delete(
+	ctx context.Context,
+	id uuid.UUID,
+	tombstones func(image *entity.Image, tasks []entity.ProcessingTask) []entity.ObjectTombstone,
+) ([]entity.ObjectTombstone, error) {
+	var recorded []entity.ObjectTombstone
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var image entity.Image
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&image).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrImageNotFound
+			}
+			return err
+		}
+		var tasks []entity.ProcessingTask
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("image_id = ?", id).
+			Order("created_at, id").
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", id).Delete(&entity.Image{}).Error; err != nil {
+			return err
+		}
+
+		// The tasks went with the image, so task_id is cleared as well.
+		if err := tx.Model(&entity.Upload{}).
+			Where("image_id = ?", id).
+			Updates(map[string]any{
+				"image_id":   nil,
+				"task_id":    nil,
+				"updated_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+
+		recorded = tombstones(&image, tasks)
+		if len(recorded) == 0 {
+			return nil
+		}
+		return tx.Create(&recorded).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+func (r *imageRepository) ReferencesOriginal(ctx context.Context, bucket, key string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&entity.Image{}).
+		Where("original_key = ? AND original_bucket = ? AND original_deleted_at IS NULL", key, bucket).
+		Limit(1).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *imageRepository) WithOriginalLock(
+	ctx context.Context,
+	bucket, key string,
+	fn func(ctx context.Context) error,
+) error {
+	// The transaction only holds the advisory lock; fn runs its queries on
+	// other connections.
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", bucket+"/"+key).Error; err != nil {
+			return err
+		}
+		return fn(ctx)
+	})
+}
+
+func (r *imageRepository) ListFinishedBefore(
+	ctx context.Context,
+	status entity.ImageStatus,
+	before time.Time,
+	originalStored bool,
+	limit int,
+) ([]entity.Image, error) {
+	query := r.db.WithContext(ctx).Where("status = ? AND finished_at < ?", status, before)
+	if originalStored {
+		query = query.Where("original_deleted_at IS NULL")
+	}
+
+	var images []entity.Image
+	if err := query.Order("finished_at").Limit(limit).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *imageRepository) AddClient(ctx context.Context, imageID uuid.UUID, clientID string) error {
+	return r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.ImageClient{ImageID: imageID, ClientID: clientID}).Error
+}
+
+func (r *imageRepository) List(ctx context.Context, filter ImageFilter, page Page) ([]entity.Image, error) {
+	query := filter.Created.apply(r.db.WithContext(ctx))
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ClientID != "" {
+		query = query.Where(
+			"EXISTS (SELECT 1 FROM image_clients c WHERE c.image_id = images.id AND c.client_id = ?)",
+			filter.ClientID,
+		)
+	}
+
+	var images []entity.Image
+	if err := page.apply(query).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+func (r *imageRepository) MarkOriginalDeleted(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error {
+	return r.transition(ctx, id, status, map[string]any{"original_deleted_at": time.Now()})
+}
+
+func (r *imageRepository) MarkExpired(ctx context.Context, id uuid.UUID, status entity.ImageStatus) error {
+	return r.transition(ctx, id, status, map[string]any{
+		"status":              entity.ImageStatusExpired,
+		"processed_bucket":    nil,
+		"processed_key":       nil,
+		"original_deleted_at": gorm.Expr("COALESCE(original_deleted_at, ?)", time.Now()),
+	})
+}
+
+// transition applies updates to an image that is still in status.
+func (r *imageRepository) transition(
+	ctx context.Context,
+	id uuid.UUID,
+	status entity.ImageStatus,
+	updates map[string]any,
+) error {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).Model(&entity.Image{}).
+		Where("id = ? AND status = ?", id, status).
+		Updates(updates)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrImageStatusChanged
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Cursor is the position of a row in a listing ordered by creation time,
+// with the ID breaking ties between rows created at the same time.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Page selects a page of a listing: up to Limit rows after the cursor, in
+// ascending or descending order of (created_at, id).
+type Page struct {
+	Limit      int
+	After      *Cursor
+	Descending bool
+}
+
+// CreatedFilter restricts a listing to rows created in [After, Before).
+// Either bound may be nil.
+type CreatedFilter struct {
+	After  *time.Time
+	Before *time.Time
+}
+
+// apply adds the creation time bounds to query.
+func (f CreatedFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.After != nil {
+		query = query.Where("created_at >= ?", *f.After)
+	}
+	if f.Before != nil {
+		query = query.Where("created_at < ?", *f.Before)
+	}
+	return query
+}
+
+// apply adds the cursor, order and limit of the page to query. The row
+// comparison lets PostgreSQL seek in a (created_at, id) index instead of
+// skipping rows like an offset would.
+func (p Page) apply(query *gorm.DB) *gorm.DB {
+	comparison, direction := ">", "ASC"
+	if p.Descending {
+		comparison, direction = "<", "DESC"
+	}
+	if p.After != nil {
+		query = query.Where("(created_at, id) "+comparison+" (?, ?)", p.After.CreatedAt, p.After.ID)
+	}
+	return query.Order("created_at " + direction).Order("id " + direction).Limit(p.Limit)
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RenditionRepository interface {
+	// Upsert creates the rendition or replaces the existing one with the same
+	// size and format of the same image and kind, or of the same task for
+	// renditions of a processed result. It returns ErrImageNotFound once the
+	// image was deleted, together with its tasks.
+	Upsert(ctx context.Context, rendition *entity.ImageRendition) error
+	ListByImageID(ctx context.Context, imageID uuid.UUID) ([]entity.ImageRendition, error)
+	// DeleteByImageIDAndKind forgets the renditions of one kind of an image.
+	DeleteByImageIDAndKind(ctx context.Context, imageID uuid.UUID, kind entity.RenditionKind) error
+}
+
+type renditionRepository struct {
+	db *gorm.DB
+}
+
+func NewRenditionRepository(db *gorm.DB) RenditionRepository {
+	return &renditionRepository{db: db}
+}
+
+func (r *renditionRepository) Upsert(ctx context.Context, rendition *entity.ImageRendition) error {
+	conflict := clause.OnConflict{
+		Columns:     []clause.Column{{Name: "image_id"}, {Name: "kind"}, {Name: "size"}, {Name: "format"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "task_id IS NULL"}}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"width", "height", "bytes", "bucket", "object_key", "created_at",
+		}),
+	}
+	if rendition.TaskID != nil {
+		conflict.Columns = []clause.Column{{Name: "task_id"}, {Name: "size"}, {Name: "format"}}
+		conflict.TargetWhere = clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "task_id IS NOT NULL"}}}
+	}
+	if err := r.db.WithContext(ctx).Clauses(conflict).Create(rendition).Error; err != nil {
+		if errors.Is(err, gorm.ErrForeignKeyViolated) {
+			return ErrImageNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *renditionRepository) ListByImageID(ctx context.Context, imageID uuid.UUID) ([]entity.ImageRendition, error) {
+	var renditions []entity.ImageRendition
+	if err := r.db.WithContext(ctx).
+		Where("image_id = ?", imageID).
+		Order("kind, size, format").
+		Find(&renditions).Error; err != nil {
+		return nil, err
+	}
+	return renditions, nil
+}
+
+func (r *renditionRepository) DeleteByImageIDAndKind(
+	ctx context.Context,
+	imageID uuid.UUID,
+	kind entity.RenditionKind,
+) error {
+	if err := r.db.WithContext(ctx).
+		Where("image_id = ? AND kind = ?", imageID, kind).
+		Delete(&entity.ImageRendition{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
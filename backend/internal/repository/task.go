@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -18,9 +19,39 @@ var (
 type TaskRepository interface {
 	Create(ctx context.Context, task *entity.ProcessingTask) error
 	GetByID(ctx context.Context, id uuid.UUID) (*entity.ProcessingTask, error)
-	GetByImageID(ctx context.Context, imageID uuid.UUID) (*entity.ProcessingTask, error)
+	// ListByImageID returns the tasks of an image, oldest first.
+	ListByImageID(ctx context.Context, imageID uuid.UUID) ([]entity.ProcessingTask, error)
+	// GetLatestByImageIDAndOptions returns the most recent task of the image
+	// that was created with equivalent processing options.
+	GetLatestByImageIDAndOptions(
+		ctx context.Context,
+		imageID uuid.UUID,
+		options entity.ProcessingOptions,
+	) (*entity.ProcessingTask, error)
+	// List returns a page of the tasks matching filter.
+	List(ctx context.Context, filter TaskFilter, page Page) ([]entity.ProcessingTask, error)
 	Update(ctx context.Context, task *entity.ProcessingTask) error
 	UpdateStatus(ctx context.Context, id uuid.UUID, status entity.TaskStatus, errorMsg *string) error
+	// SetResult records the processed result of a task. It returns
+	// ErrTaskNotFound once the task was deleted with its image.
+	SetResult(ctx context.Context, id uuid.UUID, bucket, key string) error
+	// PromotePending raises the priority of a task that is still pending. It
+	// reports whether the task was pending.
+	PromotePending(ctx context.Context, id uuid.UUID, priority entity.TaskPriority) (bool, error)
+	// CountPendingAhead returns the number of pending tasks of the priority
+	// that were created before createdAt.
+	CountPendingAhead(ctx context.Context, priority entity.TaskPriority, createdAt time.Time) (int64, error)
+	// CountFinishedSince returns, per priority, the number of tasks that
+	// completed or failed since the given time.
+	CountFinishedSince(ctx context.Context, since time.Time) (map[entity.TaskPriority]int64, error)
+	CountByStatus(ctx context.Context, status entity.TaskStatus) (int64, error)
+}
+
+// TaskFilter selects the tasks List returns. Zero fields match every task.
+type TaskFilter struct {
+	Status   entity.TaskStatus
+	ClientID string
+	Created  CreatedFilter
 }
 
 type taskRepository struct {
@@ -49,9 +80,33 @@ func (r *taskRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Pro
 	return &task, nil
 }
 
-func (r *taskRepository) GetByImageID(ctx context.Context, imageID uuid.UUID) (*entity.ProcessingTask, error) {
+func (r *taskRepository) ListByImageID(ctx context.Context, imageID uuid.UUID) ([]entity.ProcessingTask, error) {
+	var tasks []entity.ProcessingTask
+	if err := r.db.WithContext(ctx).
+		Where("image_id = ?", imageID).
+		Order("created_at, id").
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+func (r *taskRepository) GetLatestByImageIDAndOptions(
+	ctx context.Context,
+	imageID uuid.UUID,
+	options entity.ProcessingOptions,
+) (*entity.ProcessingTask, error) {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
 	var task entity.ProcessingTask
-	if err := r.db.WithContext(ctx).Where("image_id = ?", imageID).First(&task).Error; err != nil {
+	// JSONB equality ignores key order and formatting.
+	if err = r.db.WithContext(ctx).
+		Where("image_id = ? AND options = CAST(? AS jsonb)", imageID, string(optionsJSON)).
+		Order("created_at DESC, id DESC").
+		First(&task).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrTaskNotFound
 		}
@@ -60,6 +115,22 @@ func (r *taskRepository) GetByImageID(ctx context.Context, imageID uuid.UUID) (*
 	return &task, nil
 }
 
+func (r *taskRepository) List(ctx context.Context, filter TaskFilter, page Page) ([]entity.ProcessingTask, error) {
+	query := filter.Created.apply(r.db.WithContext(ctx))
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ClientID != "" {
+		query = query.Where("client_id = ?", filter.ClientID)
+	}
+
+	var tasks []entity.ProcessingTask
+	if err := page.apply(query).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
 func (r *taskRepository) Update(ctx context.Context, task *entity.ProcessingTask) error {
 	task.UpdatedAt = time.Now()
 	if err := r.db.WithContext(ctx).Save(task).Error; err != nil {
@@ -96,3 +167,78 @@ func (r *taskRepository) UpdateStatus(
 
 	return nil
 }
+
+func (r *taskRepository) SetResult(ctx context.Context, id uuid.UUID, bucket, key string) error {
+	result := r.db.WithContext(ctx).Model(&entity.ProcessingTask{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"processed_bucket": bucket,
+			"processed_key":    key,
+			"updated_at":       time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (r *taskRepository) PromotePending(ctx context.Context, id uuid.UUID, priority entity.TaskPriority) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&entity.ProcessingTask{}).
+		Where("id = ? AND status = ?", id, entity.TaskStatusPending).
+		Updates(map[string]any{
+			"priority":   priority,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *taskRepository) CountPendingAhead(
+	ctx context.Context,
+	priority entity.TaskPriority,
+	createdAt time.Time,
+) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&entity.ProcessingTask{}).
+		Where("status = ? AND priority = ? AND created_at < ?", entity.TaskStatusPending, priority, createdAt).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *taskRepository) CountFinishedSince(ctx context.Context, since time.Time) (map[entity.TaskPriority]int64, error) {
+	var rows []struct {
+		Priority entity.TaskPriority
+		Count    int64
+	}
+	if err := r.db.WithContext(ctx).Model(&entity.ProcessingTask{}).
+		Select("priority, COUNT(*) AS count").
+		Where("status IN ? AND updated_at >= ?",
+			[]entity.TaskStatus{entity.TaskStatusCompleted, entity.TaskStatusFailed}, since).
+		Group("priority").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[entity.TaskPriority]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Priority] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *taskRepository) CountByStatus(ctx context.Context, status entity.TaskStatus) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&entity.ProcessingTask{}).
+		Where("status = ?", status).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
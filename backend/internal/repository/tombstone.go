@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TombstoneRepository tracks objects of deleted images that still have to
+// be deleted from storage. Tombstones are created by ImageRepository.Delete.
+type TombstoneRepository interface {
+	// ListDue returns up to limit tombstones whose retry time passed, oldest
+	// first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]entity.ObjectTombstone, error)
+	// Delete forgets a tombstone once its object was deleted.
+	Delete(ctx context.Context, id uuid.UUID) error
+	// RecordFailure counts a failed deletion and postpones the next attempt
+	// until retryAt.
+	RecordFailure(ctx context.Context, id uuid.UUID, reason string, retryAt time.Time) error
+}
+
+type tombstoneRepository struct {
+	db *gorm.DB
+}
+
+func NewTombstoneRepository(db *gorm.DB) TombstoneRepository {
+	return &tombstoneRepository{db: db}
+}
+
+func (r *tombstoneRepository) ListDue(ctx context.Context, now time.Time, limit int) ([]entity.ObjectTombstone, error) {
+	var tombstones []entity.ObjectTombstone
+	if err := r.db.WithContext(ctx).
+		Where("retry_at <= ?", now).
+		Order("retry_at").
+		Limit(limit).
+		Find(&tombstones).Error; err != nil {
+		return nil, err
+	}
+	return tombstones, nil
+}
+
+func (r *tombstoneRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.ObjectTombstone{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *tombstoneRepository) RecordFailure(
+	ctx context.Context,
+	id uuid.UUID,
+	reason string,
+	retryAt time.Time,
+) error {
+	if err := r.db.WithContext(ctx).Model(&entity.ObjectTombstone{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason,
+			"retry_at":   retryAt,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	return nil
+}
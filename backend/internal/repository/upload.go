@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadNotPending = errors.New("upload is no longer pending")
+	// ErrUploadOffsetChanged is returned when another chunk of a resumable
+	// upload was stored first.
+	ErrUploadOffsetChanged = errors.New("upload offset changed")
+)
+
+type UploadRepository interface {
+	Create(ctx context.Context, upload *entity.Upload) error
+	GetByID(ctx context.Context, id uuid.UUID) (*entity.Upload, error)
+	// Complete records the image and task of a pending upload, or returns
+	// ErrUploadNotPending if it was completed or expired meanwhile.
+	Complete(ctx context.Context, id, imageID, taskID uuid.UUID) error
+	// AppendPart records a chunk of a pending resumable upload that had
+	// received exactly offset bytes, advancing it past the chunk and moving
+	// its expiry. It returns ErrUploadOffsetChanged if the upload is at a
+	// different offset.
+	AppendPart(ctx context.Context, id uuid.UUID, offset int64, part *entity.UploadPart, expiresAt time.Time) error
+	// ListParts returns the stored chunks of a resumable upload by number.
+	ListParts(ctx context.Context, id uuid.UUID) ([]entity.UploadPart, error)
+	// FinishMultipart records that the chunks of a resumable upload were
+	// assembled into its object and forgets them.
+	FinishMultipart(ctx context.Context, id uuid.UUID) error
+	// ListExpired returns up to limit pending uploads that expired before now,
+	// oldest first.
+	ListExpired(ctx context.Context, now time.Time, limit int) ([]entity.Upload, error)
+	// MarkExpired moves a pending upload to expired and forgets its chunks,
+	// or returns ErrUploadNotPending if it is no longer pending.
+	MarkExpired(ctx context.Context, id uuid.UUID) error
+}
+
+type uploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) UploadRepository {
+	return &uploadRepository{db: db}
+}
+
+func (r *uploadRepository) Create(ctx context.Context, upload *entity.Upload) error {
+	if err := r.db.WithContext(ctx).Create(upload).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *uploadRepository) GetByID(ctx context.Context, id uuid.UUID) (*entity.Upload, error) {
+	var upload entity.Upload
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func (r *uploadRepository) Complete(ctx context.Context, id, imageID, taskID uuid.UUID) error {
+	return r.transition(ctx, id, map[string]any{
+		"status":   entity.UploadStatusCompleted,
+		"image_id": imageID,
+		"task_id":  taskID,
+	})
+}
+
+func (r *uploadRepository) AppendPart(
+	ctx context.Context,
+	id uuid.UUID,
+	offset int64,
+	part *entity.UploadPart,
+	expiresAt time.Time,
+) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Upload{}).
+			Where("id = ? AND status = ? AND received = ?", id, entity.UploadStatusPending, offset).
+			Updates(map[string]any{
+				"received":   offset + part.Size,
+				"expires_at": expiresAt,
+				"updated_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUploadOffsetChanged
+		}
+
+		part.UploadID = id
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "upload_id"}, {Name: "number"}},
+			DoUpdates: clause.AssignmentColumns([]string{"etag", "size"}),
+		}).Create(part).Error
+	})
+}
+
+func (r *uploadRepository) ListParts(ctx context.Context, id uuid.UUID) ([]entity.UploadPart, error) {
+	var parts []entity.UploadPart
+	if err := r.db.WithContext(ctx).Where("upload_id = ?", id).Order("number").Find(&parts).Error; err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func (r *uploadRepository) FinishMultipart(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Upload{}).
+			Where("id = ?", id).
+			Updates(map[string]any{
+				"multipart_id": nil,
+				"updated_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUploadNotFound
+		}
+		return tx.Where("upload_id = ?", id).Delete(&entity.UploadPart{}).Error
+	})
+}
+
+func (r *uploadRepository) ListExpired(ctx context.Context, now time.Time, limit int) ([]entity.Upload, error) {
+	var uploads []entity.Upload
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND expires_at < ?", entity.UploadStatusPending, now).
+		Order("expires_at").
+		Limit(limit).
+		Find(&uploads).Error; err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func (r *uploadRepository) MarkExpired(ctx context.Context, id uuid.UUID) error {
+	if err := r.transition(ctx, id, map[string]any{"status": entity.UploadStatusExpired}); err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Where("upload_id = ?", id).Delete(&entity.UploadPart{}).Error
+}
+
+// transition applies updates to a pending upload.
+func (r *uploadRepository) transition(ctx context.Context, id uuid.UUID, updates map[string]any) error {
+	updates["updated_at"] = time.Now()
+	result := r.db.WithContext(ctx).Model(&entity.Upload{}).
+		Where("id = ? AND status = ?", id, entity.UploadStatusPending).
+		Updates(updates)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrUploadNotPending
+	}
+
+	return nil
+}
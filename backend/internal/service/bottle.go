@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidBottleAsset = errors.New("invalid bottle asset")
+	ErrBottleStyleUnknown = errors.New("bottle style is not available")
+)
+
+const (
+	bottleAssetPrefix = "assets"
+	maxBottleNameLen  = 128
+)
+
+// BottleMetadata describes how an uploaded overlay is placed. Anchor and
+// shadow offsets are relative to the overlay size; nil anchors default to
+// entity.DefaultBottleAnchorX and entity.DefaultBottleAnchorY.
+type BottleMetadata struct {
+	Style         string
+	Name          string
+	AnchorX       *float64
+	AnchorY       *float64
+	ShadowOpacity float64
+	ShadowOffsetX float64
+	ShadowOffsetY float64
+	ShadowBlur    float64
+}
+
+// BottleAssetURL is a catalog entry together with a URL to preview it. URL
+// is nil if storage can't presign URLs, see storage.ErrPresignUnsupported.
+type BottleAssetURL struct {
+	entity.BottleAsset
+	URL *string
+}
+
+// BottleService manages the bottle overlay catalog.
+type BottleService struct {
+	bottles   repository.BottleRepository
+	storage   storage.Storage
+	validator *imaging.Validator
+	cfg       *config.Config
+	logger    *slog.Logger
+}
+
+func NewBottleService(
+	bottles repository.BottleRepository,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *BottleService {
+	limits := cfg.Image
+	limits.MaxUploadBytes = cfg.Image.BottleMaxBytes
+
+	return &BottleService{
+		bottles:   bottles,
+		storage:   store,
+		validator: imaging.NewValidator(&limits),
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// BottleAssetObjectKey returns the object key of an overlay version:
+// assets/{style}/v{version}.{ext}. Keys are never reused, so a cached
+// overlay can't be mixed up with its replacement.
+func BottleAssetObjectKey(style string, version int, format imaging.Format) string {
+	return fmt.Sprintf("%s/%s/v%d%s", bottleAssetPrefix, style, version, format.Extension())
+}
+
+// Upload stores a bottle overlay and records it in the catalog. Uploading an
+// existing style replaces its overlay and metadata, bumps its version,
+// enables it again and deletes the overlay of the previous version. The
+// overlay must be a PNG or WebP with an alpha channel.
+func (s *BottleService) Upload(
+	ctx context.Context,
+	file io.Reader,
+	meta BottleMetadata,
+) (*entity.BottleAsset, error) {
+	if err := meta.validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := s.validator.ReadLimited(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.validator.Validate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkOverlay(data, info); err != nil {
+		return nil, err
+	}
+
+	var previous *entity.BottleAsset
+	asset, err := s.bottles.GetByStyle(ctx, meta.Style)
+	switch {
+	case err == nil:
+		snapshot := *asset
+		previous = &snapshot
+		asset.Version++
+	case errors.Is(err, repository.ErrBottleAssetNotFound):
+		asset = &entity.BottleAsset{
+			ID:      uuid.New(),
+			Style:   meta.Style,
+			Version: 1,
+		}
+	default:
+		return nil, fmt.Errorf("failed to look up bottle asset: %w", err)
+	}
+
+	asset.Name = meta.Name
+	asset.Bucket = s.cfg.S3.BucketBottles
+	asset.ObjectKey = BottleAssetObjectKey(meta.Style, asset.Version, info.Format)
+	asset.Format = info.Format.String()
+	asset.Width = info.Width
+	asset.Height = info.Height
+	asset.AnchorX = valueOr(meta.AnchorX, entity.DefaultBottleAnchorX)
+	asset.AnchorY = valueOr(meta.AnchorY, entity.DefaultBottleAnchorY)
+	asset.ShadowOpacity = meta.ShadowOpacity
+	asset.ShadowOffsetX = meta.ShadowOffsetX
+	asset.ShadowOffsetY = meta.ShadowOffsetY
+	asset.ShadowBlur = meta.ShadowBlur
+	asset.Enabled = true
+
+	if err = s.storage.UploadFile(
+		ctx,
+		asset.Bucket,
+		asset.ObjectKey,
+		bytes.NewReader(data),
+		int64(len(data)),
+		info.Format.ContentType(),
+	); err != nil {
+		return nil, fmt.Errorf("failed to store bottle asset: %w", err)
+	}
+
+	if asset.Version == 1 {
+		err = s.bottles.Create(ctx, asset)
+	} else {
+		err = s.bottles.Update(ctx, asset)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save bottle asset: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Bottle asset uploaded",
+		"bottle_id", asset.ID,
+		"style", asset.Style,
+		"version", asset.Version)
+
+	// Caches load overlays by style, so nothing reads the old version any
+	// more. A leftover object only wastes space, so a failure isn't fatal.
+	if previous != nil && previous.ObjectKey != asset.ObjectKey {
+		if err = s.storage.DeleteFile(ctx, previous.Bucket, previous.ObjectKey); err != nil {
+			s.logger.WarnContext(ctx, "Failed to delete previous bottle asset version",
+				"style", previous.Style,
+				"version", previous.Version,
+				"key", previous.ObjectKey,
+				"error", err)
+		}
+	}
+
+	return asset, nil
+}
+
+// List returns the catalog ordered by style. Disabled assets are only
+// included on request, for the admin listing.
+func (s *BottleService) List(ctx context.Context, includeDisabled bool) ([]BottleAssetURL, error) {
+	assets, err := s.bottles.List(ctx, includeDisabled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bottle assets: %w", err)
+	}
+
+	result := make([]BottleAssetURL, 0, len(assets))
+	for _, asset := range assets {
+		entry := BottleAssetURL{BottleAsset: asset}
+		url, urlErr := s.storage.GetFileURL(ctx, asset.Bucket, asset.ObjectKey)
+		switch {
+		case errors.Is(urlErr, storage.ErrPresignUnsupported):
+		case urlErr != nil:
+			return nil, fmt.Errorf("failed to generate bottle asset URL: %w", urlErr)
+		default:
+			entry.URL = &url
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Disable hides an asset from the public catalog and rejects new uploads
+// using its style. Tasks that were already queued with it still render.
+func (s *BottleService) Disable(ctx context.Context, id uuid.UUID) (*entity.BottleAsset, error) {
+	if err := s.bottles.SetEnabled(ctx, id, false); err != nil {
+		return nil, err
+	}
+
+	asset, err := s.bottles.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Bottle asset disabled", "bottle_id", asset.ID, "style", asset.Style)
+
+	return asset, nil
+}
+
+func (m *BottleMetadata) validate() error {
+	details := map[string]any{}
+
+	if !entity.IsValidBottleStyle(m.Style) {
+		details["style"] = "must be a lowercase slug"
+	}
+	if m.Name == "" || len(m.Name) > maxBottleNameLen {
+		details["name"] = fmt.Sprintf("must be between 1 and %d characters", maxBottleNameLen)
+	}
+	if outside(m.AnchorX, 0, 1) || outside(m.AnchorY, 0, 1) {
+		details["anchor"] = "coordinates must be between 0 and 1"
+	}
+	if m.ShadowOpacity < 0 || m.ShadowOpacity > 1 {
+		details["shadow_opacity"] = "must be between 0 and 1"
+	}
+	if m.ShadowOffsetX < -1 || m.ShadowOffsetX > 1 || m.ShadowOffsetY < -1 || m.ShadowOffsetY > 1 {
+		details["shadow_offset"] = "must be between -1 and 1"
+	}
+	if m.ShadowBlur < 0 || m.ShadowBlur > 1 {
+		details["shadow_blur"] = "must be between 0 and 1"
+	}
+
+	if len(details) > 0 {
+		return &imaging.ValidationError{Err: ErrInvalidBottleAsset, Details: details}
+	}
+	return nil
+}
+
+// checkOverlay makes sure the overlay carries an alpha mask. JPEG can't, and
+// a fully opaque image would paint a rectangle over the photo.
+func checkOverlay(data []byte, info *imaging.Info) error {
+	if info.Format == imaging.FormatJPEG {
+		return &imaging.ValidationError{
+			Err:     ErrInvalidBottleAsset,
+			Details: map[string]any{"format": "overlay must be a PNG or WebP with transparency"},
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return &imaging.ValidationError{Err: imaging.ErrCorruptImage}
+	}
+
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return &imaging.ValidationError{
+			Err:     ErrInvalidBottleAsset,
+			Details: map[string]any{"alpha": "overlay has no transparent pixels"},
+		}
+	}
+	return nil
+}
+
+// valueOr returns the value of p, or fallback if p is nil.
+func valueOr[T any](p *T, fallback T) T {
+	if p == nil {
+		return fallback
+	}
+	return *p
+}
+
+// outside reports whether an optional value is set and not within [low, high].
+func outside(p *float64, low, high float64) bool {
+	return p != nil && (*p < low || *p > high)
+}
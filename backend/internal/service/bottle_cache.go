@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrNoBottleAssets = errors.New("bottle catalog has no enabled assets")
+)
+
+// LoadedBottle is a decoded overlay ready for compositing.
+type LoadedBottle struct {
+	Asset entity.BottleAsset
+	Image image.Image
+}
+
+// BottleCache keeps decoded overlays in worker memory. Overlays are loaded on
+// first use; the catalog's last modification time is polled at most once per
+// configured interval and the whole cache is dropped when it changes. The
+// lock is never held during I/O, and concurrent misses of a style share one
+// load.
+type BottleCache struct {
+	bottles  repository.BottleRepository
+	storage  storage.Storage
+	interval time.Duration
+	logger   *slog.Logger
+
+	loads     singleflight.Group
+	refreshes singleflight.Group
+
+	mu           sync.Mutex
+	entries      map[string]*LoadedBottle
+	generation   uint64 // bumped whenever entries are dropped
+	lastModified time.Time
+	checkedAt    time.Time
+}
+
+func NewBottleCache(
+	bottles repository.BottleRepository,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *BottleCache {
+	return &BottleCache{
+		bottles:  bottles,
+		storage:  store,
+		interval: cfg.Image.BottleCheckInterval(),
+		logger:   logger,
+		entries:  make(map[string]*LoadedBottle),
+	}
+}
+
+// Get returns the overlay of a style, loading it if needed. An empty style
+// selects the first enabled asset of the catalog. Disabled assets are still
+// served so that tasks queued before the change can finish.
+func (c *BottleCache) Get(ctx context.Context, style string) (*LoadedBottle, error) {
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	if style == "" {
+		assets, err := c.bottles.List(ctx, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bottle assets: %w", err)
+		}
+		if len(assets) == 0 {
+			return nil, ErrNoBottleAssets
+		}
+		style = assets[0].Style
+	}
+
+	c.mu.Lock()
+	loaded, ok := c.entries[style]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok {
+		return loaded, nil
+	}
+
+	// The generation is part of the key, so a load started before the cache
+	// was dropped isn't shared with callers that came after.
+	key := strconv.FormatUint(generation, 10) + "/" + style
+	value, err, _ := c.loads.Do(key, func() (any, error) {
+		loaded, loadErr := c.load(ctx, style)
+		if loadErr != nil {
+			return nil, loadErr
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		// An overlay loaded before the cache was dropped may be outdated.
+		if c.generation == generation {
+			c.entries[style] = loaded
+		}
+		return loaded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*LoadedBottle), nil //nolint:forcetypeassert // the only value stored above
+}
+
+// Invalidate drops every cached overlay, forcing them to be reloaded.
+func (c *BottleCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.drop()
+	c.checkedAt = time.Time{}
+}
+
+// drop forgets every cached overlay. The caller must hold mu.
+func (c *BottleCache) drop() {
+	clear(c.entries)
+	c.generation++
+}
+
+func (c *BottleCache) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	due := time.Since(c.checkedAt) >= c.interval
+	c.mu.Unlock()
+	if !due {
+		return nil
+	}
+
+	_, err, _ := c.refreshes.Do("", func() (any, error) {
+		lastModified, err := c.bottles.LastModified(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check bottle catalog: %w", err)
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.checkedAt = time.Now()
+		if !lastModified.Equal(c.lastModified) {
+			if len(c.entries) > 0 {
+				c.logger.InfoContext(ctx, "Bottle catalog changed, dropping cached overlays", "count", len(c.entries))
+			}
+			c.drop()
+			c.lastModified = lastModified
+		}
+		return nil, nil //nolint:nilnil // only the error is used
+	})
+	return err
+}
+
+func (c *BottleCache) load(ctx context.Context, style string) (*LoadedBottle, error) {
+	asset, err := c.bottles.GetByStyle(ctx, style)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _, err := c.storage.GetObject(ctx, asset.Bucket, asset.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bottle asset: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if closeErr := reader.Close(); closeErr != nil {
+		c.logger.WarnContext(ctx, "Failed to close bottle asset", "key", asset.ObjectKey, "error", closeErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bottle asset: %w", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bottle asset %s: %w", asset.Style, err)
+	}
+
+	c.logger.DebugContext(ctx, "Bottle asset loaded", "style", asset.Style, "version", asset.Version)
+
+	return &LoadedBottle{Asset: *asset, Image: img}, nil
+}
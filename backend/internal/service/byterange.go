@@ -0,0 +1,87 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// RangeNotSatisfiableError is returned for a Range that lies outside the
+// result. Size is the size of the whole result, for the Content-Range of the
+// 416 response.
+type RangeNotSatisfiableError struct {
+	Size int64
+}
+
+func (e *RangeNotSatisfiableError) Error() string {
+	return fmt.Sprintf("%s: result has %d bytes", ErrRangeNotSatisfiable, e.Size)
+}
+
+func (e *RangeNotSatisfiableError) Unwrap() error {
+	return ErrRangeNotSatisfiable
+}
+
+// ByteRange is an inclusive range of bytes, as in Content-Range.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+// ContentRange formats the range as a Content-Range header value.
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// parseRange resolves a Range header against an object of the given size.
+// Only a single byte range is served: an empty, malformed or multi-range
+// header yields nil, the whole object, since servers may ignore Range. It
+// returns false if the range lies outside the object.
+func parseRange(header string, size int64) (*ByteRange, bool) {
+	unit, spec, ok := strings.Cut(strings.TrimSpace(header), "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") || strings.Contains(spec, ",") {
+		return nil, true
+	}
+
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, true
+	}
+
+	// Suffix range: the last n bytes.
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, true
+		}
+		if n == 0 || size == 0 {
+			return nil, false
+		}
+		return &ByteRange{Start: max(size-n, 0), End: size - 1}, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, true
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, true
+		}
+	}
+	if start >= size {
+		return nil, false
+	}
+
+	return &ByteRange{Start: start, End: min(end, size-1)}, true
+}
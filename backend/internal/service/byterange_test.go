@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		size   int64
+		want   *ByteRange // nil means the whole object
+		ok     bool       // false means 416
+	}{
+		{name: "no header", header: "", size: 100, ok: true},
+		{name: "closed range", header: "bytes=0-9", size: 100, want: &ByteRange{0, 9}, ok: true},
+		{name: "single byte", header: "bytes=5-5", size: 100, want: &ByteRange{5, 5}, ok: true},
+		{name: "whitespace and unit case", header: " Bytes = 10-19 ", size: 100, want: &ByteRange{10, 19}, ok: true},
+		{name: "open-ended", header: "bytes=90-", size: 100, want: &ByteRange{90, 99}, ok: true},
+		{name: "open-ended from zero", header: "bytes=0-", size: 100, want: &ByteRange{0, 99}, ok: true},
+		{name: "end clamped to size", header: "bytes=50-1000", size: 100, want: &ByteRange{50, 99}, ok: true},
+		{name: "last byte", header: "bytes=99-99", size: 100, want: &ByteRange{99, 99}, ok: true},
+
+		{name: "suffix", header: "bytes=-10", size: 100, want: &ByteRange{90, 99}, ok: true},
+		{name: "suffix longer than object", header: "bytes=-500", size: 100, want: &ByteRange{0, 99}, ok: true},
+		{name: "suffix of the whole object", header: "bytes=-100", size: 100, want: &ByteRange{0, 99}, ok: true},
+		{name: "empty suffix", header: "bytes=-0", size: 100, ok: false},
+
+		{name: "start at size", header: "bytes=100-", size: 100, ok: false},
+		{name: "start past size", header: "bytes=150-200", size: 100, ok: false},
+		{name: "zero-size object", header: "bytes=0-", size: 0, ok: false},
+		{name: "suffix of zero-size object", header: "bytes=-5", size: 0, ok: false},
+
+		// Servers may ignore a Range they don't serve and send everything.
+		{name: "multi-range", header: "bytes=0-9,20-29", size: 100, ok: true},
+		{name: "multi-range with spaces", header: "bytes=0-9, 20-", size: 100, ok: true},
+		{name: "other unit", header: "items=0-9", size: 100, ok: true},
+		{name: "no unit", header: "0-9", size: 100, ok: true},
+		{name: "no dash", header: "bytes=10", size: 100, ok: true},
+		{name: "end before start", header: "bytes=20-10", size: 100, ok: true},
+		{name: "negative start", header: "bytes=--5", size: 100, ok: true},
+		{name: "not a number", header: "bytes=a-b", size: 100, ok: true},
+		{name: "suffix not a number", header: "bytes=-x", size: 100, ok: true},
+		{name: "empty spec", header: "bytes=-", size: 100, ok: true},
+		{name: "overflow", header: "bytes=0-99999999999999999999", size: 100, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRange(tt.header, tt.size)
+			if ok != tt.ok {
+				t.Fatalf("parseRange(%q, %d) ok = %v, want %v", tt.header, tt.size, ok, tt.ok)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("parseRange(%q, %d) = %v, want %v", tt.header, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteRange(t *testing.T) {
+	r := ByteRange{Start: 90, End: 99}
+	if got := r.Length(); got != 10 {
+		t.Errorf("Length() = %d, want 10", got)
+	}
+	if got := r.ContentRange(100); got != "bytes 90-99/100" {
+		t.Errorf("ContentRange() = %q, want %q", got, "bytes 90-99/100")
+	}
+
+	err := error(&RangeNotSatisfiableError{Size: 100})
+	if !errors.Is(err, ErrRangeNotSatisfiable) {
+		t.Errorf("errors.Is(%v, ErrRangeNotSatisfiable) = false", err)
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+// clientIDLength is the number of hex digits of a client ID.
+const clientIDLength = 16
+
+// ClientID identifies the caller of an API key on the images and tasks it
+// creates without storing the key itself: it is the first 16 hex digits of
+// the key's SHA-256, as printed by
+//
+//	printf %s "$API_KEY" | sha256sum | cut -c1-16
+//
+// Callers without a key or with an unknown key have no client ID.
+func ClientID(cfg *config.BackendConfig, apiKey string) *string {
+	if apiKey == "" {
+		return nil
+	}
+	if _, ok := cfg.APIKeyTiers[apiKey]; !ok {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	id := hex.EncodeToString(sum[:])[:clientIDLength]
+	return &id
+}
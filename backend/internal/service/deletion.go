@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	tombstoneBatchLimit = 100
+	// maxTombstoneBackoff caps how many sweep intervals a repeatedly failing
+	// deletion waits before its next attempt.
+	maxTombstoneBackoff = 12
+)
+
+// DeletionService deletes images on request. The image row goes first, so
+// the image disappears at once even if storage is unavailable; its objects
+// are deleted afterwards and tracked as tombstones until that succeeds.
+type DeletionService struct {
+	images     repository.ImageRepository
+	tombstones repository.TombstoneRepository
+	storage    storage.Storage
+	cfg        *config.Config
+	logger     *slog.Logger
+}
+
+func NewDeletionService(
+	images repository.ImageRepository,
+	tombstones repository.TombstoneRepository,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *DeletionService {
+	return &DeletionService{
+		images:     images,
+		tombstones: tombstones,
+		storage:    store,
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+// DeleteImage deletes an image together with its tasks and renditions, then
+// its original, processed results, renditions and cached variants. Uploads
+// that created the image keep no reference to it. Objects that fail to be
+// deleted are retried by SweepTombstones, so a storage failure doesn't fail
+// the deletion.
+//
+// Deleting the tasks cancels them. Queued tasks are dropped, as workers ack
+// deliveries whose task no longer exists. A running task finds out through
+// TaskService.Cancelled, and whatever it stores afterwards is deleted when
+// recording it fails, see TaskService.RecordResult and
+// RenditionService.Generate.
+func (s *DeletionService) DeleteImage(ctx context.Context, id uuid.UUID) error {
+	tombstones, err := s.images.Delete(ctx, id, s.tombstonesOf)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range tombstones {
+		if !s.bury(ctx, &tombstones[i]) {
+			failed++
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Image deleted",
+		"image_id", id,
+		"objects", len(tombstones),
+		"objects_pending", failed)
+
+	return nil
+}
+
+// tombstonesOf returns the stored objects of an image and its tasks.
+// Renditions and variants are covered by their prefixes.
+func (s *DeletionService) tombstonesOf(image *entity.Image, tasks []entity.ProcessingTask) []entity.ObjectTombstone {
+	tombstone := func(bucket, key string, prefix bool) entity.ObjectTombstone {
+		return entity.ObjectTombstone{
+			ID:        uuid.New(),
+			ImageID:   image.ID,
+			Bucket:    bucket,
+			ObjectKey: key,
+			Prefix:    prefix,
+		}
+	}
+
+	tombstones := []entity.ObjectTombstone{
+		tombstone(s.cfg.S3.BucketUploads, RenditionPrefix(image.ID), true),
+		tombstone(s.cfg.S3.BucketProcessed, RenditionPrefix(image.ID), true),
+		tombstone(s.cfg.S3.BucketProcessed, VariantPrefix(image.ID), true),
+	}
+	if image.OriginalDeletedAt == nil && image.OriginalKey != "" {
+		tombstones = append(tombstones, tombstone(image.OriginalBucket, image.OriginalKey, false))
+	}
+	for _, object := range processedObjects(image, tasks) {
+		tombstones = append(tombstones, tombstone(object.bucket, object.key, false))
+	}
+	return tombstones
+}
+
+// bury deletes the object of a tombstone and forgets the tombstone, or
+// records the failure for the next sweep. It reports whether the object is
+// gone.
+func (s *DeletionService) bury(ctx context.Context, tombstone *entity.ObjectTombstone) bool {
+	err := s.deleteObject(ctx, tombstone)
+	if err == nil {
+		if err = s.tombstones.Delete(ctx, tombstone.ID); err != nil {
+			// The object is gone; deleting it again on the next sweep is harmless.
+			s.logger.WarnContext(ctx, "Failed to forget tombstone", "tombstone_id", tombstone.ID, "error", err)
+		}
+		return true
+	}
+
+	s.logger.WarnContext(ctx, "Failed to delete object of deleted image",
+		"image_id", tombstone.ImageID,
+		"bucket", tombstone.Bucket,
+		"key", tombstone.ObjectKey,
+		"attempts", tombstone.Attempts+1,
+		"error", err)
+
+	backoff := time.Duration(min(tombstone.Attempts+1, maxTombstoneBackoff)) * s.cfg.Retention.TombstoneInterval()
+	if recordErr := s.tombstones.RecordFailure(ctx, tombstone.ID, err.Error(), time.Now().Add(backoff)); recordErr != nil {
+		s.logger.WarnContext(ctx, "Failed to record tombstone failure", "tombstone_id", tombstone.ID, "error", recordErr)
+	}
+	return false
+}
+
+// deleteObject deletes the object or prefix of a tombstone. Originals are
+// content-addressed, so an original that a new upload of the same content
+// references again is kept. The lock of the original keeps such an upload
+// from referencing it between the check and the deletion.
+func (s *DeletionService) deleteObject(ctx context.Context, tombstone *entity.ObjectTombstone) error {
+	if tombstone.Prefix {
+		return s.storage.DeletePrefix(ctx, tombstone.Bucket, tombstone.ObjectKey)
+	}
+
+	return s.images.WithOriginalLock(ctx, tombstone.Bucket, tombstone.ObjectKey, func(ctx context.Context) error {
+		referenced, err := s.images.ReferencesOriginal(ctx, tombstone.Bucket, tombstone.ObjectKey)
+		if err != nil {
+			return fmt.Errorf("failed to check original references: %w", err)
+		}
+		if referenced {
+			return nil
+		}
+		return s.storage.DeleteFile(ctx, tombstone.Bucket, tombstone.ObjectKey)
+	})
+}
+
+// SweepTombstones retries the deletion of objects whose tombstone is due. It
+// returns the number of objects deleted.
+func (s *DeletionService) SweepTombstones(ctx context.Context) (int, error) {
+	deleted := 0
+	for {
+		tombstones, err := s.tombstones.ListDue(ctx, time.Now(), tombstoneBatchLimit)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list tombstones: %w", err)
+		}
+
+		batchDeleted := 0
+		for i := range tombstones {
+			if s.bury(ctx, &tombstones[i]) {
+				batchDeleted++
+			}
+		}
+		deleted += batchDeleted
+
+		// Failed tombstones are postponed, so they aren't listed again; a
+		// batch without progress means storage or the database is down.
+		if len(tombstones) < tombstoneBatchLimit || batchDeleted == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// RunSweep calls SweepTombstones every configured interval until ctx is
+// done.
+func (s *DeletionService) RunSweep(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Retention.TombstoneInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := s.SweepTombstones(ctx)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to sweep tombstones", "deleted", deleted, "error", err)
+			continue
+		}
+		if deleted > 0 {
+			s.logger.InfoContext(ctx, "Objects of deleted images cleaned up", "count", deleted)
+		}
+	}
+}
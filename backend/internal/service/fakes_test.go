@@ -0,0 +1,482 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// fakeStorage keeps objects and multipart uploads in memory and fails calls
+// with queued errors. Operations the tests don't need panic through the nil
+// Storage.
+type fakeStorage struct {
+	storage.Storage
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// parts holds the parts of each multipart upload by number.
+	parts map[string]map[int][]byte
+	// errs holds the errors the next calls of an operation fail with.
+	errs  map[string][]error
+	calls map[string]int
+	// onPutPart runs after a part was stored, before PutPart returns.
+	onPutPart func()
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		objects: make(map[string][]byte),
+		parts:   make(map[string]map[int][]byte),
+		errs:    make(map[string][]error),
+		calls:   make(map[string]int),
+	}
+}
+
+func objectPath(bucket, objectName string) string {
+	return bucket + "/" + objectName
+}
+
+// failNext makes the next calls of operation fail with errs, in order.
+func (f *fakeStorage) failNext(operation string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs[operation] = append(f.errs[operation], errs...)
+}
+
+func (f *fakeStorage) put(bucket, objectName string, content []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects[objectPath(bucket, objectName)] = content
+}
+
+func (f *fakeStorage) object(bucket, objectName string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.objects[objectPath(bucket, objectName)]
+	return data, ok
+}
+
+func (f *fakeStorage) callCount(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[operation]
+}
+
+// call counts a call and returns the error it should fail with.
+func (f *fakeStorage) call(operation string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[operation]++
+	if len(f.errs[operation]) == 0 {
+		return nil
+	}
+	err := f.errs[operation][0]
+	f.errs[operation] = f.errs[operation][1:]
+	return err
+}
+
+func (f *fakeStorage) UploadFile(
+	_ context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	_ int64,
+	_ string,
+) error {
+	if err := f.call("UploadFile"); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	f.put(bucket, objectName, data)
+	return nil
+}
+
+func (f *fakeStorage) GetFileURL(_ context.Context, bucket string, objectName string) (string, error) {
+	if err := f.call("GetFileURL"); err != nil {
+		return "", err
+	}
+	return "https://storage.test/" + objectPath(bucket, objectName), nil
+}
+
+func (f *fakeStorage) GetObject(
+	_ context.Context,
+	bucket string,
+	objectName string,
+) (io.ReadCloser, *storage.ObjectInfo, error) {
+	if err := f.call("GetObject"); err != nil {
+		return nil, nil, err
+	}
+	data, ok := f.object(bucket, objectName)
+	if !ok {
+		return nil, nil, storage.ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), &storage.ObjectInfo{Key: objectName, Size: int64(len(data))}, nil
+}
+
+// StatObject reports the SHA-256 of every object, like a backend that
+// records checksums.
+func (f *fakeStorage) StatObject(_ context.Context, bucket string, objectName string) (*storage.ObjectInfo, error) {
+	if err := f.call("StatObject"); err != nil {
+		return nil, err
+	}
+	data, ok := f.object(bucket, objectName)
+	if !ok {
+		return nil, storage.ErrObjectNotFound
+	}
+	sum := sha256.Sum256(data)
+	return &storage.ObjectInfo{Key: objectName, Size: int64(len(data)), ChecksumSHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+func (f *fakeStorage) PutPart(
+	_ context.Context,
+	_ string,
+	_ string,
+	uploadID string,
+	number int,
+	part io.Reader,
+	size int64,
+) (*storage.Part, error) {
+	if err := f.call("PutPart"); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(part)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	if f.parts[uploadID] == nil {
+		f.parts[uploadID] = make(map[int][]byte)
+	}
+	f.parts[uploadID][number] = data
+	f.mu.Unlock()
+
+	if f.onPutPart != nil {
+		f.onPutPart()
+	}
+	return &storage.Part{Number: number, ETag: "etag-" + string(data), Size: size}, nil
+}
+
+// CompleteMultipartUpload assembles the listed parts in order and forgets
+// the multipart upload.
+func (f *fakeStorage) CompleteMultipartUpload(
+	_ context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	parts []storage.Part,
+) error {
+	if err := f.call("CompleteMultipartUpload"); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.parts[uploadID]
+	if !ok {
+		return storage.ErrMultipartUploadNotFound
+	}
+	var object []byte
+	for _, part := range parts {
+		object = append(object, stored[part.Number]...)
+	}
+	f.objects[objectPath(bucket, objectName)] = object
+	delete(f.parts, uploadID)
+	return nil
+}
+
+func (f *fakeStorage) DeleteFile(_ context.Context, bucket string, objectName string) error {
+	if err := f.call("DeleteFile"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, objectPath(bucket, objectName))
+	return nil
+}
+
+func (f *fakeStorage) DeletePrefix(_ context.Context, bucket string, prefix string) error {
+	if err := f.call("DeletePrefix"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key := range f.objects {
+		if strings.HasPrefix(key, objectPath(bucket, prefix)) {
+			delete(f.objects, key)
+		}
+	}
+	return nil
+}
+
+// fakeUploadRepository keeps uploads and their parts in memory. Operations
+// the tests don't need panic through the nil UploadRepository.
+type fakeUploadRepository struct {
+	repository.UploadRepository
+
+	mu      sync.Mutex
+	uploads map[uuid.UUID]entity.Upload
+	parts   map[uuid.UUID][]entity.UploadPart
+}
+
+func newFakeUploadRepository(uploads ...entity.Upload) *fakeUploadRepository {
+	r := &fakeUploadRepository{
+		uploads: make(map[uuid.UUID]entity.Upload),
+		parts:   make(map[uuid.UUID][]entity.UploadPart),
+	}
+	for _, upload := range uploads {
+		r.uploads[upload.ID] = upload
+	}
+	return r
+}
+
+func (r *fakeUploadRepository) GetByID(_ context.Context, id uuid.UUID) (*entity.Upload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[id]
+	if !ok {
+		return nil, repository.ErrUploadNotFound
+	}
+	return &upload, nil
+}
+
+func (r *fakeUploadRepository) Complete(_ context.Context, id, imageID, taskID uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[id]
+	if !ok || upload.Status != entity.UploadStatusPending {
+		return repository.ErrUploadNotPending
+	}
+	upload.Status = entity.UploadStatusCompleted
+	upload.ImageID = &imageID
+	upload.TaskID = &taskID
+	r.uploads[id] = upload
+	return nil
+}
+
+func (r *fakeUploadRepository) AppendPart(
+	_ context.Context,
+	id uuid.UUID,
+	offset int64,
+	part *entity.UploadPart,
+	expiresAt time.Time,
+) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload, ok := r.uploads[id]
+	if !ok || upload.Status != entity.UploadStatusPending || upload.Received != offset {
+		return repository.ErrUploadOffsetChanged
+	}
+	upload.Received += part.Size
+	upload.ExpiresAt = expiresAt
+	r.uploads[id] = upload
+
+	stored := *part
+	stored.UploadID = id
+	r.parts[id] = append(r.parts[id], stored)
+	return nil
+}
+
+func (r *fakeUploadRepository) ListParts(_ context.Context, id uuid.UUID) ([]entity.UploadPart, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parts := slices.Clone(r.parts[id])
+	slices.SortFunc(parts, func(a, b entity.UploadPart) int { return a.Number - b.Number })
+	return parts, nil
+}
+
+func (r *fakeUploadRepository) FinishMultipart(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload := r.uploads[id]
+	upload.MultipartID = nil
+	r.uploads[id] = upload
+	delete(r.parts, id)
+	return nil
+}
+
+// advance moves an upload past a chunk, as a concurrent request would.
+func (r *fakeUploadRepository) advance(id uuid.UUID, length int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upload := r.uploads[id]
+	upload.Received += length
+	r.uploads[id] = upload
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// fakeImageRepository keeps images in memory. Operations the tests don't
+// need panic through the nil ImageRepository.
+type fakeImageRepository struct {
+	repository.ImageRepository
+
+	images  map[uuid.UUID]entity.Image
+	clients map[uuid.UUID][]string
+}
+
+func newFakeImageRepository() *fakeImageRepository {
+	return &fakeImageRepository{
+		images:  make(map[uuid.UUID]entity.Image),
+		clients: make(map[uuid.UUID][]string),
+	}
+}
+
+func (r *fakeImageRepository) Create(_ context.Context, image *entity.Image) error {
+	for _, existing := range r.images {
+		if image.ContentHash != nil && existing.ContentHash != nil && *existing.ContentHash == *image.ContentHash {
+			return repository.ErrImageAlreadyExists
+		}
+	}
+	r.images[image.ID] = *image
+	return nil
+}
+
+func (r *fakeImageRepository) GetByContentHash(_ context.Context, hash string) (*entity.Image, error) {
+	for _, image := range r.images {
+		if image.ContentHash != nil && *image.ContentHash == hash {
+			return &image, nil
+		}
+	}
+	return nil, repository.ErrImageNotFound
+}
+
+func (r *fakeImageRepository) Update(_ context.Context, image *entity.Image) error {
+	if _, ok := r.images[image.ID]; !ok {
+		return repository.ErrImageNotFound
+	}
+	r.images[image.ID] = *image
+	return nil
+}
+
+func (r *fakeImageRepository) AddClient(_ context.Context, imageID uuid.UUID, clientID string) error {
+	if !slices.Contains(r.clients[imageID], clientID) {
+		r.clients[imageID] = append(r.clients[imageID], clientID)
+	}
+	return nil
+}
+
+func (r *fakeImageRepository) WithOriginalLock(
+	ctx context.Context,
+	_, _ string,
+	fn func(ctx context.Context) error,
+) error {
+	return fn(ctx)
+}
+
+// fakeTaskRepository keeps tasks in memory in the order they were created.
+// Operations the tests don't need panic through the nil TaskRepository.
+type fakeTaskRepository struct {
+	repository.TaskRepository
+
+	tasks []entity.ProcessingTask
+}
+
+func (r *fakeTaskRepository) Create(_ context.Context, task *entity.ProcessingTask) error {
+	r.tasks = append(r.tasks, *task)
+	return nil
+}
+
+func (r *fakeTaskRepository) GetLatestByImageIDAndOptions(
+	_ context.Context,
+	imageID uuid.UUID,
+	options entity.ProcessingOptions,
+) (*entity.ProcessingTask, error) {
+	for i := len(r.tasks) - 1; i >= 0; i-- {
+		if r.tasks[i].ImageID == imageID && reflect.DeepEqual(r.tasks[i].Options, options) {
+			task := r.tasks[i]
+			return &task, nil
+		}
+	}
+	return nil, repository.ErrTaskNotFound
+}
+
+func (r *fakeTaskRepository) UpdateStatus(
+	_ context.Context,
+	id uuid.UUID,
+	status entity.TaskStatus,
+	errorMsg *string,
+) error {
+	task := r.task(id)
+	if task == nil {
+		return repository.ErrTaskNotFound
+	}
+	task.Status = status
+	task.ErrorMessage = errorMsg
+	return nil
+}
+
+func (r *fakeTaskRepository) PromotePending(
+	_ context.Context,
+	id uuid.UUID,
+	priority entity.TaskPriority,
+) (bool, error) {
+	task := r.task(id)
+	if task == nil || task.Status != entity.TaskStatusPending {
+		return false, nil
+	}
+	task.Priority = priority
+	return true, nil
+}
+
+func (r *fakeTaskRepository) task(id uuid.UUID) *entity.ProcessingTask {
+	for i := range r.tasks {
+		if r.tasks[i].ID == id {
+			return &r.tasks[i]
+		}
+	}
+	return nil
+}
+
+// fakeQueue records published messages and fails with queued errors.
+// Operations the tests don't need panic through the nil Queue.
+type fakeQueue struct {
+	queue.Queue
+
+	published []*queue.ProcessingMessage
+	errs      []error
+}
+
+func (q *fakeQueue) PublishTask(_ context.Context, msg *queue.ProcessingMessage) error {
+	if len(q.errs) > 0 {
+		err := q.errs[0]
+		q.errs = q.errs[1:]
+		return err
+	}
+	q.published = append(q.published, msg)
+	return nil
+}
@@ -0,0 +1,550 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidProcessingOptions = errors.New("invalid processing options")
+)
+
+type UploadResult struct {
+	ImageID uuid.UUID
+	TaskID  uuid.UUID
+	// Deduplicated is set when identical content had already been uploaded.
+	Deduplicated bool
+}
+
+// RenditionURL is a stored rendition together with a URL to fetch it. URL
+// is nil if storage can't presign URLs, see storage.ErrPresignUnsupported.
+type RenditionURL struct {
+	entity.ImageRendition
+	URL *string
+}
+
+// ImageDetails is an image with URLs to fetch its files. The URLs are
+// generated per request and expire, so they must not be stored.
+type ImageDetails struct {
+	Image        *entity.Image
+	OriginalURL  *string // nil once retention deleted the original or without presigned URLs
+	ProcessedURL *string // nil until processing completed, once the image expired or without presigned URLs
+	Renditions   []RenditionURL
+}
+
+// ImageList is a page of images. NextCursor is nil on the last page.
+type ImageList struct {
+	Items      []ImageDetails
+	NextCursor *string
+}
+
+type ImageService struct {
+	images     repository.ImageRepository
+	tasks      repository.TaskRepository
+	renditions repository.RenditionRepository
+	bottles    repository.BottleRepository
+	storage    storage.Storage
+	queue      queue.Queue
+	validator  *imaging.Validator
+	sanitizer  *imaging.Sanitizer
+	cfg        *config.Config
+	logger     *slog.Logger
+}
+
+func NewImageService(
+	images repository.ImageRepository,
+	tasks repository.TaskRepository,
+	renditions repository.RenditionRepository,
+	bottles repository.BottleRepository,
+	store storage.Storage,
+	q queue.Queue,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *ImageService {
+	return &ImageService{
+		images:     images,
+		tasks:      tasks,
+		renditions: renditions,
+		bottles:    bottles,
+		storage:    store,
+		queue:      q,
+		validator:  imaging.NewValidator(&cfg.Image),
+		sanitizer:  imaging.NewSanitizer(&cfg.Image),
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+// Upload validates the image content, normalises its orientation, strips
+// personal metadata, stores the sanitised original and queues a processing
+// task for it. Invalid content is reported as *imaging.ValidationError.
+//
+// Originals are content-addressed: re-uploading identical bytes with
+// identical options returns the existing image and its task instead of
+// queueing the same work again.
+//
+// The task is queued in the lane of priority, as resolved by ResolvePriority,
+// and recorded for clientID, as resolved by ClientID. A new image is recorded
+// for the same client; a deduplicated one keeps the client that uploaded it
+// first, but is listed for every client that uploaded it.
+func (s *ImageService) Upload(
+	ctx context.Context,
+	file io.Reader,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*UploadResult, error) {
+	if err := s.ValidateOptions(ctx, options); err != nil {
+		return nil, err
+	}
+
+	data, err := s.validator.ReadLimited(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.validator.Validate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sanitized, err := s.sanitizer.Sanitize(data, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sanitize image: %w", err)
+	}
+
+	sum := sha256.Sum256(sanitized.Data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	existing, err := s.images.GetByContentHash(ctx, contentHash)
+	if err == nil {
+		if err = s.addClient(ctx, existing.ID, clientID); err != nil {
+			return nil, err
+		}
+		if existing.OriginalDeletedAt != nil {
+			return s.restore(ctx, existing, contentHash, sanitized, options, priority, clientID)
+		}
+		return s.reuse(ctx, existing, options, priority, clientID)
+	}
+	if !errors.Is(err, repository.ErrImageNotFound) {
+		return nil, fmt.Errorf("failed to look up image by content hash: %w", err)
+	}
+
+	image := &entity.Image{
+		ID:             uuid.New(),
+		OriginalBucket: s.cfg.S3.BucketUploads,
+		Status:         entity.ImageStatusPending,
+		Format:         sanitized.Format.String(),
+		Width:          sanitized.Width,
+		Height:         sanitized.Height,
+		ContentHash:    &contentHash,
+		ClientID:       clientID,
+	}
+	if s.cfg.Image.KeepOriginalExif && sanitized.Exif != nil {
+		if image.OriginalExif, err = json.Marshal(sanitized.Exif); err != nil {
+			return nil, fmt.Errorf("failed to marshal original EXIF: %w", err)
+		}
+	}
+	err = s.storeOriginal(ctx, contentHash, sanitized, func(ctx context.Context, key string) error {
+		image.OriginalKey = key
+		if err := s.images.Create(ctx, image); err != nil {
+			return fmt.Errorf("failed to create image: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, repository.ErrImageAlreadyExists) {
+			return nil, err
+		}
+		// A concurrent upload of the same content won the race.
+		if existing, err = s.images.GetByContentHash(ctx, contentHash); err != nil {
+			return nil, fmt.Errorf("failed to look up image by content hash: %w", err)
+		}
+		if err = s.addClient(ctx, existing.ID, clientID); err != nil {
+			return nil, err
+		}
+		return s.reuse(ctx, existing, options, priority, clientID)
+	}
+	if err = s.addClient(ctx, image.ID, clientID); err != nil {
+		return nil, err
+	}
+
+	task, err := s.enqueue(ctx, image.ID, options, priority, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "Image uploaded",
+		"image_id", image.ID,
+		"task_id", task.ID,
+		"priority", priority,
+		"format", sanitized.Format,
+		"width", sanitized.Width,
+		"height", sanitized.Height)
+
+	return &UploadResult{
+		ImageID: image.ID,
+		TaskID:  task.ID,
+	}, nil
+}
+
+// addClient records that the client uploaded the image, so that it is
+// listed for the client even if another client uploaded it first.
+func (s *ImageService) addClient(ctx context.Context, imageID uuid.UUID, clientID *string) error {
+	if clientID == nil {
+		return nil
+	}
+	if err := s.images.AddClient(ctx, imageID, *clientID); err != nil {
+		return fmt.Errorf("failed to record image client: %w", err)
+	}
+	return nil
+}
+
+// storeOriginal uploads the sanitised original under its content hash,
+// skipping the upload if an object with the same checksum is already stored,
+// and calls record with its object key in the uploads bucket. Both happen
+// under the lock of the original, so that the deletion of an image with the
+// same content can't delete the object before record references it.
+func (s *ImageService) storeOriginal(
+	ctx context.Context,
+	contentHash string,
+	sanitized *imaging.Sanitized,
+	record func(ctx context.Context, key string) error,
+) error {
+	bucket := s.cfg.S3.BucketUploads
+	objectName := contentHash + sanitized.Format.Extension()
+
+	return s.images.WithOriginalLock(ctx, bucket, objectName, func(ctx context.Context) error {
+		info, err := s.storage.StatObject(ctx, bucket, objectName)
+		switch {
+		case err == nil && info.ChecksumSHA256 == contentHash:
+			return record(ctx, objectName)
+		case err != nil && !errors.Is(err, storage.ErrObjectNotFound):
+			return fmt.Errorf("failed to stat original image: %w", err)
+		}
+
+		if err = s.storage.UploadFile(
+			ctx,
+			bucket,
+			objectName,
+			bytes.NewReader(sanitized.Data),
+			int64(len(sanitized.Data)),
+			sanitized.Format.ContentType(),
+		); err != nil {
+			return fmt.Errorf("failed to store original image: %w", err)
+		}
+		return record(ctx, objectName)
+	})
+}
+
+// restore stores the original of an image again after retention deleted it.
+// An expired image has no processed result either and is queued again.
+func (s *ImageService) restore(
+	ctx context.Context,
+	image *entity.Image,
+	contentHash string,
+	sanitized *imaging.Sanitized,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*UploadResult, error) {
+	expired := image.Status == entity.ImageStatusExpired
+	err := s.storeOriginal(ctx, contentHash, sanitized, func(ctx context.Context, key string) error {
+		image.OriginalBucket = s.cfg.S3.BucketUploads
+		image.OriginalKey = key
+		image.OriginalDeletedAt = nil
+		if expired {
+			image.Status = entity.ImageStatusPending
+			image.FinishedAt = nil
+		}
+		if err := s.images.Update(ctx, image); err != nil {
+			return fmt.Errorf("failed to restore image: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !expired {
+		return s.reuse(ctx, image, options, priority, clientID)
+	}
+
+	task, err := s.enqueue(ctx, image.ID, options, priority, clientID)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Expired image restored", "image_id", image.ID, "task_id", task.ID)
+	return &UploadResult{ImageID: image.ID, TaskID: task.ID, Deduplicated: true}, nil
+}
+
+// reuse returns the latest task of an already uploaded image with the same
+// options. Only a failed (or missing) task causes the image to be queued again.
+// A pending task is moved to the lane of priority if that is more urgent, so
+// a bulk upload doesn't hold back the same image uploaded interactively.
+func (s *ImageService) reuse(
+	ctx context.Context,
+	image *entity.Image,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*UploadResult, error) {
+	task, err := s.tasks.GetLatestByImageIDAndOptions(ctx, image.ID, options)
+	if err != nil && !errors.Is(err, repository.ErrTaskNotFound) {
+		return nil, fmt.Errorf("failed to get task for image: %w", err)
+	}
+
+	if task == nil || task.Status == entity.TaskStatusFailed {
+		if task, err = s.enqueue(ctx, image.ID, options, priority, clientID); err != nil {
+			return nil, err
+		}
+		s.logger.InfoContext(ctx, "Duplicate upload requeued", "image_id", image.ID, "task_id", task.ID)
+		return &UploadResult{ImageID: image.ID, TaskID: task.ID, Deduplicated: true}, nil
+	}
+
+	if task.Status == entity.TaskStatusPending && priority.Rank() < task.Priority.Rank() {
+		if err = s.promote(ctx, task, priority); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Duplicate upload, reusing existing task",
+		"image_id", image.ID,
+		"task_id", task.ID,
+		"task_status", task.Status)
+
+	return &UploadResult{ImageID: image.ID, TaskID: task.ID, Deduplicated: true}, nil
+}
+
+// promote publishes a pending task again in the lane of priority and records
+// the new priority. The message in the old lane stays queued and becomes a
+// duplicate delivery, which workers tolerate anyway since delivery is at
+// least once. Publishing first means a failure leaves the task unchanged, so
+// the next duplicate upload tries again.
+func (s *ImageService) promote(ctx context.Context, task *entity.ProcessingTask, priority entity.TaskPriority) error {
+	msg := queue.NewProcessingMessage(task.ID, task.ImageID, &task.Options)
+	msg.Priority = priority
+	if err := s.queue.PublishTask(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish promoted task: %w", err)
+	}
+
+	promoted, err := s.tasks.PromotePending(ctx, task.ID, priority)
+	if err != nil {
+		return fmt.Errorf("failed to promote task: %w", err)
+	}
+	if promoted {
+		s.logger.InfoContext(ctx, "Pending task promoted",
+			"task_id", task.ID,
+			"from", task.Priority,
+			"to", priority)
+		task.Priority = priority
+	}
+	return nil
+}
+
+// enqueue creates a pending task for the image and publishes it. A task that
+// couldn't be published is marked failed, so that the next upload of the
+// image queues it again instead of reusing a task no worker will see.
+func (s *ImageService) enqueue(
+	ctx context.Context,
+	imageID uuid.UUID,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*entity.ProcessingTask, error) {
+	task := &entity.ProcessingTask{
+		ID:       uuid.New(),
+		ImageID:  imageID,
+		Status:   entity.TaskStatusPending,
+		Priority: priority,
+		Options:  options,
+		ClientID: clientID,
+	}
+	if err := s.tasks.Create(ctx, task); err != nil {
+		return nil, fmt.Errorf("failed to create processing task: %w", err)
+	}
+
+	msg := queue.NewProcessingMessage(task.ID, imageID, &task.Options)
+	msg.Priority = task.Priority
+	if err := s.queue.PublishTask(ctx, msg); err != nil {
+		reason := "failed to publish processing task"
+		if failErr := s.tasks.UpdateStatus(
+			context.WithoutCancel(ctx), task.ID, entity.TaskStatusFailed, &reason,
+		); failErr != nil {
+			s.logger.ErrorContext(ctx, "Failed to mark unpublished task failed", "task_id", task.ID, "error", failErr)
+		}
+		return nil, fmt.Errorf("%s: %w", reason, err)
+	}
+
+	return task, nil
+}
+
+// ValidateOptions reports invalid processing options, including an unknown
+// bottle style, as *imaging.ValidationError.
+func (s *ImageService) ValidateOptions(ctx context.Context, options entity.ProcessingOptions) error {
+	if err := options.Validate(); err != nil {
+		return &imaging.ValidationError{
+			Err:     ErrInvalidProcessingOptions,
+			Details: map[string]any{"options": err.Error()},
+		}
+	}
+	return s.checkBottleStyle(ctx, options.BottleStyle)
+}
+
+// checkBottleStyle reports a validation error unless the style is an enabled
+// catalog entry. An empty style lets the worker pick one.
+func (s *ImageService) checkBottleStyle(ctx context.Context, style string) error {
+	if style == "" {
+		return nil
+	}
+
+	asset, err := s.bottles.GetByStyle(ctx, style)
+	if err != nil && !errors.Is(err, repository.ErrBottleAssetNotFound) {
+		return fmt.Errorf("failed to look up bottle style: %w", err)
+	}
+	if err != nil || !asset.Enabled {
+		return &imaging.ValidationError{
+			Err:     ErrBottleStyleUnknown,
+			Details: map[string]any{"bottle_style": style},
+		}
+	}
+	return nil
+}
+
+// GetImage returns the image together with its renditions and fresh URLs
+// for its files. An expired image is returned without URLs, its files are
+// gone.
+func (s *ImageService) GetImage(ctx context.Context, id uuid.UUID) (*ImageDetails, error) {
+	image, err := s.images.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	renditions, err := s.renditions.ListByImageID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renditions: %w", err)
+	}
+
+	details, err := s.details(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	details.Renditions = make([]RenditionURL, 0, len(renditions))
+	for _, rendition := range renditions {
+		url, urlErr := s.fileURL(ctx, rendition.Bucket, rendition.ObjectKey)
+		if urlErr != nil {
+			return nil, fmt.Errorf("failed to generate rendition URL: %w", urlErr)
+		}
+		details.Renditions = append(details.Renditions, RenditionURL{ImageRendition: rendition, URL: url})
+	}
+
+	return details, nil
+}
+
+// ListImages returns a page of the images in status, all images if it is
+// empty, that match the options. Renditions are not listed; GetImage returns
+// them. Once API keys are configured, callers without a known key get
+// ErrAPIKeyRequired.
+func (s *ImageService) ListImages(ctx context.Context, status entity.ImageStatus, opts ListOptions) (*ImageList, error) {
+	details := map[string]any{}
+	if status != "" && !status.IsValid() {
+		details["status"] = "must be one of pending, processing, completed, failed, expired"
+	}
+	clientID, err := opts.clientID(&s.cfg.Backend, details)
+	if err != nil {
+		return nil, err
+	}
+	page, created, err := opts.page(details)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := s.images.List(ctx, repository.ImageFilter{
+		Status:   status,
+		ClientID: clientID,
+		Created:  created,
+	}, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	images, cursor := nextCursor(images, page, func(image *entity.Image) (time.Time, uuid.UUID) {
+		return image.CreatedAt, image.ID
+	})
+	list := &ImageList{Items: make([]ImageDetails, 0, len(images)), NextCursor: cursor}
+	for i := range images {
+		item, detailsErr := s.details(ctx, &images[i])
+		if detailsErr != nil {
+			return nil, detailsErr
+		}
+		list.Items = append(list.Items, *item)
+	}
+
+	return list, nil
+}
+
+// details returns the image with the URLs of its original and processed
+// files.
+func (s *ImageService) details(ctx context.Context, image *entity.Image) (*ImageDetails, error) {
+	details := &ImageDetails{Image: image}
+
+	var err error
+	if image.OriginalDeletedAt == nil {
+		if details.OriginalURL, err = s.fileURL(ctx, image.OriginalBucket, image.OriginalKey); err != nil {
+			return nil, fmt.Errorf("failed to generate original URL: %w", err)
+		}
+	}
+	if image.ProcessedBucket != nil && image.ProcessedKey != nil {
+		if details.ProcessedURL, err = s.fileURL(ctx, *image.ProcessedBucket, *image.ProcessedKey); err != nil {
+			return nil, fmt.Errorf("failed to generate processed URL: %w", err)
+		}
+	}
+
+	return details, nil
+}
+
+// fileURL returns a presigned URL of an object, or nil if storage encrypts
+// objects with keys clients don't have.
+func (s *ImageService) fileURL(ctx context.Context, bucket, key string) (*string, error) {
+	url, err := s.storage.GetFileURL(ctx, bucket, key)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &url, nil
+}
+
+// IsValidationError reports whether err was caused by invalid client input
+// and returns the details that should be sent back with VALIDATION_ERROR.
+func IsValidationError(err error) (map[string]any, bool) {
+	var validationErr *imaging.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, false
+	}
+
+	details := map[string]any{
+		"error": validationErr.Err.Error(),
+	}
+	maps.Copy(details, validationErr.Details)
+	return details, true
+}
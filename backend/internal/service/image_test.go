@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+)
+
+type uploadTest struct {
+	images  *fakeImageRepository
+	tasks   *fakeTaskRepository
+	queue   *fakeQueue
+	storage *fakeStorage
+	service *ImageService
+}
+
+func newUploadTest() *uploadTest {
+	u := &uploadTest{
+		images:  newFakeImageRepository(),
+		tasks:   &fakeTaskRepository{},
+		queue:   &fakeQueue{},
+		storage: newFakeStorage(),
+	}
+	cfg := &config.Config{
+		S3: config.S3Config{BucketUploads: "uploads"},
+		Image: config.ImageConfig{
+			MaxUploadBytes: 1 << 20,
+			MaxPixels:      1 << 20,
+			MaxDimension:   1024,
+			JPEGQuality:    90,
+		},
+	}
+	u.service = NewImageService(u.images, u.tasks, nil, nil, u.storage, u.queue, cfg, discardLogger())
+	return u
+}
+
+// beerPhoto returns a small PNG; different shades give different content.
+func beerPhoto(t *testing.T, shade uint8) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for y := range 6 {
+		for x := range 8 {
+			img.Set(x, y, color.RGBA{R: shade, G: uint8(x * 16), B: uint8(y * 16), A: 255})
+		}
+	}
+	data, err := imaging.Encode(img, imaging.FormatPNG, 90)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return data
+}
+
+func (u *uploadTest) upload(
+	t *testing.T,
+	data []byte,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+) *UploadResult {
+	t.Helper()
+
+	result, err := u.service.Upload(context.Background(), bytes.NewReader(data), options, priority, nil)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	return result
+}
+
+func TestUploadNewImage(t *testing.T) {
+	u := newUploadTest()
+	client := "brewery"
+
+	got, err := u.service.Upload(context.Background(), bytes.NewReader(beerPhoto(t, 200)),
+		entity.ProcessingOptions{}, entity.TaskPriorityNormal, &client)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+
+	if got.Deduplicated {
+		t.Error("Upload() deduplicated a new image")
+	}
+	image, ok := u.images.images[got.ImageID]
+	if !ok {
+		t.Fatalf("Upload() image %s not created", got.ImageID)
+	}
+	if image.Status != entity.ImageStatusPending || image.ContentHash == nil ||
+		image.OriginalKey != *image.ContentHash+".png" {
+		t.Errorf("Upload() image = %+v, want a pending image stored under its content hash", image)
+	}
+	if _, stored := u.storage.object("uploads", image.OriginalKey); !stored {
+		t.Errorf("Upload() didn't store the original %s", image.OriginalKey)
+	}
+	if clients := u.images.clients[got.ImageID]; len(clients) != 1 || clients[0] != client {
+		t.Errorf("Upload() clients = %v, want [%s]", clients, client)
+	}
+	if len(u.tasks.tasks) != 1 || u.tasks.tasks[0].ID != got.TaskID || u.tasks.tasks[0].ImageID != got.ImageID {
+		t.Fatalf("Upload() tasks = %+v, want task %s of the image", u.tasks.tasks, got.TaskID)
+	}
+	if len(u.queue.published) != 1 || u.queue.published[0].TaskID != got.TaskID {
+		t.Errorf("Upload() published %d messages, want task %s once", len(u.queue.published), got.TaskID)
+	}
+}
+
+func TestUploadSameContent(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      entity.ProcessingOptions
+		priority     entity.TaskPriority
+		wantSameTask bool
+		wantPriority entity.TaskPriority // priority of the returned task
+	}{
+		{
+			name:         "same options",
+			priority:     entity.TaskPriorityNormal,
+			wantSameTask: true,
+			wantPriority: entity.TaskPriorityNormal,
+		},
+		{
+			name:         "same options less urgent",
+			priority:     entity.TaskPriorityBulk,
+			wantSameTask: true,
+			wantPriority: entity.TaskPriorityNormal,
+		},
+		{
+			name:         "same options more urgent",
+			priority:     entity.TaskPriorityInteractive,
+			wantSameTask: true,
+			wantPriority: entity.TaskPriorityInteractive,
+		},
+		{
+			name:         "different options",
+			options:      entity.ProcessingOptions{Placement: entity.BottlePlacementLeft},
+			priority:     entity.TaskPriorityNormal,
+			wantPriority: entity.TaskPriorityNormal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := newUploadTest()
+			photo := beerPhoto(t, 200)
+			first := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+
+			got := u.upload(t, photo, tt.options, tt.priority)
+
+			if !got.Deduplicated || got.ImageID != first.ImageID {
+				t.Errorf("Upload() = %+v, want image %s deduplicated", got, first.ImageID)
+			}
+			if len(u.images.images) != 1 || u.storage.callCount("UploadFile") != 1 {
+				t.Errorf("Upload() created %d images and stored %d originals, want one each",
+					len(u.images.images), u.storage.callCount("UploadFile"))
+			}
+			if (got.TaskID == first.TaskID) != tt.wantSameTask {
+				t.Errorf("Upload() task = %s, first task %s, want same %v", got.TaskID, first.TaskID, tt.wantSameTask)
+			}
+			wantTasks := 1
+			if !tt.wantSameTask {
+				wantTasks = 2
+			}
+			if len(u.tasks.tasks) != wantTasks {
+				t.Errorf("Upload() created %d tasks, want %d", len(u.tasks.tasks), wantTasks)
+			}
+			if task := u.tasks.task(got.TaskID); task == nil || task.Priority != tt.wantPriority {
+				t.Errorf("Upload() task = %+v, want priority %s", task, tt.wantPriority)
+			}
+			// A new or promoted task is published, a reused one isn't.
+			wantPublished := wantTasks
+			if tt.wantSameTask && tt.priority.Rank() < entity.TaskPriorityNormal.Rank() {
+				wantPublished++
+			}
+			if len(u.queue.published) != wantPublished {
+				t.Errorf("Upload() published %d messages, want %d", len(u.queue.published), wantPublished)
+			}
+		})
+	}
+}
+
+func TestUploadRequeuesFailedTask(t *testing.T) {
+	u := newUploadTest()
+	photo := beerPhoto(t, 200)
+	first := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+	u.tasks.task(first.TaskID).Status = entity.TaskStatusFailed
+
+	got := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+
+	if !got.Deduplicated || got.ImageID != first.ImageID || got.TaskID == first.TaskID {
+		t.Errorf("Upload() = %+v, want a new task of image %s", got, first.ImageID)
+	}
+	if task := u.tasks.task(got.TaskID); task == nil || task.Status != entity.TaskStatusPending {
+		t.Errorf("Upload() task = %+v, want a pending task", task)
+	}
+	if len(u.queue.published) != 2 || u.queue.published[1].TaskID != got.TaskID {
+		t.Errorf("Upload() published %d messages, want the new task published", len(u.queue.published))
+	}
+}
+
+func TestUploadRestoresExpiredImage(t *testing.T) {
+	u := newUploadTest()
+	photo := beerPhoto(t, 200)
+	first := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+
+	// Retention deleted the files of the completed image.
+	deletedAt := time.Now()
+	image := u.images.images[first.ImageID]
+	image.Status = entity.ImageStatusExpired
+	image.FinishedAt = &deletedAt
+	image.OriginalDeletedAt = &deletedAt
+	u.images.images[image.ID] = image
+	u.tasks.task(first.TaskID).Status = entity.TaskStatusCompleted
+	if err := u.storage.DeleteFile(context.Background(), "uploads", image.OriginalKey); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+
+	got := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+
+	if !got.Deduplicated || got.ImageID != first.ImageID || got.TaskID == first.TaskID {
+		t.Errorf("Upload() = %+v, want a new task of image %s", got, first.ImageID)
+	}
+	restored := u.images.images[first.ImageID]
+	if restored.Status != entity.ImageStatusPending || restored.OriginalDeletedAt != nil || restored.FinishedAt != nil {
+		t.Errorf("Upload() image = %+v, want it pending with its original", restored)
+	}
+	if _, stored := u.storage.object("uploads", restored.OriginalKey); !stored {
+		t.Errorf("Upload() didn't store the original %s again", restored.OriginalKey)
+	}
+	if len(u.queue.published) != 2 || u.queue.published[1].TaskID != got.TaskID {
+		t.Errorf("Upload() published %d messages, want the new task published", len(u.queue.published))
+	}
+}
+
+func TestUploadPublishFailure(t *testing.T) {
+	u := newUploadTest()
+	photo := beerPhoto(t, 200)
+	errBroker := errors.New("broker unavailable")
+	u.queue.errs = []error{errBroker}
+
+	if _, err := u.service.Upload(context.Background(), bytes.NewReader(photo),
+		entity.ProcessingOptions{}, entity.TaskPriorityNormal, nil); !errors.Is(err, errBroker) {
+		t.Fatalf("Upload() error = %v, want %v", err, errBroker)
+	}
+	if len(u.tasks.tasks) != 1 || u.tasks.tasks[0].Status != entity.TaskStatusFailed {
+		t.Fatalf("Upload() tasks = %+v, want the unpublished task failed", u.tasks.tasks)
+	}
+
+	// The next upload of the image queues it again.
+	got := u.upload(t, photo, entity.ProcessingOptions{}, entity.TaskPriorityNormal)
+	if got.TaskID == u.tasks.tasks[0].ID || len(u.queue.published) != 1 || u.queue.published[0].TaskID != got.TaskID {
+		t.Errorf("Upload() = %+v, want a new task published", got)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"cmp"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+)
+
+type acceptedType struct {
+	mediaType string
+	quality   float64
+	order     int
+}
+
+// negotiateFormat picks the output format from an Accept header. The stored
+// format wins whenever the client accepts it as well as the alternatives, so
+// a plain "*/*" never triggers a transcode. It returns false if none of the
+// supported formats is acceptable.
+func negotiateFormat(accept string, stored imaging.Format) (imaging.Format, bool) {
+	accept = strings.TrimSpace(accept)
+	if accept == "" {
+		return stored, true
+	}
+
+	types := parseAccept(accept)
+	candidates := []imaging.Format{stored, imaging.FormatWebP, imaging.FormatJPEG, imaging.FormatPNG}
+
+	best := imaging.Format("")
+	bestQuality := 0.0
+	for _, format := range candidates {
+		quality := acceptQuality(types, format.ContentType())
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best, bestQuality > 0
+}
+
+func parseAccept(accept string) []acceptedType {
+	var types []acceptedType
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, parseErr := strconv.ParseFloat(q, 64); parseErr == nil {
+				quality = parsed
+			}
+		}
+
+		types = append(types, acceptedType{mediaType: mediaType, quality: quality, order: i})
+	}
+	return types
+}
+
+// acceptQuality returns the q-value of the most specific Accept entry
+// matching the content type, 0 if it is not acceptable.
+func acceptQuality(types []acceptedType, contentType string) float64 {
+	majorType, _, _ := strings.Cut(contentType, "/")
+
+	specificity := func(mediaType string) int {
+		switch mediaType {
+		case contentType:
+			return 3 //nolint:mnd // exact match
+		case majorType + "/*":
+			return 2 //nolint:mnd // type wildcard
+		case "*/*":
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	matches := slices.DeleteFunc(slices.Clone(types), func(t acceptedType) bool {
+		return specificity(t.mediaType) == 0
+	})
+	if len(matches) == 0 {
+		return 0
+	}
+
+	best := slices.MaxFunc(matches, func(a, b acceptedType) int {
+		return cmp.Or(cmp.Compare(specificity(a.mediaType), specificity(b.mediaType)), cmp.Compare(b.order, a.order))
+	})
+	return best.quality
+}
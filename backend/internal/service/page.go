@@ -0,0 +1,169 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidListOptions = errors.New("invalid list options")
+	// ErrAPIKeyRequired is returned for a listing without a known API key
+	// once API keys are configured.
+	ErrAPIKeyRequired = errors.New("listing requires a known API key")
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+const (
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+)
+
+// ListOptions selects a page of images or tasks. Zero values mean the first
+// page of 50, newest first, unfiltered. Filters and sort must stay the same
+// while following NextCursor.
+type ListOptions struct {
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+	// Sort is SortCreatedAsc or SortCreatedDesc.
+	Sort string
+	// CreatedAfter and CreatedBefore bound the creation time, inclusive and
+	// exclusive.
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// ClientID selects what the client with this ID, as resolved by
+	// ClientID, created.
+	ClientID string
+	// APIKey is the key of the caller. Once API keys are configured it is
+	// required, and only what its client created is listed.
+	APIKey string
+}
+
+// clientID returns the client whose images or tasks are listed, empty for
+// every client. Without configured API keys that is the ClientID filter;
+// with them it is the client of the caller's key, or ErrAPIKeyRequired
+// without a known key. A ClientID filter naming another client is reported
+// in details.
+func (o ListOptions) clientID(cfg *config.BackendConfig, details map[string]any) (string, error) {
+	if len(cfg.APIKeyTiers) == 0 {
+		return o.ClientID, nil
+	}
+
+	id := ClientID(cfg, o.APIKey)
+	if id == nil {
+		return "", ErrAPIKeyRequired
+	}
+	if o.ClientID != "" && o.ClientID != *id {
+		details["client_id"] = "must be the client of the API key"
+	}
+	return *id, nil
+}
+
+// pageCursor is the decoded form of an opaque cursor. The sort order is
+// part of it, so a cursor can't be replayed in the opposite direction.
+type pageCursor struct {
+	CreatedAt  time.Time `json:"t"`
+	ID         uuid.UUID `json:"i"`
+	Descending bool      `json:"d"`
+}
+
+// page validates the options and returns the repository page and creation
+// time filter, asking for one row more than the limit to learn whether
+// another page follows. Invalid options are reported as
+// *imaging.ValidationError, together with the problems the caller already
+// found in details.
+func (o ListOptions) page(details map[string]any) (repository.Page, repository.CreatedFilter, error) {
+	limit := o.Limit
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if limit < 1 || limit > maxPageLimit {
+		details["limit"] = fmt.Sprintf("must be between 1 and %d", maxPageLimit)
+	}
+
+	descending := true
+	switch o.Sort {
+	case "", SortCreatedDesc:
+	case SortCreatedAsc:
+		descending = false
+	default:
+		details["sort"] = "must be one of created_at, -created_at"
+	}
+
+	if o.CreatedAfter != nil && o.CreatedBefore != nil && !o.CreatedAfter.Before(*o.CreatedBefore) {
+		details["created_before"] = "must be after created_after"
+	}
+
+	var after *repository.Cursor
+	if o.Cursor != "" {
+		cursor, err := decodeCursor(o.Cursor)
+		switch {
+		case err != nil:
+			details["cursor"] = "is not a cursor returned by this listing"
+		case cursor.Descending != descending:
+			details["cursor"] = "belongs to the opposite sort order"
+		default:
+			after = &repository.Cursor{CreatedAt: cursor.CreatedAt, ID: cursor.ID}
+		}
+	}
+
+	if len(details) > 0 {
+		return repository.Page{}, repository.CreatedFilter{}, &imaging.ValidationError{
+			Err:     ErrInvalidListOptions,
+			Details: details,
+		}
+	}
+
+	page := repository.Page{Limit: limit + 1, After: after, Descending: descending}
+	created := repository.CreatedFilter{After: o.CreatedAfter, Before: o.CreatedBefore}
+	return page, created, nil
+}
+
+// nextCursor trims the extra row fetched by page and returns the cursor of
+// the next page, or nil on the last page. position returns the creation
+// time and ID of a row.
+func nextCursor[T any](rows []T, page repository.Page, position func(*T) (time.Time, uuid.UUID)) ([]T, *string) {
+	limit := page.Limit - 1
+	if len(rows) <= limit {
+		return rows, nil
+	}
+
+	rows = rows[:limit]
+	createdAt, id := position(&rows[limit-1])
+	cursor := encodeCursor(pageCursor{CreatedAt: createdAt, ID: id, Descending: page.Descending})
+	return rows, &cursor
+}
+
+func encodeCursor(cursor pageCursor) string {
+	// Marshalling a struct of a time, a UUID and a bool can't fail.
+	data, _ := json.Marshal(cursor) //nolint:errchkjson // see above
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor pageCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.CreatedAt.IsZero() || cursor.ID == uuid.Nil {
+		return nil, errors.New("incomplete cursor")
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type row struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+func rowPosition(r *row) (time.Time, uuid.UUID) {
+	return r.createdAt, r.id
+}
+
+func rows(n int) []row {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := make([]row, n)
+	for i := range result {
+		result[i] = row{createdAt: start.Add(time.Duration(i) * time.Second), id: uuid.New()}
+	}
+	return result
+}
+
+func TestListOptionsPage(t *testing.T) {
+	after := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := after.Add(time.Hour)
+	cursorTime := after.Add(time.Minute)
+	cursorID := uuid.New()
+	descCursor := encodeCursor(pageCursor{CreatedAt: cursorTime, ID: cursorID, Descending: true})
+	ascCursor := encodeCursor(pageCursor{CreatedAt: cursorTime, ID: cursorID})
+
+	tests := []struct {
+		name        string
+		opts        ListOptions
+		wantPage    repository.Page
+		wantCreated repository.CreatedFilter
+		wantDetails map[string]any
+	}{
+		{
+			name:     "defaults",
+			wantPage: repository.Page{Limit: defaultPageLimit + 1, Descending: true},
+		},
+		{
+			name:     "ascending with limit",
+			opts:     ListOptions{Limit: maxPageLimit, Sort: SortCreatedAsc},
+			wantPage: repository.Page{Limit: maxPageLimit + 1},
+		},
+		{
+			name: "descending cursor",
+			opts: ListOptions{Cursor: descCursor, Sort: SortCreatedDesc},
+			wantPage: repository.Page{
+				Limit:      defaultPageLimit + 1,
+				After:      &repository.Cursor{CreatedAt: cursorTime, ID: cursorID},
+				Descending: true,
+			},
+		},
+		{
+			name: "ascending cursor",
+			opts: ListOptions{Cursor: ascCursor, Sort: SortCreatedAsc},
+			wantPage: repository.Page{
+				Limit: defaultPageLimit + 1,
+				After: &repository.Cursor{CreatedAt: cursorTime, ID: cursorID},
+			},
+		},
+		{
+			name:        "created range",
+			opts:        ListOptions{CreatedAfter: &after, CreatedBefore: &before},
+			wantPage:    repository.Page{Limit: defaultPageLimit + 1, Descending: true},
+			wantCreated: repository.CreatedFilter{After: &after, Before: &before},
+		},
+		{
+			name:        "only created after",
+			opts:        ListOptions{CreatedAfter: &after},
+			wantPage:    repository.Page{Limit: defaultPageLimit + 1, Descending: true},
+			wantCreated: repository.CreatedFilter{After: &after},
+		},
+		{
+			name:        "limit too small",
+			opts:        ListOptions{Limit: -1},
+			wantDetails: map[string]any{"limit": "must be between 1 and 200"},
+		},
+		{
+			name:        "limit too large",
+			opts:        ListOptions{Limit: maxPageLimit + 1},
+			wantDetails: map[string]any{"limit": "must be between 1 and 200"},
+		},
+		{
+			name:        "unknown sort",
+			opts:        ListOptions{Sort: "id"},
+			wantDetails: map[string]any{"sort": "must be one of created_at, -created_at"},
+		},
+		{
+			name:        "empty created range",
+			opts:        ListOptions{CreatedAfter: &after, CreatedBefore: &after},
+			wantDetails: map[string]any{"created_before": "must be after created_after"},
+		},
+		{
+			name:        "inverted created range",
+			opts:        ListOptions{CreatedAfter: &before, CreatedBefore: &after},
+			wantDetails: map[string]any{"created_before": "must be after created_after"},
+		},
+		{
+			name:        "descending cursor reused ascending",
+			opts:        ListOptions{Cursor: descCursor, Sort: SortCreatedAsc},
+			wantDetails: map[string]any{"cursor": "belongs to the opposite sort order"},
+		},
+		{
+			name:        "ascending cursor reused with the default sort",
+			opts:        ListOptions{Cursor: ascCursor},
+			wantDetails: map[string]any{"cursor": "belongs to the opposite sort order"},
+		},
+		{
+			name:        "cursor is not base64",
+			opts:        ListOptions{Cursor: "not a cursor!"},
+			wantDetails: map[string]any{"cursor": "is not a cursor returned by this listing"},
+		},
+		{
+			name:        "cursor is not JSON",
+			opts:        ListOptions{Cursor: base64.RawURLEncoding.EncodeToString([]byte("12345"))},
+			wantDetails: map[string]any{"cursor": "is not a cursor returned by this listing"},
+		},
+		{
+			name:        "cursor without an ID",
+			opts:        ListOptions{Cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"t":"2026-01-01T00:00:00Z"}`))},
+			wantDetails: map[string]any{"cursor": "is not a cursor returned by this listing"},
+		},
+		{
+			name: "cursor without a time",
+			opts: ListOptions{
+				Cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"i":"` + cursorID.String() + `","d":true}`)),
+			},
+			wantDetails: map[string]any{"cursor": "is not a cursor returned by this listing"},
+		},
+		{
+			name: "every problem at once",
+			opts: ListOptions{Limit: 1000, Sort: "name", CreatedAfter: &before, CreatedBefore: &after, Cursor: "x"},
+			wantDetails: map[string]any{
+				"limit":          "must be between 1 and 200",
+				"sort":           "must be one of created_at, -created_at",
+				"created_before": "must be after created_after",
+				"cursor":         "is not a cursor returned by this listing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, created, err := tt.opts.page(map[string]any{})
+			if tt.wantDetails != nil {
+				details, ok := IsValidationError(err)
+				if !ok || !errors.Is(err, ErrInvalidListOptions) {
+					t.Fatalf("page() error = %v, want %v", err, ErrInvalidListOptions)
+				}
+				delete(details, "error")
+				if !reflect.DeepEqual(details, tt.wantDetails) {
+					t.Errorf("page() details = %v, want %v", details, tt.wantDetails)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("page: %v", err)
+			}
+			if !reflect.DeepEqual(page, tt.wantPage) {
+				t.Errorf("page() page = %+v, want %+v", page, tt.wantPage)
+			}
+			if !reflect.DeepEqual(created, tt.wantCreated) {
+				t.Errorf("page() created = %+v, want %+v", created, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestListOptionsPageKeepsCallerDetails(t *testing.T) {
+	_, _, err := ListOptions{}.page(map[string]any{"status": "must be one of pending"})
+	details, ok := IsValidationError(err)
+	if !ok || details["status"] != "must be one of pending" {
+		t.Errorf("page() error = %v, want the caller's details", err)
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	tests := []struct {
+		name       string
+		rows       int
+		limit      int
+		descending bool
+		wantRows   int
+		wantCursor bool
+	}{
+		{name: "empty", rows: 0, limit: 3},
+		{name: "short page", rows: 2, limit: 3, wantRows: 2},
+		{name: "exactly the limit", rows: 3, limit: 3, wantRows: 3},
+		{name: "extra row", rows: 4, limit: 3, wantRows: 3, wantCursor: true},
+		{name: "extra row descending", rows: 4, limit: 3, descending: true, wantRows: 3, wantCursor: true},
+		{name: "limit of one", rows: 2, limit: 1, wantRows: 1, wantCursor: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all := rows(tt.rows)
+			page := repository.Page{Limit: tt.limit + 1, Descending: tt.descending}
+
+			got, cursor := nextCursor(all, page, rowPosition)
+			if len(got) != tt.wantRows {
+				t.Fatalf("nextCursor() returned %d rows, want %d", len(got), tt.wantRows)
+			}
+			if (cursor != nil) != tt.wantCursor {
+				t.Fatalf("nextCursor() cursor = %v, want one: %v", cursor, tt.wantCursor)
+			}
+			if cursor == nil {
+				return
+			}
+
+			// The cursor points at the last returned row, not the extra one.
+			decoded, err := decodeCursor(*cursor)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			last := got[len(got)-1]
+			want := pageCursor{CreatedAt: last.createdAt, ID: last.id, Descending: tt.descending}
+			if !decoded.CreatedAt.Equal(want.CreatedAt) || decoded.ID != want.ID || decoded.Descending != want.Descending {
+				t.Errorf("cursor = %+v, want %+v", decoded, want)
+			}
+
+			// Following it sets up the next page in the same order.
+			sort := SortCreatedAsc
+			if tt.descending {
+				sort = SortCreatedDesc
+			}
+			next, _, err := ListOptions{Limit: tt.limit, Sort: sort, Cursor: *cursor}.page(map[string]any{})
+			if err != nil {
+				t.Fatalf("page: %v", err)
+			}
+			if next.After == nil || next.After.ID != last.id || !next.After.CreatedAt.Equal(last.createdAt) {
+				t.Errorf("next page starts after %+v, want the last row", next.After)
+			}
+		})
+	}
+}
+
+func TestListOptionsClientID(t *testing.T) {
+	open := &config.BackendConfig{}
+	keyed := &config.BackendConfig{APIKeyTiers: map[string]string{"secret": "normal"}}
+	own := *ClientID(keyed, "secret")
+
+	tests := []struct {
+		name        string
+		cfg         *config.BackendConfig
+		opts        ListOptions
+		want        string
+		wantErr     error
+		wantDetails map[string]any
+	}{
+		{name: "without keys unfiltered", cfg: open, want: ""},
+		{name: "without keys filtered", cfg: open, opts: ListOptions{ClientID: "3f2a9c1e7b4d5a60"}, want: "3f2a9c1e7b4d5a60"},
+		{name: "without keys a key is ignored", cfg: open, opts: ListOptions{APIKey: "secret"}, want: ""},
+		{name: "no key", cfg: keyed, wantErr: ErrAPIKeyRequired},
+		{name: "unknown key", cfg: keyed, opts: ListOptions{APIKey: "guess"}, wantErr: ErrAPIKeyRequired},
+		{name: "known key", cfg: keyed, opts: ListOptions{APIKey: "secret"}, want: own},
+		{name: "known key with its client", cfg: keyed, opts: ListOptions{APIKey: "secret", ClientID: own}, want: own},
+		{
+			name:        "known key with another client",
+			cfg:         keyed,
+			opts:        ListOptions{APIKey: "secret", ClientID: "3f2a9c1e7b4d5a60"},
+			want:        own,
+			wantDetails: map[string]any{"client_id": "must be the client of the API key"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := map[string]any{}
+			got, err := tt.opts.clientID(tt.cfg, details)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("clientID() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("clientID() = %q, want %q", got, tt.want)
+			}
+			if tt.wantDetails == nil {
+				tt.wantDetails = map[string]any{}
+			}
+			if !reflect.DeepEqual(details, tt.wantDetails) {
+				t.Errorf("clientID() details = %v, want %v", details, tt.wantDetails)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+)
+
+var (
+	ErrInvalidPriority = errors.New("invalid priority")
+)
+
+// ResolvePriority picks the lane of a new task. The tier of the API key is
+// both the default and the most urgent priority the caller may use; an
+// explicitly requested priority can only lower it. Callers without a known
+// key are treated as the normal tier.
+func ResolvePriority(cfg *config.BackendConfig, apiKey string, requested entity.TaskPriority) (entity.TaskPriority, error) {
+	if requested != "" && !requested.IsValid() {
+		return "", &imaging.ValidationError{
+			Err:     ErrInvalidPriority,
+			Details: map[string]any{"priority": "must be one of interactive, normal, bulk"},
+		}
+	}
+
+	tier := entity.TaskPriorityNormal
+	if apiKey != "" {
+		if keyTier, ok := cfg.APIKeyTiers[apiKey]; ok {
+			tier = entity.TaskPriority(keyTier)
+		}
+	}
+
+	if requested == "" || requested.Rank() < tier.Rank() {
+		return tier, nil
+	}
+	return requested, nil
+}
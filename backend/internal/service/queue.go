@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/queue"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+)
+
+// LaneOverview is the backlog of one priority lane with a wait estimate.
+type LaneOverview struct {
+	queue.LaneStats
+	// Throughput is the number of tasks of the lane finished per minute over
+	// the throughput window.
+	Throughput float64
+	// EstimatedWait is how long a task queued now would wait before a
+	// worker picks it up. It is nil when nothing finished in the window.
+	EstimatedWait *time.Duration
+}
+
+type QueueOverview struct {
+	Lanes       map[entity.TaskPriority]LaneOverview
+	DeadLetters int
+	// Processing counts tasks being processed by any worker, unlike the
+	// per-lane Unacked that only covers this process.
+	Processing int64
+	Window     time.Duration
+}
+
+// QueuePosition tells where a pending task stands in its lane.
+type QueuePosition struct {
+	// Position is 1 for the next task of the lane to be picked up.
+	Position      int64
+	EstimatedWait *time.Duration
+}
+
+type QueueService struct {
+	queue  queue.Queue
+	tasks  repository.TaskRepository
+	cfg    *config.Config
+	logger *slog.Logger
+}
+
+func NewQueueService(
+	q queue.Queue,
+	tasks repository.TaskRepository,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *QueueService {
+	return &QueueService{
+		queue:  q,
+		tasks:  tasks,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Overview reports the backlog of every lane from the broker and estimates
+// the wait of a new upload from the recent throughput of its lane. Lanes are
+// served in proportion to their weights, so each lane's own throughput
+// already accounts for the share it gets.
+func (s *QueueService) Overview(ctx context.Context) (*QueueOverview, error) {
+	stats, err := s.queue.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue stats: %w", err)
+	}
+
+	rates, err := s.throughput(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	processing, err := s.tasks.CountByStatus(ctx, entity.TaskStatusProcessing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count processing tasks: %w", err)
+	}
+
+	overview := &QueueOverview{
+		Lanes:       make(map[entity.TaskPriority]LaneOverview, len(queue.Lanes)),
+		DeadLetters: stats.DeadLetters,
+		Processing:  processing,
+		Window:      s.cfg.Backend.ThroughputWindow(),
+	}
+	for _, lane := range queue.Lanes {
+		laneStats := stats.Lanes[lane]
+		overview.Lanes[lane] = LaneOverview{
+			LaneStats:     laneStats,
+			Throughput:    rates[lane] * float64(time.Minute/time.Second),
+			EstimatedWait: estimateWait(int64(laneStats.Ready)+1, rates[lane]),
+		}
+	}
+
+	return overview, nil
+}
+
+// Position returns the place of a pending task in its lane, counted from the
+// pending tasks created before it, and when it should be picked up.
+func (s *QueueService) Position(ctx context.Context, task *entity.ProcessingTask) (*QueuePosition, error) {
+	ahead, err := s.tasks.CountPendingAhead(ctx, task.Priority, task.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tasks ahead: %w", err)
+	}
+
+	rates, err := s.throughput(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueuePosition{
+		Position:      ahead + 1,
+		EstimatedWait: estimateWait(ahead+1, rates[task.Priority]),
+	}, nil
+}
+
+// throughput returns the finished tasks per second of each lane over the
+// throughput window.
+func (s *QueueService) throughput(ctx context.Context) (map[entity.TaskPriority]float64, error) {
+	window := s.cfg.Backend.ThroughputWindow()
+	counts, err := s.tasks.CountFinishedSince(ctx, time.Now().Add(-window))
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure throughput: %w", err)
+	}
+
+	rates := make(map[entity.TaskPriority]float64, len(counts))
+	for priority, count := range counts {
+		rates[priority] = float64(count) / window.Seconds()
+	}
+	return rates, nil
+}
+
+func estimateWait(position int64, perSecond float64) *time.Duration {
+	if perSecond <= 0 {
+		return nil
+	}
+	wait := time.Duration(float64(position) / perSecond * float64(time.Second))
+	return &wait
+}
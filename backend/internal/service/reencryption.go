@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+)
+
+// ReencryptionReport counts the objects a re-encryption run went through.
+type ReencryptionReport struct {
+	Checked   int
+	Rewritten int
+	Failed    int
+}
+
+// ReencryptionService rewrites stored objects with the configured
+// server-side encryption, after encryption was turned on or changed or the
+// SSE-C master key was rotated. Once a run finished without failures the
+// previous master keys can be dropped from the configuration.
+type ReencryptionService struct {
+	storage storage.Storage
+	cfg     *config.Config
+	logger  *slog.Logger
+}
+
+func NewReencryptionService(store storage.Storage, cfg *config.Config, logger *slog.Logger) *ReencryptionService {
+	return &ReencryptionService{
+		storage: store,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// Buckets returns the buckets a run goes through by default.
+func (s *ReencryptionService) Buckets() []string {
+	return []string{s.cfg.S3.BucketUploads, s.cfg.S3.BucketProcessed, s.cfg.S3.BucketBottles}
+}
+
+// Reencrypt rewrites every object under prefix in the buckets that is not
+// encrypted the way new objects are. Objects that fail are logged and
+// counted, so one bad object doesn't stop the run; an error is returned only
+// if a bucket can't be listed.
+func (s *ReencryptionService) Reencrypt(ctx context.Context, buckets []string, prefix string) (*ReencryptionReport, error) {
+	report := &ReencryptionReport{}
+	for _, bucket := range buckets {
+		err := s.storage.WalkObjects(ctx, bucket, prefix, func(key string) error {
+			report.Checked++
+			rewritten, err := s.storage.Reencrypt(ctx, bucket, key)
+			switch {
+			case err == nil:
+			case errors.Is(err, storage.ErrObjectNotFound):
+				// Deleted since it was listed.
+				return nil
+			case ctx.Err() != nil:
+				return ctx.Err()
+			default:
+				report.Failed++
+				s.logger.ErrorContext(ctx, "Failed to re-encrypt object", "bucket", bucket, "key", key, "error", err)
+				return nil
+			}
+			if rewritten {
+				report.Rewritten++
+				s.logger.DebugContext(ctx, "Object re-encrypted", "bucket", bucket, "key", key)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to re-encrypt bucket %s: %w", bucket, err)
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Re-encryption finished",
+		"checked", report.Checked,
+		"rewritten", report.Rewritten,
+		"failed", report.Failed)
+
+	return report, nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const renditionPrefix = "renditions"
+
+// ErrRenditionSource is returned when processed renditions are generated
+// without their task, or renditions of the original with one.
+var ErrRenditionSource = errors.New("processed renditions need their task, original ones none")
+
+// RenditionService renders the configured thumbnail sizes and formats of
+// original and processed images. It is run by the worker once the source
+// bytes are available.
+type RenditionService struct {
+	renditions repository.RenditionRepository
+	storage    storage.Storage
+	cfg        *config.Config
+	logger     *slog.Logger
+}
+
+func NewRenditionService(
+	renditions repository.RenditionRepository,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *RenditionService {
+	return &RenditionService{
+		renditions: renditions,
+		storage:    store,
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+// RenditionObjectKey returns the predictable object key of a rendition:
+// renditions/{image_id}/{kind}-{size}.{ext} for the original and
+// renditions/{image_id}/{task_id}/{kind}-{size}.{ext} for the processed
+// result of a task, since each task has its own result.
+func RenditionObjectKey(
+	imageID uuid.UUID,
+	taskID *uuid.UUID,
+	kind entity.RenditionKind,
+	size int,
+	format imaging.Format,
+) string {
+	prefix := RenditionPrefix(imageID)
+	if taskID != nil {
+		prefix += taskID.String() + "/"
+	}
+	return fmt.Sprintf("%s%s-%d%s", prefix, kind, size, format.Extension())
+}
+
+// RenditionPrefix returns the common prefix of the renditions of an image.
+func RenditionPrefix(imageID uuid.UUID) string {
+	return fmt.Sprintf("%s/%s/", renditionPrefix, imageID)
+}
+
+// Generate renders every configured size in every configured format from the
+// source image, stores the results and records them in image_renditions.
+// taskID is the task whose processed result source is, nil for the original.
+// Existing renditions of the same source are overwritten. If the image was
+// deleted meanwhile, the rendition just stored is deleted and
+// ErrTaskCancelled is returned.
+func (s *RenditionService) Generate(
+	ctx context.Context,
+	imageID uuid.UUID,
+	taskID *uuid.UUID,
+	kind entity.RenditionKind,
+	source []byte,
+) ([]entity.ImageRendition, error) {
+	if (kind == entity.RenditionKindProcessed) != (taskID != nil) {
+		return nil, fmt.Errorf("%w: %s renditions of task %v", ErrRenditionSource, kind, taskID)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s image: %w", kind, err)
+	}
+
+	bucket := s.bucket(kind)
+	renditions := make([]entity.ImageRendition, 0, len(s.cfg.Image.RenditionSizes)*len(s.cfg.Image.RenditionFormats))
+
+	for _, size := range s.cfg.Image.RenditionSizes {
+		resized := imaging.Fit(src, size)
+
+		for _, name := range s.cfg.Image.RenditionFormats {
+			format := imaging.Format(name)
+
+			data, encodeErr := imaging.Encode(resized, format, s.cfg.Image.JPEGQuality)
+			if encodeErr != nil {
+				return nil, encodeErr
+			}
+
+			key := RenditionObjectKey(imageID, taskID, kind, size, format)
+			if err = s.storage.UploadFile(
+				ctx,
+				bucket,
+				key,
+				bytes.NewReader(data),
+				int64(len(data)),
+				format.ContentType(),
+			); err != nil {
+				return nil, fmt.Errorf("failed to store rendition %s: %w", key, err)
+			}
+
+			rendition := entity.ImageRendition{
+				ImageID:   imageID,
+				TaskID:    taskID,
+				Kind:      kind,
+				Size:      size,
+				Format:    format.String(),
+				Width:     resized.Bounds().Dx(),
+				Height:    resized.Bounds().Dy(),
+				Bytes:     int64(len(data)),
+				Bucket:    bucket,
+				ObjectKey: key,
+			}
+			if err = s.renditions.Upsert(ctx, &rendition); err != nil {
+				if errors.Is(err, repository.ErrImageNotFound) {
+					return nil, discard(ctx, s.storage, s.logger, bucket, key)
+				}
+				return nil, fmt.Errorf("failed to save rendition %s: %w", key, err)
+			}
+
+			renditions = append(renditions, rendition)
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Renditions generated",
+		"image_id", imageID,
+		"task_id", taskID,
+		"kind", kind,
+		"count", len(renditions))
+
+	return renditions, nil
+}
+
+func (s *RenditionService) bucket(kind entity.RenditionKind) string {
+	if kind == entity.RenditionKindProcessed {
+		return s.cfg.S3.BucketProcessed
+	}
+	return s.cfg.S3.BucketUploads
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUploadNotResumable   = errors.New("upload is not resumable")
+	ErrUploadOffsetMismatch = errors.New("chunk offset does not match the upload offset")
+	ErrInvalidChunk         = errors.New("invalid chunk")
+)
+
+// UploadOffsetError is returned for a chunk sent at the wrong offset, for
+// example after a response was lost. Offset is where the client must resume.
+type UploadOffsetError struct {
+	Offset int64
+}
+
+func (e *UploadOffsetError) Error() string {
+	return fmt.Sprintf("%s: upload is at offset %d", ErrUploadOffsetMismatch, e.Offset)
+}
+
+func (e *UploadOffsetError) Unwrap() error {
+	return ErrUploadOffsetMismatch
+}
+
+// ResumableUpload is the state of a resumable upload. Result is set once the
+// upload is completed, unless its image was deleted since.
+type ResumableUpload struct {
+	Upload    *entity.Upload
+	ChunkSize int64
+	Result    *UploadResult
+}
+
+// CreateResumableUpload validates the declared file and the processing
+// options and starts a multipart upload for its chunks. The upload expires
+// if no chunk arrives for the configured resumable TTL. Like CreateUpload the
+// task is queued with priority and recorded for clientID once completed.
+func (s *UploadService) CreateResumableUpload(
+	ctx context.Context,
+	contentType string,
+	size int64,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*ResumableUpload, error) {
+	upload, err := s.newUpload(ctx, contentType, size, options, priority, clientID, time.Now().Add(s.cfg.Upload.ResumableTTL()))
+	if err != nil {
+		return nil, err
+	}
+
+	multipartID, err := s.storage.NewMultipartUpload(ctx, upload.Bucket, upload.ObjectKey, upload.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	upload.Resumable = true
+	upload.MultipartID = &multipartID
+
+	if err = s.uploads.Create(ctx, upload); err != nil {
+		if abortErr := s.storage.AbortMultipartUpload(ctx, upload.Bucket, upload.ObjectKey, multipartID); abortErr != nil {
+			s.logger.WarnContext(ctx, "Failed to abort multipart upload", "upload_id", upload.ID, "error", abortErr)
+		}
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Resumable upload created",
+		"upload_id", upload.ID,
+		"content_type", upload.ContentType,
+		"size", upload.Size,
+		"priority", upload.Priority)
+
+	return &ResumableUpload{Upload: upload, ChunkSize: s.cfg.Upload.ChunkBytes}, nil
+}
+
+// GetResumableUpload returns the state of a resumable upload, in particular
+// the offset to resume from.
+func (s *UploadService) GetResumableUpload(ctx context.Context, id uuid.UUID) (*ResumableUpload, error) {
+	upload, err := s.uploads.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !upload.Resumable {
+		return nil, ErrUploadNotResumable
+	}
+
+	state := &ResumableUpload{Upload: upload, ChunkSize: s.cfg.Upload.ChunkBytes}
+	if upload.Status == entity.UploadStatusCompleted {
+		// Without a result the image was deleted; the upload stays completed.
+		state.Result, _ = completedUpload(upload)
+	}
+	return state, nil
+}
+
+// AppendChunk stores length bytes of the file at offset, which must be the
+// current offset of the upload. Every chunk but the last must be exactly the
+// chunk size. A chunk that fails midway leaves the offset unchanged and can
+// simply be sent again. The last chunk completes the upload like
+// CompleteUpload; if that fails, sending an empty chunk at the final offset
+// retries it.
+func (s *UploadService) AppendChunk(
+	ctx context.Context,
+	id uuid.UUID,
+	offset int64,
+	chunk io.Reader,
+	length int64,
+) (*ResumableUpload, error) {
+	state, err := s.GetResumableUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	upload := state.Upload
+
+	switch upload.Status {
+	case entity.UploadStatusPending:
+	case entity.UploadStatusCompleted:
+		return state, nil
+	case entity.UploadStatusExpired:
+		return nil, ErrUploadExpired
+	default:
+		return nil, fmt.Errorf("upload %s has unknown status %q", upload.ID, upload.Status)
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	if offset != upload.Received {
+		return nil, &UploadOffsetError{Offset: upload.Received}
+	}
+
+	if upload.Received < upload.Size {
+		if err = s.putChunk(ctx, upload, chunk, length); err != nil {
+			return nil, err
+		}
+		upload.Received += length
+		if upload.Received < upload.Size {
+			return state, nil
+		}
+	} else if length != 0 {
+		return nil, &imaging.ValidationError{
+			Err:     ErrInvalidChunk,
+			Details: map[string]any{"length": "must be 0, every byte has been received"},
+		}
+	}
+
+	if state.Result, err = s.CompleteUpload(ctx, upload.ID); err != nil {
+		return nil, err
+	}
+	if state.Upload, err = s.uploads.GetByID(ctx, upload.ID); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// putChunk stores a chunk as the part numbered by its offset and advances
+// the upload.
+func (s *UploadService) putChunk(ctx context.Context, upload *entity.Upload, chunk io.Reader, length int64) error {
+	chunkSize := s.cfg.Upload.ChunkBytes
+	if want := min(chunkSize, upload.Size-upload.Received); length != want {
+		return &imaging.ValidationError{
+			Err:     ErrInvalidChunk,
+			Details: map[string]any{"length": fmt.Sprintf("must be %d at offset %d", want, upload.Received)},
+		}
+	}
+
+	number := int(upload.Received/chunkSize) + 1
+	part, err := s.storage.PutPart(ctx, upload.Bucket, upload.ObjectKey, *upload.MultipartID, number, chunk, length)
+	if err != nil {
+		return err
+	}
+
+	err = s.uploads.AppendPart(ctx, upload.ID, upload.Received, &entity.UploadPart{
+		Number: part.Number,
+		ETag:   part.ETag,
+		Size:   part.Size,
+	}, time.Now().Add(s.cfg.Upload.ResumableTTL()))
+	if err != nil {
+		if !errors.Is(err, repository.ErrUploadOffsetChanged) {
+			return fmt.Errorf("failed to record chunk: %w", err)
+		}
+		// A concurrent request stored the same chunk first.
+		current, getErr := s.uploads.GetByID(ctx, upload.ID)
+		if getErr != nil {
+			return getErr
+		}
+		return &UploadOffsetError{Offset: current.Received}
+	}
+
+	return nil
+}
+
+// assemble completes the multipart upload of a resumable upload that has
+// received every byte.
+func (s *UploadService) assemble(ctx context.Context, upload *entity.Upload) error {
+	parts, err := s.uploads.ListParts(ctx, upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list upload parts: %w", err)
+	}
+
+	storageParts := make([]storage.Part, 0, len(parts))
+	for _, part := range parts {
+		storageParts = append(storageParts, storage.Part{Number: part.Number, ETag: part.ETag, Size: part.Size})
+	}
+
+	err = s.storage.CompleteMultipartUpload(ctx, upload.Bucket, upload.ObjectKey, *upload.MultipartID, storageParts)
+	if errors.Is(err, storage.ErrMultipartUploadNotFound) {
+		// An earlier attempt assembled the object but failed to record it.
+		if _, statErr := s.storage.StatObject(ctx, upload.Bucket, upload.ObjectKey); statErr != nil {
+			return fmt.Errorf("multipart upload of %s is gone: %w", upload.ID, statErr)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err = s.uploads.FinishMultipart(ctx, upload.ID); err != nil {
+		return fmt.Errorf("failed to finish multipart upload: %w", err)
+	}
+	upload.MultipartID = nil
+	return nil
+}
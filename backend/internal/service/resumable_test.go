@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const testChunkBytes = 4
+
+func newResumableUploadService(uploads *fakeUploadRepository, store *fakeStorage) *UploadService {
+	cfg := &config.Config{Upload: config.UploadConfig{ChunkBytes: testChunkBytes, ResumableTTLMinutes: 60}}
+	return NewUploadService(uploads, nil, store, cfg, discardLogger())
+}
+
+// resumableUpload returns a pending resumable upload of 10 bytes, three
+// chunks of the test chunk size, that has received the first received bytes.
+func resumableUpload(received int64) entity.Upload {
+	multipartID := "multipart-" + uuid.NewString()
+	return entity.Upload{
+		ID:          uuid.New(),
+		Bucket:      "uploads",
+		ObjectKey:   "originals/upload",
+		Size:        10,
+		Status:      entity.UploadStatusPending,
+		Resumable:   true,
+		MultipartID: &multipartID,
+		Received:    received,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+}
+
+func TestAppendChunk(t *testing.T) {
+	tests := []struct {
+		name       string
+		received   int64
+		offset     int64
+		chunk      string
+		wantPart   int   // part number the chunk is stored as, 0 for none
+		wantOffset int64 // offset of an UploadOffsetError, -1 for none
+		wantErr    error
+	}{
+		{name: "first chunk", received: 0, offset: 0, chunk: "abcd", wantPart: 1, wantOffset: -1},
+		{name: "second chunk", received: 4, offset: 4, chunk: "efgh", wantPart: 2, wantOffset: -1},
+		{name: "resent chunk", received: 4, offset: 0, chunk: "abcd", wantOffset: 4, wantErr: ErrUploadOffsetMismatch},
+		{name: "chunk ahead", received: 4, offset: 8, chunk: "ij", wantOffset: 4, wantErr: ErrUploadOffsetMismatch},
+		{name: "short chunk", received: 0, offset: 0, chunk: "abc", wantOffset: -1, wantErr: ErrInvalidChunk},
+		{name: "long chunk", received: 0, offset: 0, chunk: "abcde", wantOffset: -1, wantErr: ErrInvalidChunk},
+		{name: "last chunk too long", received: 8, offset: 8, chunk: "ijkl", wantOffset: -1, wantErr: ErrInvalidChunk},
+		{name: "empty chunk before the end", received: 8, offset: 8, chunk: "", wantOffset: -1, wantErr: ErrInvalidChunk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := resumableUpload(tt.received)
+			uploads := newFakeUploadRepository(upload)
+			store := newFakeStorage()
+			s := newResumableUploadService(uploads, store)
+
+			state, err := s.AppendChunk(context.Background(), upload.ID, tt.offset, bytes.NewBufferString(tt.chunk),
+				int64(len(tt.chunk)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AppendChunk() error = %v, want %v", err, tt.wantErr)
+			}
+
+			var offsetErr *UploadOffsetError
+			switch {
+			case errors.As(err, &offsetErr) && offsetErr.Offset != tt.wantOffset:
+				t.Errorf("AppendChunk() offset = %d, want %d", offsetErr.Offset, tt.wantOffset)
+			case offsetErr == nil && tt.wantOffset >= 0:
+				t.Errorf("AppendChunk() error = %v, want offset %d", err, tt.wantOffset)
+			}
+			var validationErr *imaging.ValidationError
+			if errors.Is(err, ErrInvalidChunk) && !errors.As(err, &validationErr) {
+				t.Errorf("AppendChunk() error = %T, want *imaging.ValidationError", err)
+			}
+
+			stored, _ := uploads.GetByID(context.Background(), upload.ID)
+			parts, _ := uploads.ListParts(context.Background(), upload.ID)
+			if tt.wantPart == 0 {
+				if err == nil {
+					t.Fatal("AppendChunk() error = nil, want one")
+				}
+				if stored.Received != tt.received || len(parts) != 0 || store.callCount("PutPart") != 0 {
+					t.Errorf("AppendChunk() stored %d parts and moved to %d, want nothing stored at %d",
+						len(parts), stored.Received, tt.received)
+				}
+				return
+			}
+
+			want := tt.received + int64(len(tt.chunk))
+			if state.Upload.Received != want || stored.Received != want {
+				t.Errorf("AppendChunk() received = %d, stored %d, want %d", state.Upload.Received, stored.Received, want)
+			}
+			if len(parts) != 1 || parts[0].Number != tt.wantPart || parts[0].Size != int64(len(tt.chunk)) {
+				t.Errorf("AppendChunk() parts = %+v, want part %d of %d bytes", parts, tt.wantPart, len(tt.chunk))
+			}
+			if data := store.parts[*upload.MultipartID][tt.wantPart]; string(data) != tt.chunk {
+				t.Errorf("AppendChunk() stored part %d = %q, want %q", tt.wantPart, data, tt.chunk)
+			}
+		})
+	}
+}
+
+func TestAppendChunkConcurrent(t *testing.T) {
+	upload := resumableUpload(0)
+	uploads := newFakeUploadRepository(upload)
+	store := newFakeStorage()
+	// Another request stores the same chunk while this one uploads its part.
+	store.onPutPart = func() { uploads.advance(upload.ID, testChunkBytes) }
+	s := newResumableUploadService(uploads, store)
+
+	_, err := s.AppendChunk(context.Background(), upload.ID, 0, bytes.NewBufferString("abcd"), testChunkBytes)
+
+	var offsetErr *UploadOffsetError
+	if !errors.As(err, &offsetErr) {
+		t.Fatalf("AppendChunk() error = %v, want *UploadOffsetError", err)
+	}
+	if offsetErr.Offset != testChunkBytes {
+		t.Errorf("AppendChunk() offset = %d, want %d", offsetErr.Offset, testChunkBytes)
+	}
+	if parts, _ := uploads.ListParts(context.Background(), upload.ID); len(parts) != 0 {
+		t.Errorf("AppendChunk() recorded parts %+v, want none", parts)
+	}
+}
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name    string
+		lost    bool // an earlier CompleteMultipartUpload succeeded but its result was lost
+		stored  bool // the assembled object exists
+		wantErr error
+	}{
+		{name: "parts assembled", stored: true},
+		{name: "lost completion", lost: true, stored: true},
+		{name: "lost completion without object", lost: true, wantErr: storage.ErrObjectNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload := resumableUpload(0)
+			uploads := newFakeUploadRepository(upload)
+			store := newFakeStorage()
+			s := newResumableUploadService(uploads, store)
+
+			// The chunks arrive out of order to check the parts are listed by number.
+			for _, chunk := range []struct {
+				offset int64
+				data   string
+			}{{4, "efgh"}, {0, "abcd"}, {8, "ij"}} {
+				part, err := store.PutPart(context.Background(), upload.Bucket, upload.ObjectKey, *upload.MultipartID,
+					int(chunk.offset/testChunkBytes)+1, bytes.NewBufferString(chunk.data), int64(len(chunk.data)))
+				if err != nil {
+					t.Fatalf("PutPart: %v", err)
+				}
+				uploads.parts[upload.ID] = append(uploads.parts[upload.ID], entity.UploadPart{
+					UploadID: upload.ID,
+					Number:   part.Number,
+					ETag:     part.ETag,
+					Size:     part.Size,
+				})
+			}
+			if tt.lost {
+				err := store.CompleteMultipartUpload(context.Background(), upload.Bucket, upload.ObjectKey,
+					*upload.MultipartID, []storage.Part{{Number: 1}, {Number: 2}, {Number: 3}})
+				if err != nil {
+					t.Fatalf("CompleteMultipartUpload: %v", err)
+				}
+				if !tt.stored {
+					store.objects = make(map[string][]byte)
+				}
+			}
+
+			err := s.assemble(context.Background(), &upload)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("assemble() error = %v, want %v", err, tt.wantErr)
+			}
+
+			stored, _ := uploads.GetByID(context.Background(), upload.ID)
+			if tt.wantErr != nil {
+				if upload.MultipartID == nil || stored.MultipartID == nil {
+					t.Error("assemble() cleared the multipart upload, want it kept")
+				}
+				return
+			}
+			if upload.MultipartID != nil || stored.MultipartID != nil {
+				t.Error("assemble() kept the multipart upload, want it cleared")
+			}
+			if data, _ := store.object(upload.Bucket, upload.ObjectKey); string(data) != "abcdefghij" {
+				t.Errorf("assemble() object = %q, want %q", data, "abcdefghij")
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+)
+
+const retentionBatchLimit = 100
+
+// RetentionService deletes stored files once their retention, counted from
+// when the image finished processing, ran out. An image whose processed
+// result or, after failing, whose original is deleted becomes expired.
+type RetentionService struct {
+	images     repository.ImageRepository
+	tasks      repository.TaskRepository
+	renditions repository.RenditionRepository
+	storage    storage.Storage
+	cfg        *config.Config
+	logger     *slog.Logger
+}
+
+func NewRetentionService(
+	images repository.ImageRepository,
+	tasks repository.TaskRepository,
+	renditions repository.RenditionRepository,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *RetentionService {
+	return &RetentionService{
+		images:     images,
+		tasks:      tasks,
+		renditions: renditions,
+		storage:    store,
+		cfg:        cfg,
+		logger:     logger,
+	}
+}
+
+// Enforce deletes the files of every image past its retention. It returns
+// the number of images whose files were deleted.
+func (s *RetentionService) Enforce(ctx context.Context) (int, error) {
+	retention := s.cfg.Retention
+	now := time.Now()
+	cleaned := 0
+
+	// Processed results go first: expiring an image deletes its original too.
+	if retention.ProcessedDays > 0 {
+		before := now.Add(-retention.ProcessedRetention())
+		n, err := s.enforce(ctx, entity.ImageStatusCompleted, before, false, s.expire)
+		cleaned += n
+		if err != nil {
+			return cleaned, err
+		}
+	}
+
+	if retention.FailedOriginalDays > 0 {
+		before := now.Add(-retention.FailedOriginalRetention())
+		n, err := s.enforce(ctx, entity.ImageStatusFailed, before, false, s.expire)
+		cleaned += n
+		if err != nil {
+			return cleaned, err
+		}
+	}
+
+	if retention.OriginalDays > 0 {
+		before := now.Add(-retention.OriginalRetention())
+		n, err := s.enforce(ctx, entity.ImageStatusCompleted, before, true, s.deleteOriginal)
+		cleaned += n
+		if err != nil {
+			return cleaned, err
+		}
+	}
+
+	return cleaned, nil
+}
+
+// enforce applies clean to the images in status that finished before the
+// given time, batch by batch. Images that left the status meanwhile, for
+// example because they were uploaded again, are skipped.
+func (s *RetentionService) enforce(
+	ctx context.Context,
+	status entity.ImageStatus,
+	before time.Time,
+	originalStored bool,
+	clean func(ctx context.Context, image *entity.Image) error,
+) (int, error) {
+	cleaned := 0
+	for {
+		images, err := s.images.ListFinishedBefore(ctx, status, before, originalStored, retentionBatchLimit)
+		if err != nil {
+			return cleaned, fmt.Errorf("failed to list %s images: %w", status, err)
+		}
+
+		for i := range images {
+			if err = clean(ctx, &images[i]); err != nil {
+				if errors.Is(err, repository.ErrImageStatusChanged) {
+					continue
+				}
+				return cleaned, fmt.Errorf("failed to apply retention to image %s: %w", images[i].ID, err)
+			}
+			cleaned++
+		}
+
+		if len(images) < retentionBatchLimit {
+			return cleaned, nil
+		}
+	}
+}
+
+// deleteOriginal deletes the original of a completed image and its
+// renditions. The processed result stays available.
+func (s *RetentionService) deleteOriginal(ctx context.Context, image *entity.Image) error {
+	if err := s.deleteRenditions(ctx, image, entity.RenditionKindOriginal); err != nil {
+		return err
+	}
+	if err := s.storage.DeleteFile(ctx, image.OriginalBucket, image.OriginalKey); err != nil {
+		return fmt.Errorf("failed to delete original: %w", err)
+	}
+	if err := s.images.MarkOriginalDeleted(ctx, image.ID, image.Status); err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Original deleted by retention", "image_id", image.ID)
+	return nil
+}
+
+// expire deletes every file of an image: the original, the processed results
+// of its tasks, their renditions and the cached result variants.
+func (s *RetentionService) expire(ctx context.Context, image *entity.Image) error {
+	for _, kind := range []entity.RenditionKind{entity.RenditionKindOriginal, entity.RenditionKindProcessed} {
+		if err := s.deleteRenditions(ctx, image, kind); err != nil {
+			return err
+		}
+	}
+	if err := s.storage.DeletePrefix(ctx, s.cfg.S3.BucketProcessed, VariantPrefix(image.ID)); err != nil {
+		return fmt.Errorf("failed to delete result variants: %w", err)
+	}
+	tasks, err := s.tasks.ListByImageID(ctx, image.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list tasks: %w", err)
+	}
+	for _, object := range processedObjects(image, tasks) {
+		if err = s.storage.DeleteFile(ctx, object.bucket, object.key); err != nil {
+			return fmt.Errorf("failed to delete processed image: %w", err)
+		}
+	}
+	if image.OriginalDeletedAt == nil {
+		if err := s.storage.DeleteFile(ctx, image.OriginalBucket, image.OriginalKey); err != nil {
+			return fmt.Errorf("failed to delete original: %w", err)
+		}
+	}
+	if err := s.images.MarkExpired(ctx, image.ID, image.Status); err != nil {
+		return err
+	}
+
+	s.logger.InfoContext(ctx, "Image expired by retention", "image_id", image.ID, "status", image.Status)
+	return nil
+}
+
+// deleteRenditions deletes the renditions of one kind of an image.
+func (s *RetentionService) deleteRenditions(ctx context.Context, image *entity.Image, kind entity.RenditionKind) error {
+	renditions, err := s.renditions.ListByImageID(ctx, image.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list renditions: %w", err)
+	}
+
+	for _, rendition := range renditions {
+		if rendition.Kind != kind {
+			continue
+		}
+		if err = s.storage.DeleteFile(ctx, rendition.Bucket, rendition.ObjectKey); err != nil {
+			return fmt.Errorf("failed to delete rendition: %w", err)
+		}
+	}
+
+	if err = s.renditions.DeleteByImageIDAndKind(ctx, image.ID, kind); err != nil {
+		return fmt.Errorf("failed to forget renditions: %w", err)
+	}
+	return nil
+}
+
+// RunRetention calls Enforce every configured interval until ctx is done.
+func (s *RetentionService) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Retention.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cleaned, err := s.Enforce(ctx)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to enforce retention", "cleaned", cleaned, "error", err)
+			continue
+		}
+		if cleaned > 0 {
+			s.logger.InfoContext(ctx, "Retention enforced", "images", cleaned)
+		}
+	}
+}
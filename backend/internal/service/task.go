@@ -0,0 +1,503 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTaskNotCompleted     = errors.New("task is still being processed")
+	ErrResultExpired        = errors.New("task result has expired")
+	ErrTaskFailed           = errors.New("task processing failed")
+	ErrNotAcceptable        = errors.New("none of the accepted formats is supported")
+	ErrInvalidResultOptions = errors.New("invalid result options")
+	// ErrTaskCancelled is returned to a worker whose task was deleted with
+	// its image. What it stored for the task has been deleted.
+	ErrTaskCancelled = errors.New("task was cancelled by deleting its image")
+)
+
+const (
+	variantPrefix       = "variants"
+	minResultDimension  = 16
+	maxResultQuality    = 100
+	fullResolutionLabel = "full"
+)
+
+// ResultOptions controls the representation returned by GetResult.
+// Zero values mean "as stored".
+type ResultOptions struct {
+	// Format is requested explicitly and takes precedence over Accept.
+	Format       imaging.Format
+	Quality      int
+	MaxDimension int
+	// Accept is the raw Accept header used when Format is empty.
+	Accept string
+	// Delivery is redirect or proxy; empty means the configured default.
+	Delivery string
+	// Range is the raw Range header, only honoured by proxy delivery.
+	Range string
+}
+
+// TaskResult is a processed image ready to be served. Redirect delivery sets
+// URL; proxy delivery sets Body and the object details, and the caller must
+// close Body.
+type TaskResult struct {
+	URL         string
+	Format      imaging.Format
+	ContentType string
+
+	Body io.ReadCloser
+	// Size is the size of the whole image. Range is the part of it in Body,
+	// nil if Body holds all of it.
+	Size         int64
+	Range        *ByteRange
+	ETag         string
+	LastModified time.Time
+}
+
+type TaskDetails struct {
+	Task *entity.ProcessingTask
+	// Queue is set while the task is pending.
+	Queue *QueuePosition
+}
+
+// TaskList is a page of tasks. NextCursor is nil on the last page.
+type TaskList struct {
+	Items      []entity.ProcessingTask
+	NextCursor *string
+}
+
+type TaskService struct {
+	images  repository.ImageRepository
+	tasks   repository.TaskRepository
+	storage storage.Storage
+	queue   *QueueService
+	cfg     *config.Config
+	logger  *slog.Logger
+}
+
+func NewTaskService(
+	images repository.ImageRepository,
+	tasks repository.TaskRepository,
+	store storage.Storage,
+	queueService *QueueService,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *TaskService {
+	return &TaskService{
+		images:  images,
+		tasks:   tasks,
+		storage: store,
+		queue:   queueService,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// GetTask returns the task, with its queue position and estimated wait
+// while it is pending.
+func (s *TaskService) GetTask(ctx context.Context, id uuid.UUID) (*TaskDetails, error) {
+	task, err := s.tasks.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &TaskDetails{Task: task}
+	if task.Status != entity.TaskStatusPending {
+		return details, nil
+	}
+
+	// The position is only an estimate, so the task is still returned
+	// without it.
+	details.Queue, err = s.queue.Position(ctx, task)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to estimate queue position", "task_id", task.ID, "error", err)
+	}
+
+	return details, nil
+}
+
+// ListTasks returns a page of the tasks in status, all tasks if it is empty,
+// that match the options. Unlike GetTask it doesn't estimate queue
+// positions. Once API keys are configured, callers without a known key get
+// ErrAPIKeyRequired.
+func (s *TaskService) ListTasks(ctx context.Context, status entity.TaskStatus, opts ListOptions) (*TaskList, error) {
+	details := map[string]any{}
+	if status != "" && !status.IsValid() {
+		details["status"] = "must be one of pending, processing, completed, failed"
+	}
+	clientID, err := opts.clientID(&s.cfg.Backend, details)
+	if err != nil {
+		return nil, err
+	}
+	page, created, err := opts.page(details)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := s.tasks.List(ctx, repository.TaskFilter{
+		Status:   status,
+		ClientID: clientID,
+		Created:  created,
+	}, page)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+
+	tasks, cursor := nextCursor(tasks, page, func(task *entity.ProcessingTask) (time.Time, uuid.UUID) {
+		return task.CreatedAt, task.ID
+	})
+	return &TaskList{Items: tasks, NextCursor: cursor}, nil
+}
+
+// GetResult returns the processed image of a completed task in the requested
+// format, quality and maximum dimension. Transcoded variants are cached in
+// the processed bucket under a key derived from the task and the options.
+// Depending on the delivery the result is a presigned URL or an open stream
+// of the image. Once retention deleted the result it returns
+// ErrResultExpired.
+func (s *TaskService) GetResult(ctx context.Context, taskID uuid.UUID, opts ResultOptions) (*TaskResult, error) {
+	task, err := s.tasks.GetByID(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch task.Status {
+	case entity.TaskStatusCompleted:
+	case entity.TaskStatusFailed:
+		return nil, ErrTaskFailed
+	case entity.TaskStatusPending, entity.TaskStatusProcessing:
+		return nil, ErrTaskNotCompleted
+	default:
+		return nil, ErrTaskNotCompleted
+	}
+
+	img, err := s.images.GetByID(ctx, task.ImageID)
+	if err != nil {
+		return nil, err
+	}
+	if img.Status == entity.ImageStatusExpired {
+		return nil, ErrResultExpired
+	}
+	bucket, key, ok := processedObject(task, img)
+	if !ok {
+		return nil, fmt.Errorf("task %s is completed but has no processed result", task.ID)
+	}
+
+	stored := formatFromKey(key)
+	if err = s.normalizeOptions(&opts, stored); err != nil {
+		return nil, err
+	}
+
+	if opts.Format == stored && opts.Quality == 0 && opts.MaxDimension == 0 {
+		return s.result(ctx, bucket, key, opts)
+	}
+
+	variantKey := VariantObjectKey(img.ID, task.ID, opts)
+	_, err = s.storage.StatObject(ctx, bucket, variantKey)
+	if err == nil {
+		return s.result(ctx, bucket, variantKey, opts)
+	}
+	if !errors.Is(err, storage.ErrObjectNotFound) {
+		return nil, fmt.Errorf("failed to stat cached variant: %w", err)
+	}
+
+	if err = s.transcode(ctx, bucket, key, variantKey, opts); err != nil {
+		return nil, err
+	}
+	// Variants are not recorded anywhere, so a variant stored after the image
+	// was deleted would outlive the deletion of the variant prefix.
+	cancelled, err := s.Cancelled(ctx, task.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cancelled {
+		if err = discard(ctx, s.storage, s.logger, bucket, variantKey); err != nil {
+			return nil, fmt.Errorf("%w: %w", repository.ErrTaskNotFound, err)
+		}
+	}
+
+	s.logger.InfoContext(ctx, "Result variant cached",
+		"task_id", task.ID,
+		"key", variantKey)
+
+	return s.result(ctx, bucket, variantKey, opts)
+}
+
+// Cancelled reports whether a task was cancelled by deleting its image. A
+// worker checks it before processing and before storing results, since a
+// deleted task is not signalled otherwise.
+func (s *TaskService) Cancelled(ctx context.Context, id uuid.UUID) (bool, error) {
+	_, err := s.tasks.GetByID(ctx, id)
+	switch {
+	case err == nil:
+		return false, nil
+	case errors.Is(err, repository.ErrTaskNotFound):
+		return true, nil
+	default:
+		return false, fmt.Errorf("failed to get task: %w", err)
+	}
+}
+
+// RecordResult records the processed result a worker stored for a task. If
+// the task was cancelled meanwhile, the result is deleted and
+// ErrTaskCancelled is returned: recording fails once the deletion committed,
+// and a result recorded before is among the objects the deletion removes.
+func (s *TaskService) RecordResult(ctx context.Context, id uuid.UUID, bucket, key string) error {
+	err := s.tasks.SetResult(ctx, id, bucket, key)
+	if errors.Is(err, repository.ErrTaskNotFound) {
+		return discard(ctx, s.storage, s.logger, bucket, key)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record task result: %w", err)
+	}
+	return nil
+}
+
+// discard deletes an object stored for a task that was cancelled before the
+// object could be recorded, and returns ErrTaskCancelled.
+func discard(ctx context.Context, store storage.Storage, logger *slog.Logger, bucket, key string) error {
+	if err := store.DeleteFile(ctx, bucket, key); err != nil {
+		logger.WarnContext(ctx, "Failed to delete object of cancelled task", "bucket", bucket, "key", key, "error", err)
+	}
+	return ErrTaskCancelled
+}
+
+// processedObject returns the processed result of a task. Tasks completed
+// before results were recorded per task fall back to the latest result of
+// the image.
+func processedObject(task *entity.ProcessingTask, img *entity.Image) (string, string, bool) {
+	switch {
+	case task.ProcessedBucket != nil && task.ProcessedKey != nil:
+		return *task.ProcessedBucket, *task.ProcessedKey, true
+	case img.ProcessedBucket != nil && img.ProcessedKey != nil:
+		return *img.ProcessedBucket, *img.ProcessedKey, true
+	default:
+		return "", "", false
+	}
+}
+
+// storedObject is an object in storage.
+type storedObject struct {
+	bucket string
+	key    string
+}
+
+// processedObjects returns the processed results of an image and its tasks,
+// each once.
+func processedObjects(img *entity.Image, tasks []entity.ProcessingTask) []storedObject {
+	var objects []storedObject
+	add := func(bucket, key *string) {
+		if bucket == nil || key == nil {
+			return
+		}
+		object := storedObject{bucket: *bucket, key: *key}
+		if !slices.Contains(objects, object) {
+			objects = append(objects, object)
+		}
+	}
+
+	add(img.ProcessedBucket, img.ProcessedKey)
+	for i := range tasks {
+		add(tasks[i].ProcessedBucket, tasks[i].ProcessedKey)
+	}
+	return objects
+}
+
+// VariantObjectKey returns the cache key of a transcoded result:
+// variants/{image_id}/{task_id}/{max_dimension|full}-q{quality}.{ext}. Each
+// task has its own processing options and therefore its own variants.
+func VariantObjectKey(imageID, taskID uuid.UUID, opts ResultOptions) string {
+	size := fullResolutionLabel
+	if opts.MaxDimension > 0 {
+		size = strconv.Itoa(opts.MaxDimension)
+	}
+	return fmt.Sprintf("%s%s/%s-q%d%s", VariantPrefix(imageID), taskID, size, opts.Quality, opts.Format.Extension())
+}
+
+// VariantPrefix returns the common prefix of the cached variants of all
+// tasks of an image.
+func VariantPrefix(imageID uuid.UUID) string {
+	return fmt.Sprintf("%s/%s/", variantPrefix, imageID)
+}
+
+// normalizeOptions validates the options and resolves the output format,
+// so that equivalent requests map to the same cache key.
+func (s *TaskService) normalizeOptions(opts *ResultOptions, stored imaging.Format) error {
+	details := map[string]any{}
+
+	if opts.Format != "" && !opts.Format.IsValid() {
+		details["format"] = "must be one of jpeg, png, webp"
+	}
+	if opts.Quality != 0 && (opts.Quality < 1 || opts.Quality > maxResultQuality) {
+		details["quality"] = fmt.Sprintf("must be between 1 and %d", maxResultQuality)
+	}
+	maxDimension := s.cfg.Image.MaxDimension
+	if opts.MaxDimension != 0 && (opts.MaxDimension < minResultDimension || opts.MaxDimension > maxDimension) {
+		details["max_dimension"] = fmt.Sprintf("must be between %d and %d", minResultDimension, maxDimension)
+	}
+	if opts.Delivery != "" && opts.Delivery != config.ResultDeliveryRedirect && opts.Delivery != config.ResultDeliveryProxy {
+		details["delivery"] = "must be one of redirect, proxy"
+	}
+	if len(details) > 0 {
+		return &imaging.ValidationError{Err: ErrInvalidResultOptions, Details: details}
+	}
+
+	if opts.Delivery == "" {
+		opts.Delivery = s.cfg.Backend.ResultDelivery
+	}
+
+	if opts.Format == "" {
+		format, ok := negotiateFormat(opts.Accept, stored)
+		if !ok {
+			return ErrNotAcceptable
+		}
+		opts.Format = format
+	}
+
+	// Quality only affects JPEG output.
+	switch {
+	case opts.Format != imaging.FormatJPEG:
+		opts.Quality = 0
+	case opts.Quality == 0 && opts.Format != stored:
+		opts.Quality = s.cfg.Image.JPEGQuality
+	}
+
+	return nil
+}
+
+func (s *TaskService) transcode(ctx context.Context, bucket, key, variantKey string, opts ResultOptions) error {
+	reader, _, err := s.storage.GetObject(ctx, bucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to read processed image: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if closeErr := reader.Close(); closeErr != nil {
+		s.logger.WarnContext(ctx, "Failed to close processed image", "key", key, "error", closeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read processed image: %w", err)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode processed image: %w", err)
+	}
+
+	quality := opts.Quality
+	if quality == 0 {
+		quality = s.cfg.Image.JPEGQuality
+	}
+
+	encoded, err := imaging.Encode(imaging.Fit(src, opts.MaxDimension), opts.Format, quality)
+	if err != nil {
+		return err
+	}
+
+	if err = s.storage.UploadFile(
+		ctx,
+		bucket,
+		variantKey,
+		bytes.NewReader(encoded),
+		int64(len(encoded)),
+		opts.Format.ContentType(),
+	); err != nil {
+		return fmt.Errorf("failed to cache result variant: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TaskService) result(ctx context.Context, bucket, key string, opts ResultOptions) (*TaskResult, error) {
+	if opts.Delivery == config.ResultDeliveryProxy {
+		return s.proxyResult(ctx, bucket, key, opts)
+	}
+
+	url, err := s.storage.GetFileURL(ctx, bucket, key)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		// The client can't open encrypted objects itself.
+		return s.proxyResult(ctx, bucket, key, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate result URL: %w", err)
+	}
+
+	return &TaskResult{
+		URL:         url,
+		Format:      opts.Format,
+		ContentType: opts.Format.ContentType(),
+	}, nil
+}
+
+// proxyResult opens the image for streaming through the backend, honouring a
+// single byte range.
+func (s *TaskService) proxyResult(ctx context.Context, bucket, key string, opts ResultOptions) (*TaskResult, error) {
+	var rng *ByteRange
+	if strings.TrimSpace(opts.Range) != "" {
+		info, err := s.storage.StatObject(ctx, bucket, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat result: %w", err)
+		}
+		var ok bool
+		if rng, ok = parseRange(opts.Range, info.Size); !ok {
+			return nil, &RangeNotSatisfiableError{Size: info.Size}
+		}
+	}
+
+	var (
+		body io.ReadCloser
+		info *storage.ObjectInfo
+		err  error
+	)
+	if rng == nil {
+		body, info, err = s.storage.GetObject(ctx, bucket, key)
+	} else {
+		body, info, err = s.storage.GetObjectRange(ctx, bucket, key, rng.Start, rng.Length())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open result: %w", err)
+	}
+	if rng != nil {
+		// The storage clamps the range if the object shrank since the stat.
+		rng.End = min(rng.End, info.Size-1)
+	}
+
+	return &TaskResult{
+		Format:       opts.Format,
+		ContentType:  opts.Format.ContentType(),
+		Body:         body,
+		Size:         info.Size,
+		Range:        rng,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func formatFromKey(key string) imaging.Format {
+	switch path.Ext(key) {
+	case ".png":
+		return imaging.FormatPNG
+	case ".webp":
+		return imaging.FormatWebP
+	default:
+		return imaging.FormatJPEG
+	}
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/imaging"
+	"github.com/Helltale/beer-mania/backend/internal/repository"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidUpload       = errors.New("invalid upload")
+	ErrUploadExpired       = errors.New("upload has expired")
+	ErrUploadObjectMissing = errors.New("upload has no file yet")
+)
+
+const (
+	// incomingPrefix holds files PUT by clients until their upload is
+	// completed; the sanitised original is stored under its content hash.
+	incomingPrefix    = "incoming"
+	cleanupBatchLimit = 100
+)
+
+// UploadSession is a created upload with the URL the client PUTs the file to.
+// The PUT must send the upload's content type and size as Content-Type and
+// Content-Length.
+type UploadSession struct {
+	Upload       *entity.Upload
+	URL          string
+	URLExpiresAt time.Time
+}
+
+// UploadService lets clients upload files straight to storage instead of
+// streaming them through the backend, or in resumable chunks.
+type UploadService struct {
+	uploads repository.UploadRepository
+	images  *ImageService
+	storage storage.Storage
+	cfg     *config.Config
+	logger  *slog.Logger
+}
+
+func NewUploadService(
+	uploads repository.UploadRepository,
+	images *ImageService,
+	store storage.Storage,
+	cfg *config.Config,
+	logger *slog.Logger,
+) *UploadService {
+	return &UploadService{
+		uploads: uploads,
+		images:  images,
+		storage: store,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// CreateUpload validates the declared file and the processing options and
+// returns a presigned PUT URL for the file. The task is queued with priority,
+// as resolved by ResolvePriority, and recorded for clientID, as resolved by
+// ClientID, once the upload is completed.
+func (s *UploadService) CreateUpload(
+	ctx context.Context,
+	contentType string,
+	size int64,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+) (*UploadSession, error) {
+	now := time.Now()
+	upload, err := s.newUpload(ctx, contentType, size, options, priority, clientID, now.Add(s.cfg.Upload.TTL()))
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := s.storage.PresignedPutURL(
+		ctx,
+		upload.Bucket,
+		upload.ObjectKey,
+		upload.ContentType,
+		upload.Size,
+		s.cfg.Upload.URLExpiration(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.uploads.Create(ctx, upload); err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "Upload created",
+		"upload_id", upload.ID,
+		"content_type", upload.ContentType,
+		"size", upload.Size,
+		"priority", upload.Priority)
+
+	return &UploadSession{
+		Upload:       upload,
+		URL:          url,
+		URLExpiresAt: now.Add(s.cfg.Upload.URLExpiration()),
+	}, nil
+}
+
+// newUpload validates the declared file and the processing options and
+// returns a pending upload with an incoming object key.
+func (s *UploadService) newUpload(
+	ctx context.Context,
+	contentType string,
+	size int64,
+	options entity.ProcessingOptions,
+	priority entity.TaskPriority,
+	clientID *string,
+	expiresAt time.Time,
+) (*entity.Upload, error) {
+	details := map[string]any{}
+	format, ok := imaging.FormatFromContentType(contentType)
+	if !ok {
+		details["content_type"] = "must be one of image/jpeg, image/png, image/webp"
+	}
+	if size < 1 || size > s.cfg.Image.MaxUploadBytes {
+		details["size"] = fmt.Sprintf("must be between 1 and %d", s.cfg.Image.MaxUploadBytes)
+	}
+	if len(details) > 0 {
+		return nil, &imaging.ValidationError{Err: ErrInvalidUpload, Details: details}
+	}
+
+	if err := s.images.ValidateOptions(ctx, options); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	return &entity.Upload{
+		ID:          id,
+		Bucket:      s.cfg.S3.BucketUploads,
+		ObjectKey:   fmt.Sprintf("%s/%s%s", incomingPrefix, id, format.Extension()),
+		ContentType: contentType,
+		Size:        size,
+		Options:     options,
+		Priority:    priority,
+		ClientID:    clientID,
+		Status:      entity.UploadStatusPending,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// CompleteUpload validates the uploaded file and hands it to
+// ImageService.Upload, which stores the sanitised original and queues the
+// processing task. Completing an upload again returns the same image and
+// task, or repository.ErrImageNotFound once the image was deleted. An
+// invalid file is reported as *imaging.ValidationError and leaves the upload
+// pending, so the client can PUT a corrected file while the URL is valid.
+// The chunks of a resumable upload are assembled first.
+func (s *UploadService) CompleteUpload(ctx context.Context, id uuid.UUID) (*UploadResult, error) {
+	upload, err := s.uploads.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch upload.Status {
+	case entity.UploadStatusPending:
+	case entity.UploadStatusCompleted:
+		return completedUpload(upload)
+	case entity.UploadStatusExpired:
+		return nil, ErrUploadExpired
+	default:
+		return nil, fmt.Errorf("upload %s has unknown status %q", upload.ID, upload.Status)
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+
+	if upload.MultipartID != nil {
+		if upload.Received < upload.Size {
+			return nil, ErrUploadObjectMissing
+		}
+		if err = s.assemble(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, info, err := s.storage.GetObject(ctx, upload.Bucket, upload.ObjectKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return nil, ErrUploadObjectMissing
+		}
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	defer func() {
+		if closeErr := reader.Close(); closeErr != nil {
+			s.logger.WarnContext(ctx, "Failed to close uploaded file", "upload_id", upload.ID, "error", closeErr)
+		}
+	}()
+
+	if info.Size != upload.Size {
+		return nil, &imaging.ValidationError{
+			Err:     ErrInvalidUpload,
+			Details: map[string]any{"size": fmt.Sprintf("uploaded %d bytes, declared %d", info.Size, upload.Size)},
+		}
+	}
+
+	result, err := s.images.Upload(ctx, reader, upload.Options, upload.Priority, upload.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.uploads.Complete(ctx, upload.ID, result.ImageID, result.TaskID); err != nil {
+		if !errors.Is(err, repository.ErrUploadNotPending) {
+			return nil, fmt.Errorf("failed to complete upload: %w", err)
+		}
+		// A concurrent completion won the race; the content hash led both
+		// to the same image.
+		if upload, err = s.uploads.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		if upload.Status != entity.UploadStatusCompleted {
+			return nil, ErrUploadExpired
+		}
+		return completedUpload(upload)
+	}
+
+	// The original is stored under its content hash, the incoming file is
+	// no longer needed.
+	if err = s.storage.DeleteFile(ctx, upload.Bucket, upload.ObjectKey); err != nil {
+		s.logger.WarnContext(ctx, "Failed to delete uploaded file",
+			"upload_id", upload.ID,
+			"key", upload.ObjectKey,
+			"error", err)
+	}
+
+	s.logger.InfoContext(ctx, "Upload completed",
+		"upload_id", upload.ID,
+		"image_id", result.ImageID,
+		"task_id", result.TaskID,
+		"deduplicated", result.Deduplicated)
+
+	return result, nil
+}
+
+// completedUpload returns the image and task a completed upload created.
+// Deleting the image clears both.
+func completedUpload(upload *entity.Upload) (*UploadResult, error) {
+	if upload.ImageID == nil || upload.TaskID == nil {
+		return nil, repository.ErrImageNotFound
+	}
+	return &UploadResult{ImageID: *upload.ImageID, TaskID: *upload.TaskID}, nil
+}
+
+// CleanupExpired deletes the files of pending uploads past their expiry and
+// marks the uploads expired. It returns the number of uploads cleaned up.
+func (s *UploadService) CleanupExpired(ctx context.Context) (int, error) {
+	cleaned := 0
+	for {
+		expired, err := s.uploads.ListExpired(ctx, time.Now(), cleanupBatchLimit)
+		if err != nil {
+			return cleaned, fmt.Errorf("failed to list expired uploads: %w", err)
+		}
+
+		for _, upload := range expired {
+			if upload.MultipartID != nil {
+				err = s.storage.AbortMultipartUpload(ctx, upload.Bucket, upload.ObjectKey, *upload.MultipartID)
+				if err != nil && !errors.Is(err, storage.ErrMultipartUploadNotFound) {
+					return cleaned, fmt.Errorf("failed to abort upload %s: %w", upload.ID, err)
+				}
+			}
+			// Deleting a missing object succeeds, so uploads that never got
+			// a file are handled the same way.
+			if err = s.storage.DeleteFile(ctx, upload.Bucket, upload.ObjectKey); err != nil {
+				return cleaned, fmt.Errorf("failed to delete file of upload %s: %w", upload.ID, err)
+			}
+			if err = s.uploads.MarkExpired(ctx, upload.ID); err != nil {
+				if errors.Is(err, repository.ErrUploadNotPending) {
+					continue
+				}
+				return cleaned, fmt.Errorf("failed to expire upload %s: %w", upload.ID, err)
+			}
+			cleaned++
+		}
+
+		if len(expired) < cleanupBatchLimit {
+			return cleaned, nil
+		}
+	}
+}
+
+// RunCleanup calls CleanupExpired every configured interval until ctx is
+// done.
+func (s *UploadService) RunCleanup(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Upload.CleanupInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cleaned, err := s.CleanupExpired(ctx)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to clean up expired uploads", "cleaned", cleaned, "error", err)
+			continue
+		}
+		if cleaned > 0 {
+			s.logger.InfoContext(ctx, "Expired uploads cleaned up", "count", cleaned)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+const (
+	cacheFileSuffix = ".obj"
+	cacheFillPrefix = "fill-"
+)
+
+// CacheStats is a snapshot of a read cache.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+	Bytes   int64
+}
+
+// CachingStorage keeps hot objects of some buckets, such as bottle assets
+// and recent results, in a directory on local disk. Whole-object reads fill
+// the cache as the caller reads, range reads and stats are served from it
+// but don't fill it, and the least recently used objects are evicted beyond
+// the size limit. Writes and deletions through the cache invalidate it;
+// changes made by other processes go unnoticed until the entry expires.
+type CachingStorage struct {
+	next           Storage
+	dir            string
+	maxBytes       int64
+	maxObjectBytes int64
+	ttl            time.Duration
+	buckets        map[string]bool
+	logger         *slog.Logger
+
+	mu sync.Mutex
+	// entries indexes lru, whose front is the most recently used entry.
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	// epoch changes on every invalidation, so that a fill that started
+	// before one isn't stored with stale content.
+	epoch  uint64
+	stored uint64
+	hits   int64
+	misses int64
+}
+
+type cacheEntry struct {
+	key      string
+	path     string
+	info     ObjectInfo
+	storedAt time.Time
+}
+
+// NewCachingStorage caches objects of buckets in cfg.CacheDir, which it
+// creates if needed. Objects cached by a previous run are removed, since
+// their metadata was only kept in memory.
+func NewCachingStorage(next Storage, cfg *config.StorageConfig, buckets []string, logger *slog.Logger) (*CachingStorage, error) {
+	if err := os.MkdirAll(cfg.CacheDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage cache directory: %w", err)
+	}
+	if err := clearCacheDir(cfg.CacheDir); err != nil {
+		return nil, err
+	}
+
+	cached := make(map[string]bool, len(buckets))
+	for _, bucket := range buckets {
+		cached[bucket] = true
+	}
+
+	return &CachingStorage{
+		next:           next,
+		dir:            cfg.CacheDir,
+		maxBytes:       cfg.CacheMaxBytes,
+		maxObjectBytes: cfg.CacheMaxObjectBytes,
+		ttl:            cfg.CacheTTL(),
+		buckets:        cached,
+		logger:         logger,
+		entries:        make(map[string]*list.Element),
+		lru:            list.New(),
+	}, nil
+}
+
+// clearCacheDir removes the files of a previous run, leaving anything else
+// in the directory alone.
+func clearCacheDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read storage cache directory: %w", err)
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || (!strings.HasSuffix(name, cacheFileSuffix) && !strings.HasPrefix(name, cacheFillPrefix)) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to clear storage cache directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of the cache.
+func (c *CachingStorage) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.lru.Len(),
+		Bytes:   c.size,
+	}
+}
+
+func cacheKey(bucket, objectName string) string {
+	return bucket + "/" + objectName
+}
+
+// pathLocked returns a new file name for a copy of an object. Names are
+// never reused, so a reader that opens a replaced copy gets the content that
+// matches the metadata it was given.
+func (c *CachingStorage) pathLocked(key string) string {
+	c.stored++
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%d%s", hex.EncodeToString(sum[:8]), c.stored, cacheFileSuffix))
+}
+
+// lookup opens the cached copy of an object, or returns nil on a miss.
+func (c *CachingStorage) lookup(bucket, objectName string) (*os.File, *ObjectInfo) {
+	if !c.buckets[bucket] {
+		return nil, nil
+	}
+	key := cacheKey(bucket, objectName)
+
+	c.mu.Lock()
+	element, ok := c.entries[key]
+	if ok && time.Since(element.Value.(*cacheEntry).storedAt) > c.ttl {
+		c.removeLocked(element)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.mu.Unlock()
+		return nil, nil
+	}
+	c.lru.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	info := entry.info
+	info.UserMetadata = maps.Clone(entry.info.UserMetadata)
+	c.mu.Unlock()
+
+	// An entry evicted meanwhile is still readable through an open file.
+	file, err := os.Open(entry.path)
+	if err != nil {
+		c.logger.Warn("Failed to open cached object", "key", key, "error", err)
+		c.invalidate(bucket, objectName)
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	c.hits++
+	c.mu.Unlock()
+	return file, &info
+}
+
+func (c *CachingStorage) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.epoch
+}
+
+// invalidate forgets a cached object after it was changed or deleted.
+func (c *CachingStorage) invalidate(bucket, objectName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	if element, ok := c.entries[cacheKey(bucket, objectName)]; ok {
+		c.removeLocked(element)
+	}
+}
+
+// invalidatePrefix forgets every cached object whose name starts with
+// prefix.
+func (c *CachingStorage) invalidatePrefix(bucket, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.epoch++
+	keyPrefix := cacheKey(bucket, prefix)
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, keyPrefix) {
+			c.removeLocked(element)
+		}
+	}
+}
+
+func (c *CachingStorage) removeLocked(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= entry.info.Size
+	if err := os.Remove(entry.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.logger.Warn("Failed to remove cached object", "key", entry.key, "error", err)
+	}
+}
+
+// store moves a completely read copy of an object from tempPath into the
+// cache, unless the cache was invalidated since the read started.
+func (c *CachingStorage) store(bucket, objectName string, info ObjectInfo, epoch uint64, tempPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if epoch != c.epoch {
+		c.discard(tempPath)
+		return
+	}
+
+	key := cacheKey(bucket, objectName)
+	if element, ok := c.entries[key]; ok {
+		c.removeLocked(element)
+	}
+	path := c.pathLocked(key)
+	if err := os.Rename(tempPath, path); err != nil {
+		c.logger.Warn("Failed to store cached object", "key", key, "error", err)
+		c.discard(tempPath)
+		return
+	}
+
+	entry := &cacheEntry{key: key, path: path, info: info, storedAt: time.Now()}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += entry.info.Size
+
+	for c.size > c.maxBytes {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *CachingStorage) discard(tempPath string) {
+	if err := os.Remove(tempPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.logger.Warn("Failed to remove partial cached object", "path", tempPath, "error", err)
+	}
+}
+
+// fillingReader copies an object into a temporary file while the caller
+// reads it, and stores the copy once the whole object was read.
+type fillingReader struct {
+	io.ReadCloser
+	cache      *CachingStorage
+	bucket     string
+	objectName string
+	info       ObjectInfo
+	epoch      uint64
+	// temp is nil once filling was given up.
+	temp    *os.File
+	written int64
+}
+
+func (r *fillingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && r.temp != nil {
+		if _, writeErr := r.temp.Write(p[:n]); writeErr != nil {
+			r.cache.logger.Warn("Failed to write cached object", "key", cacheKey(r.bucket, r.objectName), "error", writeErr)
+			r.abandon()
+		} else {
+			r.written += int64(n)
+		}
+	}
+	return n, err
+}
+
+func (r *fillingReader) Close() error {
+	err := r.ReadCloser.Close()
+	if r.temp == nil {
+		return err
+	}
+
+	temp := r.temp
+	r.temp = nil
+	complete := err == nil && r.written == r.info.Size
+	if closeErr := temp.Close(); closeErr != nil {
+		complete = false
+	}
+	if complete {
+		r.cache.store(r.bucket, r.objectName, r.info, r.epoch, temp.Name())
+	} else {
+		r.cache.discard(temp.Name())
+	}
+	return err
+}
+
+func (r *fillingReader) abandon() {
+	// The copy is thrown away, so a failed close doesn't matter.
+	_ = r.temp.Close()
+	r.cache.discard(r.temp.Name())
+	r.temp = nil
+}
+
+// GetObject serves cached objects from disk. On a miss the object is read
+// from storage and cached while the caller reads it to the end.
+func (c *CachingStorage) GetObject(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+) (io.ReadCloser, *ObjectInfo, error) {
+	if file, info := c.lookup(bucket, objectName); file != nil {
+		return file, info, nil
+	}
+
+	epoch := c.currentEpoch()
+	reader, info, err := c.next.GetObject(ctx, bucket, objectName)
+	if err != nil || !c.buckets[bucket] || info.Size > c.maxObjectBytes {
+		return reader, info, err
+	}
+
+	temp, err := os.CreateTemp(c.dir, cacheFillPrefix+"*")
+	if err != nil {
+		c.logger.WarnContext(ctx, "Failed to create cached object", "key", cacheKey(bucket, objectName), "error", err)
+		return reader, info, nil
+	}
+
+	fill := &fillingReader{
+		ReadCloser: reader,
+		cache:      c,
+		bucket:     bucket,
+		objectName: objectName,
+		info:       *info,
+		epoch:      epoch,
+		temp:       temp,
+	}
+	fill.info.UserMetadata = maps.Clone(info.UserMetadata)
+	return fill, info, nil
+}
+
+// GetObjectRange serves ranges of cached objects from disk; a miss is read
+// from storage without filling the cache.
+func (c *CachingStorage) GetObjectRange(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *ObjectInfo, error) {
+	file, info := c.lookup(bucket, objectName)
+	if file == nil {
+		return c.next.GetObjectRange(ctx, bucket, objectName, offset, length)
+	}
+
+	if offset < 0 || (offset > 0 && offset >= info.Size) {
+		if err := file.Close(); err != nil {
+			c.logger.WarnContext(ctx, "Failed to close cached object", "key", cacheKey(bucket, objectName), "error", err)
+		}
+		return nil, nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+
+	return sectionReadCloser{
+		Reader: io.NewSectionReader(file, offset, length),
+		Closer: file,
+	}, info, nil
+}
+
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// StatObject answers from the cache if the object is cached.
+func (c *CachingStorage) StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	if file, info := c.lookup(bucket, objectName); file != nil {
+		if err := file.Close(); err != nil {
+			c.logger.WarnContext(ctx, "Failed to close cached object", "key", cacheKey(bucket, objectName), "error", err)
+		}
+		return info, nil
+	}
+	return c.next.StatObject(ctx, bucket, objectName)
+}
+
+func (c *CachingStorage) UploadFile(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	size int64,
+	contentType string,
+) error {
+	defer c.invalidate(bucket, objectName)
+	return c.next.UploadFile(ctx, bucket, objectName, file, size, contentType)
+}
+
+func (c *CachingStorage) GetFileURL(ctx context.Context, bucket string, objectName string) (string, error) {
+	return c.next.GetFileURL(ctx, bucket, objectName)
+}
+
+func (c *CachingStorage) PresignedPutURL(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+	size int64,
+	expires time.Duration,
+) (string, error) {
+	return c.next.PresignedPutURL(ctx, bucket, objectName, contentType, size, expires)
+}
+
+func (c *CachingStorage) NewMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+) (string, error) {
+	return c.next.NewMultipartUpload(ctx, bucket, objectName, contentType)
+}
+
+func (c *CachingStorage) PutPart(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	number int,
+	part io.Reader,
+	size int64,
+) (*Part, error) {
+	return c.next.PutPart(ctx, bucket, objectName, uploadID, number, part, size)
+}
+
+func (c *CachingStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	parts []Part,
+) error {
+	defer c.invalidate(bucket, objectName)
+	return c.next.CompleteMultipartUpload(ctx, bucket, objectName, uploadID, parts)
+}
+
+func (c *CachingStorage) AbortMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+) error {
+	return c.next.AbortMultipartUpload(ctx, bucket, objectName, uploadID)
+}
+
+func (c *CachingStorage) DeleteFile(ctx context.Context, bucket string, objectName string) error {
+	defer c.invalidate(bucket, objectName)
+	return c.next.DeleteFile(ctx, bucket, objectName)
+}
+
+func (c *CachingStorage) DeletePrefix(ctx context.Context, bucket string, prefix string) error {
+	defer c.invalidatePrefix(bucket, prefix)
+	return c.next.DeletePrefix(ctx, bucket, prefix)
+}
+
+func (c *CachingStorage) WalkObjects(
+	ctx context.Context,
+	bucket string,
+	prefix string,
+	fn func(key string) error,
+) error {
+	return c.next.WalkObjects(ctx, bucket, prefix, fn)
+}
+
+// Reencrypt invalidates the object, whose content stays the same but whose
+// ETag changes.
+func (c *CachingStorage) Reencrypt(ctx context.Context, bucket string, objectName string) (bool, error) {
+	defer c.invalidate(bucket, objectName)
+	return c.next.Reencrypt(ctx, bucket, objectName)
+}
+
+func (c *CachingStorage) EnsureBucketExists(ctx context.Context, bucketName string) error {
+	return c.next.EnsureBucketExists(ctx, bucketName)
+}
@@ -0,0 +1,332 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+const cachedBucket = "cached"
+
+func newTestCache(t *testing.T, next Storage, maxBytes int64) *CachingStorage {
+	t.Helper()
+
+	cache, err := NewCachingStorage(next, &config.StorageConfig{
+		CacheDir:            t.TempDir(),
+		CacheMaxBytes:       maxBytes,
+		CacheMaxObjectBytes: maxBytes,
+		CacheTTLSeconds:     3600,
+	}, []string{cachedBucket}, discardLogger())
+	if err != nil {
+		t.Fatalf("NewCachingStorage: %v", err)
+	}
+	return cache
+}
+
+func readObject(t *testing.T, s Storage, bucket, objectName string) string {
+	t.Helper()
+
+	reader, _, err := s.GetObject(t.Context(), bucket, objectName)
+	if err != nil {
+		t.Fatalf("GetObject(%s): %v", objectName, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll(%s): %v", objectName, err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close(%s): %v", objectName, err)
+	}
+	return string(data)
+}
+
+// cacheFiles returns the names of the files in the cache directory.
+func cacheFiles(t *testing.T, cache *CachingStorage) []string {
+	t.Helper()
+
+	files, err := os.ReadDir(cache.dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return names
+}
+
+func TestCachingStorageServesHits(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", "content")
+	fake.put("other", "k", "content")
+	cache := newTestCache(t, fake, 1024)
+
+	for range 3 {
+		if got := readObject(t, cache, cachedBucket, "k"); got != "content" {
+			t.Fatalf("GetObject() = %q, want %q", got, "content")
+		}
+		readObject(t, cache, "other", "k")
+	}
+
+	if got := fake.callCount("GetObject"); got != 4 {
+		t.Errorf("GetObject calls = %d, want 1 for the cached bucket and 3 for the other", got)
+	}
+	want := CacheStats{Hits: 2, Misses: 1, Entries: 1, Bytes: int64(len("content"))}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	info, err := cache.StatObject(t.Context(), cachedBucket, "k")
+	if err != nil || info.Size != int64(len("content")) {
+		t.Errorf("StatObject() = %+v, %v, want the cached info", info, err)
+	}
+	if got := fake.callCount("StatObject"); got != 0 {
+		t.Errorf("StatObject calls = %d, want 0", got)
+	}
+}
+
+func TestCachingStorageDoesNotCachePartialReads(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", "content")
+	cache := newTestCache(t, fake, 1024)
+
+	reader, _, err := cache.GetObject(t.Context(), cachedBucket, "k")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if _, err = reader.Read(make([]byte, 3)); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got := cache.Stats().Entries; got != 0 {
+		t.Errorf("Entries = %d, want 0", got)
+	}
+	if files := cacheFiles(t, cache); len(files) != 0 {
+		t.Errorf("cache directory = %v, want empty", files)
+	}
+}
+
+func TestCachingStorageDropsFillAfterInvalidation(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", "old")
+	cache := newTestCache(t, fake, 1024)
+
+	reader, _, err := cache.GetObject(t.Context(), cachedBucket, "k")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+
+	// The object is replaced while the old content is still being read.
+	if err = cache.UploadFile(t.Context(), cachedBucket, "k", strings.NewReader("new"), 3, "image/png"); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil || string(data) != "old" {
+		t.Fatalf("ReadAll() = %q, %v, want the old content", data, err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if got := cache.Stats().Entries; got != 0 {
+		t.Errorf("Entries = %d, want the stale fill discarded", got)
+	}
+	if files := cacheFiles(t, cache); len(files) != 0 {
+		t.Errorf("cache directory = %v, want empty", files)
+	}
+	if got := readObject(t, cache, cachedBucket, "k"); got != "new" {
+		t.Errorf("GetObject() = %q, want %q", got, "new")
+	}
+	if got := readObject(t, cache, cachedBucket, "k"); got != "new" {
+		t.Errorf("cached GetObject() = %q, want %q", got, "new")
+	}
+}
+
+func TestCachingStorageInvalidatesOnDelete(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "a/1", "one")
+	fake.put(cachedBucket, "a/2", "two")
+	fake.put(cachedBucket, "b/1", "three")
+	cache := newTestCache(t, fake, 1024)
+
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		readObject(t, cache, cachedBucket, key)
+	}
+	if err := cache.DeletePrefix(t.Context(), cachedBucket, "a/"); err != nil {
+		t.Fatalf("DeletePrefix: %v", err)
+	}
+	if got := cache.Stats(); got.Entries != 1 || got.Bytes != int64(len("three")) {
+		t.Errorf("Stats() = %+v, want only b/1 cached", got)
+	}
+
+	if err := cache.DeleteFile(t.Context(), cachedBucket, "b/1"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if _, _, err := cache.GetObject(t.Context(), cachedBucket, "b/1"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetObject() error = %v, want %v", err, ErrObjectNotFound)
+	}
+}
+
+func TestCachingStorageEvictsLeastRecentlyUsed(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "a", "aaaa")
+	fake.put(cachedBucket, "b", "bbbb")
+	fake.put(cachedBucket, "c", "cccc")
+	cache := newTestCache(t, fake, 10)
+
+	readObject(t, cache, cachedBucket, "a")
+	readObject(t, cache, cachedBucket, "b")
+	readObject(t, cache, cachedBucket, "a") // b is now the least recently used
+	readObject(t, cache, cachedBucket, "c")
+
+	if got := cache.Stats(); got.Entries != 2 || got.Bytes != 8 {
+		t.Errorf("Stats() = %+v, want 2 entries of 8 bytes", got)
+	}
+	if files := cacheFiles(t, cache); len(files) != 2 {
+		t.Errorf("cache directory = %v, want 2 files", files)
+	}
+
+	calls := fake.callCount("GetObject")
+	readObject(t, cache, cachedBucket, "a")
+	readObject(t, cache, cachedBucket, "c")
+	if got := fake.callCount("GetObject"); got != calls {
+		t.Errorf("GetObject calls = %d, want a and c served from the cache", got-calls)
+	}
+	readObject(t, cache, cachedBucket, "b")
+	if got := fake.callCount("GetObject"); got != calls+1 {
+		t.Errorf("GetObject calls = %d, want b read from storage", got-calls)
+	}
+}
+
+func TestCachingStorageSkipsLargeObjects(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", strings.Repeat("x", 11))
+	cache := newTestCache(t, fake, 10)
+
+	readObject(t, cache, cachedBucket, "k")
+	readObject(t, cache, cachedBucket, "k")
+	if got := fake.callCount("GetObject"); got != 2 {
+		t.Errorf("GetObject calls = %d, want 2", got)
+	}
+}
+
+func TestCachingStorageExpiresEntries(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", "old")
+	cache := newTestCache(t, fake, 1024)
+
+	readObject(t, cache, cachedBucket, "k")
+	// Another process replaced the object; the cache can't notice.
+	fake.put(cachedBucket, "k", "new")
+	if got := readObject(t, cache, cachedBucket, "k"); got != "old" {
+		t.Fatalf("GetObject() = %q, want the cached %q", got, "old")
+	}
+
+	cache.mu.Lock()
+	entry := cache.entries[cacheKey(cachedBucket, "k")].Value.(*cacheEntry)
+	entry.storedAt = time.Now().Add(-cache.ttl - time.Second)
+	path := entry.path
+	cache.mu.Unlock()
+
+	if got := readObject(t, cache, cachedBucket, "k"); got != "new" {
+		t.Errorf("GetObject() = %q, want %q after expiry", got, "new")
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired copy %s still exists: %v", filepath.Base(path), err)
+	}
+}
+
+func TestCachingStorageServesRanges(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put(cachedBucket, "k", "0123456789")
+	cache := newTestCache(t, fake, 1024)
+	readObject(t, cache, cachedBucket, "k")
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+		wantErr        error
+	}{
+		{name: "middle", offset: 2, length: 3, want: "234"},
+		{name: "to the end", offset: 7, length: -1, want: "789"},
+		{name: "past the end", offset: 8, length: 100, want: "89"},
+		{name: "whole", offset: 0, length: 10, want: "0123456789"},
+		{name: "offset at size", offset: 10, length: 1, wantErr: ErrInvalidRange},
+		{name: "negative offset", offset: -1, length: 1, wantErr: ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, info, err := cache.GetObjectRange(t.Context(), cachedBucket, "k", tt.offset, tt.length)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetObjectRange() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetObjectRange: %v", err)
+			}
+			data, err := io.ReadAll(reader)
+			if err != nil || string(data) != tt.want {
+				t.Errorf("GetObjectRange() = %q, %v, want %q", data, err, tt.want)
+			}
+			if err = reader.Close(); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+			if info.Size != 10 {
+				t.Errorf("Size = %d, want the whole object's 10", info.Size)
+			}
+		})
+	}
+
+	if got := fake.callCount("GetObjectRange"); got != 0 {
+		t.Errorf("GetObjectRange calls = %d, want 0", got)
+	}
+
+	// A miss is read from storage and doesn't fill the cache.
+	fake.put(cachedBucket, "other", "abc")
+	reader, _, err := cache.GetObjectRange(t.Context(), cachedBucket, "other", 0, -1)
+	if err != nil {
+		t.Fatalf("GetObjectRange: %v", err)
+	}
+	if _, err = io.ReadAll(reader); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := cache.Stats().Entries; got != 1 {
+		t.Errorf("Entries = %d, want 1", got)
+	}
+}
+
+func TestNewCachingStorageClearsPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"stale" + cacheFileSuffix, cacheFillPrefix + "123", "keep.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+	}
+
+	cache, err := NewCachingStorage(newFakeStorage(), &config.StorageConfig{
+		CacheDir:      dir,
+		CacheMaxBytes: 1024,
+	}, nil, discardLogger())
+	if err != nil {
+		t.Fatalf("NewCachingStorage: %v", err)
+	}
+	if files := cacheFiles(t, cache); strings.Join(files, ",") != "keep.txt" {
+		t.Errorf("cache directory = %v, want [keep.txt]", files)
+	}
+}
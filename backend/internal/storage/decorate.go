@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"log/slog"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+var (
+	_ Storage = (*S3Storage)(nil)
+	_ Storage = (*RetryingStorage)(nil)
+	_ Storage = (*CachingStorage)(nil)
+	_ Storage = (*InstrumentedStorage)(nil)
+)
+
+// Decorate layers the storage decorators around base for the server and the
+// worker. Instrumentation is outermost, so it measures what callers see,
+// cache hits included; the read cache comes next, so a hit never waits for
+// storage; retries are innermost, so a miss is retried before the cache
+// gives up on it. The cache is left out if no cache directory is configured.
+func Decorate(base Storage, cfg *config.Config, logger *slog.Logger) (*InstrumentedStorage, *CachingStorage, error) {
+	var store Storage = NewRetryingStorage(base, &cfg.Storage, logger)
+
+	var cache *CachingStorage
+	if cfg.Storage.CacheDir != "" {
+		buckets := cfg.Storage.CacheBuckets
+		if len(buckets) == 0 {
+			buckets = []string{cfg.S3.BucketProcessed, cfg.S3.BucketBottles}
+		}
+
+		var err error
+		if cache, err = NewCachingStorage(store, &cfg.Storage, buckets, logger); err != nil {
+			return nil, nil, err
+		}
+		store = cache
+	}
+
+	return NewInstrumentedStorage(store, &cfg.Storage, logger), cache, nil
+}
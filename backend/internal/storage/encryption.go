@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+var (
+	// ErrPresignUnsupported is returned for presigned URLs under SSE-C: the
+	// client would need the object key to use them.
+	ErrPresignUnsupported = errors.New("presigned URLs are not available with SSE-C")
+)
+
+const (
+	masterKeySize = 32
+	// keyDerivationInfo binds derived keys to their purpose; changing it
+	// makes every SSE-C object unreadable.
+	keyDerivationInfo = "beer-mania sse-c object key v1"
+)
+
+// encryption applies the configured server-side encryption. SSE-C keys are
+// derived per object from a master key, so no key has to be stored and a
+// leaked object key exposes only that object. Objects written under a
+// previous master key, or before encryption was turned on, stay readable
+// until the reencrypt job rewrote them.
+type encryption struct {
+	mode     string
+	kmsKeyID string
+	// masterKeys holds the current master key first, then the previous ones.
+	masterKeys [][]byte
+}
+
+func newEncryption(cfg *config.S3Config) (*encryption, error) {
+	e := &encryption{mode: cfg.SSE, kmsKeyID: cfg.SSEKMSKeyID}
+
+	encoded := cfg.SSEPreviousMasterKeys
+	if cfg.SSEMasterKey != "" {
+		encoded = append([]string{cfg.SSEMasterKey}, encoded...)
+	}
+	for i, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSE master key %d: %w", i, err)
+		}
+		if len(key) != masterKeySize {
+			return nil, fmt.Errorf("invalid SSE master key %d: want %d bytes, got %d", i, masterKeySize, len(key))
+		}
+		e.masterKeys = append(e.masterKeys, key)
+	}
+
+	if e.mode == config.SSEC {
+		if cfg.SSEMasterKey == "" {
+			return nil, errors.New("sse-c needs S3_SSE_MASTER_KEY")
+		}
+		if !cfg.UseSSL {
+			return nil, errors.New("sse-c sends keys with every request and needs S3_USE_SSL")
+		}
+	}
+
+	return e, nil
+}
+
+// presignable reports whether presigned URLs can serve objects.
+func (e *encryption) presignable() bool {
+	return e.mode != config.SSEC
+}
+
+// mayUseSSEC reports whether stored objects may be encrypted with SSE-C,
+// in which case reads have to find their key first.
+func (e *encryption) mayUseSSEC() bool {
+	return len(e.masterKeys) > 0
+}
+
+// forWrite returns the encryption of a new object, nil for none.
+func (e *encryption) forWrite(bucket, objectName string) (encrypt.ServerSide, error) {
+	switch e.mode {
+	case config.SSES3:
+		return encrypt.NewSSE(), nil
+	case config.SSEKMS:
+		sse, err := encrypt.NewSSEKMS(e.kmsKeyID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up sse-kms: %w", err)
+		}
+		return sse, nil
+	case config.SSEC:
+		return e.objectKey(e.masterKeys[0], bucket, objectName)
+	case config.SSENone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown server-side encryption %q", e.mode)
+	}
+}
+
+// forPart returns the encryption headers of a multipart upload part. Only
+// SSE-C repeats them for every part, S3 rejects SSE-S3 and SSE-KMS headers
+// on parts.
+func (e *encryption) forPart(bucket, objectName string) (encrypt.ServerSide, error) {
+	if e.mode != config.SSEC {
+		return nil, nil
+	}
+	return e.forWrite(bucket, objectName)
+}
+
+// readCandidates returns the SSE-C keys an existing object may be encrypted
+// with, most likely first; nil stands for no SSE-C, which covers plain,
+// SSE-S3 and SSE-KMS objects since those are decrypted transparently.
+func (e *encryption) readCandidates(bucket, objectName string) ([]encrypt.ServerSide, error) {
+	candidates := make([]encrypt.ServerSide, 0, len(e.masterKeys)+1)
+	if e.mode != config.SSEC {
+		candidates = append(candidates, nil)
+	}
+	for _, master := range e.masterKeys {
+		sse, err := e.objectKey(master, bucket, objectName)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, sse)
+	}
+	if e.mode == config.SSEC {
+		candidates = append(candidates, nil)
+	}
+	return candidates, nil
+}
+
+// current reports whether an object that was read with the candidate at
+// index of readCandidates and has the given metadata is encrypted the way
+// new objects are.
+func (e *encryption) current(index int, metadata http.Header) bool {
+	if index != 0 {
+		return false
+	}
+	algorithm := metadata.Get("X-Amz-Server-Side-Encryption")
+	switch e.mode {
+	case config.SSENone:
+		return algorithm == ""
+	case config.SSES3:
+		return algorithm == "AES256"
+	case config.SSEKMS:
+		keyID := metadata.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+		return algorithm == "aws:kms" && strings.HasSuffix(keyID, e.kmsKeyID)
+	case config.SSEC:
+		// The first candidate is the key derived from the current master key.
+		return true
+	default:
+		return false
+	}
+}
+
+// objectKey derives the SSE-C key of an object from a master key.
+func (e *encryption) objectKey(master []byte, bucket, objectName string) (encrypt.ServerSide, error) {
+	key, err := hkdf.Key(sha256.New, master, nil, keyDerivationInfo+"\x00"+bucket+"/"+objectName, masterKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive object key: %w", err)
+	}
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up sse-c: %w", err)
+	}
+	return sse, nil
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	testMasterKey         = "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=" // bytes 0 to 31
+	testPreviousMasterKey = "ICEiIyQlJicoKSorLC0uLzAxMjM0NTY3ODk6Ozw9Pj8=" // bytes 32 to 63
+)
+
+// customerKey returns the SSE-C key sse sends, "" for no SSE-C.
+func customerKey(sse encrypt.ServerSide) string {
+	if sse == nil {
+		return ""
+	}
+	header := make(http.Header)
+	sse.Marshal(header)
+	return header.Get(encrypt.SseCustomerKey)
+}
+
+func newTestEncryption(t *testing.T, mode string, masterKeys ...string) *encryption {
+	t.Helper()
+
+	cfg := &config.S3Config{SSE: mode, SSEKMSKeyID: "beer-key", UseSSL: true}
+	if len(masterKeys) > 0 {
+		cfg.SSEMasterKey = masterKeys[0]
+		cfg.SSEPreviousMasterKeys = masterKeys[1:]
+	}
+	e, err := newEncryption(cfg)
+	if err != nil {
+		t.Fatalf("newEncryption: %v", err)
+	}
+	return e
+}
+
+// TestObjectKey pins the key derivation: if it changes, every object
+// stored with SSE-C becomes unreadable.
+func TestObjectKey(t *testing.T) {
+	e := newTestEncryption(t, config.SSEC, testMasterKey)
+
+	sse, err := e.objectKey(e.masterKeys[0], "uploads", "originals/abc.jpg")
+	if err != nil {
+		t.Fatalf("objectKey: %v", err)
+	}
+	if got, want := customerKey(sse), "8pQgUCb7AhKqFA6uT3v3wSXxKcwwvNg2hJ3pLRK8Pg8="; got != want {
+		t.Errorf("objectKey() = %s, want %s", got, want)
+	}
+
+	for _, other := range []struct{ bucket, objectName string }{
+		{"processed", "originals/abc.jpg"},
+		{"uploads", "originals/abd.jpg"},
+	} {
+		otherSSE, err := e.objectKey(e.masterKeys[0], other.bucket, other.objectName)
+		if err != nil {
+			t.Fatalf("objectKey: %v", err)
+		}
+		if customerKey(otherSSE) == customerKey(sse) {
+			t.Errorf("objectKey(%s, %s) = key of uploads/originals/abc.jpg, want another", other.bucket, other.objectName)
+		}
+	}
+}
+
+func TestReadCandidates(t *testing.T) {
+	const bucket, objectName = "uploads", "originals/abc.jpg"
+
+	keys := newTestEncryption(t, config.SSEC, testMasterKey, testPreviousMasterKey)
+	derive := func(master []byte) string {
+		sse, err := keys.objectKey(master, bucket, objectName)
+		if err != nil {
+			t.Fatalf("objectKey: %v", err)
+		}
+		return customerKey(sse)
+	}
+	current, previous := derive(keys.masterKeys[0]), derive(keys.masterKeys[1])
+
+	tests := []struct {
+		name       string
+		mode       string
+		masterKeys []string
+		want       []string // customer keys in order, "" for no SSE-C
+	}{
+		{name: "none", mode: config.SSENone, want: []string{""}},
+		{name: "sse-s3", mode: config.SSES3, want: []string{""}},
+		{name: "sse-kms", mode: config.SSEKMS, want: []string{""}},
+		{
+			name:       "none after sse-c",
+			mode:       config.SSENone,
+			masterKeys: []string{testMasterKey, testPreviousMasterKey},
+			want:       []string{"", current, previous},
+		},
+		{
+			name:       "sse-kms after sse-c",
+			mode:       config.SSEKMS,
+			masterKeys: []string{testMasterKey},
+			want:       []string{"", current},
+		},
+		{name: "sse-c", mode: config.SSEC, masterKeys: []string{testMasterKey}, want: []string{current, ""}},
+		{
+			name:       "sse-c after rotation",
+			mode:       config.SSEC,
+			masterKeys: []string{testMasterKey, testPreviousMasterKey},
+			want:       []string{current, previous, ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestEncryption(t, tt.mode, tt.masterKeys...)
+
+			candidates, err := e.readCandidates(bucket, objectName)
+			if err != nil {
+				t.Fatalf("readCandidates: %v", err)
+			}
+			got := make([]string, 0, len(candidates))
+			for _, candidate := range candidates {
+				got = append(got, customerKey(candidate))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCandidates() = %q, want %q", got, tt.want)
+			}
+
+			write, err := e.forWrite(bucket, objectName)
+			if err != nil {
+				t.Fatalf("forWrite: %v", err)
+			}
+			if customerKey(write) != got[0] {
+				t.Errorf("forWrite() = %q, want the first candidate %q", customerKey(write), got[0])
+			}
+		})
+	}
+}
+
+func TestEncryptionCurrent(t *testing.T) {
+	plain := http.Header{}
+	s3 := http.Header{"X-Amz-Server-Side-Encryption": {"AES256"}}
+	kms := http.Header{
+		"X-Amz-Server-Side-Encryption":                {"aws:kms"},
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": {"arn:aws:kms:eu-central-1:123456789012:key/beer-key"},
+	}
+	otherKMS := http.Header{
+		"X-Amz-Server-Side-Encryption":                {"aws:kms"},
+		"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": {"arn:aws:kms:eu-central-1:123456789012:key/old-key"},
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		index    int
+		metadata http.Header
+		want     bool
+	}{
+		{name: "none plain", mode: config.SSENone, metadata: plain, want: true},
+		{name: "none sse-s3", mode: config.SSENone, metadata: s3, want: false},
+		{name: "none read with a master key", mode: config.SSENone, index: 1, metadata: plain, want: false},
+		{name: "sse-s3", mode: config.SSES3, metadata: s3, want: true},
+		{name: "sse-s3 plain", mode: config.SSES3, metadata: plain, want: false},
+		{name: "sse-kms", mode: config.SSEKMS, metadata: kms, want: true},
+		{name: "sse-kms other key", mode: config.SSEKMS, metadata: otherKMS, want: false},
+		{name: "sse-kms sse-s3", mode: config.SSEKMS, metadata: s3, want: false},
+		{name: "sse-c current master key", mode: config.SSEC, metadata: plain, want: true},
+		{name: "sse-c previous master key", mode: config.SSEC, index: 1, metadata: plain, want: false},
+		{name: "sse-c plain", mode: config.SSEC, index: 2, metadata: plain, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var masterKeys []string
+			if tt.mode == config.SSEC {
+				masterKeys = []string{testMasterKey, testPreviousMasterKey}
+			}
+			e := newTestEncryption(t, tt.mode, masterKeys...)
+
+			if got := e.current(tt.index, tt.metadata); got != tt.want {
+				t.Errorf("current(%d, %v) = %v, want %v", tt.index, tt.metadata, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+// OperationStats accumulates the calls of one storage operation.
+type OperationStats struct {
+	Calls int64
+	// Errors counts failed calls; NotFound counts calls that found no
+	// object, which is usually expected and not a failure.
+	Errors   int64
+	NotFound int64
+	// Bytes counts bytes uploaded, or read by callers of GetObject and
+	// GetObjectRange.
+	Bytes int64
+	// Total and Max measure how long calls took. Reads are measured until
+	// the object was opened, not until it was read.
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Mean returns the average call duration.
+func (s OperationStats) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// InstrumentedStorage records the count, outcome, duration and size of
+// storage calls per operation, and logs calls slower than the configured
+// threshold.
+type InstrumentedStorage struct {
+	next   Storage
+	slow   time.Duration
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	operations map[string]*OperationStats
+}
+
+func NewInstrumentedStorage(next Storage, cfg *config.StorageConfig, logger *slog.Logger) *InstrumentedStorage {
+	return &InstrumentedStorage{
+		next:       next,
+		slow:       cfg.SlowCallThreshold(),
+		logger:     logger,
+		operations: make(map[string]*OperationStats),
+	}
+}
+
+// Stats returns a snapshot of the recorded calls by operation name.
+func (s *InstrumentedStorage) Stats() map[string]OperationStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := make(map[string]OperationStats, len(s.operations))
+	for name, stats := range s.operations {
+		snapshot[name] = *stats
+	}
+	return snapshot
+}
+
+// observe records a call that started at start.
+func (s *InstrumentedStorage) observe(
+	ctx context.Context,
+	operation string,
+	bucket string,
+	objectName string,
+	start time.Time,
+	bytes int64,
+	err error,
+) {
+	elapsed := time.Since(start)
+
+	s.mu.Lock()
+	stats, ok := s.operations[operation]
+	if !ok {
+		stats = &OperationStats{}
+		s.operations[operation] = stats
+	}
+	stats.Calls++
+	switch {
+	case err == nil:
+		stats.Bytes += bytes
+	case errors.Is(err, ErrObjectNotFound):
+		stats.NotFound++
+	default:
+		stats.Errors++
+	}
+	stats.Total += elapsed
+	stats.Max = max(stats.Max, elapsed)
+	s.mu.Unlock()
+
+	if elapsed >= s.slow {
+		s.logger.WarnContext(ctx, "Slow storage call",
+			"operation", operation,
+			"bucket", bucket,
+			"key", objectName,
+			"duration", elapsed,
+			"error", err)
+	}
+}
+
+// addBytes counts bytes read after the call was observed.
+func (s *InstrumentedStorage) addBytes(operation string, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stats, ok := s.operations[operation]; ok {
+		stats.Bytes += bytes
+	}
+}
+
+// countingReader counts the bytes a caller read and records them on Close.
+type countingReader struct {
+	io.ReadCloser
+	storage   *InstrumentedStorage
+	operation string
+	read      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	r.storage.addBytes(r.operation, r.read)
+	return r.ReadCloser.Close()
+}
+
+func (s *InstrumentedStorage) UploadFile(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	size int64,
+	contentType string,
+) error {
+	start := time.Now()
+	err := s.next.UploadFile(ctx, bucket, objectName, file, size, contentType)
+	s.observe(ctx, "UploadFile", bucket, objectName, start, size, err)
+	return err
+}
+
+func (s *InstrumentedStorage) GetFileURL(ctx context.Context, bucket string, objectName string) (string, error) {
+	start := time.Now()
+	url, err := s.next.GetFileURL(ctx, bucket, objectName)
+	s.observe(ctx, "GetFileURL", bucket, objectName, start, 0, err)
+	return url, err
+}
+
+func (s *InstrumentedStorage) PresignedPutURL(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+	size int64,
+	expires time.Duration,
+) (string, error) {
+	start := time.Now()
+	url, err := s.next.PresignedPutURL(ctx, bucket, objectName, contentType, size, expires)
+	s.observe(ctx, "PresignedPutURL", bucket, objectName, start, 0, err)
+	return url, err
+}
+
+func (s *InstrumentedStorage) GetObject(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+) (io.ReadCloser, *ObjectInfo, error) {
+	start := time.Now()
+	reader, info, err := s.next.GetObject(ctx, bucket, objectName)
+	s.observe(ctx, "GetObject", bucket, objectName, start, 0, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingReader{ReadCloser: reader, storage: s, operation: "GetObject"}, info, nil
+}
+
+func (s *InstrumentedStorage) GetObjectRange(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *ObjectInfo, error) {
+	start := time.Now()
+	reader, info, err := s.next.GetObjectRange(ctx, bucket, objectName, offset, length)
+	s.observe(ctx, "GetObjectRange", bucket, objectName, start, 0, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &countingReader{ReadCloser: reader, storage: s, operation: "GetObjectRange"}, info, nil
+}
+
+func (s *InstrumentedStorage) StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.next.StatObject(ctx, bucket, objectName)
+	s.observe(ctx, "StatObject", bucket, objectName, start, 0, err)
+	return info, err
+}
+
+func (s *InstrumentedStorage) NewMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+) (string, error) {
+	start := time.Now()
+	uploadID, err := s.next.NewMultipartUpload(ctx, bucket, objectName, contentType)
+	s.observe(ctx, "NewMultipartUpload", bucket, objectName, start, 0, err)
+	return uploadID, err
+}
+
+func (s *InstrumentedStorage) PutPart(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	number int,
+	part io.Reader,
+	size int64,
+) (*Part, error) {
+	start := time.Now()
+	uploaded, err := s.next.PutPart(ctx, bucket, objectName, uploadID, number, part, size)
+	s.observe(ctx, "PutPart", bucket, objectName, start, size, err)
+	return uploaded, err
+}
+
+func (s *InstrumentedStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	parts []Part,
+) error {
+	start := time.Now()
+	err := s.next.CompleteMultipartUpload(ctx, bucket, objectName, uploadID, parts)
+	s.observe(ctx, "CompleteMultipartUpload", bucket, objectName, start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStorage) AbortMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+) error {
+	start := time.Now()
+	err := s.next.AbortMultipartUpload(ctx, bucket, objectName, uploadID)
+	s.observe(ctx, "AbortMultipartUpload", bucket, objectName, start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStorage) DeleteFile(ctx context.Context, bucket string, objectName string) error {
+	start := time.Now()
+	err := s.next.DeleteFile(ctx, bucket, objectName)
+	s.observe(ctx, "DeleteFile", bucket, objectName, start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStorage) DeletePrefix(ctx context.Context, bucket string, prefix string) error {
+	start := time.Now()
+	err := s.next.DeletePrefix(ctx, bucket, prefix)
+	s.observe(ctx, "DeletePrefix", bucket, prefix, start, 0, err)
+	return err
+}
+
+// WalkObjects is measured including the time fn takes.
+func (s *InstrumentedStorage) WalkObjects(
+	ctx context.Context,
+	bucket string,
+	prefix string,
+	fn func(key string) error,
+) error {
+	start := time.Now()
+	err := s.next.WalkObjects(ctx, bucket, prefix, fn)
+	s.observe(ctx, "WalkObjects", bucket, prefix, start, 0, err)
+	return err
+}
+
+func (s *InstrumentedStorage) Reencrypt(ctx context.Context, bucket string, objectName string) (bool, error) {
+	start := time.Now()
+	rewritten, err := s.next.Reencrypt(ctx, bucket, objectName)
+	s.observe(ctx, "Reencrypt", bucket, objectName, start, 0, err)
+	return rewritten, err
+}
+
+func (s *InstrumentedStorage) EnsureBucketExists(ctx context.Context, bucketName string) error {
+	start := time.Now()
+	err := s.next.EnsureBucketExists(ctx, bucketName)
+	s.observe(ctx, "EnsureBucketExists", bucketName, "", start, 0, err)
+	return err
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+)
+
+// slowStorage delays every StatObject call.
+type slowStorage struct {
+	*fakeStorage
+	delay time.Duration
+}
+
+func (s slowStorage) StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	time.Sleep(s.delay)
+	return s.fakeStorage.StatObject(ctx, bucket, objectName)
+}
+
+func TestInstrumentedStorageStats(t *testing.T) {
+	fake := newFakeStorage()
+	fake.put("b", "k", "0123456789")
+	fake.failNext("UploadFile", syscall.ECONNRESET)
+	s := NewInstrumentedStorage(fake, &config.StorageConfig{SlowCallMilliseconds: 60000}, discardLogger())
+	ctx := t.Context()
+
+	// Uploads count their size only if they succeed.
+	if err := s.UploadFile(ctx, "b", "new", strings.NewReader("abc"), 3, "image/png"); err == nil {
+		t.Fatalf("UploadFile: want an error")
+	}
+	if err := s.UploadFile(ctx, "b", "new", strings.NewReader("abc"), 3, "image/png"); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	// Reads count what the caller read, once it closed the reader.
+	reader, _, err := s.GetObject(ctx, "b", "k")
+	if err != nil {
+		t.Fatalf("GetObject: %v", err)
+	}
+	if _, err = io.ReadFull(reader, make([]byte, 4)); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if got := s.Stats()["GetObject"].Bytes; got != 0 {
+		t.Errorf("GetObject bytes before Close = %d, want 0", got)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, _, err = s.GetObject(ctx, "b", "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("GetObject() error = %v, want %v", err, ErrObjectNotFound)
+	}
+
+	reader, _, err = s.GetObjectRange(ctx, "b", "k", 8, -1)
+	if err != nil {
+		t.Fatalf("GetObjectRange: %v", err)
+	}
+	if _, err = io.ReadAll(reader); err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if err = reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	stats := s.Stats()
+	tests := []struct {
+		operation string
+		want      OperationStats
+	}{
+		{"UploadFile", OperationStats{Calls: 2, Errors: 1, Bytes: 3}},
+		{"GetObject", OperationStats{Calls: 2, NotFound: 1, Bytes: 4}},
+		{"GetObjectRange", OperationStats{Calls: 1, Bytes: 2}},
+	}
+	for _, tt := range tests {
+		got := stats[tt.operation]
+		if got.Max < 0 || got.Total < got.Max || got.Mean() > got.Max {
+			t.Errorf("%s durations: total %v, max %v, mean %v", tt.operation, got.Total, got.Max, got.Mean())
+		}
+		got.Total, got.Max = 0, 0
+		if got != tt.want {
+			t.Errorf("%s stats = %+v, want %+v", tt.operation, got, tt.want)
+		}
+	}
+	if len(stats) != len(tests) {
+		t.Errorf("Stats() has %d operations, want %d", len(stats), len(tests))
+	}
+	if got := (OperationStats{}).Mean(); got != 0 {
+		t.Errorf("Mean() of no calls = %v, want 0", got)
+	}
+}
+
+func TestInstrumentedStorageLogsSlowCalls(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	fake := newFakeStorage()
+	fake.put("b", "k", "content")
+	s := NewInstrumentedStorage(
+		slowStorage{fakeStorage: fake, delay: 5 * time.Millisecond},
+		&config.StorageConfig{SlowCallMilliseconds: 1},
+		logger,
+	)
+
+	if _, err := s.StatObject(t.Context(), "b", "k"); err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Slow storage call") || !strings.Contains(logs.String(), "operation=StatObject") {
+		t.Errorf("logs = %q, want a slow StatObject call", logs.String())
+	}
+}
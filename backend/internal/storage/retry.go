@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// RetryingStorage retries calls that failed with a transient error, waiting
+// an exponentially growing, jittered delay between attempts. Only calls that
+// are safe to repeat are retried: uploads only if their reader can be
+// rewound, and listings only until the first object was handed out.
+// Starting a multipart upload is never retried, since a lost response would
+// leave behind an upload nobody aborts.
+type RetryingStorage struct {
+	next      Storage
+	attempts  int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	logger    *slog.Logger
+}
+
+func NewRetryingStorage(next Storage, cfg *config.StorageConfig, logger *slog.Logger) *RetryingStorage {
+	return &RetryingStorage{
+		next:      next,
+		attempts:  cfg.RetryAttempts,
+		baseDelay: cfg.RetryBaseDelay(),
+		maxDelay:  cfg.RetryMaxDelay(),
+		logger:    logger,
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, runs out of attempts or ctx is done. fn gets the attempt
+// number, starting at 1.
+func retry[T any](ctx context.Context, s *RetryingStorage, operation string, fn func(attempt int) (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := fn(attempt)
+		if err == nil || attempt >= s.attempts || !transient(err) {
+			return result, err
+		}
+
+		delay := s.delay(attempt)
+		s.logger.WarnContext(ctx, "Transient storage failure, retrying",
+			"operation", operation,
+			"attempt", attempt,
+			"delay", delay,
+			"error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns the wait after a failed attempt: the doubled base delay,
+// capped, with up to half of it taken off at random so that clients that
+// failed together don't retry together.
+func (s *RetryingStorage) delay(attempt int) time.Duration {
+	delay := s.maxDelay
+	if shift := attempt - 1; shift < 32 && s.baseDelay<<shift < s.maxDelay {
+		delay = s.baseDelay << shift
+	}
+	return delay - rand.N(delay/2+1)
+}
+
+// permanentError keeps retry from repeating a call whatever its cause.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// transient reports whether a failed call may succeed when repeated.
+func transient(err error) bool {
+	var permanent *permanentError
+	switch {
+	case errors.As(err, &permanent):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrObjectNotFound), errors.Is(err, ErrInvalidRange),
+		errors.Is(err, ErrMultipartUploadNotFound), errors.Is(err, ErrPresignUnsupported):
+		return false
+	}
+
+	var response minio.ErrorResponse
+	if errors.As(err, &response) {
+		switch response.Code {
+		case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+			return true
+		}
+		return response.StatusCode >= http.StatusInternalServerError ||
+			response.StatusCode == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// rewinder returns a function that moves the reader back to where it is now
+// before every attempt after the first, or nil if the reader can't seek.
+func rewinder(reader io.Reader) func(attempt int) error {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	return func(attempt int) error {
+		if attempt == 1 {
+			return nil
+		}
+		_, err := seeker.Seek(start, io.SeekStart)
+		return err
+	}
+}
+
+func (s *RetryingStorage) UploadFile(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	size int64,
+	contentType string,
+) error {
+	rewind := rewinder(file)
+	if rewind == nil {
+		return s.next.UploadFile(ctx, bucket, objectName, file, size, contentType)
+	}
+	_, err := retry(ctx, s, "UploadFile", func(attempt int) (struct{}, error) {
+		if err := rewind(attempt); err != nil {
+			return struct{}{}, err
+		}
+		return struct{}{}, s.next.UploadFile(ctx, bucket, objectName, file, size, contentType)
+	})
+	return err
+}
+
+// GetFileURL is signed locally and never fails transiently.
+func (s *RetryingStorage) GetFileURL(ctx context.Context, bucket string, objectName string) (string, error) {
+	return s.next.GetFileURL(ctx, bucket, objectName)
+}
+
+// PresignedPutURL is signed locally and never fails transiently.
+func (s *RetryingStorage) PresignedPutURL(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+	size int64,
+	expires time.Duration,
+) (string, error) {
+	return s.next.PresignedPutURL(ctx, bucket, objectName, contentType, size, expires)
+}
+
+// GetObject retries opening the object; a read failing midway is up to the
+// caller.
+func (s *RetryingStorage) GetObject(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+) (io.ReadCloser, *ObjectInfo, error) {
+	type opened struct {
+		reader io.ReadCloser
+		info   *ObjectInfo
+	}
+	result, err := retry(ctx, s, "GetObject", func(int) (opened, error) {
+		reader, info, err := s.next.GetObject(ctx, bucket, objectName)
+		return opened{reader, info}, err
+	})
+	return result.reader, result.info, err
+}
+
+// GetObjectRange retries opening the range like GetObject.
+func (s *RetryingStorage) GetObjectRange(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *ObjectInfo, error) {
+	type opened struct {
+		reader io.ReadCloser
+		info   *ObjectInfo
+	}
+	result, err := retry(ctx, s, "GetObjectRange", func(int) (opened, error) {
+		reader, info, err := s.next.GetObjectRange(ctx, bucket, objectName, offset, length)
+		return opened{reader, info}, err
+	})
+	return result.reader, result.info, err
+}
+
+func (s *RetryingStorage) StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	return retry(ctx, s, "StatObject", func(int) (*ObjectInfo, error) {
+		return s.next.StatObject(ctx, bucket, objectName)
+	})
+}
+
+// NewMultipartUpload is not retried, see RetryingStorage.
+func (s *RetryingStorage) NewMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+) (string, error) {
+	return s.next.NewMultipartUpload(ctx, bucket, objectName, contentType)
+}
+
+// PutPart is retried if the part can be rewound; uploading a part number
+// again replaces it.
+func (s *RetryingStorage) PutPart(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	number int,
+	part io.Reader,
+	size int64,
+) (*Part, error) {
+	rewind := rewinder(part)
+	if rewind == nil {
+		return s.next.PutPart(ctx, bucket, objectName, uploadID, number, part, size)
+	}
+	return retry(ctx, s, "PutPart", func(attempt int) (*Part, error) {
+		if err := rewind(attempt); err != nil {
+			return nil, err
+		}
+		return s.next.PutPart(ctx, bucket, objectName, uploadID, number, part, size)
+	})
+}
+
+// CompleteMultipartUpload treats an upload that is gone on a retry as
+// completed by the previous attempt, whose response was lost, if the object
+// exists.
+func (s *RetryingStorage) CompleteMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	parts []Part,
+) error {
+	_, err := retry(ctx, s, "CompleteMultipartUpload", func(attempt int) (struct{}, error) {
+		err := s.next.CompleteMultipartUpload(ctx, bucket, objectName, uploadID, parts)
+		if attempt > 1 && errors.Is(err, ErrMultipartUploadNotFound) {
+			if _, statErr := s.next.StatObject(ctx, bucket, objectName); statErr == nil {
+				return struct{}{}, nil
+			}
+		}
+		return struct{}{}, err
+	})
+	return err
+}
+
+// AbortMultipartUpload treats an upload that is gone on a retry as aborted
+// by the previous attempt.
+func (s *RetryingStorage) AbortMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+) error {
+	_, err := retry(ctx, s, "AbortMultipartUpload", func(attempt int) (struct{}, error) {
+		err := s.next.AbortMultipartUpload(ctx, bucket, objectName, uploadID)
+		if attempt > 1 && errors.Is(err, ErrMultipartUploadNotFound) {
+			return struct{}{}, nil
+		}
+		return struct{}{}, err
+	})
+	return err
+}
+
+func (s *RetryingStorage) DeleteFile(ctx context.Context, bucket string, objectName string) error {
+	_, err := retry(ctx, s, "DeleteFile", func(int) (struct{}, error) {
+		return struct{}{}, s.next.DeleteFile(ctx, bucket, objectName)
+	})
+	return err
+}
+
+func (s *RetryingStorage) DeletePrefix(ctx context.Context, bucket string, prefix string) error {
+	_, err := retry(ctx, s, "DeletePrefix", func(int) (struct{}, error) {
+		return struct{}{}, s.next.DeletePrefix(ctx, bucket, prefix)
+	})
+	return err
+}
+
+// WalkObjects is retried only while fn hasn't been called, so that no object
+// is handed out twice.
+func (s *RetryingStorage) WalkObjects(
+	ctx context.Context,
+	bucket string,
+	prefix string,
+	fn func(key string) error,
+) error {
+	walked := false
+	_, err := retry(ctx, s, "WalkObjects", func(int) (struct{}, error) {
+		err := s.next.WalkObjects(ctx, bucket, prefix, func(key string) error {
+			walked = true
+			return fn(key)
+		})
+		if err != nil && walked {
+			return struct{}{}, &permanentError{err: err}
+		}
+		return struct{}{}, err
+	})
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return permanent.err
+	}
+	return err
+}
+
+// Reencrypt is conditional on the object's ETag, so repeating it is safe.
+func (s *RetryingStorage) Reencrypt(ctx context.Context, bucket string, objectName string) (bool, error) {
+	return retry(ctx, s, "Reencrypt", func(int) (bool, error) {
+		return s.next.Reencrypt(ctx, bucket, objectName)
+	})
+}
+
+func (s *RetryingStorage) EnsureBucketExists(ctx context.Context, bucketName string) error {
+	_, err := retry(ctx, s, "EnsureBucketExists", func(int) (struct{}, error) {
+		return struct{}{}, s.next.EnsureBucketExists(ctx, bucketName)
+	})
+	return err
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func newTestRetrying(next Storage, attempts int) *RetryingStorage {
+	return NewRetryingStorage(next, &config.StorageConfig{
+		RetryAttempts:              attempts,
+		RetryBaseDelayMilliseconds: 1,
+		RetryMaxDelayMilliseconds:  1,
+	}, discardLogger())
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), false},
+		{"not found", fmt.Errorf("get: %w", ErrObjectNotFound), false},
+		{"invalid range", ErrInvalidRange, false},
+		{"multipart upload gone", ErrMultipartUploadNotFound, false},
+		{"presign unsupported", ErrPresignUnsupported, false},
+		{"permanent", &permanentError{err: io.ErrUnexpectedEOF}, false},
+		{"slow down", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, true},
+		{"internal error code", minio.ErrorResponse{Code: "InternalError"}, true},
+		{"server error", minio.ErrorResponse{Code: "Whatever", StatusCode: http.StatusBadGateway}, true},
+		{"too many requests", minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, true},
+		{"access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, false},
+		{"wrapped response", fmt.Errorf("put: %w", minio.ErrorResponse{Code: "RequestTimeout"}), true},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"other", errors.New("bad digest"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transient(tt.err); got != tt.want {
+				t.Errorf("transient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	s := &RetryingStorage{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{33, time.Second}, // the shift would overflow
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		for range 200 {
+			got := s.delay(tt.attempt)
+			if got < tt.full-tt.full/2 || got > tt.full {
+				t.Fatalf("delay(%d) = %v, want between %v and %v", tt.attempt, got, tt.full-tt.full/2, tt.full)
+			}
+		}
+	}
+}
+
+func TestRetryingStorageRetries(t *testing.T) {
+	reset := fmt.Errorf("read: %w", syscall.ECONNRESET)
+	tests := []struct {
+		name      string
+		attempts  int
+		errs      []error
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "succeeds", attempts: 3, wantCalls: 1},
+		{name: "recovers", attempts: 3, errs: []error{reset, reset}, wantCalls: 3},
+		{name: "runs out of attempts", attempts: 2, errs: []error{reset, reset}, wantErr: syscall.ECONNRESET, wantCalls: 2},
+		{name: "retries disabled", attempts: 1, errs: []error{reset}, wantErr: syscall.ECONNRESET, wantCalls: 1},
+		{name: "not transient", attempts: 3, errs: []error{ErrObjectNotFound}, wantErr: ErrObjectNotFound, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeStorage()
+			fake.put("b", "k", "content")
+			fake.failNext("StatObject", tt.errs...)
+
+			_, err := newTestRetrying(fake, tt.attempts).StatObject(t.Context(), "b", "k")
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Errorf("StatObject() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := fake.callCount("StatObject"); got != tt.wantCalls {
+				t.Errorf("StatObject calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryingStorageStopsWhenContextDone(t *testing.T) {
+	fake := newFakeStorage()
+	fake.failNext("DeleteFile", syscall.ECONNRESET, syscall.ECONNRESET)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err := newTestRetrying(fake, 3).DeleteFile(ctx, "b", "k"); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("DeleteFile() error = %v, want %v", err, syscall.ECONNRESET)
+	}
+	if got := fake.callCount("DeleteFile"); got != 1 {
+		t.Errorf("DeleteFile calls = %d, want 1", got)
+	}
+}
+
+func TestRetryingStorageRewindsUploads(t *testing.T) {
+	fake := newFakeStorage()
+	fake.failNext("UploadFile", syscall.ECONNRESET, io.ErrUnexpectedEOF)
+
+	// Uploads start wherever the reader is, not at its beginning.
+	file := strings.NewReader("header|payload")
+	if _, err := file.Seek(int64(len("header|")), io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if err := newTestRetrying(fake, 3).UploadFile(t.Context(), "b", "k", file, 7, "image/png"); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	want := []string{"payload", "payload", "payload"}
+	if strings.Join(fake.uploads, ",") != strings.Join(want, ",") {
+		t.Errorf("uploaded bodies = %q, want %q", fake.uploads, want)
+	}
+	if data, _, _ := fake.object("b", "k"); string(data) != "payload" {
+		t.Errorf("stored object = %q, want %q", data, "payload")
+	}
+}
+
+func TestRetryingStorageDoesNotRetryUnseekableUploads(t *testing.T) {
+	fake := newFakeStorage()
+	fake.failNext("UploadFile", syscall.ECONNRESET)
+
+	file := io.MultiReader(strings.NewReader("payload"))
+	err := newTestRetrying(fake, 3).UploadFile(t.Context(), "b", "k", file, 7, "image/png")
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("UploadFile() error = %v, want %v", err, syscall.ECONNRESET)
+	}
+	if got := fake.callCount("UploadFile"); got != 1 {
+		t.Errorf("UploadFile calls = %d, want 1", got)
+	}
+}
+
+func TestRetryingStorageWalkObjects(t *testing.T) {
+	fake := newFakeStorage()
+	fake.failNext("WalkObjects", syscall.ECONNRESET)
+
+	var keys []string
+	err := newTestRetrying(fake, 3).WalkObjects(t.Context(), "b", "", func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	// A retry would hand out "a" again.
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("WalkObjects() error = %v, want %v", err, syscall.ECONNRESET)
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		t.Errorf("WalkObjects() error = %#v, want the cause", err)
+	}
+	if strings.Join(keys, ",") != "a" {
+		t.Errorf("walked keys = %q, want [a]", keys)
+	}
+}
+
+func TestRetryingStorageCompletesLostMultipartResponse(t *testing.T) {
+	fake := newFakeStorage()
+	// The first attempt assembled the object, but its response was lost.
+	fake.failNext("CompleteMultipartUpload", syscall.ECONNRESET, ErrMultipartUploadNotFound)
+	fake.put("b", "k", "assembled")
+
+	if err := newTestRetrying(fake, 3).CompleteMultipartUpload(t.Context(), "b", "k", "upload", nil); err != nil {
+		t.Errorf("CompleteMultipartUpload() error = %v, want nil", err)
+	}
+
+	// Without the object the upload really is unknown.
+	fake = newFakeStorage()
+	fake.failNext("CompleteMultipartUpload", ErrMultipartUploadNotFound)
+	err := newTestRetrying(fake, 3).CompleteMultipartUpload(t.Context(), "b", "k", "upload", nil)
+	if !errors.Is(err, ErrMultipartUploadNotFound) {
+		t.Errorf("CompleteMultipartUpload() error = %v, want %v", err, ErrMultipartUploadNotFound)
+	}
+}
@@ -0,0 +1,624 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Helltale/beer-mania/backend/internal/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/minio/minio-go/v7/pkg/sse"
+)
+
+// S3Storage stores objects on MinIO, AWS S3 or another S3-compatible
+// provider.
+type S3Storage struct {
+	client *minio.Client
+	// presigner signs URLs for the public endpoint. Signing happens locally,
+	// the backend never connects to that endpoint.
+	presigner  *minio.Client
+	encryption *encryption
+	cfg        *config.S3Config
+}
+
+func NewS3Storage(cfg *config.S3Config) (*S3Storage, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Credentials are shared with the presigner, so a credential chain is
+	// resolved and refreshed once for both clients.
+	creds := newCredentials(cfg)
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       cfg.UseSSL,
+		Transport:    transport,
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup(cfg.AddressingStyle),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	presigner := client
+	if cfg.PublicURL != "" {
+		if presigner, err = newPresigner(cfg, creds); err != nil {
+			return nil, err
+		}
+	}
+
+	encryption, err := newEncryption(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &S3Storage{
+		client:     client,
+		presigner:  presigner,
+		encryption: encryption,
+		cfg:        cfg,
+	}
+
+	if err = storage.setUpBuckets(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// newTransport returns the HTTP transport of the client, trusting the CA
+// bundle in addition to the system certificates.
+func newTransport(cfg *config.S3Config) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(cfg.UseSSL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 transport: %w", err)
+	}
+	if cfg.CABundle == "" {
+		return transport, nil
+	}
+
+	bundle, err := os.ReadFile(cfg.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in S3 CA bundle %s", cfg.CABundle)
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = roots
+	return transport, nil
+}
+
+func newCredentials(cfg *config.S3Config) *credentials.Credentials {
+	if cfg.Credentials == config.S3CredentialsChain {
+		return credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+	return credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, cfg.SessionToken)
+}
+
+func bucketLookup(style string) minio.BucketLookupType {
+	switch style {
+	case config.S3AddressingPath:
+		return minio.BucketLookupPath
+	case config.S3AddressingVirtualHost:
+		return minio.BucketLookupDNS
+	default:
+		return minio.BucketLookupAuto
+	}
+}
+
+// newPresigner returns a client for the public URL. The signature covers the
+// host and path, so the public URL can't carry a path prefix.
+func newPresigner(cfg *config.S3Config, creds *credentials.Credentials) (*minio.Client, error) {
+	public, err := url.Parse(cfg.PublicURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 public URL: %w", err)
+	}
+	if public.Host == "" || (public.Scheme != "http" && public.Scheme != "https") {
+		return nil, fmt.Errorf("invalid S3 public URL %q: want http(s)://host[:port]", cfg.PublicURL)
+	}
+	if strings.Trim(public.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid S3 public URL %q: a path prefix breaks presigned URLs", cfg.PublicURL)
+	}
+
+	presigner, err := minio.New(public.Host, &minio.Options{
+		Creds:        creds,
+		Secure:       public.Scheme == "https",
+		Region:       cfg.Region,
+		BucketLookup: bucketLookup(cfg.AddressingStyle),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 presigning client: %w", err)
+	}
+	return presigner, nil
+}
+
+// setUpBuckets prepares the buckets according to the bucket setup.
+func (s *S3Storage) setUpBuckets(ctx context.Context) error {
+	buckets := []struct {
+		name   string
+		bucket string
+	}{
+		{"uploads", s.cfg.BucketUploads},
+		{"processed", s.cfg.BucketProcessed},
+		{"bottles", s.cfg.BucketBottles},
+	}
+
+	for _, b := range buckets {
+		var err error
+		switch s.cfg.BucketSetup {
+		case config.BucketSetupCreate:
+			err = s.EnsureBucketExists(ctx, b.bucket)
+		case config.BucketSetupVerify:
+			err = s.verifyBucket(ctx, b.bucket)
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set up %s bucket: %w", b.name, err)
+		}
+	}
+	return nil
+}
+
+// verifyBucket checks that a pre-provisioned bucket exists, without trying
+// to create it.
+func (s *S3Storage) verifyBucket(ctx context.Context, bucketName string) error {
+	exists, err := s.client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	return nil
+}
+
+func (s *S3Storage) EnsureBucketExists(ctx context.Context, bucketName string) error {
+	exists, err := s.client.BucketExists(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket exists: %w", err)
+	}
+
+	if !exists {
+		if makeErr := s.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{}); makeErr != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bucketName, makeErr)
+		}
+	}
+
+	// Default encryption also covers files PUT to presigned URLs, which
+	// can't carry encryption headers of their own.
+	var defaultEncryption *sse.Configuration
+	switch s.cfg.SSE {
+	case config.SSES3:
+		defaultEncryption = sse.NewConfigurationSSES3()
+	case config.SSEKMS:
+		defaultEncryption = sse.NewConfigurationSSEKMS(s.cfg.SSEKMSKeyID)
+	}
+	if defaultEncryption != nil {
+		if err = s.client.SetBucketEncryption(ctx, bucketName, defaultEncryption); err != nil {
+			return fmt.Errorf("failed to set default encryption of bucket %s: %w", bucketName, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) UploadFile(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	size int64,
+	contentType string,
+) error {
+	encryption, err := s.encryption.forWrite(bucket, objectName)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, bucket, objectName, file, size, minio.PutObjectOptions{
+		ContentType:          contentType,
+		AutoChecksum:         minio.ChecksumSHA256,
+		ServerSideEncryption: encryption,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) GetFileURL(ctx context.Context, bucket string, objectName string) (string, error) {
+	if !s.encryption.presignable() {
+		return "", ErrPresignUnsupported
+	}
+
+	presignedURL, err := s.presigner.PresignedGetObject(ctx, bucket, objectName, s.cfg.PresignedURLExpiration(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+func (s *S3Storage) PresignedPutURL(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+	size int64,
+	expires time.Duration,
+) (string, error) {
+	if !s.encryption.presignable() {
+		return "", ErrPresignUnsupported
+	}
+
+	headers := http.Header{}
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Length", strconv.FormatInt(size, 10))
+
+	presignedURL, err := s.presigner.PresignHeader(ctx, http.MethodPut, bucket, objectName, expires, nil, headers)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate presigned upload URL: %w", err)
+	}
+
+	return presignedURL.String(), nil
+}
+
+func (s *S3Storage) GetObject(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+) (io.ReadCloser, *ObjectInfo, error) {
+	opts := minio.GetObjectOptions{Checksum: true}
+	if s.encryption.mayUseSSEC() {
+		encryption, _, _, err := s.resolve(ctx, bucket, objectName)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts.ServerSideEncryption = encryption
+	}
+
+	object, err := s.client.GetObject(ctx, bucket, objectName, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	// GetObject is lazy, Stat performs the request and reports missing objects.
+	info, err := object.Stat()
+	if err != nil {
+		if closeErr := object.Close(); closeErr != nil {
+			return nil, nil, fmt.Errorf("failed to get object: %w (also failed to close object: %w)", err, closeErr)
+		}
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	return object, toObjectInfo(info), nil
+}
+
+func (s *S3Storage) GetObjectRange(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *ObjectInfo, error) {
+	encryption, _, stat, err := s.resolve(ctx, bucket, objectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := toObjectInfo(stat)
+	if offset < 0 || (offset > 0 && offset >= info.Size) {
+		return nil, nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), info, nil
+	}
+
+	// The ETag condition makes the read fail instead of mixing up two versions
+	// if the object is replaced after the stat.
+	opts := minio.GetObjectOptions{ServerSideEncryption: encryption}
+	if err = opts.SetRange(offset, offset+length-1); err != nil {
+		return nil, nil, fmt.Errorf("failed to set range: %w", err)
+	}
+	if err = opts.SetMatchETag(info.ETag); err != nil {
+		return nil, nil, fmt.Errorf("failed to set etag condition: %w", err)
+	}
+
+	object, err := s.client.GetObject(ctx, bucket, objectName, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get object range: %w", err)
+	}
+	if _, err = object.Stat(); err != nil {
+		if closeErr := object.Close(); closeErr != nil {
+			return nil, nil, fmt.Errorf("failed to get object range: %w (also failed to close object: %w)", err, closeErr)
+		}
+		if minio.ToErrorResponse(err).Code == minio.NoSuchKey {
+			return nil, nil, ErrObjectNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to get object range: %w", err)
+	}
+
+	return object, info, nil
+}
+
+func (s *S3Storage) StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	_, _, info, err := s.resolve(ctx, bucket, objectName)
+	if err != nil {
+		return nil, err
+	}
+	return toObjectInfo(info), nil
+}
+
+// resolve stats an object with each SSE-C key it may be encrypted with and
+// returns the encryption that opened it, its index among the candidates and
+// the object info.
+func (s *S3Storage) resolve(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+) (encrypt.ServerSide, int, minio.ObjectInfo, error) {
+	candidates, err := s.encryption.readCandidates(bucket, objectName)
+	if err != nil {
+		return nil, 0, minio.ObjectInfo{}, err
+	}
+
+	var firstErr error
+	for i, candidate := range candidates {
+		info, statErr := s.client.StatObject(ctx, bucket, objectName, minio.StatObjectOptions{
+			ServerSideEncryption: candidate,
+			Checksum:             true,
+		})
+		if statErr == nil {
+			return candidate, i, info, nil
+		}
+		// A missing object is missing whatever the key.
+		if minio.ToErrorResponse(statErr).Code == minio.NoSuchKey {
+			return nil, 0, minio.ObjectInfo{}, ErrObjectNotFound
+		}
+		if firstErr == nil {
+			firstErr = statErr
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, minio.ObjectInfo{}, fmt.Errorf("failed to stat object: %w", firstErr)
+}
+
+func (s *S3Storage) NewMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	contentType string,
+) (string, error) {
+	encryption, err := s.encryption.forWrite(bucket, objectName)
+	if err != nil {
+		return "", err
+	}
+
+	core := minio.Core{Client: s.client}
+	uploadID, err := core.NewMultipartUpload(ctx, bucket, objectName, minio.PutObjectOptions{
+		ContentType:          contentType,
+		ServerSideEncryption: encryption,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+func (s *S3Storage) PutPart(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	number int,
+	part io.Reader,
+	size int64,
+) (*Part, error) {
+	encryption, err := s.encryption.forPart(bucket, objectName)
+	if err != nil {
+		return nil, err
+	}
+
+	core := minio.Core{Client: s.client}
+	uploaded, err := core.PutObjectPart(ctx, bucket, objectName, uploadID, number, part, size, minio.PutObjectPartOptions{
+		SSE: encryption,
+	})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchUpload {
+			return nil, ErrMultipartUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to upload part %d: %w", number, err)
+	}
+	return &Part{Number: uploaded.PartNumber, ETag: uploaded.ETag, Size: uploaded.Size}, nil
+}
+
+func (s *S3Storage) CompleteMultipartUpload(
+	ctx context.Context,
+	bucket string,
+	objectName string,
+	uploadID string,
+	parts []Part,
+) error {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+	slices.SortFunc(completed, func(a, b minio.CompletePart) int {
+		return cmp.Compare(a.PartNumber, b.PartNumber)
+	})
+
+	encryption, err := s.encryption.forPart(bucket, objectName)
+	if err != nil {
+		return err
+	}
+
+	core := minio.Core{Client: s.client}
+	opts := minio.PutObjectOptions{ServerSideEncryption: encryption}
+	if _, err = core.CompleteMultipartUpload(ctx, bucket, objectName, uploadID, completed, opts); err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchUpload {
+			return ErrMultipartUploadNotFound
+		}
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, bucket string, objectName string, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	if err := core.AbortMultipartUpload(ctx, bucket, objectName, uploadID); err != nil {
+		if minio.ToErrorResponse(err).Code == minio.NoSuchUpload {
+			return ErrMultipartUploadNotFound
+		}
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) DeleteFile(ctx context.Context, bucket string, objectName string) error {
+	if err := s.client.RemoveObject(ctx, bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) DeletePrefix(ctx context.Context, bucket string, prefix string) error {
+	listed := s.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+
+	// RemoveObjects skips listing errors, so they are filtered out here.
+	var listErr error
+	objects := make(chan minio.ObjectInfo)
+	listDone := make(chan struct{})
+	go func() {
+		defer close(listDone)
+		defer close(objects)
+		for object := range listed {
+			if object.Err != nil {
+				listErr = object.Err
+				continue
+			}
+			select {
+			case objects <- object:
+			case <-ctx.Done():
+				listErr = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	// Drain the errors so that the removal goroutine finishes.
+	var err error
+	for removeErr := range s.client.RemoveObjects(ctx, bucket, objects, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = fmt.Errorf("failed to delete %s: %w", removeErr.ObjectName, removeErr.Err)
+		}
+	}
+	<-listDone
+	if err != nil {
+		return err
+	}
+	if listErr != nil {
+		return fmt.Errorf("failed to list objects under %s: %w", prefix, listErr)
+	}
+	return nil
+}
+
+func (s *S3Storage) WalkObjects(ctx context.Context, bucket string, prefix string, fn func(key string) error) error {
+	// Cancelling stops the listing goroutine when fn fails midway.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list objects under %s: %w", prefix, object.Err)
+		}
+		if err := fn(object.Key); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *S3Storage) Reencrypt(ctx context.Context, bucket string, objectName string) (bool, error) {
+	source, index, info, err := s.resolve(ctx, bucket, objectName)
+	if err != nil {
+		return false, err
+	}
+	if s.encryption.current(index, info.Metadata) {
+		return false, nil
+	}
+
+	target, err := s.encryption.forWrite(bucket, objectName)
+	if err != nil {
+		return false, err
+	}
+
+	// Copying onto itself rewrites the object with the new encryption; the
+	// ETag condition keeps a concurrent replacement from being overwritten.
+	if _, err = s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: bucket, Object: objectName, Encryption: target},
+		minio.CopySrcOptions{Bucket: bucket, Object: objectName, Encryption: source, MatchETag: info.ETag},
+	); err != nil {
+		return false, fmt.Errorf("failed to re-encrypt object: %w", err)
+	}
+	return true, nil
+}
+
+func toObjectInfo(info minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:            info.Key,
+		Size:           info.Size,
+		ContentType:    info.ContentType,
+		ETag:           info.ETag,
+		LastModified:   info.LastModified,
+		ChecksumSHA256: decodeChecksum(info.ChecksumSHA256),
+		UserMetadata:   info.UserMetadata,
+	}
+}
+
+// decodeChecksum converts the base64 checksum returned by S3 to hex.
+// Multipart checksums ("<base64>-<parts>") are not content hashes and are ignored.
+func decodeChecksum(checksum string) string {
+	raw, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil || len(raw) != sha256.Size {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
@@ -2,11 +2,41 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidRange   = errors.New("range starts past the end of the object")
+	// ErrMultipartUploadNotFound is returned for a multipart upload that was
+	// completed, aborted or never started.
+	ErrMultipartUploadNotFound = errors.New("multipart upload not found")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	// ChecksumSHA256 is the hex-encoded SHA-256 of the object content,
+	// empty if the backend did not record one.
+	ChecksumSHA256 string
+	UserMetadata   map[string]string
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int
+	ETag   string
+	Size   int64
+}
+
 type Storage interface {
-	// UploadFile uploads a file to the storage and returns the object URL
+	// UploadFile uploads a file to the storage
 	UploadFile(
 		ctx context.Context,
 		bucket string,
@@ -14,14 +44,80 @@ type Storage interface {
 		file io.Reader,
 		size int64,
 		contentType string,
-	) (string, error)
+	) error
 
-	// GetFileURL returns the URL to access a file in the storage
+	// GetFileURL returns a fresh, temporary public URL to access a file in the storage.
+	// URLs expire, so they are generated when served and never stored. It returns
+	// ErrPresignUnsupported if objects are encrypted with keys the client doesn't have.
 	GetFileURL(ctx context.Context, bucket string, objectName string) (string, error)
 
+	// PresignedPutURL returns a URL to upload an object without credentials until it expires.
+	// The content type and size are signed into the URL, so the upload must send exactly
+	// these Content-Type and Content-Length headers. It returns ErrPresignUnsupported like
+	// GetFileURL.
+	PresignedPutURL(
+		ctx context.Context,
+		bucket string,
+		objectName string,
+		contentType string,
+		size int64,
+		expires time.Duration,
+	) (string, error)
+
+	// GetObject opens an object for reading, or returns ErrObjectNotFound if it does not exist.
+	// The caller must close the returned reader.
+	GetObject(ctx context.Context, bucket string, objectName string) (io.ReadCloser, *ObjectInfo, error)
+
+	// GetObjectRange opens length bytes of an object starting at offset, or up to the end if length is negative
+	// or runs past it. The returned info describes the whole object. It returns ErrInvalidRange if offset is
+	// outside the object. The caller must close the returned reader.
+	GetObjectRange(
+		ctx context.Context,
+		bucket string,
+		objectName string,
+		offset int64,
+		length int64,
+	) (io.ReadCloser, *ObjectInfo, error)
+
+	// StatObject returns object metadata, or ErrObjectNotFound if the object does not exist
+	StatObject(ctx context.Context, bucket string, objectName string) (*ObjectInfo, error)
+
+	// NewMultipartUpload starts a multipart upload of an object and returns its upload ID.
+	NewMultipartUpload(ctx context.Context, bucket string, objectName string, contentType string) (string, error)
+
+	// PutPart uploads part number of a multipart upload. Every part but the last must be
+	// at least 5 MiB; uploading a part number again replaces it.
+	PutPart(
+		ctx context.Context,
+		bucket string,
+		objectName string,
+		uploadID string,
+		number int,
+		part io.Reader,
+		size int64,
+	) (*Part, error)
+
+	// CompleteMultipartUpload assembles the parts, ordered by number, into the object.
+	CompleteMultipartUpload(ctx context.Context, bucket string, objectName string, uploadID string, parts []Part) error
+
+	// AbortMultipartUpload discards a multipart upload and its parts
+	AbortMultipartUpload(ctx context.Context, bucket string, objectName string, uploadID string) error
+
 	// DeleteFile deletes a file from the storage
 	DeleteFile(ctx context.Context, bucket string, objectName string) error
 
-	// EnsureBucketExists ensures that a bucket exists, creates it if it doesn't
+	// DeletePrefix deletes every object whose name starts with prefix
+	DeletePrefix(ctx context.Context, bucket string, prefix string) error
+
+	// WalkObjects calls fn with the name of every object whose name starts with prefix,
+	// stopping at the first error.
+	WalkObjects(ctx context.Context, bucket string, prefix string, fn func(key string) error) error
+
+	// Reencrypt rewrites an object that is not encrypted the way new objects are, for example
+	// after the SSE master key was rotated, and reports whether it did.
+	Reencrypt(ctx context.Context, bucket string, objectName string) (bool, error)
+
+	// EnsureBucketExists ensures that a bucket exists, creates it if it doesn't. At startup it
+	// only runs with the create bucket setup, pre-provisioned buckets are left alone
 	EnsureBucketExists(ctx context.Context, bucketName string) error
 }
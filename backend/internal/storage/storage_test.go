@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// fakeStorage keeps objects in memory and fails calls with queued errors.
+// Operations the tests don't need panic through the nil Storage.
+type fakeStorage struct {
+	Storage
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// errs holds the errors the next calls of an operation fail with.
+	errs  map[string][]error
+	calls map[string]int
+	// uploads records the body every UploadFile call read.
+	uploads []string
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{
+		objects: make(map[string][]byte),
+		errs:    make(map[string][]error),
+		calls:   make(map[string]int),
+	}
+}
+
+// failNext makes the next calls of operation fail with errs, in order.
+func (f *fakeStorage) failNext(operation string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs[operation] = append(f.errs[operation], errs...)
+}
+
+func (f *fakeStorage) put(bucket, objectName, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.objects[cacheKey(bucket, objectName)] = []byte(content)
+}
+
+func (f *fakeStorage) callCount(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[operation]
+}
+
+// call counts a call and returns the error it should fail with.
+func (f *fakeStorage) call(operation string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[operation]++
+	if len(f.errs[operation]) == 0 {
+		return nil
+	}
+	err := f.errs[operation][0]
+	f.errs[operation] = f.errs[operation][1:]
+	return err
+}
+
+func (f *fakeStorage) object(bucket, objectName string) ([]byte, *ObjectInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, ok := f.objects[cacheKey(bucket, objectName)]
+	if !ok {
+		return nil, nil, ErrObjectNotFound
+	}
+	return data, &ObjectInfo{Key: objectName, Size: int64(len(data)), ETag: string(data)}, nil
+}
+
+func (f *fakeStorage) UploadFile(
+	_ context.Context,
+	bucket string,
+	objectName string,
+	file io.Reader,
+	_ int64,
+	_ string,
+) error {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.uploads = append(f.uploads, string(data))
+	f.mu.Unlock()
+
+	if err = f.call("UploadFile"); err != nil {
+		return err
+	}
+	f.put(bucket, objectName, string(data))
+	return nil
+}
+
+func (f *fakeStorage) GetObject(_ context.Context, bucket string, objectName string) (io.ReadCloser, *ObjectInfo, error) {
+	if err := f.call("GetObject"); err != nil {
+		return nil, nil, err
+	}
+	data, info, err := f.object(bucket, objectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), info, nil
+}
+
+func (f *fakeStorage) GetObjectRange(
+	_ context.Context,
+	bucket string,
+	objectName string,
+	offset int64,
+	length int64,
+) (io.ReadCloser, *ObjectInfo, error) {
+	if err := f.call("GetObjectRange"); err != nil {
+		return nil, nil, err
+	}
+	data, info, err := f.object(bucket, objectName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset < 0 || (offset > 0 && offset >= info.Size) {
+		return nil, nil, ErrInvalidRange
+	}
+	if length < 0 || offset+length > info.Size {
+		length = info.Size - offset
+	}
+	return io.NopCloser(bytes.NewReader(data[offset : offset+length])), info, nil
+}
+
+func (f *fakeStorage) StatObject(_ context.Context, bucket string, objectName string) (*ObjectInfo, error) {
+	if err := f.call("StatObject"); err != nil {
+		return nil, err
+	}
+	_, info, err := f.object(bucket, objectName)
+	return info, err
+}
+
+func (f *fakeStorage) DeleteFile(_ context.Context, bucket string, objectName string) error {
+	if err := f.call("DeleteFile"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.objects, cacheKey(bucket, objectName))
+	return nil
+}
+
+func (f *fakeStorage) DeletePrefix(_ context.Context, bucket string, prefix string) error {
+	if err := f.call("DeletePrefix"); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key := range f.objects {
+		if strings.HasPrefix(key, cacheKey(bucket, prefix)) {
+			delete(f.objects, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeStorage) CompleteMultipartUpload(
+	_ context.Context,
+	bucket string,
+	objectName string,
+	_ string,
+	_ []Part,
+) error {
+	if err := f.call("CompleteMultipartUpload"); err != nil {
+		return err
+	}
+	f.put(bucket, objectName, "assembled")
+	return nil
+}
+
+// WalkObjects hands out "a" and "b", failing in between if told to.
+func (f *fakeStorage) WalkObjects(_ context.Context, _ string, _ string, fn func(key string) error) error {
+	if err := fn("a"); err != nil {
+		return err
+	}
+	if err := f.call("WalkObjects"); err != nil {
+		return err
+	}
+	return fn("b")
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidObjectURL = errors.New("invalid object URL")
+)
+
+// ObjectFromURL extracts the bucket and object key from a path-style object
+// URL (http://host/bucket/key), such as the presigned URLs images used to
+// store.
+func ObjectFromURL(rawURL string) (string, string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrInvalidObjectURL, err)
+	}
+
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidObjectURL, parsed.Path)
+	}
+
+	return bucket, key, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Helltale/beer-mania/backend/internal/entity"
+	"github.com/Helltale/beer-mania/backend/internal/storage"
 
 	"gorm.io/gorm"
 )
@@ -17,42 +18,275 @@ func RunMigrations(db *gorm.DB) error {
 	// AutoMigrate creates tables and indexes based on entity definitions
 	if err := db.AutoMigrate(
 		&entity.Image{},
+		&entity.ImageClient{},
 		&entity.ProcessingTask{},
+		&entity.ImageRendition{},
+		&entity.BottleAsset{},
+		&entity.QueueJob{},
+		&entity.Upload{},
+		&entity.UploadPart{},
+		&entity.ObjectTombstone{},
 	); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	// Create foreign key constraint for processing_tasks.image_id -> images.id
-	// GORM doesn't automatically create foreign keys with AutoMigrate,
-	// so we need to create it manually if it doesn't exist
+	if err := migrateImageURLs(db); err != nil {
+		return err
+	}
+
+	if err := migrateImageRetention(db); err != nil {
+		return err
+	}
+
+	if err := migrateTaskResults(db); err != nil {
+		return err
+	}
+
+	if err := migrateImageClients(db); err != nil {
+		return err
+	}
+
+	if err := migrateRenditionTasks(db); err != nil {
+		return err
+	}
+
+	// Create foreign key constraints, GORM doesn't automatically create
+	// foreign keys with AutoMigrate, so we need to create them manually
+	// if they don't exist
+	if err := ensureForeignKey(db, "fk_processing_tasks_image_id", "processing_tasks", "image_id", "images"); err != nil {
+		return err
+	}
+
+	if err := ensureForeignKey(db, "fk_image_renditions_image_id", "image_renditions", "image_id", "images"); err != nil {
+		return err
+	}
+
+	if err := ensureForeignKey(
+		db, "fk_image_renditions_task_id", "image_renditions", "task_id", "processing_tasks",
+	); err != nil {
+		return err
+	}
+
+	if err := ensureForeignKey(db, "fk_upload_parts_upload_id", "upload_parts", "upload_id", "uploads"); err != nil {
+		return err
+	}
+
+	if err := ensureForeignKey(db, "fk_image_clients_image_id", "image_clients", "image_id", "images"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// imageURLBatchSize is the number of images converted per batch by
+// migrateImageURLs.
+const imageURLBatchSize = 500
+
+// imageURLRow is an image that still stores presigned URLs.
+type imageURLRow struct {
+	ID           string
+	OriginalURL  string
+	ProcessedURL *string
+}
+
+// migrateImageURLs converts the presigned URLs images used to store into the
+// bucket and object keys they point to, then drops the URL columns. It does
+// nothing once the columns are gone.
+func migrateImageURLs(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("images", "original_url") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		lastID := "00000000-0000-0000-0000-000000000000"
+		for {
+			var rows []imageURLRow
+			if err := tx.Raw(
+				"SELECT id, original_url, processed_url FROM images WHERE id > ? ORDER BY id LIMIT ?",
+				lastID, imageURLBatchSize,
+			).Scan(&rows).Error; err != nil {
+				return fmt.Errorf("failed to read image URLs: %w", err)
+			}
+
+			for _, row := range rows {
+				if err := migrateImageURL(tx, row); err != nil {
+					return err
+				}
+			}
+
+			if len(rows) < imageURLBatchSize {
+				break
+			}
+			lastID = rows[len(rows)-1].ID
+		}
+
+		for _, column := range []string{"original_url", "processed_url"} {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE images DROP COLUMN IF EXISTS %s", column)).Error; err != nil {
+				return fmt.Errorf("failed to drop images.%s: %w", column, err)
+			}
+		}
+		return nil
+	})
+}
+
+func migrateImageURL(tx *gorm.DB, row imageURLRow) error {
+	originalBucket, originalKey, err := storage.ObjectFromURL(row.OriginalURL)
+	if err != nil {
+		return fmt.Errorf("failed to convert original URL of image %s: %w", row.ID, err)
+	}
+	updates := map[string]any{
+		"original_bucket": originalBucket,
+		"original_key":    originalKey,
+	}
+
+	if row.ProcessedURL != nil {
+		processedBucket, processedKey, urlErr := storage.ObjectFromURL(*row.ProcessedURL)
+		if urlErr != nil {
+			return fmt.Errorf("failed to convert processed URL of image %s: %w", row.ID, urlErr)
+		}
+		updates["processed_bucket"] = processedBucket
+		updates["processed_key"] = processedKey
+	}
+
+	if err = tx.Table("images").Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to store object keys of image %s: %w", row.ID, err)
+	}
+	return nil
+}
+
+// migrateImageRetention allows the expired image status, which AutoMigrate
+// doesn't add to the existing check constraint, and backfills when finished
+// images finished from their last update.
+func migrateImageRetention(db *gorm.DB) error {
 	if err := db.Exec(`
 		DO $$
 		BEGIN
 			IF NOT EXISTS (
-				SELECT 1 FROM pg_constraint 
-				WHERE conname = 'fk_processing_tasks_image_id'
+				SELECT 1 FROM pg_constraint
+				WHERE conname = 'chk_images_status'
+				AND pg_get_constraintdef(oid) LIKE '%expired%'
 			) THEN
-				ALTER TABLE processing_tasks 
-				ADD CONSTRAINT fk_processing_tasks_image_id 
-				FOREIGN KEY (image_id) 
-				REFERENCES images(id) 
-				ON DELETE CASCADE;
+				ALTER TABLE images DROP CONSTRAINT IF EXISTS chk_images_status;
+				ALTER TABLE images ADD CONSTRAINT chk_images_status
+				CHECK (status IN ('pending','processing','completed','failed','expired'));
 			END IF;
 		END $$;
 	`).Error; err != nil {
-		return fmt.Errorf("failed to create foreign key constraint: %w", err)
+		return fmt.Errorf("failed to update image status constraint: %w", err)
+	}
+
+	if err := db.Exec(
+		"UPDATE images SET finished_at = updated_at WHERE status IN ('completed','failed') AND finished_at IS NULL",
+	).Error; err != nil {
+		return fmt.Errorf("failed to backfill image finish times: %w", err)
+	}
+	return nil
+}
+
+// migrateImageClients records the clients of images uploaded before
+// image_clients existed: the client that uploaded an image first and those
+// whose tasks were queued for it.
+func migrateImageClients(db *gorm.DB) error {
+	if err := db.Exec(`
+		INSERT INTO image_clients (image_id, client_id, created_at)
+		SELECT id, client_id, created_at FROM images WHERE client_id IS NOT NULL
+		UNION ALL
+		SELECT image_id, client_id, MIN(created_at) FROM processing_tasks
+		WHERE client_id IS NOT NULL
+		GROUP BY image_id, client_id
+		ON CONFLICT DO NOTHING
+	`).Error; err != nil {
+		return fmt.Errorf("failed to backfill image clients: %w", err)
+	}
+	return nil
+}
+
+// migrateTaskResults records the processed result of an image on the task
+// that produced it. Before results were kept per task every task of an image
+// wrote its result to the image, so it belongs to the task that completed
+// last. Images whose tasks already have results are left alone.
+func migrateTaskResults(db *gorm.DB) error {
+	if err := db.Exec(`
+		UPDATE processing_tasks t
+		SET processed_bucket = i.processed_bucket, processed_key = i.processed_key
+		FROM images i
+		WHERE t.image_id = i.id
+		AND i.processed_key IS NOT NULL
+		AND t.id = (
+			SELECT id FROM processing_tasks
+			WHERE image_id = i.id AND status = 'completed'
+			ORDER BY updated_at DESC, id DESC
+			LIMIT 1
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM processing_tasks
+			WHERE image_id = i.id AND processed_key IS NOT NULL
+		)
+	`).Error; err != nil {
+		return fmt.Errorf("failed to backfill task results: %w", err)
 	}
+	return nil
+}
 
+// migrateRenditionTasks assigns the processed renditions made before they
+// were kept per task to the task whose result they were made from, the task
+// that completed last, and drops the index that allowed one processed
+// rendition per size and format of an image.
+func migrateRenditionTasks(db *gorm.DB) error {
+	if err := db.Exec(`
+		UPDATE image_renditions r
+		SET task_id = (
+			SELECT id FROM processing_tasks
+			WHERE image_id = r.image_id AND status = 'completed'
+			ORDER BY updated_at DESC, id DESC
+			LIMIT 1
+		)
+		WHERE r.kind = 'processed' AND r.task_id IS NULL
+	`).Error; err != nil {
+		return fmt.Errorf("failed to backfill rendition tasks: %w", err)
+	}
+	if err := db.Exec("DROP INDEX IF EXISTS idx_image_renditions_variant").Error; err != nil {
+		return fmt.Errorf("failed to drop rendition index: %w", err)
+	}
 	return nil
 }
 
 // RollbackMigrations drops all tables (use with caution!)
 func RollbackMigrations(db *gorm.DB) error {
 	if err := db.Migrator().DropTable(
+		&entity.ObjectTombstone{},
+		&entity.UploadPart{},
+		&entity.Upload{},
+		&entity.QueueJob{},
+		&entity.BottleAsset{},
+		&entity.ImageRendition{},
 		&entity.ProcessingTask{},
+		&entity.ImageClient{},
 		&entity.Image{},
 	); err != nil {
 		return fmt.Errorf("failed to rollback migrations: %w", err)
 	}
 	return nil
 }
+
+// ensureForeignKey adds an ON DELETE CASCADE foreign key from table.column to refTable(id).
+func ensureForeignKey(db *gorm.DB, name, table, column, refTable string) error {
+	if err := db.Exec(fmt.Sprintf(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM pg_constraint 
+				WHERE conname = '%[1]s'
+			) THEN
+				ALTER TABLE %[2]s 
+				ADD CONSTRAINT %[1]s 
+				FOREIGN KEY (%[3]s) 
+				REFERENCES %[4]s(id) 
+				ON DELETE CASCADE;
+			END IF;
+		END $$;
+	`, name, table, column, refTable)).Error; err != nil {
+		return fmt.Errorf("failed to create foreign key constraint %s: %w", name, err)
+	}
+	return nil
+}